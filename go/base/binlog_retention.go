@@ -0,0 +1,74 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"fmt"
+	"time"
+)
+
+// What to do once binary log headroom runs below --min-binlog-headroom-seconds
+const (
+	// ApplyEventsBinlogHeadroomAction keeps applying binlog events even while throttled; row copy remains throttled
+	ApplyEventsBinlogHeadroomAction = "apply-events"
+	// NotifyBinlogHeadroomAction only logs and fires the gh-ost-on-binlog-headroom-low hook
+	NotifyBinlogHeadroomAction = "notify"
+	// AbortBinlogHeadroomAction aborts the migration, cleaning up
+	AbortBinlogHeadroomAction = "abort"
+)
+
+// ValidateBinlogHeadroomAction checks for a known --binlog-headroom-action
+func ValidateBinlogHeadroomAction(action string) error {
+	switch action {
+	case ApplyEventsBinlogHeadroomAction, NotifyBinlogHeadroomAction, AbortBinlogHeadroomAction:
+		return nil
+	}
+	return fmt.Errorf("Unknown binlog headroom action: %q. Expected one of: %s, %s, %s", action,
+		ApplyEventsBinlogHeadroomAction, NotifyBinlogHeadroomAction, AbortBinlogHeadroomAction,
+	)
+}
+
+// BinlogRetention is the binary log retention on the streamer's source
+type BinlogRetention struct {
+	// ExpireSeconds is as of binlog_expire_logs_seconds, or else expire_logs_days. Zero means binary logs do not expire
+	ExpireSeconds int64
+	// LogFiles are the binary logs present on the server, as of SHOW BINARY LOGS
+	LogFiles []string
+}
+
+// NewBinlogRetention reads expiry off binlog_expire_logs_seconds, which takes precedence as of MySQL 8.0,
+// or else off expire_logs_days
+func NewBinlogRetention(expireLogsSeconds int64, expireLogsDays int64, logFiles []string) *BinlogRetention {
+	retention := &BinlogRetention{ExpireSeconds: expireLogsSeconds, LogFiles: logFiles}
+	if retention.ExpireSeconds == 0 {
+		retention.ExpireSeconds = expireLogsDays * 24 * 3600
+	}
+	return retention
+}
+
+// HasLogFile checks whether given binary log is still present
+func (this *BinlogRetention) HasLogFile(logFile string) bool {
+	for _, file := range this.LogFiles {
+		if file == logFile {
+			return true
+		}
+	}
+	return false
+}
+
+// Headroom estimates how long until the binary log being read is purged. A binary log expires once its
+// last event is older than the expiry; since the streamer is yet to read the file's last event, the
+// last event read gives a lower bound. limited is false when binary logs do not expire.
+func (this *BinlogRetention) Headroom(lastEventTime time.Time, now time.Time) (headroom time.Duration, limited bool) {
+	if this.ExpireSeconds <= 0 {
+		return 0, false
+	}
+	headroom = lastEventTime.Add(time.Duration(this.ExpireSeconds) * time.Second).Sub(now)
+	if headroom < 0 {
+		headroom = 0
+	}
+	return headroom, true
+}
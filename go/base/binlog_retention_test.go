@@ -0,0 +1,63 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestValidateBinlogHeadroomAction(t *testing.T) {
+	test.S(t).ExpectNil(ValidateBinlogHeadroomAction("apply-events"))
+	test.S(t).ExpectNil(ValidateBinlogHeadroomAction("notify"))
+	test.S(t).ExpectNil(ValidateBinlogHeadroomAction("abort"))
+	test.S(t).ExpectNotNil(ValidateBinlogHeadroomAction("throttle"))
+	test.S(t).ExpectNotNil(ValidateBinlogHeadroomAction(""))
+}
+
+func TestNewBinlogRetention(t *testing.T) {
+	{
+		retention := NewBinlogRetention(3600, 7, nil)
+		test.S(t).ExpectEquals(retention.ExpireSeconds, int64(3600))
+	}
+	{
+		retention := NewBinlogRetention(0, 2, nil)
+		test.S(t).ExpectEquals(retention.ExpireSeconds, int64(2*24*3600))
+	}
+	{
+		retention := NewBinlogRetention(0, 0, nil)
+		test.S(t).ExpectEquals(retention.ExpireSeconds, int64(0))
+	}
+}
+
+func TestBinlogRetentionHasLogFile(t *testing.T) {
+	retention := NewBinlogRetention(3600, 0, []string{"mysql-bin.000012", "mysql-bin.000013"})
+	test.S(t).ExpectTrue(retention.HasLogFile("mysql-bin.000013"))
+	test.S(t).ExpectFalse(retention.HasLogFile("mysql-bin.000011"))
+}
+
+func TestBinlogRetentionHeadroom(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	{
+		retention := NewBinlogRetention(0, 0, nil)
+		_, limited := retention.Headroom(now.Add(-time.Hour), now)
+		test.S(t).ExpectFalse(limited)
+	}
+	{
+		retention := NewBinlogRetention(3*3600, 0, nil)
+		headroom, limited := retention.Headroom(now.Add(-time.Hour), now)
+		test.S(t).ExpectTrue(limited)
+		test.S(t).ExpectEquals(headroom, 2*time.Hour)
+	}
+	{
+		retention := NewBinlogRetention(3600, 0, nil)
+		headroom, limited := retention.Headroom(now.Add(-2*time.Hour), now)
+		test.S(t).ExpectTrue(limited)
+		test.S(t).ExpectEquals(headroom, time.Duration(0))
+	}
+}
@@ -7,9 +7,13 @@ package base
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -48,6 +52,8 @@ const (
 	NoThrottleReasonHint                 ThrottleReasonHint = "NoThrottleReasonHint"
 	UserCommandThrottleReasonHint        ThrottleReasonHint = "UserCommandThrottleReasonHint"
 	LeavingHibernationThrottleReasonHint ThrottleReasonHint = "LeavingHibernationThrottleReasonHint"
+	LagThrottleReasonHint                ThrottleReasonHint = "LagThrottleReasonHint"
+	LoadThrottleReasonHint               ThrottleReasonHint = "LoadThrottleReasonHint"
 )
 
 const (
@@ -55,8 +61,18 @@ const (
 	MaxEventsBatchSize = 1000
 )
 
+// Policies of --abort-drop-tables: which tables to drop upon graceful abort
+const (
+	AbortDropAllTables      = "all"
+	AbortDropChangelogTable = "changelog"
+	AbortDropNoTables       = "none"
+)
+
 var (
-	envVariableRegexp = regexp.MustCompile("[$][{](.*)[}]")
+	envVariableRegexp        = regexp.MustCompile("[$][{](.*)[}]")
+	artifactTableRegexp      = regexp.MustCompile(`^_(.+?)_(gho|ghc|gds|del|([0-9]{14})_del)$`)
+	artifactTimestampLayout  = "20060102150405"
+	pendingDropCommentRegexp = regexp.MustCompile(`^gh-ost-pending-drop:([0-9]+)$`)
 )
 
 type ThrottleCheckResult struct {
@@ -73,6 +89,15 @@ func NewThrottleCheckResult(throttle bool, reason string, reasonHint ThrottleRea
 	}
 }
 
+// AbortError is returned by a migration that was gracefully aborted
+type AbortError struct {
+	Reason string
+}
+
+func (this *AbortError) Error() string {
+	return fmt.Sprintf("Migration aborted: %s", this.Reason)
+}
+
 // MigrationContext has the general, global state of migration. It is used by
 // all components throughout the migration process.
 type MigrationContext struct {
@@ -86,6 +111,8 @@ type MigrationContext struct {
 	ConcurrentCountTableRows bool
 	AllowedRunningOnMaster   bool
 	AllowedMasterMaster      bool
+	// AllowLocalTableLocks allows cut-over where LOCK TABLES does not apply cluster-wide: multi-primary Group Replication, Galera
+	AllowLocalTableLocks bool
 	SwitchToRowBinlogFormat  bool
 	AssumeRBR                bool
 	SkipForeignKeyChecks     bool
@@ -111,6 +138,17 @@ type MigrationContext struct {
 	TLSKey            string
 	CliMasterUser     string
 	CliMasterPassword string
+	// Binlog source: the server binary logs are streamed from, when other than the inspected server. Credentials
+	// and TLS settings default to those of the inspected server. See doc/binlog-source.md
+	BinlogSourceHostname         string
+	CliBinlogSourceUser          string
+	CliBinlogSourcePassword      string
+	BinlogSourceUseTLS           bool
+	BinlogSourceTLSAllowInsecure bool
+	BinlogSourceTLSCACertificate string
+	BinlogSourceTLSCertificate   string
+	BinlogSourceTLSKey           string
+	BinlogSourceConnectionConfig *mysql.ConnectionConfig
 
 	HeartbeatIntervalMilliseconds       int64
 	defaultNumRetries                   int64
@@ -119,11 +157,39 @@ type MigrationContext struct {
 	MaxLagMillisecondsThrottleThreshold int64
 	//要限流的实例
 	throttleControlReplicaKeys          *mysql.InstanceKeyMap
+	discoveredReplicaKeys               *mysql.InstanceKeyMap
+	// Automatic discovery of throttle control replicas, see doc/command-line-flags.md#discover-throttle-control-replicas
+	DiscoverThrottleControlReplicas bool
+	DiscoverReplicasInclude         string
+	DiscoverReplicasExclude         string
+	DiscoverReplicasIntervalSeconds int64
+	// Throttle coordination between concurrent migrations, see doc/coordination.md
+	CoordinationTable            string
+	CoordinationMaxRowsPerSecond int64
+	CoordinationMaxActiveCopiers int64
 	ThrottleFlagFile                    string
 	ThrottleAdditionalFlagFile          string
 	throttleQuery                       string
 	throttleHTTP                        string
 	IgnoreHTTPErrors                    bool
+	// Flow control thresholds, applying to Group Replication and Galera clusters respectively
+	MaxGroupReplicationQueue  int64
+	MaxWsrepFlowControlPaused float64
+	MaxWsrepLocalRecvQueue    int64
+	// Binary log retention guard, see doc/throttle.md
+	MinBinlogHeadroomSeconds int64
+	BinlogHeadroomAction     string
+	// BinlogHeadroomNanoseconds is the estimated time until the binlog being read is purged; -1 when unlimited or unknown
+	BinlogHeadroomNanoseconds int64
+	BinlogHeadroomLowFlag     int64
+	// Disk backed buffer of binlog events, between the streamer and the apply queue; see doc/events-spill.md
+	EventsSpillDir      string
+	EventsSpillMaxBytes int64
+	// ThrottleHTTPMethod is HEAD or GET; GET reads an optional JSON response, see doc/throttle.md
+	ThrottleHTTPMethod      string
+	ThrottleHTTPHeadersFile string
+	throttleHTTPHeaders     http.Header
+	throttleHTTPResult      *ThrottleHTTPResult
 	ThrottleCommandedByUser             int64
 	HibernateUntil                      int64
 	maxLoad                             LoadMap
@@ -137,14 +203,43 @@ type MigrationContext struct {
 	ForceNamedCutOverCommand            bool
 	ForceNamedPanicCommand              bool
 	PanicFlagFile                       string
+	AbortFlagFile                       string
+	AbortDropTables                     string
 	HooksPath                           string
 	HooksHintMessage                    string
 	HooksHintOwner                      string
 	HooksHintToken                      string
+	HooksTimeoutSeconds                 int64
+	HooksNotYetRetrySeconds             int64
 
 	DropServeSocket bool
 	ServeSocketFile string
 	ServeTCPPort    int64
+	// Authentication of the interactive TCP port, see doc/interactive-commands.md
+	ServeTCPTokensFile       string
+	ServeTCPTLSCertificate   string
+	ServeTCPTLSKey           string
+	ServeTCPTLSCACertificate string
+	ServeTCPTLSAdminNames    string
+	ServeTCPAuth             *ServerAuth
+
+	// ReturnOnPanicAbort makes a panic abort end the migration with an error, rather than exit
+	// the process. Used when migrations run within a long running process (see daemon mode)
+	ReturnOnPanicAbort bool
+	// StatusOutput is where status is printed, in addition to interactive command responses
+	StatusOutput io.Writer
+	// EventListener, when set, is notified of phase changes, status, throttle changes and cut-over results.
+	// It is called synchronously and should return promptly. See EmitEvent
+	EventListener func(event *MigrationEvent)
+	//HTTP 钩子，读取自配置文件的 [webhook "name"] 段
+	webhooks []*Webhook
+	//备库延迟的读取方式与阈值，读取自配置文件的 [replica-lag "name"] 段
+	replicaLags []*ReplicaLag
+	ClusterName  string
+
+	DaemonStateDir                string
+	DaemonQueueTable              string
+	DaemonMaxConcurrentPerCluster int64
 
 	Noop                         bool
 	TestOnReplica                bool
@@ -155,11 +250,42 @@ type MigrationContext struct {
 	InitiallyDropGhostTable      bool
 	TimestampOldTable            bool // Should old table name include a timestamp
 	CutOverType                  CutOver
+	cutOverMutex                 *sync.Mutex
 	ReplicaServerId              uint
 
+	PostCutOverValidation              bool
+	PostCutOverValidationWindowSeconds int64
+	PostCutOverValidationMaxRowsDelta  int64
+	PostCutOverValidationChecksumRows  int64
+	PostCutOverValidationRollback      bool
+
+	DeferSecondaryIndexes bool
+
+	WarmUpGhostTable       bool
+	WarmUpReplayStatements int64
+	WarmUpMaxSeconds       int64
+	WarmUpMaxPages         int64
+
+	PlanCheckDigests    int64
+	PlanCheckRowsFactor float64
+	PlanCheckPostpone   bool
+
+	DesiredSchemaFile string
+
+	CleanupConfirm       bool
+	CleanupMinAgeSeconds int64
+	CleanupLowImpactRows int64
+	// CleanupOrphanedOldTables takes "old" tables with no changelog to be gh-ost's when the migrated table exists
+	CleanupOrphanedOldTables bool
+
+	LowImpactDropOldTable    bool
+	OldTableRetentionSeconds int64
+
 	Hostname                  string
 	AssumeMasterHostname      string
 	ApplierTimeZone           string
+	// ClusterTopology is the applier's cluster: async replication, Group Replication or Galera
+	ClusterTopology           *mysql.ClusterTopology
 	TableEngine               string
 	RowsEstimate              int64
 	RowsDeltaEstimate         int64
@@ -171,6 +297,8 @@ type MigrationContext struct {
 	InspectorMySQLVersion     string
 	ApplierConnectionConfig   *mysql.ConnectionConfig
 	ApplierMySQLVersion       string
+	// BinlogSourceMySQLVersion is the version of the server binary logs are streamed from
+	BinlogSourceMySQLVersion  string
 	StartTime                 time.Time
 	RowCopyStartTime          time.Time
 	RowCopyEndTime            time.Time
@@ -191,18 +319,32 @@ type MigrationContext struct {
 	throttleReason             string
 	throttleReasonHint         ThrottleReasonHint
 	throttleGeneralCheckResult ThrottleCheckResult
+	coordinationThrottleReason string
+	throttleHTTPRateReason     string
 	//限流互斥锁
 	throttleMutex                          *sync.Mutex
 	throttleHTTPMutex                      *sync.Mutex
 	IsPostponingCutOver                    int64
+	IsAddingDeferredIndexes                int64
+	IsWarmingUpGhostTable                  int64
+	WarmUpPagesRead                        int64
+	QueryPlanApprovalPendingFlag           int64
 	CountingRowsFlag                       int64
 	AllEventsUpToLockProcessedInjectedFlag int64
 	CleanupImminentFlag                    int64
 	UserCommandedUnpostponeFlag            int64
+	//通过交互命令 postpone / postpone-until 推迟切换
+	UserCommandedPostponeFlag              int64
+	PostponeCutOverUntil                   int64
 	CutOverCompleteFlag                    int64
 	InCutOverCriticalSectionFlag           int64
+	CutOverAttempts                        int64
 	//ghost中有众多的goroutine， 当有goroutine发生panic时，将error写入PanicAbort chan中，在migrator.go中的Migrator函数中，会单独开启一条协程消费这个chan
 	PanicAbort                             chan error
+	//优雅中止：请求中止迁移时关闭该 chan，各等待点据此有序退出，并清理鬼表和日志表
+	abortRequested     chan struct{}
+	abortRequestedOnce *sync.Once
+	abortReason        string
 
 	OriginalTableColumnsOnApplier *sql.ColumnList
 	OriginalTableColumns          *sql.ColumnList
@@ -239,6 +381,8 @@ type ContextConfig struct {
 		Replication_Lag_Query string
 		Max_Load              string
 	}
+	Webhook     map[string]*WebhookConfig
+	Replica_Lag map[string]*ReplicaLagConfig
 }
 
 func NewMigrationContext() *MigrationContext {
@@ -257,6 +401,16 @@ func NewMigrationContext() *MigrationContext {
 		MaxLagMillisecondsThrottleThreshold: 1500,
 		//对表进行重命名最长锁表时间为3秒 // todo 失败了会怎样
 		CutOverLockTimeoutSeconds:           3,
+		//切换后校验的时间窗口，超过窗口仍未通过校验则回滚
+		PostCutOverValidationWindowSeconds: 60,
+		PostCutOverValidationMaxRowsDelta:  -1,
+		PostCutOverValidationChecksumRows:  1000,
+		//鬼表预热的时间预算
+		WarmUpMaxSeconds: 60,
+		//执行计划检查中，估算行数增长超过该倍数视为退化
+		PlanCheckRowsFactor: 10,
+		//钩子返回"暂不"后重试的间隔
+		HooksNotYetRetrySeconds: 30,
 		//要在单个事务中应用的DML事件的批处理大小默认为10
 		DMLBatchSize:                        10,
 		//最大负载
@@ -267,8 +421,20 @@ func NewMigrationContext() *MigrationContext {
 		throttleMutex:                       &sync.Mutex{},
 		//HTTP限流互斥锁
 		throttleHTTPMutex:                   &sync.Mutex{},
+		cutOverMutex:                        &sync.Mutex{},
 		//要限流的实例信息
 		throttleControlReplicaKeys:          mysql.NewInstanceKeyMap(),
+		discoveredReplicaKeys:               mysql.NewInstanceKeyMap(),
+		DiscoverReplicasIntervalSeconds:     60,
+		ThrottleHTTPMethod:                  http.MethodHead,
+		ClusterTopology:                     &mysql.ClusterTopology{Type: mysql.AsyncClusterType},
+		MaxGroupReplicationQueue:            1000,
+		MaxWsrepFlowControlPaused:           0.05,
+		MaxWsrepLocalRecvQueue:              16,
+		MinBinlogHeadroomSeconds:            3600,
+		BinlogHeadroomAction:                NotifyBinlogHeadroomAction,
+		BinlogHeadroomNanoseconds:           -1,
+		EventsSpillMaxBytes:                 10 * 1024 * 1024 * 1024,
 		//配置文件修改互斥锁
 		configMutex:                         &sync.Mutex{},
 		//配置更新时间互斥锁
@@ -277,9 +443,45 @@ func NewMigrationContext() *MigrationContext {
 		ColumnRenameMap:                     make(map[string]string),
 		//panic 退出
 		PanicAbort:                          make(chan error),
+		abortRequested:                      make(chan struct{}),
+		abortRequestedOnce:                  &sync.Once{},
+		AbortDropTables:                     AbortDropAllTables,
+		StatusOutput:                        os.Stdout,
+	}
+}
+
+// RequestAbort asks for a graceful abort of the migration: unlike a panic abort, the migration
+// stops in an orderly fashion and cleans up. Only the first request's reason is kept.
+func (this *MigrationContext) RequestAbort(reason string) {
+	this.abortRequestedOnce.Do(func() {
+		this.abortReason = reason
+		close(this.abortRequested)
+	})
+}
+
+// IsAbortRequested checks whether a graceful abort has been requested
+func (this *MigrationContext) IsAbortRequested() bool {
+	select {
+	case <-this.abortRequested:
+		return true
+	default:
+		return false
 	}
 }
 
+// AbortRequested returns a channel that is closed upon graceful abort request
+func (this *MigrationContext) AbortRequested() <-chan struct{} {
+	return this.abortRequested
+}
+
+// GetAbortReason returns the reason given for a graceful abort, if requested
+func (this *MigrationContext) GetAbortReason() string {
+	if !this.IsAbortRequested() {
+		return ""
+	}
+	return this.abortReason
+}
+
 func getSafeTableName(baseName string, suffix string) string {
 	name := fmt.Sprintf("_%s_%s", baseName, suffix)
 	if len(name) <= mysql.MaxTableNameLength {
@@ -289,6 +491,62 @@ func getSafeTableName(baseName string, suffix string) string {
 	return fmt.Sprintf("_%s_%s", baseName[0:len(baseName)-extraCharacters], suffix)
 }
 
+// ArtifactTable describes a table left behind by gh-ost, as identified by its name
+type ArtifactTable struct {
+	TableName string
+	BaseName  string
+	Suffix    string
+	// Timestamp is only set for timestamped "old" tables (see --timestamp-old-table)
+	Timestamp time.Time
+}
+
+// IsChangelog checks whether this is a changelog table
+func (this *ArtifactTable) IsChangelog() bool {
+	return this.Suffix == "ghc"
+}
+
+// ParseArtifactTableName identifies gh-ost ghost, changelog, desired-schema and "old" tables,
+// as named by getSafeTableName(). Note the base name may be truncated.
+func ParseArtifactTableName(tableName string) (artifact *ArtifactTable, ok bool) {
+	submatch := artifactTableRegexp.FindStringSubmatch(tableName)
+	if len(submatch) == 0 {
+		return nil, false
+	}
+	artifact = &ArtifactTable{
+		TableName: tableName,
+		BaseName:  submatch[1],
+		Suffix:    submatch[2],
+	}
+	if submatch[3] != "" {
+		timestamp, err := time.ParseInLocation(artifactTimestampLayout, submatch[3], time.Local)
+		if err != nil {
+			return nil, false
+		}
+		artifact.Suffix = "del"
+		artifact.Timestamp = timestamp
+	}
+	return artifact, true
+}
+
+// BuildPendingDropComment returns a table comment marking a table to be dropped at given time.
+// See --old-table-retention-seconds
+func BuildPendingDropComment(dropAt time.Time) string {
+	return fmt.Sprintf("gh-ost-pending-drop:%d", dropAt.Unix())
+}
+
+// ParsePendingDropComment reads the time at which a table is to be dropped, if so marked
+func ParsePendingDropComment(tableComment string) (dropAt time.Time, ok bool) {
+	submatch := pendingDropCommentRegexp.FindStringSubmatch(tableComment)
+	if len(submatch) == 0 {
+		return dropAt, false
+	}
+	unixTime, err := strconv.ParseInt(submatch[1], 10, 64)
+	if err != nil {
+		return dropAt, false
+	}
+	return time.Unix(unixTime, 0), true
+}
+
 // GetGhostTableName generates the name of ghost table, based on original table name
 // or a given table name
 func (this *MigrationContext) GetGhostTableName() string {
@@ -328,6 +586,16 @@ func (this *MigrationContext) GetChangelogTableName() string {
 	}
 }
 
+// GetDesiredSchemaTableName generates the name of the scratch table on which a desired schema
+// (see --desired-schema) is created, so as to read its canonical definition
+func (this *MigrationContext) GetDesiredSchemaTableName() string {
+	if this.ForceTmpTableName != "" {
+		return getSafeTableName(this.ForceTmpTableName, "gds")
+	} else {
+		return getSafeTableName(this.OriginalTableName, "gds")
+	}
+}
+
 // GetVoluntaryLockName returns a name of a voluntary lock to be used throughout
 // the swap-tables process.
 func (this *MigrationContext) GetVoluntaryLockName() string {
@@ -361,6 +629,38 @@ func (this *MigrationContext) GetInspectorHostname() string {
 	return this.InspectorConnectionConfig.ImpliedKey.Hostname
 }
 
+// HasBinlogSource is `true` when binary logs are streamed from a server other than the inspected one
+func (this *MigrationContext) HasBinlogSource() bool {
+	return this.BinlogSourceHostname != ""
+}
+
+// GetBinlogSourceConnectionConfig returns the connection config of the server binary logs are streamed from:
+// --binlog-source if given, or else the inspected server
+func (this *MigrationContext) GetBinlogSourceConnectionConfig() *mysql.ConnectionConfig {
+	if this.BinlogSourceConnectionConfig == nil {
+		return this.InspectorConnectionConfig
+	}
+	return this.BinlogSourceConnectionConfig
+}
+
+// GetInspectorServerVersion returns the flavor and version of the inspected server
+func (this *MigrationContext) GetInspectorServerVersion() *mysql.ServerVersion {
+	return mysql.ParseServerVersion(this.InspectorMySQLVersion)
+}
+
+// GetApplierServerVersion returns the flavor and version of the applier server
+func (this *MigrationContext) GetApplierServerVersion() *mysql.ServerVersion {
+	return mysql.ParseServerVersion(this.ApplierMySQLVersion)
+}
+
+// GetBinlogSourceServerVersion returns the flavor and version of the server binary logs are streamed from
+func (this *MigrationContext) GetBinlogSourceServerVersion() *mysql.ServerVersion {
+	if this.BinlogSourceMySQLVersion == "" {
+		return this.GetInspectorServerVersion()
+	}
+	return mysql.ParseServerVersion(this.BinlogSourceMySQLVersion)
+}
+
 // InspectorIsAlsoApplier is `true` when the both inspector and applier are the
 // same database instance. This would be true when running directly on master or when
 // testing on replica.
@@ -384,10 +684,70 @@ func (this *MigrationContext) SetCutOverLockTimeoutSeconds(timeoutSeconds int64)
 		return fmt.Errorf("Maximal timeout is 10sec. Timeout remains at %d", this.CutOverLockTimeoutSeconds)
 	}
 	//合法的超时时间范围是[1,10)
-	this.CutOverLockTimeoutSeconds = timeoutSeconds
+	atomic.StoreInt64(&this.CutOverLockTimeoutSeconds, timeoutSeconds)
 	return nil
 }
 
+func (this *MigrationContext) GetCutOverLockTimeoutSeconds() int64 {
+	return atomic.LoadInt64(&this.CutOverLockTimeoutSeconds)
+}
+
+// SetCutOverType parses a cut-over type name: atomic (or default) or two-step
+func (this *MigrationContext) SetCutOverType(cutOver string) error {
+	this.cutOverMutex.Lock()
+	defer this.cutOverMutex.Unlock()
+	switch cutOver {
+	case "atomic", "default", "":
+		this.CutOverType = CutOverAtomic
+	case "two-step":
+		this.CutOverType = CutOverTwoStep
+	default:
+		return fmt.Errorf("Unknown cut-over: %s", cutOver)
+	}
+	return nil
+}
+
+func (this *MigrationContext) GetCutOverType() CutOver {
+	this.cutOverMutex.Lock()
+	defer this.cutOverMutex.Unlock()
+	return this.CutOverType
+}
+
+// GetCutOverTypeName returns the cut-over type by its command line name
+func (this *MigrationContext) GetCutOverTypeName() string {
+	if this.GetCutOverType() == CutOverTwoStep {
+		return "two-step"
+	}
+	return "atomic"
+}
+
+func (this *MigrationContext) SetCutOverExponentialBackoff(exponentialBackoff bool) {
+	this.cutOverMutex.Lock()
+	defer this.cutOverMutex.Unlock()
+	this.CutOverExponentialBackoff = exponentialBackoff
+}
+
+func (this *MigrationContext) GetCutOverExponentialBackoff() bool {
+	this.cutOverMutex.Lock()
+	defer this.cutOverMutex.Unlock()
+	return this.CutOverExponentialBackoff
+}
+
+// IsCutOverPostponedByUser checks whether the user has postponed cut-over via 'postpone' or 'postpone-until' commands
+func (this *MigrationContext) IsCutOverPostponedByUser() bool {
+	if atomic.LoadInt64(&this.UserCommandedPostponeFlag) > 0 {
+		return true
+	}
+	postponeUntil := atomic.LoadInt64(&this.PostponeCutOverUntil)
+	return postponeUntil > 0 && time.Now().UnixNano() < postponeUntil
+}
+
+// ClearUserCommandedPostpone undoes 'postpone' and 'postpone-until' commands
+func (this *MigrationContext) ClearUserCommandedPostpone() {
+	atomic.StoreInt64(&this.UserCommandedPostponeFlag, 0)
+	atomic.StoreInt64(&this.PostponeCutOverUntil, 0)
+}
+
 func (this *MigrationContext) SetExponentialBackoffMaxInterval(intervalSeconds int64) error {
 	//间隔小于2 返回报错信息
 	if intervalSeconds < 2 {
@@ -554,10 +914,49 @@ func (this *MigrationContext) GetThrottleGeneralCheckResult() *ThrottleCheckResu
 
 func (this *MigrationContext) SetThrottled(throttle bool, reason string, reasonHint ThrottleReasonHint) {
 	this.throttleMutex.Lock()
-	defer this.throttleMutex.Unlock()
+	changed := (this.isThrottled != throttle)
 	this.isThrottled = throttle
 	this.throttleReason = reason
 	this.throttleReasonHint = reasonHint
+	this.throttleMutex.Unlock()
+
+	if changed {
+		this.EmitEvent(&MigrationEvent{Type: ThrottleChangedEvent, Throttled: throttle, ThrottleReason: reason})
+	}
+}
+
+// SetCoordinationThrottleReason sets the reason for which coordination with concurrent migrations requires throttling.
+// An empty reason means coordination does not require throttling.
+func (this *MigrationContext) SetCoordinationThrottleReason(reason string) {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+	this.coordinationThrottleReason = reason
+}
+
+func (this *MigrationContext) GetCoordinationThrottleReason() string {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+	return this.coordinationThrottleReason
+}
+
+// SetThrottleHTTPRateReason sets the reason for which row copy exceeds the rate suggested by the throttle HTTP endpoint.
+// An empty reason means the rate is not exceeded.
+func (this *MigrationContext) SetThrottleHTTPRateReason(reason string) {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+	this.throttleHTTPRateReason = reason
+}
+
+// GetRowCopyThrottleReason returns the reason for which row copy, and only row copy, should be held back:
+// coordination with concurrent migrations, or a rate suggested by the throttle HTTP endpoint.
+// Unlike throttling, this does not hold back binlog event apply.
+func (this *MigrationContext) GetRowCopyThrottleReason() string {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+	if this.coordinationThrottleReason != "" {
+		return this.coordinationThrottleReason
+	}
+	return this.throttleHTTPRateReason
 }
 
 func (this *MigrationContext) IsThrottled() (bool, string, ThrottleReasonHint) {
@@ -606,6 +1005,29 @@ func (this *MigrationContext) SetThrottleHTTP(throttleHTTP string) {
 	this.throttleHTTP = throttleHTTP
 }
 
+// GetThrottleHTTPHeaders returns the headers sent along throttle HTTP checks
+func (this *MigrationContext) GetThrottleHTTPHeaders() http.Header {
+	this.throttleHTTPMutex.Lock()
+	defer this.throttleHTTPMutex.Unlock()
+
+	return this.throttleHTTPHeaders
+}
+
+// GetThrottleHTTPResult returns the latest throttle HTTP check result, or nil if none
+func (this *MigrationContext) GetThrottleHTTPResult() *ThrottleHTTPResult {
+	this.throttleHTTPMutex.Lock()
+	defer this.throttleHTTPMutex.Unlock()
+
+	return this.throttleHTTPResult
+}
+
+func (this *MigrationContext) SetThrottleHTTPResult(result *ThrottleHTTPResult) {
+	this.throttleHTTPMutex.Lock()
+	defer this.throttleHTTPMutex.Unlock()
+
+	this.throttleHTTPResult = result
+}
+
 func (this *MigrationContext) SetIgnoreHTTPErrors(ignoreHTTPErrors bool) {
 	this.throttleHTTPMutex.Lock()
 	defer this.throttleHTTPMutex.Unlock()
@@ -634,6 +1056,16 @@ func (this *MigrationContext) GetNiceRatio() float64 {
 	return this.niceRatio
 }
 
+// GetEffectiveNiceRatio returns the nice-ratio to apply: the configured nice-ratio, or a higher one
+// suggested by the throttle HTTP endpoint
+func (this *MigrationContext) GetEffectiveNiceRatio() float64 {
+	niceRatio := this.GetNiceRatio()
+	if result := this.GetThrottleHTTPResult(); result != nil && result.NiceRatio > niceRatio {
+		niceRatio = math.Min(result.NiceRatio, 100.0)
+	}
+	return niceRatio
+}
+
 func (this *MigrationContext) SetNiceRatio(newRatio float64) {
 	if newRatio < 0.0 {
 		newRatio = 0.0
@@ -660,6 +1092,30 @@ func (this *MigrationContext) SetRecentBinlogCoordinates(coordinates mysql.Binlo
 	this.recentBinlogCoordinates = coordinates
 }
 
+// GetBinlogHeadroom returns the estimated time until the binary log being read is purged. limited is false
+// when binary logs do not expire, or when headroom is yet unknown
+func (this *MigrationContext) GetBinlogHeadroom() (headroom time.Duration, limited bool) {
+	nanoseconds := atomic.LoadInt64(&this.BinlogHeadroomNanoseconds)
+	if nanoseconds < 0 {
+		return 0, false
+	}
+	return time.Duration(nanoseconds), true
+}
+
+// SetBinlogHeadroom sets the estimated time until the binary log being read is purged
+func (this *MigrationContext) SetBinlogHeadroom(headroom time.Duration, limited bool) {
+	if !limited {
+		atomic.StoreInt64(&this.BinlogHeadroomNanoseconds, -1)
+		return
+	}
+	atomic.StoreInt64(&this.BinlogHeadroomNanoseconds, int64(headroom))
+}
+
+// IsBinlogHeadroomLow checks whether binary log headroom is below --min-binlog-headroom-seconds
+func (this *MigrationContext) IsBinlogHeadroomLow() bool {
+	return atomic.LoadInt64(&this.BinlogHeadroomLowFlag) > 0
+}
+
 // ReadMaxLoad parses the `--max-load` flag, which is in multiple key-value format,
 // such as: 'Threads_running=100,Threads_connected=500'
 // It only applies changes in case there's no parsing error.
@@ -721,9 +1177,57 @@ func (this *MigrationContext) GetThrottleControlReplicaKeys() *mysql.InstanceKey
 
 	keys := mysql.NewInstanceKeyMap()
 	keys.AddKeys(this.throttleControlReplicaKeys.GetInstanceKeys())
+	keys.AddKeys(this.discoveredReplicaKeys.GetInstanceKeys())
 	return keys
 }
 
+// GetDiscoveredReplicaKeys returns the throttle control replicas found by discovery
+func (this *MigrationContext) GetDiscoveredReplicaKeys() *mysql.InstanceKeyMap {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+
+	keys := mysql.NewInstanceKeyMap()
+	keys.AddKeys(this.discoveredReplicaKeys.GetInstanceKeys())
+	return keys
+}
+
+// SetDiscoveredReplicaKeys replaces the discovered throttle control replicas. These are in addition to
+// --throttle-control-replicas
+func (this *MigrationContext) SetDiscoveredReplicaKeys(keys *mysql.InstanceKeyMap) {
+	this.throttleMutex.Lock()
+	defer this.throttleMutex.Unlock()
+
+	this.discoveredReplicaKeys = keys
+}
+
+// FilterDiscoveredReplicaKeys applies --discover-replicas-include and --discover-replicas-exclude onto given
+// keys. Patterns are regular expressions matched against `host:port`
+func (this *MigrationContext) FilterDiscoveredReplicaKeys(keys *mysql.InstanceKeyMap) (*mysql.InstanceKeyMap, error) {
+	var includeRegexp, excludeRegexp *regexp.Regexp
+	var err error
+	if this.DiscoverReplicasInclude != "" {
+		if includeRegexp, err = regexp.Compile(this.DiscoverReplicasInclude); err != nil {
+			return nil, fmt.Errorf("Invalid --discover-replicas-include: %+v", err)
+		}
+	}
+	if this.DiscoverReplicasExclude != "" {
+		if excludeRegexp, err = regexp.Compile(this.DiscoverReplicasExclude); err != nil {
+			return nil, fmt.Errorf("Invalid --discover-replicas-exclude: %+v", err)
+		}
+	}
+	filtered := mysql.NewInstanceKeyMap()
+	for _, key := range keys.GetInstanceKeys() {
+		if includeRegexp != nil && !includeRegexp.MatchString(key.DisplayString()) {
+			continue
+		}
+		if excludeRegexp != nil && excludeRegexp.MatchString(key.DisplayString()) {
+			continue
+		}
+		filtered.AddKey(key)
+	}
+	return filtered, nil
+}
+
 // throttleControlReplicas Example: myhost1.com:3306,myhost2.com,myhost3.com:3307
 func (this *MigrationContext) ReadThrottleControlReplicaKeys(throttleControlReplicas string) error {
 	keys := mysql.NewInstanceKeyMap()
@@ -775,13 +1279,199 @@ func (this *MigrationContext) SetupTLS() error {
 	return nil
 }
 
-// ReadConfigFile attempts to read the config file, if it exists
-//如果配置文件存在的话读取配置文件
-func (this *MigrationContext) ReadConfigFile() error {
-	//读取配置文件要加互斥锁
+// SetupBinlogSource sets up the connection to --binlog-source, with the inspected server's credentials and TLS
+// settings unless given its own. It should be called once credentials and TLS are set up.
+func (this *MigrationContext) SetupBinlogSource() error {
+	if !this.HasBinlogSource() {
+		return nil
+	}
+	key, err := mysql.ParseRawInstanceKeyLoose(this.BinlogSourceHostname)
+	if err != nil {
+		return err
+	}
+	this.BinlogSourceConnectionConfig = this.InspectorConnectionConfig.DuplicateCredentials(*key)
+	if this.CliBinlogSourceUser != "" {
+		this.BinlogSourceConnectionConfig.User = this.CliBinlogSourceUser
+	}
+	if this.CliBinlogSourcePassword != "" {
+		this.BinlogSourceConnectionConfig.Password = this.CliBinlogSourcePassword
+	}
+	if this.BinlogSourceUseTLS {
+		return this.BinlogSourceConnectionConfig.UseTLSAs(mysql.BINLOG_SOURCE_TLS_CONFIG_KEY,
+			this.BinlogSourceTLSCACertificate, this.BinlogSourceTLSCertificate, this.BinlogSourceTLSKey, this.BinlogSourceTLSAllowInsecure,
+		)
+	}
+	return nil
+}
+
+// SetupThrottleHTTPHeaders reads the headers sent along throttle HTTP checks
+func (this *MigrationContext) SetupThrottleHTTPHeaders() error {
+	if this.ThrottleHTTPHeadersFile == "" {
+		return nil
+	}
+	bytes, err := ioutil.ReadFile(this.ThrottleHTTPHeadersFile)
+	if err != nil {
+		return err
+	}
+	headers, err := ReadThrottleHTTPHeaders(string(bytes))
+	if err != nil {
+		return fmt.Errorf("%s: %+v", this.ThrottleHTTPHeadersFile, err)
+	}
+	this.throttleHTTPMutex.Lock()
+	defer this.throttleHTTPMutex.Unlock()
+
+	this.throttleHTTPHeaders = headers
+	return nil
+}
+
+// SetupServeTCPAuth reads the interactive TCP port's tokens and TLS settings
+func (this *MigrationContext) SetupServeTCPAuth() (err error) {
+	this.ServeTCPAuth, err = NewServerAuth(this.ServeTCPTokensFile, this.ServeTCPTLSCertificate, this.ServeTCPTLSKey, this.ServeTCPTLSCACertificate, this.ServeTCPTLSAdminNames)
+	return err
+}
+
+// ValidateSettings checks for conflicting or incomplete settings
+func (this *MigrationContext) ValidateSettings() error {
+	//互斥参数检查(两个参数不能同时使用)
+	if this.AllowedRunningOnMaster && this.TestOnReplica {
+		return fmt.Errorf("--allow-on-master and --test-on-replica are mutually exclusive")
+	}
+	if this.AllowedRunningOnMaster && this.MigrateOnReplica {
+		return fmt.Errorf("--allow-on-master and --migrate-on-replica are mutually exclusive")
+	}
+	if this.MigrateOnReplica && this.TestOnReplica {
+		return fmt.Errorf("--migrate-on-replica and --test-on-replica are mutually exclusive")
+	}
+	if this.SwitchToRowBinlogFormat && this.AssumeRBR {
+		return fmt.Errorf("--switch-to-rbr and --assume-rbr are mutually exclusive")
+	}
+	//两个参数必须搭配使用检查
+	if this.TestOnReplicaSkipReplicaStop && !this.TestOnReplica {
+		return fmt.Errorf("--test-on-replica-skip-replica-stop requires --test-on-replica to be enabled")
+	}
+	if this.CliMasterUser != "" && this.AssumeMasterHostname == "" {
+		return fmt.Errorf("--master-user requires --assume-master-host")
+	}
+	if this.CliMasterPassword != "" && this.AssumeMasterHostname == "" {
+		return fmt.Errorf("--master-password requires --assume-master-host")
+	}
+	if this.CoordinationTable != "" {
+		if tokens := strings.Split(this.CoordinationTable, "."); len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return fmt.Errorf("--coordination-table must be given as schema.table. Got: %s", this.CoordinationTable)
+		}
+	} else if this.CoordinationMaxRowsPerSecond > 0 || this.CoordinationMaxActiveCopiers > 0 {
+		return fmt.Errorf("--coordination-max-rows-per-second and --coordination-max-active-copiers require --coordination-table")
+	}
+	if this.CoordinationMaxRowsPerSecond < 0 || this.CoordinationMaxActiveCopiers < 0 {
+		return fmt.Errorf("--coordination-max-rows-per-second and --coordination-max-active-copiers must not be negative")
+	}
+	if this.MaxGroupReplicationQueue < 0 || this.MaxWsrepLocalRecvQueue < 0 {
+		return fmt.Errorf("--max-group-replication-queue and --max-wsrep-local-recv-queue must not be negative")
+	}
+	if this.MaxWsrepFlowControlPaused < 0 || this.MaxWsrepFlowControlPaused > 1 {
+		return fmt.Errorf("--max-wsrep-flow-control-paused must be a fraction between 0 and 1. Got: %f", this.MaxWsrepFlowControlPaused)
+	}
+	if this.MinBinlogHeadroomSeconds < 0 {
+		return fmt.Errorf("--min-binlog-headroom-seconds must not be negative")
+	}
+	if err := ValidateBinlogHeadroomAction(this.BinlogHeadroomAction); err != nil {
+		return err
+	}
+	if this.EventsSpillDir != "" {
+		if info, err := os.Stat(this.EventsSpillDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("--events-spill-dir must be an existing directory. Got: %s", this.EventsSpillDir)
+		}
+		if this.EventsSpillMaxBytes <= 0 {
+			return fmt.Errorf("--events-spill-max-bytes must be positive")
+		}
+	}
+	if this.ThrottleHTTPMethod != http.MethodHead && this.ThrottleHTTPMethod != http.MethodGet {
+		return fmt.Errorf("--throttle-http-method must be one of: %s, %s. Got: %s", http.MethodHead, http.MethodGet, this.ThrottleHTTPMethod)
+	}
+	if (this.DiscoverReplicasInclude != "" || this.DiscoverReplicasExclude != "") && !this.DiscoverThrottleControlReplicas {
+		return fmt.Errorf("--discover-replicas-include and --discover-replicas-exclude require --discover-throttle-control-replicas")
+	}
+	if this.DiscoverThrottleControlReplicas {
+		if this.DiscoverReplicasIntervalSeconds < 1 {
+			return fmt.Errorf("--discover-replicas-interval-seconds must be at least 1")
+		}
+		if _, err := this.FilterDiscoveredReplicaKeys(mysql.NewInstanceKeyMap()); err != nil {
+			return err
+		}
+	}
+	if this.TLSCACertificate != "" && !this.UseTLS {
+		return fmt.Errorf("--ssl-ca requires --ssl")
+	}
+	if this.TLSCertificate != "" && !this.UseTLS {
+		return fmt.Errorf("--ssl-cert requires --ssl")
+	}
+	if this.TLSKey != "" && !this.UseTLS {
+		return fmt.Errorf("--ssl-key requires --ssl")
+	}
+	if this.TLSAllowInsecure && !this.UseTLS {
+		return fmt.Errorf("--ssl-allow-insecure requires --ssl")
+	}
+	if !this.HasBinlogSource() {
+		if this.CliBinlogSourceUser != "" || this.CliBinlogSourcePassword != "" || this.BinlogSourceUseTLS {
+			return fmt.Errorf("--binlog-source-user, --binlog-source-password and --binlog-source-ssl require --binlog-source")
+		}
+	} else if this.TestOnReplica || this.MigrateOnReplica {
+		return fmt.Errorf("--binlog-source is not supported with --test-on-replica or --migrate-on-replica: changes made on the replica would not be seen on the binlog source")
+	}
+	if (this.BinlogSourceTLSCACertificate != "" || this.BinlogSourceTLSCertificate != "" || this.BinlogSourceTLSKey != "" || this.BinlogSourceTLSAllowInsecure) && !this.BinlogSourceUseTLS {
+		return fmt.Errorf("--binlog-source-ssl-ca, --binlog-source-ssl-cert, --binlog-source-ssl-key and --binlog-source-ssl-allow-insecure require --binlog-source-ssl")
+	}
+	if this.LowImpactDropOldTable && !this.OkToDropTable {
+		return fmt.Errorf("--low-impact-drop-old-table requires --ok-to-drop-table")
+	}
+	if this.OldTableRetentionSeconds > 0 && !this.OkToDropTable {
+		return fmt.Errorf("--old-table-retention-seconds requires --ok-to-drop-table")
+	}
+	switch this.AbortDropTables {
+	case AbortDropAllTables, AbortDropChangelogTable, AbortDropNoTables:
+	default:
+		return fmt.Errorf("--abort-drop-tables must be one of: all, changelog, none")
+	}
+	return nil
+}
+
+// GetWebhooks returns webhooks configured in the config file
+func (this *MigrationContext) GetWebhooks() []*Webhook {
+	this.configMutex.Lock()
+	defer this.configMutex.Unlock()
+	return this.webhooks
+}
+
+// SetWebhooks sets webhooks programmatically, in place of those configured in the config file
+func (this *MigrationContext) SetWebhooks(webhooks []*Webhook) {
 	this.configMutex.Lock()
 	defer this.configMutex.Unlock()
+	this.webhooks = webhooks
+}
+
+// GetReplicaLag returns the replica-lag section applying to given throttle control replica
+func (this *MigrationContext) GetReplicaLag(key mysql.InstanceKey) *ReplicaLag {
+	this.configMutex.Lock()
+	defer this.configMutex.Unlock()
+	for _, replicaLag := range this.replicaLags {
+		if replicaLag.Matches(key) {
+			return replicaLag
+		}
+	}
+	return DefaultReplicaLag
+}
 
+// SetReplicaLags sets replica-lag sections programmatically, in place of those configured in the config file
+func (this *MigrationContext) SetReplicaLags(replicaLags []*ReplicaLag) {
+	this.configMutex.Lock()
+	defer this.configMutex.Unlock()
+	this.replicaLags = replicaLags
+}
+
+// ReadConfigFile attempts to read the config file, if it exists. The file is parsed in full before
+// taking effect, such that a failed reload leaves the current configuration in place.
+//如果配置文件存在的话读取配置文件
+func (this *MigrationContext) ReadConfigFile() error {
 	//配置文件为空 直接返回
 	if this.ConfigFile == "" {
 		return nil
@@ -789,19 +1479,36 @@ func (this *MigrationContext) ReadConfigFile() error {
 	//解析模式
 	gcfg.RelaxedParserMode = true
 	gcfgscanner.RelaxedScannerMode = true
+	//先解析到局部变量，全部解析成功后才生效
+	config := ContextConfig{}
 	//读取配置文件出错
-	if err := gcfg.ReadFileInto(&this.config, this.ConfigFile); err != nil {
+	if err := gcfg.ReadFileInto(&config, this.ConfigFile); err != nil {
+		return fmt.Errorf("Error reading config file %s. Details: %s", this.ConfigFile, err.Error())
+	}
+	webhooks, err := readWebhooks(config.Webhook)
+	if err != nil {
+		return fmt.Errorf("Error reading config file %s. Details: %s", this.ConfigFile, err.Error())
+	}
+	replicaLags, err := readReplicaLags(config.Replica_Lag)
+	if err != nil {
 		return fmt.Errorf("Error reading config file %s. Details: %s", this.ConfigFile, err.Error())
 	}
 
 	// We accept user & password in the form "${SOME_ENV_VARIABLE}" in which case we pull
 	// the given variable from os env
-	if submatch := envVariableRegexp.FindStringSubmatch(this.config.Client.User); len(submatch) > 1 {
-		this.config.Client.User = os.Getenv(submatch[1])
+	if submatch := envVariableRegexp.FindStringSubmatch(config.Client.User); len(submatch) > 1 {
+		config.Client.User = os.Getenv(submatch[1])
 	}
-	if submatch := envVariableRegexp.FindStringSubmatch(this.config.Client.Password); len(submatch) > 1 {
-		this.config.Client.Password = os.Getenv(submatch[1])
+	if submatch := envVariableRegexp.FindStringSubmatch(config.Client.Password); len(submatch) > 1 {
+		config.Client.Password = os.Getenv(submatch[1])
 	}
 
+	//生效配置要加互斥锁
+	this.configMutex.Lock()
+	this.config = config
+	this.configMutex.Unlock()
+
+	this.SetWebhooks(webhooks)
+	this.SetReplicaLags(replicaLags)
 	return nil
 }
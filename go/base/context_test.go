@@ -9,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"gh-ost/go/mysql"
+
 	"github.com/outbrain/golib/log"
 	test "github.com/outbrain/golib/tests"
 )
@@ -56,3 +58,185 @@ func TestGetTableNames(t *testing.T) {
 		test.S(t).ExpectEquals(context.GetChangelogTableName(), "_tmp_ghc")
 	}
 }
+
+func TestParseArtifactTableName(t *testing.T) {
+	{
+		_, ok := ParseArtifactTableName("some_table")
+		test.S(t).ExpectFalse(ok)
+	}
+	{
+		_, ok := ParseArtifactTableName("_some_table_old")
+		test.S(t).ExpectFalse(ok)
+	}
+	{
+		artifact, ok := ParseArtifactTableName("_some_table_gho")
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectEquals(artifact.BaseName, "some_table")
+		test.S(t).ExpectEquals(artifact.Suffix, "gho")
+		test.S(t).ExpectFalse(artifact.IsChangelog())
+		test.S(t).ExpectTrue(artifact.Timestamp.IsZero())
+	}
+	{
+		artifact, ok := ParseArtifactTableName("_some_table_ghc")
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectEquals(artifact.BaseName, "some_table")
+		test.S(t).ExpectTrue(artifact.IsChangelog())
+	}
+	{
+		artifact, ok := ParseArtifactTableName("_some_table_gds")
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectEquals(artifact.Suffix, "gds")
+	}
+	{
+		artifact, ok := ParseArtifactTableName("_some_table_del")
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectEquals(artifact.BaseName, "some_table")
+		test.S(t).ExpectEquals(artifact.Suffix, "del")
+		test.S(t).ExpectTrue(artifact.Timestamp.IsZero())
+	}
+	{
+		context := NewMigrationContext()
+		context.OriginalTableName = "some_table"
+		context.TimestampOldTable = true
+		context.StartTime = time.Date(2013, 2, 3, 19, 54, 0, 0, time.Local)
+		artifact, ok := ParseArtifactTableName(context.GetOldTableName())
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectEquals(artifact.BaseName, "some_table")
+		test.S(t).ExpectEquals(artifact.Suffix, "del")
+		test.S(t).ExpectTrue(artifact.Timestamp.Equal(context.StartTime))
+	}
+}
+
+func TestPendingDropComment(t *testing.T) {
+	{
+		_, ok := ParsePendingDropComment("")
+		test.S(t).ExpectFalse(ok)
+	}
+	{
+		_, ok := ParsePendingDropComment("some user comment")
+		test.S(t).ExpectFalse(ok)
+	}
+	{
+		dropAt := time.Unix(1700000000, 0)
+		comment := BuildPendingDropComment(dropAt)
+		test.S(t).ExpectEquals(comment, "gh-ost-pending-drop:1700000000")
+		parsed, ok := ParsePendingDropComment(comment)
+		test.S(t).ExpectTrue(ok)
+		test.S(t).ExpectTrue(parsed.Equal(dropAt))
+	}
+}
+
+func TestRequestAbort(t *testing.T) {
+	context := NewMigrationContext()
+	test.S(t).ExpectFalse(context.IsAbortRequested())
+	test.S(t).ExpectEquals(context.GetAbortReason(), "")
+
+	context.RequestAbort("first")
+	context.RequestAbort("second")
+	test.S(t).ExpectTrue(context.IsAbortRequested())
+	test.S(t).ExpectEquals(context.GetAbortReason(), "first")
+	select {
+	case <-context.AbortRequested():
+	default:
+		t.Errorf("expected abort channel to be closed")
+	}
+}
+
+func TestSetCutOverType(t *testing.T) {
+	context := NewMigrationContext()
+	test.S(t).ExpectNil(context.SetCutOverType("two-step"))
+	test.S(t).ExpectEquals(context.CutOverType, CutOverTwoStep)
+	test.S(t).ExpectNil(context.SetCutOverType("default"))
+	test.S(t).ExpectEquals(context.CutOverType, CutOverAtomic)
+	test.S(t).ExpectNotNil(context.SetCutOverType("three-step"))
+}
+
+func TestValidateSettings(t *testing.T) {
+	{
+		context := NewMigrationContext()
+		test.S(t).ExpectNil(context.ValidateSettings())
+	}
+	{
+		context := NewMigrationContext()
+		context.AllowedRunningOnMaster = true
+		context.TestOnReplica = true
+		test.S(t).ExpectNotNil(context.ValidateSettings())
+	}
+	{
+		context := NewMigrationContext()
+		context.OldTableRetentionSeconds = 60
+		test.S(t).ExpectNotNil(context.ValidateSettings())
+		context.OkToDropTable = true
+		test.S(t).ExpectNil(context.ValidateSettings())
+	}
+	{
+		context := NewMigrationContext()
+		context.AbortDropTables = "some"
+		test.S(t).ExpectNotNil(context.ValidateSettings())
+	}
+}
+
+func TestSetThrottledEmitsEvents(t *testing.T) {
+	context := NewMigrationContext()
+	events := []*MigrationEvent{}
+	context.EventListener = func(event *MigrationEvent) {
+		events = append(events, event)
+	}
+	context.SetThrottled(true, "lag=2s", NoThrottleReasonHint)
+	context.SetThrottled(true, "lag=3s", NoThrottleReasonHint)
+	context.SetThrottled(false, "", NoThrottleReasonHint)
+	test.S(t).ExpectEquals(len(events), 2)
+	test.S(t).ExpectEquals(events[0].Type, ThrottleChangedEvent)
+	test.S(t).ExpectTrue(events[0].Throttled)
+	test.S(t).ExpectEquals(events[0].ThrottleReason, "lag=2s")
+	test.S(t).ExpectFalse(events[1].Throttled)
+}
+
+func TestFilterDiscoveredReplicaKeys(t *testing.T) {
+	keys := mysql.NewInstanceKeyMap()
+	keys.ReadCommaDelimitedList("db-1:3306,db-2:3306,db-backup-1:3306,db-delayed-1:3307")
+	{
+		context := NewMigrationContext()
+		filtered, err := context.FilterDiscoveredReplicaKeys(keys)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(filtered.Len(), 4)
+	}
+	{
+		context := NewMigrationContext()
+		context.DiscoverReplicasExclude = "backup|delayed"
+		filtered, err := context.FilterDiscoveredReplicaKeys(keys)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(filtered.Len(), 2)
+		test.S(t).ExpectTrue(filtered.HasKey(mysql.InstanceKey{Hostname: "db-1", Port: 3306}))
+		test.S(t).ExpectTrue(filtered.HasKey(mysql.InstanceKey{Hostname: "db-2", Port: 3306}))
+	}
+	{
+		context := NewMigrationContext()
+		context.DiscoverReplicasInclude = ":3306$"
+		context.DiscoverReplicasExclude = "^db-2:"
+		filtered, err := context.FilterDiscoveredReplicaKeys(keys)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(filtered.Len(), 2)
+		test.S(t).ExpectTrue(filtered.HasKey(mysql.InstanceKey{Hostname: "db-1", Port: 3306}))
+		test.S(t).ExpectTrue(filtered.HasKey(mysql.InstanceKey{Hostname: "db-backup-1", Port: 3306}))
+	}
+	{
+		context := NewMigrationContext()
+		context.DiscoverReplicasInclude = "("
+		_, err := context.FilterDiscoveredReplicaKeys(keys)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestDiscoveredThrottleControlReplicaKeys(t *testing.T) {
+	context := NewMigrationContext()
+	context.ReadThrottleControlReplicaKeys("db-1:3306")
+	discovered := mysql.NewInstanceKeyMap()
+	discovered.ReadCommaDelimitedList("db-1:3306,db-2:3306")
+	context.SetDiscoveredReplicaKeys(discovered)
+	test.S(t).ExpectEquals(context.GetThrottleControlReplicaKeys().Len(), 2)
+
+	// Interactive `throttle-control-replicas=` replaces the static list only
+	context.ReadThrottleControlReplicaKeys("db-3:3306")
+	test.S(t).ExpectEquals(context.GetThrottleControlReplicaKeys().Len(), 3)
+}
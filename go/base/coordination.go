@@ -0,0 +1,89 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"sort"
+)
+
+// CoordinationSliceSeconds is the time slice after which copier slots rotate, when more migrations
+// wish to copy rows than --coordination-max-active-copiers allows
+const CoordinationSliceSeconds = 60
+
+// CoordinatedMigration is a migration registered on the coordination table
+type CoordinatedMigration struct {
+	Uuid          string
+	Hostname      string
+	DatabaseName  string
+	TableName     string
+	RowsPerSecond float64
+	// Copying is true while the migration copies rows
+	Copying bool
+	// Throttled is true when the migration is throttled for reasons other than coordination
+	Throttled bool
+}
+
+// CoordinationShare is a migration's share of the cluster-wide budget
+type CoordinationShare struct {
+	// CopierAllowed is false when the migration must wait for a copier slot
+	CopierAllowed bool
+	// RowsPerSecond is the migration's share of --coordination-max-rows-per-second. Zero means unlimited
+	RowsPerSecond float64
+	Copiers       int
+	ActiveCopiers int
+}
+
+// ComputeCoordinationShare computes the share of migration identified by uuid, given all live migrations.
+// Copier slots go round robin: with more copying migrations than maxActiveCopiers, each time slice allows
+// the next maxActiveCopiers of them, ordered by uuid. The rows/sec budget is then split evenly between the
+// allowed copiers which are not otherwise throttled; a throttled migration does not consume its share.
+func ComputeCoordinationShare(migrations []*CoordinatedMigration, uuid string, maxRowsPerSecond int64, maxActiveCopiers int64, slice int64) *CoordinationShare {
+	copiers := []*CoordinatedMigration{}
+	for _, migration := range migrations {
+		if migration.Copying {
+			copiers = append(copiers, migration)
+		}
+	}
+	sort.Slice(copiers, func(i, j int) bool { return copiers[i].Uuid < copiers[j].Uuid })
+
+	allowed := make(map[string]bool)
+	if maxActiveCopiers > 0 && int64(len(copiers)) > maxActiveCopiers {
+		for i := int64(0); i < maxActiveCopiers; i++ {
+			allowed[copiers[(slice*maxActiveCopiers+i)%int64(len(copiers))].Uuid] = true
+		}
+	} else {
+		for _, copier := range copiers {
+			allowed[copier.Uuid] = true
+		}
+	}
+	share := &CoordinationShare{
+		CopierAllowed: true,
+		Copiers:       len(copiers),
+		ActiveCopiers: len(allowed),
+	}
+	isCopier := false
+	for _, copier := range copiers {
+		if copier.Uuid == uuid {
+			isCopier = true
+		}
+	}
+	if isCopier {
+		share.CopierAllowed = allowed[uuid]
+	}
+	if maxRowsPerSecond > 0 {
+		participants := 0
+		for _, copier := range copiers {
+			if allowed[copier.Uuid] && (!copier.Throttled || copier.Uuid == uuid) {
+				participants++
+			}
+		}
+		if !isCopier {
+			participants++
+		}
+		share.RowsPerSecond = float64(maxRowsPerSecond) / float64(participants)
+	}
+	return share
+}
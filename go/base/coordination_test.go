@@ -0,0 +1,61 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestComputeCoordinationShare(t *testing.T) {
+	migrations := []*CoordinatedMigration{
+		{Uuid: "c", Copying: true},
+		{Uuid: "a", Copying: true},
+		{Uuid: "b", Copying: true},
+		{Uuid: "d", Copying: false},
+	}
+	{
+		share := ComputeCoordinationShare(migrations, "a", 0, 0, 0)
+		test.S(t).ExpectTrue(share.CopierAllowed)
+		test.S(t).ExpectEquals(share.RowsPerSecond, 0.0)
+		test.S(t).ExpectEquals(share.Copiers, 3)
+		test.S(t).ExpectEquals(share.ActiveCopiers, 3)
+	}
+	{
+		share := ComputeCoordinationShare(migrations, "a", 900, 0, 0)
+		test.S(t).ExpectEquals(share.RowsPerSecond, 300.0)
+	}
+	{
+		// Not yet copying: counted as a participant, so as not to exceed the budget once it starts
+		share := ComputeCoordinationShare(migrations, "d", 1000, 0, 0)
+		test.S(t).ExpectTrue(share.CopierAllowed)
+		test.S(t).ExpectEquals(share.RowsPerSecond, 250.0)
+	}
+	{
+		// Slots rotate between slices, ordered by uuid
+		test.S(t).ExpectTrue(ComputeCoordinationShare(migrations, "a", 0, 2, 0).CopierAllowed)
+		test.S(t).ExpectTrue(ComputeCoordinationShare(migrations, "b", 0, 2, 0).CopierAllowed)
+		test.S(t).ExpectFalse(ComputeCoordinationShare(migrations, "c", 0, 2, 0).CopierAllowed)
+		test.S(t).ExpectFalse(ComputeCoordinationShare(migrations, "b", 0, 2, 1).CopierAllowed)
+		test.S(t).ExpectTrue(ComputeCoordinationShare(migrations, "c", 0, 2, 1).CopierAllowed)
+		test.S(t).ExpectEquals(ComputeCoordinationShare(migrations, "c", 0, 2, 1).ActiveCopiers, 2)
+		test.S(t).ExpectTrue(ComputeCoordinationShare(migrations, "d", 0, 2, 1).CopierAllowed)
+	}
+	{
+		share := ComputeCoordinationShare(migrations, "a", 1000, 2, 0)
+		test.S(t).ExpectEquals(share.RowsPerSecond, 500.0)
+	}
+	{
+		// A throttled migration does not consume its share
+		throttled := []*CoordinatedMigration{
+			{Uuid: "a", Copying: true},
+			{Uuid: "b", Copying: true, Throttled: true},
+		}
+		test.S(t).ExpectEquals(ComputeCoordinationShare(throttled, "a", 1000, 0, 0).RowsPerSecond, 1000.0)
+		test.S(t).ExpectEquals(ComputeCoordinationShare(throttled, "b", 1000, 0, 0).RowsPerSecond, 500.0)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type MigrationEventType string
+
+const (
+	PhaseChangedEvent    MigrationEventType = "phase"
+	StatusEvent          MigrationEventType = "status"
+	ThrottleChangedEvent MigrationEventType = "throttle"
+	CutOverEvent         MigrationEventType = "cut-over"
+)
+
+// MigrationPhase names a milestone of the migration. Phases match hook names, see doc/hooks.md
+type MigrationPhase string
+
+const (
+	PhaseStartup          MigrationPhase = "startup"
+	PhaseValidated        MigrationPhase = "validated"
+	PhaseRowCountComplete MigrationPhase = "rowcount-complete"
+	PhaseBeforeRowCopy    MigrationPhase = "before-row-copy"
+	PhaseRowCopyComplete  MigrationPhase = "row-copy-complete"
+	PhaseBeginPostponed   MigrationPhase = "begin-postponed"
+	PhaseBeforeCutOver    MigrationPhase = "before-cut-over"
+	PhaseStopReplication  MigrationPhase = "stop-replication"
+	PhaseStartReplication MigrationPhase = "start-replication"
+	PhaseSuccess          MigrationPhase = "success"
+	PhaseFailure          MigrationPhase = "failure"
+)
+
+// MigrationEvent is delivered to MigrationContext.EventListener. Progress fields are populated on all events;
+// other fields depend on event type.
+type MigrationEvent struct {
+	Type MigrationEventType
+	Time time.Time
+
+	Elapsed      time.Duration
+	Progress     float64
+	RowsCopied   int64
+	RowsEstimate int64
+
+	// PhaseChangedEvent
+	Phase MigrationPhase
+	// StatusEvent
+	Status string
+	// ThrottleChangedEvent
+	Throttled      bool
+	ThrottleReason string
+	// CutOverEvent: nil on success
+	Error error
+}
+
+// EmitEvent populates progress fields of given event and delivers it to the event listener, if any.
+// The listener is called synchronously, on the migration's goroutines.
+func (this *MigrationContext) EmitEvent(event *MigrationEvent) {
+	if this.EventListener == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Elapsed = this.ElapsedTime()
+	event.Progress = this.GetProgressPct()
+	event.RowsCopied = this.GetTotalRowsCopied()
+	event.RowsEstimate = atomic.LoadInt64(&this.RowsEstimate) + atomic.LoadInt64(&this.RowsDeltaEstimate)
+	this.EventListener(event)
+}
+
+// EmitPhaseChanged notifies the event listener of a migration phase change
+func (this *MigrationContext) EmitPhaseChanged(phase MigrationPhase) {
+	this.EmitEvent(&MigrationEvent{Type: PhaseChangedEvent, Phase: phase})
+}
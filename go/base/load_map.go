@@ -10,10 +10,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// LoadMap is a mapping of status variable & threshold
-// e.g. [Threads_connected: 100, Threads_running: 50]
+// LoadMap is a mapping of load metric & threshold
+// e.g. [Threads_connected: 100, Threads_running: 50, rate(Innodb_row_lock_waits): 50]
+// See ParseLoadMetric for supported metrics.
 type LoadMap map[string]int64
 
 func NewLoadMap() LoadMap {
@@ -44,6 +47,9 @@ func ParseLoadMap(loadList string) (LoadMap, error) {
 		if loadTokens[0] == "" {
 			return result, fmt.Errorf("Error parsing status variable in load condition: %s", loadCondition)
 		}
+		if _, err := ParseLoadMetric(loadTokens[0]); err != nil {
+			return result, fmt.Errorf("Error parsing load condition: %s: %+v", loadCondition, err)
+		}
 		//把value转为int
 		if n, err := strconv.ParseInt(loadTokens[1], 10, 0); err != nil {
 			return result, fmt.Errorf("Error parsing numeric value in load condition: %s", loadCondition)
@@ -74,3 +80,205 @@ func (this *LoadMap) String() string {
 	sort.Strings(tokens)
 	return strings.Join(tokens, ",")
 }
+
+// LoadSourceType is where a load value is read from
+type LoadSourceType string
+
+const (
+	StatusLoadSource        LoadSourceType = "status"
+	InnodbMetricsLoadSource LoadSourceType = "innodb_metrics"
+)
+
+// LoadSource is a single value read off the server: a global status variable, or an
+// information_schema.innodb_metrics counter
+type LoadSource struct {
+	Type LoadSourceType
+	Name string
+}
+
+// LoadValue is a source's value, or its per-second rate
+type LoadValue struct {
+	Source LoadSource
+	Rate   bool
+}
+
+// LoadMetric is a parsed max-load/critical-load metric. With a Denominator, the metric is a
+// percentage: 100 * Numerator / Denominator
+type LoadMetric struct {
+	Numerator   LoadValue
+	Denominator *LoadValue
+}
+
+// parseLoadFunction splits `name(argument)` into name and argument. ok is false when given
+// expression is not a function call.
+func parseLoadFunction(expression string) (name string, argument string, ok bool, err error) {
+	open := strings.Index(expression, "(")
+	if open < 0 {
+		if strings.Contains(expression, ")") {
+			return "", "", false, fmt.Errorf("Unbalanced parentheses in %s", expression)
+		}
+		return "", "", false, nil
+	}
+	if !strings.HasSuffix(expression, ")") {
+		return "", "", false, fmt.Errorf("Unbalanced parentheses in %s", expression)
+	}
+	name = strings.TrimSpace(expression[:open])
+	argument = strings.TrimSpace(expression[open+1 : len(expression)-1])
+	if argument == "" {
+		return "", "", false, fmt.Errorf("Empty argument in %s", expression)
+	}
+	return name, argument, true, nil
+}
+
+func parseLoadSource(expression string) (source LoadSource, err error) {
+	name, argument, ok, err := parseLoadFunction(expression)
+	if err != nil {
+		return source, err
+	}
+	if !ok {
+		if expression == "" || strings.Contains(expression, "/") {
+			return source, fmt.Errorf("Invalid status variable: %q", expression)
+		}
+		return LoadSource{Type: StatusLoadSource, Name: expression}, nil
+	}
+	if name != string(InnodbMetricsLoadSource) {
+		return source, fmt.Errorf("Unknown function %s in %s", name, expression)
+	}
+	if strings.ContainsAny(argument, "()/") {
+		return source, fmt.Errorf("Invalid innodb_metrics name in %s", expression)
+	}
+	return LoadSource{Type: InnodbMetricsLoadSource, Name: argument}, nil
+}
+
+func parseLoadValue(expression string) (value LoadValue, err error) {
+	expression = strings.TrimSpace(expression)
+	name, argument, ok, err := parseLoadFunction(expression)
+	if err != nil {
+		return value, err
+	}
+	if ok && name == "rate" {
+		value.Rate = true
+		expression = argument
+	}
+	value.Source, err = parseLoadSource(expression)
+	return value, err
+}
+
+// ParseLoadMetric parses the metric part of a load condition, which is one of:
+//   - `Status_variable`: value of a global status variable, e.g. `Threads_running`
+//   - `innodb_metrics(name)`: count of an information_schema.innodb_metrics counter, e.g. `innodb_metrics(trx_rseg_history_len)`
+//   - `rate(...)`: per-second rate of either of the above, e.g. `rate(Innodb_row_lock_waits)`
+//   - `pct(a/b)`: 100*a/b, where a, b are either of the above, e.g. `pct(rate(Innodb_buffer_pool_reads)/rate(Innodb_buffer_pool_read_requests))`
+func ParseLoadMetric(expression string) (metric *LoadMetric, err error) {
+	metric = &LoadMetric{}
+	name, argument, ok, err := parseLoadFunction(expression)
+	if err != nil {
+		return nil, err
+	}
+	if ok && name == "pct" {
+		operands := strings.Split(argument, "/")
+		if len(operands) != 2 {
+			return nil, fmt.Errorf("pct() expects two operands, as in pct(a/b). Got: %s", expression)
+		}
+		if metric.Numerator, err = parseLoadValue(operands[0]); err != nil {
+			return nil, err
+		}
+		denominator, err := parseLoadValue(operands[1])
+		if err != nil {
+			return nil, err
+		}
+		metric.Denominator = &denominator
+		return metric, nil
+	}
+	if metric.Numerator, err = parseLoadValue(expression); err != nil {
+		return nil, err
+	}
+	return metric, nil
+}
+
+// Sources lists the sources this metric reads
+func (this *LoadMetric) Sources() (sources []LoadSource) {
+	sources = append(sources, this.Numerator.Source)
+	if this.Denominator != nil {
+		sources = append(sources, this.Denominator.Source)
+	}
+	return sources
+}
+
+// loadSampleMinInterval: a sample taken sooner than this after the previous one replaces it, rather than
+// shift it out, such that rates are computed over a meaningful interval
+const loadSampleMinInterval = 500 * time.Millisecond
+
+type loadSample struct {
+	value int64
+	time  time.Time
+}
+
+// LoadSampler keeps the two most recent samples of load sources, from which rates are computed
+type LoadSampler struct {
+	previous map[LoadSource]loadSample
+	current  map[LoadSource]loadSample
+	mutex    *sync.Mutex
+}
+
+func NewLoadSampler() *LoadSampler {
+	return &LoadSampler{
+		previous: make(map[LoadSource]loadSample),
+		current:  make(map[LoadSource]loadSample),
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// Sample records a source's value as read at given time
+func (this *LoadSampler) Sample(source LoadSource, value int64, at time.Time) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if current, ok := this.current[source]; ok && at.Sub(current.time) >= loadSampleMinInterval {
+		this.previous[source] = current
+	}
+	this.current[source] = loadSample{value: value, time: at}
+}
+
+func (this *LoadSampler) evaluateValue(value LoadValue) (float64, error) {
+	current, ok := this.current[value.Source]
+	if !ok {
+		return 0, fmt.Errorf("%s %s was not sampled", value.Source.Type, value.Source.Name)
+	}
+	if !value.Rate {
+		return float64(current.value), nil
+	}
+	previous, ok := this.previous[value.Source]
+	if !ok || current.value < previous.value {
+		// 首次采样或计数器被重置：速率暂时按0计算
+		return 0, nil
+	}
+	elapsed := current.time.Sub(previous.time).Seconds()
+	if elapsed <= 0 {
+		return 0, nil
+	}
+	return float64(current.value-previous.value) / elapsed, nil
+}
+
+// Evaluate computes a metric's value based on sampled sources. Until a source has been sampled twice,
+// its rate evaluates as 0.
+func (this *LoadSampler) Evaluate(metric *LoadMetric) (int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	numerator, err := this.evaluateValue(metric.Numerator)
+	if err != nil {
+		return 0, err
+	}
+	if metric.Denominator == nil {
+		return int64(numerator), nil
+	}
+	denominator, err := this.evaluateValue(*metric.Denominator)
+	if err != nil {
+		return 0, err
+	}
+	if denominator == 0 {
+		return 0, nil
+	}
+	return int64(100 * numerator / denominator), nil
+}
@@ -7,6 +7,7 @@ package base
 
 import (
 	"testing"
+	"time"
 
 	"github.com/outbrain/golib/log"
 	test "github.com/outbrain/golib/tests"
@@ -41,6 +42,93 @@ func TestParseLoadMap(t *testing.T) {
 		_, err := ParseLoadMap(loadList)
 		test.S(t).ExpectNotNil(err)
 	}
+	{
+		loadList := "rate(Innodb_row_lock_waits)=50,pct(Threads_running/Threads_connected)=80,innodb_metrics(trx_rseg_history_len)=1000000"
+		m, err := ParseLoadMap(loadList)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(m), 3)
+		test.S(t).ExpectEquals(m["rate(Innodb_row_lock_waits)"], int64(50))
+		test.S(t).ExpectEquals(m["innodb_metrics(trx_rseg_history_len)"], int64(1000000))
+	}
+	{
+		loadList := "avg(Threads_running)=20"
+		_, err := ParseLoadMap(loadList)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestParseLoadMetric(t *testing.T) {
+	{
+		metric, err := ParseLoadMetric("Threads_running")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(metric.Numerator, LoadValue{Source: LoadSource{Type: StatusLoadSource, Name: "Threads_running"}})
+		test.S(t).ExpectTrue(metric.Denominator == nil)
+	}
+	{
+		metric, err := ParseLoadMetric("rate(Questions)")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(metric.Numerator, LoadValue{Source: LoadSource{Type: StatusLoadSource, Name: "Questions"}, Rate: true})
+	}
+	{
+		metric, err := ParseLoadMetric("rate(innodb_metrics(lock_timeouts))")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(metric.Numerator, LoadValue{Source: LoadSource{Type: InnodbMetricsLoadSource, Name: "lock_timeouts"}, Rate: true})
+	}
+	{
+		metric, err := ParseLoadMetric("pct(rate(Innodb_buffer_pool_reads)/rate(Innodb_buffer_pool_read_requests))")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(metric.Numerator, LoadValue{Source: LoadSource{Type: StatusLoadSource, Name: "Innodb_buffer_pool_reads"}, Rate: true})
+		test.S(t).ExpectEquals(*metric.Denominator, LoadValue{Source: LoadSource{Type: StatusLoadSource, Name: "Innodb_buffer_pool_read_requests"}, Rate: true})
+		test.S(t).ExpectEquals(len(metric.Sources()), 2)
+	}
+	for _, expression := range []string{"", "rate()", "rate(Questions", "Questions)", "pct(Threads_running)", "pct(a/b/c)", "rate(rate(Questions))", "rate(pct(a/b))", "max(Questions)", "a/b"} {
+		_, err := ParseLoadMetric(expression)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestLoadSampler(t *testing.T) {
+	sampler := NewLoadSampler()
+	questions := LoadSource{Type: StatusLoadSource, Name: "Questions"}
+	threadsConnected := LoadSource{Type: StatusLoadSource, Name: "Threads_connected"}
+	value, _ := ParseLoadMetric("Questions")
+	rate, _ := ParseLoadMetric("rate(Questions)")
+	pct, _ := ParseLoadMetric("pct(Questions/Threads_connected)")
+
+	_, err := sampler.Evaluate(value)
+	test.S(t).ExpectNotNil(err)
+
+	start := time.Now()
+	sampler.Sample(questions, 1000, start)
+	sampler.Sample(threadsConnected, 4000, start)
+	{
+		v, err := sampler.Evaluate(value)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(v, int64(1000))
+		v, err = sampler.Evaluate(rate)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(v, int64(0))
+		v, err = sampler.Evaluate(pct)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(v, int64(25))
+	}
+	// A sample taken too soon replaces the latest sample
+	sampler.Sample(questions, 1100, start.Add(100*time.Millisecond))
+	{
+		v, _ := sampler.Evaluate(rate)
+		test.S(t).ExpectEquals(v, int64(0))
+	}
+	sampler.Sample(questions, 3100, start.Add(2100*time.Millisecond))
+	{
+		v, _ := sampler.Evaluate(rate)
+		test.S(t).ExpectEquals(v, int64(1000))
+	}
+	// Counter reset
+	sampler.Sample(questions, 10, start.Add(3*time.Second))
+	{
+		v, _ := sampler.Evaluate(rate)
+		test.S(t).ExpectEquals(v, int64(0))
+	}
 }
 
 func TestString(t *testing.T) {
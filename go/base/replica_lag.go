@@ -0,0 +1,139 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gh-ost/go/mysql"
+	"gh-ost/go/sql"
+)
+
+// ReplicaLagSource is how replication lag is read on a throttle control replica
+type ReplicaLagSource string
+
+const (
+	// HeartbeatReplicaLagSource reads gh-ost's own heartbeat off the changelog table
+	HeartbeatReplicaLagSource ReplicaLagSource = "heartbeat"
+	// PtHeartbeatReplicaLagSource reads an existing pt-heartbeat table
+	PtHeartbeatReplicaLagSource ReplicaLagSource = "pt-heartbeat"
+	// SecondsBehindMasterReplicaLagSource reads Seconds_Behind_Master off SHOW SLAVE STATUS
+	SecondsBehindMasterReplicaLagSource ReplicaLagSource = "seconds-behind-master"
+	// QueryReplicaLagSource issues a custom query, returning lag in seconds
+	QueryReplicaLagSource ReplicaLagSource = "query"
+)
+
+// ReplicaLagConfig is a `[replica-lag "name"]` section of the config file
+type ReplicaLagConfig struct {
+	Match                  string
+	Source                 string
+	Query                  string
+	Pt_Heartbeat_Table     string
+	Pt_Heartbeat_Server_Id int64
+	Pt_Heartbeat_Utc       bool
+	Max_Lag_Millis         int64
+}
+
+// ReplicaLag determines how lag is read, and what lag is tolerated, on throttle control replicas matching it
+type ReplicaLag struct {
+	Name   string
+	Match  *regexp.Regexp
+	Source ReplicaLagSource
+	// Query is the query issued on the replica; for pt-heartbeat it is generated
+	Query string
+	// MaxLag overrides --max-lag-millis for matching replicas. Zero means --max-lag-millis applies
+	MaxLag time.Duration
+}
+
+// DefaultReplicaLag applies to throttle control replicas not matching any configured section
+var DefaultReplicaLag = &ReplicaLag{Name: "default", Source: HeartbeatReplicaLagSource}
+
+// NewReplicaLag validates a replica-lag config section
+func NewReplicaLag(name string, config *ReplicaLagConfig) (replicaLag *ReplicaLag, err error) {
+	replicaLag = &ReplicaLag{
+		Name:   name,
+		Source: ReplicaLagSource(config.Source),
+		MaxLag: time.Duration(config.Max_Lag_Millis) * time.Millisecond,
+	}
+	if config.Match != "" {
+		if replicaLag.Match, err = regexp.Compile(config.Match); err != nil {
+			return nil, fmt.Errorf("replica-lag %s: invalid match: %+v", name, err)
+		}
+	}
+	if config.Max_Lag_Millis < 0 {
+		return nil, fmt.Errorf("replica-lag %s: max-lag-millis must not be negative", name)
+	}
+	if replicaLag.Source == "" {
+		replicaLag.Source = HeartbeatReplicaLagSource
+	}
+	if config.Query != "" && replicaLag.Source != QueryReplicaLagSource {
+		return nil, fmt.Errorf("replica-lag %s: query requires source=%s", name, QueryReplicaLagSource)
+	}
+	if config.Pt_Heartbeat_Table != "" && replicaLag.Source != PtHeartbeatReplicaLagSource {
+		return nil, fmt.Errorf("replica-lag %s: pt-heartbeat-table requires source=%s", name, PtHeartbeatReplicaLagSource)
+	}
+	switch replicaLag.Source {
+	case HeartbeatReplicaLagSource, SecondsBehindMasterReplicaLagSource:
+	case QueryReplicaLagSource:
+		if config.Query == "" {
+			return nil, fmt.Errorf("replica-lag %s: source=%s requires query", name, QueryReplicaLagSource)
+		}
+		replicaLag.Query = config.Query
+	case PtHeartbeatReplicaLagSource:
+		tokens := strings.Split(config.Pt_Heartbeat_Table, ".")
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return nil, fmt.Errorf("replica-lag %s: source=%s requires pt-heartbeat-table as schema.table. Got: %q", name, PtHeartbeatReplicaLagSource, config.Pt_Heartbeat_Table)
+		}
+		now := "now(6)"
+		if config.Pt_Heartbeat_Utc {
+			now = "utc_timestamp(6)"
+		}
+		where := ""
+		if config.Pt_Heartbeat_Server_Id > 0 {
+			where = fmt.Sprintf(" where server_id = %d", config.Pt_Heartbeat_Server_Id)
+		}
+		replicaLag.Query = fmt.Sprintf(`select /* gh-ost */ timestampdiff(microsecond, max(ts), %s) / 1000000 from %s.%s%s`,
+			now, sql.EscapeName(tokens[0]), sql.EscapeName(tokens[1]), where,
+		)
+	default:
+		return nil, fmt.Errorf("replica-lag %s: unknown source %q. Expected one of: %s, %s, %s, %s", name, replicaLag.Source,
+			HeartbeatReplicaLagSource, PtHeartbeatReplicaLagSource, SecondsBehindMasterReplicaLagSource, QueryReplicaLagSource,
+		)
+	}
+	return replicaLag, nil
+}
+
+// Matches checks whether this section applies to given replica. A section with no match applies to all replicas.
+func (this *ReplicaLag) Matches(key mysql.InstanceKey) bool {
+	return this.Match == nil || this.Match.MatchString(key.DisplayString())
+}
+
+// readReplicaLags builds replica-lag sections out of the config file. Sections with a match come first, ordered
+// by name, followed by catch-all sections.
+func readReplicaLags(configs map[string]*ReplicaLagConfig) (replicaLags []*ReplicaLag, err error) {
+	names := []string{}
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	catchAll := []*ReplicaLag{}
+	for _, name := range names {
+		replicaLag, err := NewReplicaLag(name, configs[name])
+		if err != nil {
+			return replicaLags, err
+		}
+		if replicaLag.Match == nil {
+			catchAll = append(catchAll, replicaLag)
+		} else {
+			replicaLags = append(replicaLags, replicaLag)
+		}
+	}
+	return append(replicaLags, catchAll...), nil
+}
@@ -0,0 +1,137 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gh-ost/go/mysql"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestNewReplicaLag(t *testing.T) {
+	{
+		replicaLag, err := NewReplicaLag("defaults", &ReplicaLagConfig{})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(replicaLag.Source, HeartbeatReplicaLagSource)
+		test.S(t).ExpectEquals(replicaLag.MaxLag, time.Duration(0))
+		test.S(t).ExpectTrue(replicaLag.Matches(mysql.InstanceKey{Hostname: "any", Port: 3306}))
+	}
+	{
+		replicaLag, err := NewReplicaLag("analytics", &ReplicaLagConfig{Match: "^analytics-", Source: "seconds-behind-master", Max_Lag_Millis: 30000})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(replicaLag.MaxLag, 30*time.Second)
+		test.S(t).ExpectTrue(replicaLag.Matches(mysql.InstanceKey{Hostname: "analytics-1", Port: 3306}))
+		test.S(t).ExpectFalse(replicaLag.Matches(mysql.InstanceKey{Hostname: "db-1", Port: 3306}))
+	}
+	{
+		replicaLag, err := NewReplicaLag("pt", &ReplicaLagConfig{Source: "pt-heartbeat", Pt_Heartbeat_Table: "percona.heartbeat", Pt_Heartbeat_Server_Id: 7, Pt_Heartbeat_Utc: true})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(replicaLag.Query, "select /* gh-ost */ timestampdiff(microsecond, max(ts), utc_timestamp(6)) / 1000000 from `percona`.`heartbeat` where server_id = 7")
+	}
+	{
+		replicaLag, err := NewReplicaLag("custom", &ReplicaLagConfig{Source: "query", Query: "select lag_seconds from meta.lag"})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(replicaLag.Query, "select lag_seconds from meta.lag")
+	}
+	{
+		_, err := NewReplicaLag("bad", &ReplicaLagConfig{Source: "ping"})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewReplicaLag("bad", &ReplicaLagConfig{Source: "query"})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewReplicaLag("bad", &ReplicaLagConfig{Query: "select 1"})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewReplicaLag("bad", &ReplicaLagConfig{Source: "pt-heartbeat", Pt_Heartbeat_Table: "heartbeat"})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewReplicaLag("bad", &ReplicaLagConfig{Match: "("})
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestReadConfigFileReplicaLags(t *testing.T) {
+	f, err := ioutil.TempFile("", "gh-ost-conf")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(f.Name())
+	f.WriteString(`
+[replica-lag "all"]
+source=seconds-behind-master
+
+[replica-lag "reports"]
+match=^reports-
+source=query
+query=select 1.5
+
+[replica-lag "analytics"]
+match=^analytics-
+max-lag-millis=60000
+`)
+	f.Close()
+
+	context := NewMigrationContext()
+	test.S(t).ExpectEquals(context.GetReplicaLag(mysql.InstanceKey{Hostname: "db-1", Port: 3306}), DefaultReplicaLag)
+
+	context.ConfigFile = f.Name()
+	test.S(t).ExpectNil(context.ReadConfigFile())
+	{
+		replicaLag := context.GetReplicaLag(mysql.InstanceKey{Hostname: "analytics-1", Port: 3306})
+		test.S(t).ExpectEquals(replicaLag.Name, "analytics")
+		test.S(t).ExpectEquals(replicaLag.Source, HeartbeatReplicaLagSource)
+		test.S(t).ExpectEquals(replicaLag.MaxLag, time.Minute)
+	}
+	{
+		replicaLag := context.GetReplicaLag(mysql.InstanceKey{Hostname: "reports-1", Port: 3306})
+		test.S(t).ExpectEquals(replicaLag.Name, "reports")
+		test.S(t).ExpectEquals(replicaLag.Query, "select 1.5")
+	}
+	{
+		// Catch-all sections apply last, regardless of name
+		replicaLag := context.GetReplicaLag(mysql.InstanceKey{Hostname: "db-1", Port: 3306})
+		test.S(t).ExpectEquals(replicaLag.Name, "all")
+		test.S(t).ExpectEquals(replicaLag.Source, SecondsBehindMasterReplicaLagSource)
+	}
+}
+
+func TestReadConfigFileReplicaLagsFailedReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "gh-ost-conf")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(f.Name())
+	f.WriteString(`
+[replica-lag "analytics"]
+match=^analytics-
+max-lag-millis=60000
+`)
+	f.Close()
+
+	context := NewMigrationContext()
+	context.ConfigFile = f.Name()
+	test.S(t).ExpectNil(context.ReadConfigFile())
+
+	// Neither the webhook nor the replica-lag sections of a failed reload take effect
+	test.S(t).ExpectNil(ioutil.WriteFile(f.Name(), []byte(`
+[webhook "notify"]
+url=https://example.com/notify
+
+[replica-lag "analytics"]
+match=(
+`), 0644))
+	test.S(t).ExpectNotNil(context.ReadConfigFile())
+	test.S(t).ExpectEquals(len(context.GetWebhooks()), 0)
+	replicaLag := context.GetReplicaLag(mysql.InstanceKey{Hostname: "analytics-1", Port: 3306})
+	test.S(t).ExpectEquals(replicaLag.Name, "analytics")
+	test.S(t).ExpectEquals(replicaLag.MaxLag, time.Minute)
+}
@@ -0,0 +1,211 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/outbrain/golib/log"
+)
+
+// ServerRole determines which interactive commands a caller may issue
+type ServerRole string
+
+const (
+	// ReadOnlyServerRole may only issue commands which do not change the migration, e.g. `status`, `max-load=?`
+	ReadOnlyServerRole ServerRole = "read-only"
+	// AdminServerRole may issue any command
+	AdminServerRole ServerRole = "admin"
+)
+
+// ParseServerRole reads a role name
+func ParseServerRole(role string) (ServerRole, error) {
+	switch ServerRole(role) {
+	case ReadOnlyServerRole, AdminServerRole:
+		return ServerRole(role), nil
+	}
+	return "", fmt.Errorf("Unknown role: %q. Expected one of: %s, %s", role, ReadOnlyServerRole, AdminServerRole)
+}
+
+// ServerCaller identifies whoever issued an interactive command
+type ServerCaller struct {
+	Identity string
+	Role     ServerRole
+	Remote   string
+}
+
+// CanMutate returns true when the caller may issue commands which change the migration
+func (this *ServerCaller) CanMutate() bool {
+	return this.Role == AdminServerRole
+}
+
+// NewUnixSocketCaller returns the caller on a unix socket file. Callers are admins when only the socket file's
+// owner may connect; when the group or others may write to it, callers are read-only unless they authenticate.
+func NewUnixSocketCaller(socketFile string) *ServerCaller {
+	caller := &ServerCaller{Identity: "unix-socket", Role: ReadOnlyServerRole, Remote: socketFile}
+	fileInfo, err := os.Stat(socketFile)
+	if err != nil {
+		log.Warningf("Cannot stat socket file %s: %+v. Treating callers as %s", socketFile, err, ReadOnlyServerRole)
+		return caller
+	}
+	if fileInfo.Mode().Perm()&0022 == 0 {
+		caller.Role = AdminServerRole
+	}
+	return caller
+}
+
+func (this *ServerCaller) String() string {
+	return fmt.Sprintf("identity=%s role=%s remote=%s", this.Identity, this.Role, this.Remote)
+}
+
+type serverToken struct {
+	identity string
+	role     ServerRole
+	token    string
+}
+
+// ServerAuth authenticates callers on the interactive TCP port, either by token or by TLS client certificate
+type ServerAuth struct {
+	tokens     []serverToken
+	adminNames map[string]bool
+	// TLSConfig is non-nil when the TCP port serves TLS
+	TLSConfig *tls.Config
+}
+
+// readServerTokens parses tokens file content. Each non-empty, non-comment line reads
+// `<identity> <role> <token>`. Like credentials, a token may be given as "${SOME_ENV_VARIABLE}"
+func readServerTokens(content string) (tokens []serverToken, err error) {
+	identities := make(map[string]bool)
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tokens line %d: expected `<identity> <role> <token>`", i+1)
+		}
+		role, err := ParseServerRole(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("tokens line %d: %+v", i+1, err)
+		}
+		token := fields[2]
+		if submatch := envVariableRegexp.FindStringSubmatch(token); len(submatch) > 1 {
+			token = os.Getenv(submatch[1])
+		}
+		if token == "" {
+			return nil, fmt.Errorf("tokens line %d: empty token for %s", i+1, fields[0])
+		}
+		if identities[fields[0]] {
+			return nil, fmt.Errorf("tokens line %d: duplicate identity %s", i+1, fields[0])
+		}
+		identities[fields[0]] = true
+		tokens = append(tokens, serverToken{identity: fields[0], role: role, token: token})
+	}
+	return tokens, nil
+}
+
+// NewServerAuth reads tokens file and TLS settings of the interactive TCP port.
+// It returns nil when neither tokens nor TLS are configured, i.e. when the port is unauthenticated.
+func NewServerAuth(tokensFile, certFile, keyFile, caFile, adminNames string) (*ServerAuth, error) {
+	if tokensFile == "" && certFile == "" && keyFile == "" && caFile == "" {
+		if adminNames != "" {
+			return nil, fmt.Errorf("--serve-tcp-tls-admin-names requires --serve-tcp-tls-ca")
+		}
+		return nil, nil
+	}
+	auth := &ServerAuth{adminNames: make(map[string]bool)}
+	if tokensFile != "" {
+		fileInfo, err := os.Stat(tokensFile)
+		if err != nil {
+			return nil, err
+		}
+		if fileInfo.Mode().Perm()&0077 != 0 {
+			log.Warningf("--serve-tcp-tokens-file %s is accessible by group or others. Consider: chmod 600 %s", tokensFile, tokensFile)
+		}
+		content, err := ioutil.ReadFile(tokensFile)
+		if err != nil {
+			return nil, err
+		}
+		if auth.tokens, err = readServerTokens(string(content)); err != nil {
+			return nil, fmt.Errorf("%s: %+v", tokensFile, err)
+		}
+		if len(auth.tokens) == 0 {
+			return nil, fmt.Errorf("%s: no tokens found", tokensFile)
+		}
+	}
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return auth, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("--serve-tcp-tls-cert and --serve-tcp-tls-key must be provided together")
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load serve-tcp TLS certificate: %+v", err)
+	}
+	auth.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		caContent, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caContent) {
+			return nil, fmt.Errorf("No certificates found in --serve-tcp-tls-ca %s", caFile)
+		}
+		auth.TLSConfig.ClientCAs = clientCAs
+		// 同时配置了令牌时，客户端证书可选
+		auth.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if len(auth.tokens) > 0 {
+			auth.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	} else if adminNames != "" {
+		return nil, fmt.Errorf("--serve-tcp-tls-admin-names requires --serve-tcp-tls-ca")
+	}
+	for _, name := range strings.Split(adminNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			auth.adminNames[name] = true
+		}
+	}
+	return auth, nil
+}
+
+// RequiresAuthentication returns true when callers must present a token or a client certificate
+func (this *ServerAuth) RequiresAuthentication() bool {
+	return len(this.tokens) > 0 || (this.TLSConfig != nil && this.TLSConfig.ClientCAs != nil)
+}
+
+// AuthenticateToken returns the caller holding given token, or nil when the token is unknown
+func (this *ServerAuth) AuthenticateToken(token string) *ServerCaller {
+	var caller *ServerCaller
+	// 逐个比较全部令牌，避免通过耗时推测令牌
+	for _, serverToken := range this.tokens {
+		if subtle.ConstantTimeCompare([]byte(serverToken.token), []byte(token)) == 1 {
+			caller = &ServerCaller{Identity: serverToken.identity, Role: serverToken.role}
+		}
+	}
+	return caller
+}
+
+// AuthenticateCertificate returns the caller for a verified client certificate. The certificate's
+// common name is the caller's identity, and is an admin if listed in --serve-tcp-tls-admin-names
+func (this *ServerAuth) AuthenticateCertificate(certificate *x509.Certificate) *ServerCaller {
+	caller := &ServerCaller{Identity: certificate.Subject.CommonName, Role: ReadOnlyServerRole}
+	if this.adminNames[caller.Identity] {
+		caller.Role = AdminServerRole
+	}
+	return caller
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestReadServerTokens(t *testing.T) {
+	{
+		os.Setenv("GH_OST_TEST_SERVER_TOKEN", "env-secret")
+		defer os.Unsetenv("GH_OST_TEST_SERVER_TOKEN")
+		tokens, err := readServerTokens(`
+# identity role token
+alice admin s3cret
+  monitoring   read-only   ${GH_OST_TEST_SERVER_TOKEN}
+`)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(tokens), 2)
+		test.S(t).ExpectEquals(tokens[0].identity, "alice")
+		test.S(t).ExpectEquals(tokens[0].role, AdminServerRole)
+		test.S(t).ExpectEquals(tokens[0].token, "s3cret")
+		test.S(t).ExpectEquals(tokens[1].identity, "monitoring")
+		test.S(t).ExpectEquals(tokens[1].role, ReadOnlyServerRole)
+		test.S(t).ExpectEquals(tokens[1].token, "env-secret")
+	}
+	{
+		_, err := readServerTokens("alice s3cret")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := readServerTokens("alice root s3cret")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := readServerTokens("alice admin ${GH_OST_TEST_UNDEFINED_TOKEN}")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := readServerTokens("alice admin s3cret\nalice read-only other")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestNewServerAuth(t *testing.T) {
+	{
+		auth, err := NewServerAuth("", "", "", "", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(auth == nil)
+	}
+	{
+		_, err := NewServerAuth("", "", "", "", "alice")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := NewServerAuth("", "/tmp/cert.pem", "", "", "")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		tokensFile, err := ioutil.TempFile("", "gh-ost-tokens")
+		test.S(t).ExpectNil(err)
+		defer os.Remove(tokensFile.Name())
+		tokensFile.WriteString("alice admin s3cret\nmonitoring read-only m0n\n")
+		tokensFile.Close()
+
+		auth, err := NewServerAuth(tokensFile.Name(), "", "", "", "")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(auth.RequiresAuthentication())
+		test.S(t).ExpectTrue(auth.TLSConfig == nil)
+
+		caller := auth.AuthenticateToken("s3cret")
+		test.S(t).ExpectEquals(caller.Identity, "alice")
+		test.S(t).ExpectTrue(caller.CanMutate())
+
+		caller = auth.AuthenticateToken("m0n")
+		test.S(t).ExpectEquals(caller.Identity, "monitoring")
+		test.S(t).ExpectFalse(caller.CanMutate())
+
+		test.S(t).ExpectTrue(auth.AuthenticateToken("s3cre") == nil)
+		test.S(t).ExpectTrue(auth.AuthenticateToken("") == nil)
+	}
+}
+
+func TestAuthenticateCertificate(t *testing.T) {
+	auth := &ServerAuth{adminNames: map[string]bool{"dba": true}}
+	{
+		caller := auth.AuthenticateCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "dba"}})
+		test.S(t).ExpectEquals(caller.Identity, "dba")
+		test.S(t).ExpectEquals(caller.Role, AdminServerRole)
+	}
+	{
+		caller := auth.AuthenticateCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "dashboard"}})
+		test.S(t).ExpectEquals(caller.Identity, "dashboard")
+		test.S(t).ExpectEquals(caller.Role, ReadOnlyServerRole)
+	}
+}
+
+func TestNewUnixSocketCaller(t *testing.T) {
+	f, err := ioutil.TempFile("", "gh-ost-test-socket")
+	test.S(t).ExpectNil(err)
+	f.Close()
+	defer os.Remove(f.Name())
+	{
+		test.S(t).ExpectNil(os.Chmod(f.Name(), 0600))
+		caller := NewUnixSocketCaller(f.Name())
+		test.S(t).ExpectEquals(caller.Role, AdminServerRole)
+		test.S(t).ExpectEquals(caller.Remote, f.Name())
+	}
+	{
+		test.S(t).ExpectNil(os.Chmod(f.Name(), 0755))
+		test.S(t).ExpectEquals(NewUnixSocketCaller(f.Name()).Role, AdminServerRole)
+	}
+	{
+		test.S(t).ExpectNil(os.Chmod(f.Name(), 0660))
+		test.S(t).ExpectEquals(NewUnixSocketCaller(f.Name()).Role, ReadOnlyServerRole)
+	}
+	{
+		test.S(t).ExpectNil(os.Chmod(f.Name(), 0777))
+		test.S(t).ExpectEquals(NewUnixSocketCaller(f.Name()).Role, ReadOnlyServerRole)
+	}
+	{
+		test.S(t).ExpectEquals(NewUnixSocketCaller("/tmp/gh-ost-test-no-such-socket").Role, ReadOnlyServerRole)
+	}
+}
@@ -0,0 +1,356 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// spillRecordHeaderSize is the size of a record's header: 4 bytes length followed by 4 bytes crc32 of the data
+const spillRecordHeaderSize = 8
+
+// SpillOffset is a position within a SpillQueue: a segment file and a byte offset within that file
+type SpillOffset struct {
+	Segment int64
+	Offset  int64
+}
+
+func (this SpillOffset) String() string {
+	return fmt.Sprintf("%d:%d", this.Segment, this.Offset)
+}
+
+// ParseSpillOffset parses an offset in the form returned by String(), e.g. `3:1024`
+func ParseSpillOffset(offset string) (spillOffset SpillOffset, err error) {
+	if _, err := fmt.Sscanf(offset, "%d:%d", &spillOffset.Segment, &spillOffset.Offset); err != nil {
+		return spillOffset, fmt.Errorf("Cannot parse spill offset %q: %+v", offset, err)
+	}
+	return spillOffset, nil
+}
+
+// SpillQueue is a disk backed FIFO queue of records. Records are appended to segment files of about
+// segmentSize bytes each; a segment file is removed once all of its records are read. Read and write offsets
+// are persisted in an offsets file as segments change and upon Close(), such that a closed queue may be opened
+// again. A SpillQueue is safe for use by one writer and one reader concurrently.
+type SpillQueue struct {
+	dir         string
+	prefix      string
+	segmentSize int64
+	mutex       *sync.Mutex
+
+	writeOffset SpillOffset
+	writeFile   *os.File
+	writer      *bufio.Writer
+
+	readOffset SpillOffset
+	readFile   *os.File
+	reader     *bufio.Reader
+
+	records int64
+	size    int64
+}
+
+// NewSpillQueue opens the queue whose segment files are named <prefix>.<segment>.spill in given directory.
+// A queue previously closed in that directory is opened again, with its records; otherwise the queue is empty.
+func NewSpillQueue(dir string, prefix string, segmentSize int64) (*SpillQueue, error) {
+	queue := &SpillQueue{
+		dir:         dir,
+		prefix:      prefix,
+		segmentSize: segmentSize,
+		mutex:       &sync.Mutex{},
+	}
+	readOffset := SpillOffset{Segment: 1}
+	writeOffset := SpillOffset{Segment: 1}
+	if FileExists(queue.OffsetsFileName()) {
+		var err error
+		if readOffset, writeOffset, err = queue.readOffsets(); err != nil {
+			return nil, err
+		}
+		if writeOffset.Offset, err = queue.scanRecords(readOffset, writeOffset.Segment); err != nil {
+			return nil, err
+		}
+	}
+	if err := queue.openWriteSegment(writeOffset.Segment); err != nil {
+		return nil, err
+	}
+	if err := queue.openReadSegment(readOffset); err != nil {
+		queue.writeFile.Close()
+		return nil, err
+	}
+	if err := queue.writeOffsets(); err != nil {
+		queue.writeFile.Close()
+		queue.readFile.Close()
+		return nil, err
+	}
+	return queue, nil
+}
+
+// SpillQueueExists returns true when given directory holds a queue by given prefix, e.g. left by a previous run
+func SpillQueueExists(dir string, prefix string) bool {
+	queue := &SpillQueue{dir: dir, prefix: prefix}
+	return FileExists(queue.OffsetsFileName())
+}
+
+// SegmentFileName returns the file name of given segment
+func (this *SpillQueue) SegmentFileName(segment int64) string {
+	return filepath.Join(this.dir, fmt.Sprintf("%s.%06d.spill", this.prefix, segment))
+}
+
+// OffsetsFileName returns the name of the file where read and write offsets are persisted
+func (this *SpillQueue) OffsetsFileName() string {
+	return filepath.Join(this.dir, fmt.Sprintf("%s.offsets", this.prefix))
+}
+
+// readOffsets reads persisted read and write offsets
+func (this *SpillQueue) readOffsets() (readOffset SpillOffset, writeOffset SpillOffset, err error) {
+	content, err := ioutil.ReadFile(this.OffsetsFileName())
+	if err != nil {
+		return readOffset, writeOffset, err
+	}
+	tokens := strings.Fields(string(content))
+	if len(tokens) != 2 {
+		return readOffset, writeOffset, fmt.Errorf("Cannot parse spill offsets file %s: %q", this.OffsetsFileName(), string(content))
+	}
+	if readOffset, err = ParseSpillOffset(tokens[0]); err != nil {
+		return readOffset, writeOffset, err
+	}
+	if writeOffset, err = ParseSpillOffset(tokens[1]); err != nil {
+		return readOffset, writeOffset, err
+	}
+	if readOffset.Segment > writeOffset.Segment {
+		return readOffset, writeOffset, fmt.Errorf("Invalid spill offsets in %s: read offset %s is past write offset %s", this.OffsetsFileName(), readOffset, writeOffset)
+	}
+	return readOffset, writeOffset, nil
+}
+
+// writeOffsets persists read and write offsets. The file is replaced atomically.
+func (this *SpillQueue) writeOffsets() error {
+	fileName := this.OffsetsFileName()
+	content := fmt.Sprintf("%s %s\n", this.readOffset, this.writeOffset)
+	if err := ioutil.WriteFile(fileName+".tmp", []byte(content), 0600); err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+// scanRecords counts the records of a reopened queue, from given read offset through the last segment, and
+// returns the offset at which the last segment ends. A record cut short at the end of the last segment, as by
+// a crash while writing, is truncated away.
+func (this *SpillQueue) scanRecords(readOffset SpillOffset, lastSegment int64) (endOffset int64, err error) {
+	for segment := readOffset.Segment; segment <= lastSegment; segment++ {
+		startOffset := int64(0)
+		if segment == readOffset.Segment {
+			startOffset = readOffset.Offset
+		}
+		if endOffset, err = this.scanSegment(segment, startOffset, segment == lastSegment); err != nil {
+			return endOffset, err
+		}
+	}
+	return endOffset, nil
+}
+
+func (this *SpillQueue) scanSegment(segment int64, offset int64, isLastSegment bool) (endOffset int64, err error) {
+	file, err := os.OpenFile(this.SegmentFileName(segment), os.O_RDWR, 0)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return offset, err
+	}
+	for offset < fileInfo.Size() {
+		var header [spillRecordHeaderSize]byte
+		recordSize := int64(-1)
+		if _, err := file.ReadAt(header[:], offset); err == nil {
+			recordSize = int64(spillRecordHeaderSize) + int64(binary.LittleEndian.Uint32(header[0:4]))
+		}
+		if recordSize < 0 || offset+recordSize > fileInfo.Size() {
+			if !isLastSegment {
+				return offset, fmt.Errorf("Spill segment %s is cut short at offset %d", this.SegmentFileName(segment), offset)
+			}
+			return offset, file.Truncate(offset)
+		}
+		offset += recordSize
+		this.records++
+		this.size += recordSize
+	}
+	return offset, nil
+}
+
+// openWriteSegment opens a segment for append, creating it if needed
+func (this *SpillQueue) openWriteSegment(segment int64) (err error) {
+	if this.writeFile, err = os.OpenFile(this.SegmentFileName(segment), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return err
+	}
+	fileInfo, err := this.writeFile.Stat()
+	if err != nil {
+		this.writeFile.Close()
+		return err
+	}
+	this.writer = bufio.NewWriter(this.writeFile)
+	this.writeOffset = SpillOffset{Segment: segment, Offset: fileInfo.Size()}
+	return nil
+}
+
+// openReadSegment opens a segment for reading, at given offset
+func (this *SpillQueue) openReadSegment(readOffset SpillOffset) (err error) {
+	if this.readFile, err = os.Open(this.SegmentFileName(readOffset.Segment)); err != nil {
+		return err
+	}
+	if _, err = this.readFile.Seek(readOffset.Offset, io.SeekStart); err != nil {
+		this.readFile.Close()
+		return err
+	}
+	this.reader = bufio.NewReader(this.readFile)
+	this.readOffset = readOffset
+	return nil
+}
+
+// Push appends a record to the queue
+func (this *SpillQueue) Push(record []byte) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.writeOffset.Offset >= this.segmentSize {
+		if err := this.writer.Flush(); err != nil {
+			return err
+		}
+		if err := this.writeFile.Close(); err != nil {
+			return err
+		}
+		if err := this.openWriteSegment(this.writeOffset.Segment + 1); err != nil {
+			return err
+		}
+		if err := this.writeOffsets(); err != nil {
+			return err
+		}
+	}
+	var header [spillRecordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(record)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(record))
+	if _, err := this.writer.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := this.writer.Write(record); err != nil {
+		return err
+	}
+	recordSize := int64(spillRecordHeaderSize + len(record))
+	this.writeOffset.Offset += recordSize
+	this.records++
+	this.size += recordSize
+	return nil
+}
+
+// Pop removes and returns the first record in the queue. It returns nil when the queue is empty.
+func (this *SpillQueue) Pop() (record []byte, err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.records == 0 {
+		return nil, nil
+	}
+	if this.readOffset.Segment < this.writeOffset.Segment {
+		if _, err := this.reader.Peek(1); err == io.EOF {
+			// Done reading this segment; the writer has moved on to a next one. The segment is removed
+			// once the offsets no longer refer to it.
+			this.readFile.Close()
+			doneSegment := this.readOffset.Segment
+			if err := this.openReadSegment(SpillOffset{Segment: doneSegment + 1}); err != nil {
+				return nil, err
+			}
+			if err := this.writeOffsets(); err != nil {
+				return nil, err
+			}
+			os.Remove(this.SegmentFileName(doneSegment))
+		}
+	}
+	if this.readOffset.Segment == this.writeOffset.Segment {
+		// The record may yet be buffered
+		if err := this.writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	var header [spillRecordHeaderSize]byte
+	if _, err := io.ReadFull(this.reader, header[:]); err != nil {
+		return nil, fmt.Errorf("Error reading spill record at %s: %+v", this.readOffset, err)
+	}
+	record = make([]byte, binary.LittleEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(this.reader, record); err != nil {
+		return nil, fmt.Errorf("Error reading spill record at %s: %+v", this.readOffset, err)
+	}
+	if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("Checksum mismatch on spill record at %s", this.readOffset)
+	}
+	recordSize := int64(spillRecordHeaderSize + len(record))
+	this.readOffset.Offset += recordSize
+	this.records--
+	this.size -= recordSize
+	return record, nil
+}
+
+// Len returns the number of records in the queue
+func (this *SpillQueue) Len() int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.records
+}
+
+// Size returns the number of bytes the queue's records take on disk
+func (this *SpillQueue) Size() int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.size
+}
+
+// Offsets returns the read and write positions of the queue
+func (this *SpillQueue) Offsets() (readOffset SpillOffset, writeOffset SpillOffset) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.readOffset, this.writeOffset
+}
+
+// Close flushes pending records, persists the read and write offsets and closes the queue. Segment files
+// are kept, such that the queue may be opened again.
+func (this *SpillQueue) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	defer this.readFile.Close()
+	defer this.writeFile.Close()
+	if err := this.writer.Flush(); err != nil {
+		return err
+	}
+	return this.writeOffsets()
+}
+
+// Remove closes the queue and removes its segment files and offsets file
+func (this *SpillQueue) Remove() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.readFile.Close()
+	this.writeFile.Close()
+	for segment := this.readOffset.Segment; segment <= this.writeOffset.Segment; segment++ {
+		if err := os.Remove(this.SegmentFileName(segment)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(this.OffsetsFileName()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	this.records = 0
+	this.size = 0
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestSpillQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gh-ost-spill-test")
+	test.S(t).ExpectNil(err)
+	defer os.RemoveAll(dir)
+
+	queue, err := NewSpillQueue(dir, "test", 64)
+	test.S(t).ExpectNil(err)
+	{
+		record, err := queue.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(record == nil)
+	}
+	for i := 0; i < 20; i++ {
+		test.S(t).ExpectNil(queue.Push([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	test.S(t).ExpectEquals(queue.Len(), int64(20))
+	readOffset, writeOffset := queue.Offsets()
+	test.S(t).ExpectEquals(readOffset.Segment, int64(1))
+	test.S(t).ExpectTrue(writeOffset.Segment > 1)
+
+	for i := 0; i < 15; i++ {
+		record, err := queue.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(record), fmt.Sprintf("record-%d", i))
+	}
+	// Consumed segments are removed
+	test.S(t).ExpectFalse(FileExists(queue.SegmentFileName(1)))
+
+	// Interleaved writes and reads
+	for i := 20; i < 40; i++ {
+		test.S(t).ExpectNil(queue.Push([]byte(fmt.Sprintf("record-%d", i))))
+		record, err := queue.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(record), fmt.Sprintf("record-%d", i-5))
+	}
+	test.S(t).ExpectEquals(queue.Len(), int64(5))
+	test.S(t).ExpectEquals(queue.Size(), int64(5*(spillRecordHeaderSize+len("record-35"))))
+
+	_, writeOffset = queue.Offsets()
+	test.S(t).ExpectNil(queue.Remove())
+	test.S(t).ExpectFalse(FileExists(queue.SegmentFileName(writeOffset.Segment)))
+	test.S(t).ExpectFalse(FileExists(queue.OffsetsFileName()))
+	test.S(t).ExpectFalse(SpillQueueExists(dir, "test"))
+}
+
+func TestSpillQueueReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gh-ost-spill-test")
+	test.S(t).ExpectNil(err)
+	defer os.RemoveAll(dir)
+
+	queue, err := NewSpillQueue(dir, "test", 64)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(SpillQueueExists(dir, "test"))
+	for i := 0; i < 20; i++ {
+		test.S(t).ExpectNil(queue.Push([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	for i := 0; i < 7; i++ {
+		_, err := queue.Pop()
+		test.S(t).ExpectNil(err)
+	}
+	readOffset, writeOffset := queue.Offsets()
+	test.S(t).ExpectNil(queue.Close())
+	// Segments are kept upon Close()
+	test.S(t).ExpectTrue(FileExists(queue.SegmentFileName(readOffset.Segment)))
+	test.S(t).ExpectTrue(FileExists(queue.SegmentFileName(writeOffset.Segment)))
+
+	queue, err = NewSpillQueue(dir, "test", 64)
+	test.S(t).ExpectNil(err)
+	defer queue.Remove()
+	reopenedReadOffset, reopenedWriteOffset := queue.Offsets()
+	test.S(t).ExpectEquals(reopenedReadOffset, readOffset)
+	test.S(t).ExpectEquals(reopenedWriteOffset, writeOffset)
+	test.S(t).ExpectEquals(queue.Len(), int64(13))
+
+	// New records are appended to the existing segment, rather than overwrite it
+	test.S(t).ExpectNil(queue.Push([]byte("record-20")))
+	for i := 7; i <= 20; i++ {
+		record, err := queue.Pop()
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(string(record), fmt.Sprintf("record-%d", i))
+	}
+	test.S(t).ExpectEquals(queue.Len(), int64(0))
+}
+
+func TestSpillQueueReopenTruncatedRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gh-ost-spill-test")
+	test.S(t).ExpectNil(err)
+	defer os.RemoveAll(dir)
+
+	queue, err := NewSpillQueue(dir, "test", 1024)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectNil(queue.Push([]byte("abcdef")))
+	test.S(t).ExpectNil(queue.Push([]byte("ghijkl")))
+	test.S(t).ExpectNil(queue.Close())
+
+	// A record cut short, as by a crash while writing
+	fileName := queue.SegmentFileName(1)
+	test.S(t).ExpectNil(os.Truncate(fileName, int64(2*spillRecordHeaderSize+len("abcdef")+3)))
+
+	queue, err = NewSpillQueue(dir, "test", 1024)
+	test.S(t).ExpectNil(err)
+	defer queue.Remove()
+	test.S(t).ExpectEquals(queue.Len(), int64(1))
+	_, writeOffset := queue.Offsets()
+	test.S(t).ExpectEquals(writeOffset.Offset, int64(spillRecordHeaderSize+len("abcdef")))
+	record, err := queue.Pop()
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(string(record), "abcdef")
+}
+
+func TestParseSpillOffset(t *testing.T) {
+	{
+		offset, err := ParseSpillOffset("3:1024")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(offset, SpillOffset{Segment: 3, Offset: 1024})
+		test.S(t).ExpectEquals(offset.String(), "3:1024")
+	}
+	{
+		_, err := ParseSpillOffset("3")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestSpillQueueChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gh-ost-spill-test")
+	test.S(t).ExpectNil(err)
+	defer os.RemoveAll(dir)
+
+	queue, err := NewSpillQueue(dir, "test", 1024)
+	test.S(t).ExpectNil(err)
+	defer queue.Remove()
+	test.S(t).ExpectNil(queue.Push([]byte("abcdef")))
+	queue.writer.Flush()
+
+	file, err := os.OpenFile(queue.SegmentFileName(1), os.O_WRONLY, 0)
+	test.S(t).ExpectNil(err)
+	_, err = file.WriteAt([]byte("x"), spillRecordHeaderSize)
+	test.S(t).ExpectNil(err)
+	file.Close()
+
+	_, err = queue.Pop()
+	test.S(t).ExpectNotNil(err)
+}
@@ -0,0 +1,180 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ThrottleHTTPMaxRetryAfter caps a Retry-After suggested by the throttle HTTP endpoint
+	ThrottleHTTPMaxRetryAfter = 5 * time.Minute
+	// throttleHTTPMaxBodySize caps the JSON response read off the throttle HTTP endpoint
+	throttleHTTPMaxBodySize = 64 * 1024
+)
+
+// ThrottleHTTPResponse is the optional JSON body returned by the throttle HTTP endpoint on GET requests
+type ThrottleHTTPResponse struct {
+	Throttle          bool    `json:"throttle"`
+	Reason            string  `json:"reason"`
+	RetryAfterSeconds float64 `json:"retry_after_seconds"`
+	NiceRatio         float64 `json:"nice_ratio"`
+	RowsPerSecond     float64 `json:"rows_per_second"`
+}
+
+// ThrottleHTTPResult is the outcome of a throttle HTTP check
+type ThrottleHTTPResult struct {
+	StatusCode int
+	Throttle   bool
+	Reason     string
+	// RetryAfter is how long the endpoint asks not to be checked again. Zero means the next regular check.
+	RetryAfter time.Duration
+	// NiceRatio, when positive, is the minimal nice-ratio the endpoint asks to apply
+	NiceRatio float64
+	// RowsPerSecond, when positive, is the row copy rate the endpoint asks not to exceed
+	RowsPerSecond float64
+}
+
+// ThrottleHTTPURL adds the migration's identity to the throttle HTTP endpoint's query parameters
+func ThrottleHTTPURL(throttleHTTP string, databaseName, tableName, uuid string) (string, error) {
+	u, err := url.Parse(throttleHTTP)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("database", databaseName)
+	query.Set("table", tableName)
+	query.Set("uuid", uuid)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// ReadThrottleHTTPHeaders reads `Name: value` lines, one header per line. Empty lines and lines
+// starting with `#` are ignored. A value of the form `${VAR}` is read from environment variable VAR.
+func ReadThrottleHTTPHeaders(content string) (http.Header, error) {
+	header := http.Header{}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens := strings.SplitN(line, ":", 2)
+		if len(tokens) != 2 || strings.TrimSpace(tokens[0]) == "" {
+			return nil, fmt.Errorf("headers line %d: expected `Name: value`", i+1)
+		}
+		value := strings.TrimSpace(tokens[1])
+		if submatch := envVariableRegexp.FindStringSubmatch(value); len(submatch) > 1 {
+			value = os.Getenv(submatch[1])
+			if value == "" {
+				return nil, fmt.Errorf("headers line %d: environment variable %s is empty", i+1, submatch[1])
+			}
+		}
+		header.Add(strings.TrimSpace(tokens[0]), value)
+	}
+	return header, nil
+}
+
+// parseRetryAfter reads a Retry-After header, given either as seconds or as an HTTP date
+func parseRetryAfter(retryAfter string, now time.Time) time.Duration {
+	retryAfter = strings.TrimSpace(retryAfter)
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(retryAfter, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(retryAfter); err == nil {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// ParseThrottleHTTPResponse reads the throttle HTTP endpoint's response. Any status code other than 200
+// throttles. A JSON object body, where given, may further request throttling, and suggest a nice-ratio or rows/sec
+// rate. A suggested retry-after is read off the JSON body or else off the Retry-After header.
+func ParseThrottleHTTPResponse(resp *http.Response, now time.Time) (result *ThrottleHTTPResult, err error) {
+	result = &ThrottleHTTPResult{
+		StatusCode: resp.StatusCode,
+		Throttle:   resp.StatusCode != http.StatusOK,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), now),
+	}
+	if resp.Body != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, throttleHTTPMaxBodySize))
+		if err != nil {
+			return result, err
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+			response := ThrottleHTTPResponse{}
+			if err := json.Unmarshal(body, &response); err != nil {
+				return result, fmt.Errorf("Cannot parse throttle-http response: %+v", err)
+			}
+			result.Throttle = result.Throttle || response.Throttle
+			result.Reason = response.Reason
+			if response.RetryAfterSeconds > 0 {
+				result.RetryAfter = time.Duration(response.RetryAfterSeconds * float64(time.Second))
+			}
+			result.NiceRatio = response.NiceRatio
+			result.RowsPerSecond = response.RowsPerSecond
+		}
+	}
+	if result.RetryAfter < 0 {
+		result.RetryAfter = 0
+	}
+	if result.RetryAfter > ThrottleHTTPMaxRetryAfter {
+		result.RetryAfter = ThrottleHTTPMaxRetryAfter
+	}
+	return result, nil
+}
+
+// RowsRateLimiter is a token bucket over copied rows: it tells whether the row copy exceeds a given rate,
+// allowing for a burst
+type RowsRateLimiter struct {
+	tokens     float64
+	rowsCopied int64
+	refilledAt time.Time
+}
+
+// Exceeded accounts for rows copied since the last call, and returns true while the rate is exceeded
+func (this *RowsRateLimiter) Exceeded(rowsPerSecond float64, burst float64, rowsCopied int64, now time.Time) bool {
+	if this.refilledAt.IsZero() {
+		this.Reset(rowsCopied, now)
+		return false
+	}
+	elapsed := now.Sub(this.refilledAt).Seconds()
+	copied := float64(rowsCopied - this.rowsCopied)
+	this.refilledAt = now
+	this.rowsCopied = rowsCopied
+
+	if rowsPerSecond <= 0 {
+		this.tokens = 0
+		return false
+	}
+	if burst < rowsPerSecond {
+		burst = rowsPerSecond
+	}
+	tokens := this.tokens + rowsPerSecond*elapsed
+	if tokens > burst {
+		tokens = burst
+	}
+	this.tokens = tokens - copied
+	return this.tokens < 0
+}
+
+// Reset empties the bucket, e.g. while copying is not allowed at all
+func (this *RowsRateLimiter) Reset(rowsCopied int64, now time.Time) {
+	this.tokens = 0
+	this.rowsCopied = rowsCopied
+	this.refilledAt = now
+}
@@ -0,0 +1,121 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func newThrottleHTTPResponse(statusCode int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: statusCode, Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func TestThrottleHTTPURL(t *testing.T) {
+	{
+		url, err := ThrottleHTTPURL("http://localhost:8111/check/gh-ost/mysql/main", "test", "orders", "abc")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(url, "http://localhost:8111/check/gh-ost/mysql/main?database=test&table=orders&uuid=abc")
+	}
+	{
+		url, err := ThrottleHTTPURL("http://localhost:8111/check?app=gh-ost", "test", "my table", "abc")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(url, "http://localhost:8111/check?app=gh-ost&database=test&table=my+table&uuid=abc")
+	}
+}
+
+func TestReadThrottleHTTPHeaders(t *testing.T) {
+	os.Setenv("GH_OST_TEST_THROTTLE_TOKEN", "s3cret")
+	defer os.Unsetenv("GH_OST_TEST_THROTTLE_TOKEN")
+	{
+		header, err := ReadThrottleHTTPHeaders(`
+# auth
+Authorization: Bearer ${GH_OST_TEST_THROTTLE_TOKEN}
+X-Client: gh-ost:1
+`)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(header.Get("Authorization"), "s3cret")
+		test.S(t).ExpectEquals(header.Get("X-Client"), "gh-ost:1")
+	}
+	{
+		_, err := ReadThrottleHTTPHeaders("Authorization")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := ReadThrottleHTTPHeaders("Authorization: ${GH_OST_TEST_UNDEFINED_TOKEN}")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestParseThrottleHTTPResponse(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	{
+		result, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(200, nil, ""), now)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectFalse(result.Throttle)
+		test.S(t).ExpectEquals(result.RetryAfter, time.Duration(0))
+	}
+	{
+		result, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(429, http.Header{"Retry-After": []string{"3"}}, "too many requests"), now)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(result.Throttle)
+		test.S(t).ExpectEquals(result.RetryAfter, 3*time.Second)
+	}
+	{
+		result, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(503, http.Header{"Retry-After": []string{"Fri, 01 Mar 2024 10:00:30 GMT"}}, ""), now)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(result.RetryAfter, 30*time.Second)
+	}
+	{
+		result, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(200, nil, `{"throttle": true, "reason": "replica lag", "retry_after_seconds": 2.5}`), now)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectTrue(result.Throttle)
+		test.S(t).ExpectEquals(result.Reason, "replica lag")
+		test.S(t).ExpectEquals(result.RetryAfter, 2500*time.Millisecond)
+	}
+	{
+		result, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(200, nil, `{"throttle": false, "nice_ratio": 0.5, "rows_per_second": 2000}`), now)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectFalse(result.Throttle)
+		test.S(t).ExpectEquals(result.NiceRatio, 0.5)
+		test.S(t).ExpectEquals(result.RowsPerSecond, 2000.0)
+	}
+	{
+		result, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(200, nil, `{"throttle": false, "retry_after_seconds": 3600}`), now)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(result.RetryAfter, ThrottleHTTPMaxRetryAfter)
+	}
+	{
+		_, err := ParseThrottleHTTPResponse(newThrottleHTTPResponse(200, nil, `{"throttle": "yes"}`), now)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestRowsRateLimiter(t *testing.T) {
+	limiter := &RowsRateLimiter{}
+	now := time.Now()
+	test.S(t).ExpectFalse(limiter.Exceeded(1000, 100, 5000, now))
+
+	now = now.Add(500 * time.Millisecond)
+	test.S(t).ExpectFalse(limiter.Exceeded(1000, 100, 5400, now))
+	now = now.Add(100 * time.Millisecond)
+	test.S(t).ExpectTrue(limiter.Exceeded(1000, 100, 6000, now))
+	// Refills at the given rate
+	now = now.Add(500 * time.Millisecond)
+	test.S(t).ExpectFalse(limiter.Exceeded(1000, 100, 6000, now))
+	// No rate: never exceeded
+	now = now.Add(100 * time.Millisecond)
+	test.S(t).ExpectFalse(limiter.Exceeded(0, 100, 100000, now))
+}
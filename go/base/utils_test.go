@@ -7,6 +7,7 @@ package base
 
 import (
 	"testing"
+	"time"
 
 	"github.com/outbrain/golib/log"
 	test "github.com/outbrain/golib/tests"
@@ -27,3 +28,54 @@ func TestStringContainsAll(t *testing.T) {
 	test.S(t).ExpectTrue(StringContainsAll(s, "insert", ""))
 	test.S(t).ExpectTrue(StringContainsAll(s, "insert", "update", "delete"))
 }
+
+func TestSplitCommandLineArgs(t *testing.T) {
+	{
+		args, err := SplitCommandLineArgs("")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(args), 0)
+	}
+	{
+		args, err := SplitCommandLineArgs("  --database=test   --table=sample_data\t--execute ")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(args), 3)
+		test.S(t).ExpectEquals(args[0], "--database=test")
+		test.S(t).ExpectEquals(args[1], "--table=sample_data")
+		test.S(t).ExpectEquals(args[2], "--execute")
+	}
+	{
+		args, err := SplitCommandLineArgs(`--alter="add column c varchar(10) default 'x'" --hooks-hint='it''s' --x=a\ b ""`)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(args), 4)
+		test.S(t).ExpectEquals(args[0], "--alter=add column c varchar(10) default 'x'")
+		test.S(t).ExpectEquals(args[1], "--hooks-hint=its")
+		test.S(t).ExpectEquals(args[2], "--x=a b")
+		test.S(t).ExpectEquals(args[3], "")
+	}
+	{
+		_, err := SplitCommandLineArgs(`--alter="add column c int`)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	{
+		ts, err := ParseTimestamp("2024-03-01T10:20:30Z")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(ts.Unix(), int64(1709288430))
+	}
+	{
+		ts, err := ParseTimestamp("1709288430")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(ts.Unix(), int64(1709288430))
+	}
+	{
+		ts, err := ParseTimestamp("2024-03-01 10:20:30")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(ts.Unix(), time.Date(2024, 3, 1, 10, 20, 30, 0, time.Local).Unix())
+	}
+	{
+		_, err := ParseTimestamp("tomorrow")
+		test.S(t).ExpectNotNil(err)
+	}
+}
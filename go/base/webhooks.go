@@ -0,0 +1,112 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookTimeoutMillis       = 5000
+	defaultWebhookRetryIntervalMillis = 1000
+)
+
+// WebhookConfig is a `[webhook "name"]` section of the config file
+type WebhookConfig struct {
+	Url                   string
+	Events                string
+	Timeout_Millis        int64
+	Retries               int64
+	Retry_Interval_Millis int64
+	Secret                string
+}
+
+// Webhook is an HTTP endpoint notified of hook events, in addition to executable hooks
+type Webhook struct {
+	Name          string
+	URL           string
+	Events        map[string]bool
+	Timeout       time.Duration
+	Retries       int64
+	RetryInterval time.Duration
+	Secret        string
+}
+
+// NewWebhook validates a webhook's config section, applying defaults
+func NewWebhook(name string, config *WebhookConfig) (*Webhook, error) {
+	if !strings.HasPrefix(config.Url, "http://") && !strings.HasPrefix(config.Url, "https://") {
+		return nil, fmt.Errorf("webhook %s: url must be http:// or https://. Got: %q", name, config.Url)
+	}
+	if config.Retries < 0 {
+		return nil, fmt.Errorf("webhook %s: retries must not be negative", name)
+	}
+	webhook := &Webhook{
+		Name:          name,
+		URL:           config.Url,
+		Events:        make(map[string]bool),
+		Timeout:       time.Duration(config.Timeout_Millis) * time.Millisecond,
+		Retries:       config.Retries,
+		RetryInterval: time.Duration(config.Retry_Interval_Millis) * time.Millisecond,
+		Secret:        config.Secret,
+	}
+	if config.Timeout_Millis <= 0 {
+		webhook.Timeout = defaultWebhookTimeoutMillis * time.Millisecond
+	}
+	if config.Retry_Interval_Millis <= 0 {
+		webhook.RetryInterval = defaultWebhookRetryIntervalMillis * time.Millisecond
+	}
+	// Like credentials, secrets may be given as "${SOME_ENV_VARIABLE}"
+	if submatch := envVariableRegexp.FindStringSubmatch(webhook.Secret); len(submatch) > 1 {
+		webhook.Secret = os.Getenv(submatch[1])
+	}
+	for _, event := range strings.Split(config.Events, ",") {
+		event = strings.TrimPrefix(strings.TrimSpace(event), "gh-ost-on-")
+		if event != "" {
+			webhook.Events[event] = true
+		}
+	}
+	return webhook, nil
+}
+
+// HandlesEvent checks whether this webhook is subscribed to given hook event, e.g. "gh-ost-on-success".
+// A webhook with no explicit events handles all events.
+func (this *Webhook) HandlesEvent(hookName string) bool {
+	if len(this.Events) == 0 {
+		return true
+	}
+	return this.Events[strings.TrimPrefix(hookName, "gh-ost-on-")]
+}
+
+// Signature returns the hex encoded HMAC-SHA256 of given payload, keyed by the webhook's secret
+func (this *Webhook) Signature(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(this.Secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readWebhooks builds webhooks out of config file sections, ordered by name
+func readWebhooks(configs map[string]*WebhookConfig) (webhooks []*Webhook, err error) {
+	names := []string{}
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		webhook, err := NewWebhook(name, configs[name])
+		if err != nil {
+			return webhooks, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
@@ -0,0 +1,109 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package base
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestNewWebhook(t *testing.T) {
+	{
+		_, err := NewWebhook("bad", &WebhookConfig{Url: "ftp://example.com"})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		webhook, err := NewWebhook("defaults", &WebhookConfig{Url: "https://example.com/hooks"})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(webhook.Timeout, 5*time.Second)
+		test.S(t).ExpectEquals(webhook.Retries, int64(0))
+		test.S(t).ExpectEquals(webhook.RetryInterval, time.Second)
+		test.S(t).ExpectTrue(webhook.HandlesEvent("gh-ost-on-startup"))
+		test.S(t).ExpectTrue(webhook.HandlesEvent("gh-ost-on-status"))
+	}
+	{
+		webhook, err := NewWebhook("some", &WebhookConfig{Url: "http://example.com", Events: "success, gh-ost-on-failure", Timeout_Millis: 200})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(webhook.Timeout, 200*time.Millisecond)
+		test.S(t).ExpectTrue(webhook.HandlesEvent("gh-ost-on-success"))
+		test.S(t).ExpectTrue(webhook.HandlesEvent("gh-ost-on-failure"))
+		test.S(t).ExpectFalse(webhook.HandlesEvent("gh-ost-on-status"))
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	webhook := &Webhook{Secret: "key"}
+	test.S(t).ExpectEquals(webhook.Signature([]byte("The quick brown fox jumps over the lazy dog")), "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")
+}
+
+func TestReadConfigFileWebhooks(t *testing.T) {
+	f, err := ioutil.TempFile("", "gh-ost-conf")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(f.Name())
+	f.WriteString(`
+[client]
+user=gromit
+
+[webhook "notify"]
+url=https://example.com/notify
+events=success,failure
+timeout-millis=200
+
+[webhook "audit"]
+url=https://example.com/audit
+secret=${GH_OST_TEST_WEBHOOK_SECRET}
+`)
+	f.Close()
+	os.Setenv("GH_OST_TEST_WEBHOOK_SECRET", "s3cr3t")
+	defer os.Unsetenv("GH_OST_TEST_WEBHOOK_SECRET")
+
+	context := NewMigrationContext()
+	context.ConfigFile = f.Name()
+	test.S(t).ExpectNil(context.ReadConfigFile())
+	webhooks := context.GetWebhooks()
+	test.S(t).ExpectEquals(len(webhooks), 2)
+	test.S(t).ExpectEquals(webhooks[0].Name, "audit")
+	test.S(t).ExpectEquals(webhooks[0].Secret, "s3cr3t")
+	test.S(t).ExpectEquals(webhooks[1].Name, "notify")
+	test.S(t).ExpectFalse(webhooks[1].HandlesEvent("gh-ost-on-startup"))
+	test.S(t).ExpectEquals(webhooks[1].Timeout, 200*time.Millisecond)
+}
+
+func TestReadConfigFileWebhooksFailedReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "gh-ost-conf")
+	test.S(t).ExpectNil(err)
+	defer os.Remove(f.Name())
+	f.WriteString(`
+[client]
+user=gromit
+
+[webhook "notify"]
+url=https://example.com/notify
+`)
+	f.Close()
+
+	context := NewMigrationContext()
+	context.ConfigFile = f.Name()
+	test.S(t).ExpectNil(context.ReadConfigFile())
+	test.S(t).ExpectEquals(len(context.GetWebhooks()), 1)
+
+	test.S(t).ExpectNil(ioutil.WriteFile(f.Name(), []byte(`
+[client]
+user=wallace
+
+[webhook "notify"]
+url=ftp://example.com/notify
+`), 0644))
+	test.S(t).ExpectNotNil(context.ReadConfigFile())
+	webhooks := context.GetWebhooks()
+	test.S(t).ExpectEquals(len(webhooks), 1)
+	test.S(t).ExpectEquals(webhooks[0].URL, "https://example.com/notify")
+	test.S(t).ExpectEquals(context.config.Client.User, "gromit")
+}
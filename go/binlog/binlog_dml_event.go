@@ -6,6 +6,7 @@
 package binlog
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 
@@ -65,3 +66,40 @@ func NewBinlogDMLEvent(databaseName, tableName string, dml EventDML) *BinlogDMLE
 func (this *BinlogDMLEvent) String() string {
 	return fmt.Sprintf("[%+v on %s:%s]", this.DML, this.DatabaseName, this.TableName)
 }
+
+// Encode returns a compact binary encoding of this event, as read back by DecodeBinlogDMLEvent
+func (this *BinlogDMLEvent) Encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	sql.EncodeBytes(buf, []byte(this.DatabaseName))
+	sql.EncodeBytes(buf, []byte(this.TableName))
+	sql.EncodeBytes(buf, []byte(this.DML))
+	if err := sql.EncodeColumnValues(buf, this.WhereColumnValues); err != nil {
+		return nil, err
+	}
+	if err := sql.EncodeColumnValues(buf, this.NewColumnValues); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeBinlogDMLEvent reads an event as encoded by Encode()
+func DecodeBinlogDMLEvent(data []byte) (event *BinlogDMLEvent, err error) {
+	reader := bytes.NewReader(data)
+	var tokens [3][]byte
+	for i := range tokens {
+		if tokens[i], err = sql.DecodeBytes(reader); err != nil {
+			return nil, err
+		}
+	}
+	event = NewBinlogDMLEvent(string(tokens[0]), string(tokens[1]), EventDML(tokens[2]))
+	if event.WhereColumnValues, err = sql.DecodeColumnValues(reader); err != nil {
+		return nil, err
+	}
+	if event.NewColumnValues, err = sql.DecodeColumnValues(reader); err != nil {
+		return nil, err
+	}
+	if reader.Len() > 0 {
+		return nil, fmt.Errorf("Unexpected %d trailing bytes decoding binlog event", reader.Len())
+	}
+	return event, nil
+}
@@ -7,7 +7,10 @@ package binlog
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gh-ost/go/base"
 	"gh-ost/go/mysql"
@@ -19,18 +22,41 @@ import (
 	"golang.org/x/net/context"
 )
 
+// MariaDB compressed event types (log_bin_compress), which the binlog library cannot decode
+const (
+	mariadbQueryCompressedEvent      replication.EventType = 165
+	mariadbDeleteRowsCompressedEvent replication.EventType = 171
+)
+
+// MariaDB GTID event flags, following the event's sequence number and domain id, which the binlog library does not decode
+const (
+	mariadbGTIDFlagsOffset    = replication.EventHeaderSize + 12
+	mariadbGTIDStandaloneFlag = 0x01
+)
+
 type GoMySQLReader struct {
 	connectionConfig         *mysql.ConnectionConfig
+	serverVersion            *mysql.ServerVersion
 	binlogSyncer             *replication.BinlogSyncer
 	binlogStreamer           *replication.BinlogStreamer
 	currentCoordinates       mysql.BinlogCoordinates
 	currentCoordinatesMutex  *sync.Mutex
 	LastAppliedRowsEventHint mysql.BinlogCoordinates
+	// currentGTIDPosition is the MariaDB GTID position of the last complete transaction read; protected by currentCoordinatesMutex
+	currentGTIDPosition mysql.MariaDBGTIDPosition
+	// pendingGTID is the GTID of the transaction being read, added to the position once the transaction completes
+	pendingGTID *mysql.MariaDBGTID
+	// pendingGTIDStandalone is set when the pending GTID's transaction is a single event, with no BEGIN/COMMIT, e.g. a DDL
+	pendingGTIDStandalone bool
+	// lastEventTimestamp is the unix timestamp of the last event read, see GetLastEventTime
+	lastEventTimestamp int64
 }
 
 func NewGoMySQLReader(migrationContext *base.MigrationContext) (binlogReader *GoMySQLReader, err error) {
 	binlogReader = &GoMySQLReader{
-		connectionConfig:        migrationContext.InspectorConnectionConfig,
+		connectionConfig:        migrationContext.GetBinlogSourceConnectionConfig(),
+		serverVersion:           migrationContext.GetBinlogSourceServerVersion(),
+		currentGTIDPosition:     mysql.MariaDBGTIDPosition{},
 		currentCoordinates:      mysql.BinlogCoordinates{},
 		currentCoordinatesMutex: &sync.Mutex{},
 		binlogSyncer:            nil,
@@ -41,7 +67,7 @@ func NewGoMySQLReader(migrationContext *base.MigrationContext) (binlogReader *Go
 
 	binlogSyncerConfig := replication.BinlogSyncerConfig{
 		ServerID:   serverId,
-		Flavor:     "mysql",
+		Flavor:     string(binlogReader.serverVersion.Flavor),
 		Host:       binlogReader.connectionConfig.Key.Hostname,
 		Port:       uint16(binlogReader.connectionConfig.Key.Port),
 		User:       binlogReader.connectionConfig.User,
@@ -61,6 +87,7 @@ func (this *GoMySQLReader) ConnectBinlogStreamer(coordinates mysql.BinlogCoordin
 	}
 
 	this.currentCoordinates = coordinates
+	atomic.StoreInt64(&this.lastEventTimestamp, time.Now().Unix())
 	log.Infof("Connecting binlog streamer at %+v", this.currentCoordinates)
 	// Start sync with specified binlog file and position
 	this.binlogStreamer, err = this.binlogSyncer.StartSync(gomysql.Position{this.currentCoordinates.LogFile, uint32(this.currentCoordinates.LogPos)})
@@ -68,6 +95,22 @@ func (this *GoMySQLReader) ConnectBinlogStreamer(coordinates mysql.BinlogCoordin
 	return err
 }
 
+// ConnectBinlogStreamerAtGTID connects to a MariaDB server at given GTID position, i.e. past the transactions the
+// position includes. Given coordinates are the binary log the position is in; the server's rotate event updates them.
+func (this *GoMySQLReader) ConnectBinlogStreamerAtGTID(gtidPosition mysql.MariaDBGTIDPosition, coordinates mysql.BinlogCoordinates) (err error) {
+	gtidSet, err := gomysql.ParseMariadbGTIDSet(gtidPosition.String())
+	if err != nil {
+		return err
+	}
+	this.SetGTIDPosition(gtidPosition)
+	this.currentCoordinates = coordinates
+	atomic.StoreInt64(&this.lastEventTimestamp, time.Now().Unix())
+	log.Infof("Connecting binlog streamer at GTID position %s", gtidPosition)
+	this.binlogStreamer, err = this.binlogSyncer.StartSyncGTID(gtidSet)
+
+	return err
+}
+
 func (this *GoMySQLReader) GetCurrentBinlogCoordinates() *mysql.BinlogCoordinates {
 	this.currentCoordinatesMutex.Lock()
 	defer this.currentCoordinatesMutex.Unlock()
@@ -75,6 +118,25 @@ func (this *GoMySQLReader) GetCurrentBinlogCoordinates() *mysql.BinlogCoordinate
 	return &returnCoordinates
 }
 
+// SetGTIDPosition sets the MariaDB GTID position the reader starts at, as in @@gtid_binlog_pos
+func (this *GoMySQLReader) SetGTIDPosition(gtidPosition mysql.MariaDBGTIDPosition) {
+	this.currentCoordinatesMutex.Lock()
+	defer this.currentCoordinatesMutex.Unlock()
+	this.currentGTIDPosition = gtidPosition.Clone()
+}
+
+// GetCurrentGTIDPosition returns the MariaDB GTID position of the last complete transaction read; it is empty on MySQL
+func (this *GoMySQLReader) GetCurrentGTIDPosition() mysql.MariaDBGTIDPosition {
+	this.currentCoordinatesMutex.Lock()
+	defer this.currentCoordinatesMutex.Unlock()
+	return this.currentGTIDPosition.Clone()
+}
+
+// GetLastEventTime returns the time of the last event read, or the time of connecting, if no event was read since
+func (this *GoMySQLReader) GetLastEventTime() time.Time {
+	return time.Unix(atomic.LoadInt64(&this.lastEventTimestamp), 0)
+}
+
 // StreamEvents
 func (this *GoMySQLReader) handleRowsEvent(ev *replication.BinlogEvent, rowsEvent *replication.RowsEvent, entriesChannel chan<- *BinlogEntry) error {
 	if this.currentCoordinates.SmallerThanOrEquals(&this.LastAppliedRowsEventHint) {
@@ -141,6 +203,14 @@ func (this *GoMySQLReader) StreamEvents(canStopStreaming func() bool, entriesCha
 			defer this.currentCoordinatesMutex.Unlock()
 			this.currentCoordinates.LogPos = int64(ev.Header.LogPos)
 		}()
+		// Artificial events, e.g. the rotate event sent upon connecting, have no timestamp
+		if ev.Header.Timestamp > 0 {
+			atomic.StoreInt64(&this.lastEventTimestamp, int64(ev.Header.Timestamp))
+		}
+		if ev.Header.EventType >= mariadbQueryCompressedEvent && ev.Header.EventType <= mariadbDeleteRowsCompressedEvent {
+			// Skipping such an event would silently lose changes to the migrated table
+			return fmt.Errorf("Unsupported MariaDB compressed binlog event (type %d) at %+v. Disable log_bin_compress", ev.Header.EventType, this.GetCurrentBinlogCoordinates())
+		}
 		if rotateEvent, ok := ev.Event.(*replication.RotateEvent); ok {
 			func() {
 				this.currentCoordinatesMutex.Lock()
@@ -152,6 +222,27 @@ func (this *GoMySQLReader) StreamEvents(canStopStreaming func() bool, entriesCha
 			if err := this.handleRowsEvent(ev, rowsEvent, entriesChannel); err != nil {
 				return err
 			}
+		} else if gtidEvent, ok := ev.Event.(*replication.MariadbGTIDEvent); ok {
+			this.pendingGTID = &mysql.MariaDBGTID{DomainID: gtidEvent.GTID.DomainID, ServerID: gtidEvent.GTID.ServerID, SequenceNumber: gtidEvent.GTID.SequenceNumber}
+			this.pendingGTIDStandalone = len(ev.RawData) > mariadbGTIDFlagsOffset && ev.RawData[mariadbGTIDFlagsOffset]&mariadbGTIDStandaloneFlag != 0
+		} else if _, ok := ev.Event.(*replication.XIDEvent); ok {
+			this.completePendingGTID()
+		} else if queryEvent, ok := ev.Event.(*replication.QueryEvent); ok {
+			// A transaction ends with the COMMIT (or ROLLBACK, with non transactional changes) of a non transactional change.
+			// A standalone event, e.g. a DDL, is a transaction of its own. Other statements, such as BEGIN or SAVEPOINT,
+			// are within the transaction.
+			query := strings.ToUpper(strings.TrimSpace(string(queryEvent.Query)))
+			if this.pendingGTIDStandalone || query == "COMMIT" || query == "ROLLBACK" {
+				this.completePendingGTID()
+			}
+		} else if gtidListEvent, ok := ev.Event.(*replication.MariadbGTIDListEvent); ok {
+			// Found at the beginning of each binary log: the position as of the previous binary logs. It never
+			// moves a domain back, e.g. upon reconnecting at a position past the start of the binary log.
+			for _, gtid := range gtidListEvent.GTIDs {
+				this.advanceMariaDBGTID(gtid.DomainID, gtid.ServerID, gtid.SequenceNumber)
+			}
+		} else if _, ok := ev.Event.(*replication.MariadbAnnotateRowsEvent); ok {
+			// binlog_annotate_row_events: the statement behind the following rows events. Rows events are what we apply.
 		}
 	}
 	log.Debugf("done streaming events")
@@ -159,6 +250,30 @@ func (this *GoMySQLReader) StreamEvents(canStopStreaming func() bool, entriesCha
 	return nil
 }
 
+// completePendingGTID advances the GTID position past the transaction just read
+func (this *GoMySQLReader) completePendingGTID() {
+	if this.pendingGTID == nil {
+		return
+	}
+	this.handleMariaDBGTID(this.pendingGTID.DomainID, this.pendingGTID.ServerID, this.pendingGTID.SequenceNumber)
+	this.pendingGTID = nil
+	this.pendingGTIDStandalone = false
+}
+
+// handleMariaDBGTID advances the GTID position
+func (this *GoMySQLReader) handleMariaDBGTID(domainID uint32, serverID uint32, sequenceNumber uint64) {
+	this.currentCoordinatesMutex.Lock()
+	defer this.currentCoordinatesMutex.Unlock()
+	this.currentGTIDPosition.Update(mysql.MariaDBGTID{DomainID: domainID, ServerID: serverID, SequenceNumber: sequenceNumber})
+}
+
+// advanceMariaDBGTID advances the GTID position, though only forward in the GTID's domain
+func (this *GoMySQLReader) advanceMariaDBGTID(domainID uint32, serverID uint32, sequenceNumber uint64) {
+	this.currentCoordinatesMutex.Lock()
+	defer this.currentCoordinatesMutex.Unlock()
+	this.currentGTIDPosition.Advance(mysql.MariaDBGTID{DomainID: domainID, ServerID: serverID, SequenceNumber: sequenceNumber})
+}
+
 func (this *GoMySQLReader) Close() error {
 	this.binlogSyncer.Close()
 	return nil
@@ -0,0 +1,492 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"gh-ost/go/base"
+
+	"github.com/outbrain/golib/log"
+)
+
+// cliFlags holds command line flags which are not directly bound to the migration context
+type cliFlags struct {
+	askPass                       *bool
+	executeFlag                   *bool
+	cutOver                       *string
+	exponentialBackoffMaxInterval *int64
+	chunkSize                     *int64
+	dmlBatchSize                  *int64
+	defaultRetries                *int64
+	cutOverLockTimeoutSeconds     *int64
+	niceRatio                     *float64
+	maxLagMillis                  *int64
+	replicationLagQuery           *string
+	throttleControlReplicas       *string
+	throttleQuery                 *string
+	throttleHTTP                  *string
+	ignoreHTTPErrors              *bool
+	heartbeatIntervalMillis       *int64
+	maxLoad                       *string
+	criticalLoad                  *string
+	quiet                         *bool
+	verbose                       *bool
+	debug                         *bool
+	stack                         *bool
+	help                          *bool
+	version                       *bool
+	checkFlag                     *bool
+}
+
+// defineFlags defines all command line flags on given flag set, binding them to given migration context.
+// The same flags are used by the command line and by daemon jobs.
+func defineFlags(flagSet *flag.FlagSet, migrationContext *base.MigrationContext) *cliFlags {
+	flags := &cliFlags{}
+	// todo
+	//参数host 主机ip
+	flagSet.StringVar(&migrationContext.InspectorConnectionConfig.Key.Hostname, "host", "127.0.0.1", "MySQL hostname (preferably a replica, not the master)")
+
+	//todo
+	//参数assume-master-host  为gh-ost指定一个主库，格式为”ip:port”或者”hostname:port”。这在主主架构里比较有用，或则在gh-ost发现不到主的时候有用。
+	flagSet.StringVar(&migrationContext.AssumeMasterHostname, "assume-master-host", "127.0.0.1:3307", "(optional) explicitly tell gh-ost the identity of the master. Format: some.host.com[:port] This is useful in master-master setups where you wish to pick an explicit master, or in a tungsten-replicator where gh-ost is unable to determine the master")
+	// todo
+	//参数port指定端口
+	flagSet.IntVar(&migrationContext.InspectorConnectionConfig.Key.Port, "port", 3307, "MySQL port (preferably a replica, not the master)")
+	//user指定mysql 用户
+	flagSet.StringVar(&migrationContext.CliUser, "user", "root", "MySQL user")
+	//MySQL登录密码 password
+	flagSet.StringVar(&migrationContext.CliPassword, "password", "root", "MySQL password")
+	//主库上的用户 当其与从库上的不一样时需要配合--assume-master-host这个参数
+	flagSet.StringVar(&migrationContext.CliMasterUser, "master-user", "", "MySQL user on master, if different from that on replica. Requires --assume-master-host")
+	//主库上的密码
+	flagSet.StringVar(&migrationContext.CliMasterPassword, "master-password", "", "MySQL password on master, if different from that on replica. Requires --assume-master-host")
+	//读取binlog的来源实例（默认为--host），格式为 host[:port]，例如专用binlog服务器或负载较低的从库
+	flagSet.StringVar(&migrationContext.BinlogSourceHostname, "binlog-source", "", "(optional) MySQL server to stream binary logs from, if other than --host: the master, or a replica with log_slave_updates. Format: some.host.com[:port]")
+	//binlog来源实例上的用户，默认与--user相同
+	flagSet.StringVar(&migrationContext.CliBinlogSourceUser, "binlog-source-user", "", "MySQL user on --binlog-source, if different from --user")
+	//binlog来源实例上的密码，默认与--password相同
+	flagSet.StringVar(&migrationContext.CliBinlogSourcePassword, "binlog-source-password", "", "MySQL password on --binlog-source, if different from --password")
+	//配置文件
+	flagSet.StringVar(&migrationContext.ConfigFile, "conf", "", "Config file")
+	//提示输入mysql密码
+	flags.askPass = flagSet.Bool("ask-pass", false, "prompt for MySQL password")
+	//启用到MySQL主机的SSL加密连接
+	flagSet.BoolVar(&migrationContext.UseTLS, "ssl", false, "Enable SSL encrypted connections to MySQL hosts")
+	//用于TLS连接到MySQL主机的PEM格式的CA证书。需要--ssl
+	flagSet.StringVar(&migrationContext.TLSCACertificate, "ssl-ca", "", "CA certificate in PEM format for TLS connections to MySQL hosts. Requires --ssl")
+	//用于TLS连接到MySQL主机的PEM格式证书。需要--ssl
+	flagSet.StringVar(&migrationContext.TLSCertificate, "ssl-cert", "", "Certificate in PEM format for TLS connections to MySQL hosts. Requires --ssl")
+	//用于TLS连接到MySQL主机的PEM格式KEY。需要--ssl
+	flagSet.StringVar(&migrationContext.TLSKey, "ssl-key", "", "Key in PEM format for TLS connections to MySQL hosts. Requires --ssl")
+	//跳过MySQL主机证书链和主机名的验证。需要--ssl
+	flagSet.BoolVar(&migrationContext.TLSAllowInsecure, "ssl-allow-insecure", false, "Skips verification of MySQL hosts' certificate chain and host name. Requires --ssl")
+	//连接binlog来源实例时使用独立的TLS设置；未指定时沿用--ssl的设置
+	flagSet.BoolVar(&migrationContext.BinlogSourceUseTLS, "binlog-source-ssl", false, "Use own TLS settings for connections to --binlog-source, given by --binlog-source-ssl-*. Otherwise --ssl settings apply")
+	//连接binlog来源实例的PEM格式CA证书。需要--binlog-source-ssl
+	flagSet.StringVar(&migrationContext.BinlogSourceTLSCACertificate, "binlog-source-ssl-ca", "", "CA certificate in PEM format for TLS connections to --binlog-source. Requires --binlog-source-ssl")
+	//连接binlog来源实例的PEM格式证书。需要--binlog-source-ssl
+	flagSet.StringVar(&migrationContext.BinlogSourceTLSCertificate, "binlog-source-ssl-cert", "", "Certificate in PEM format for TLS connections to --binlog-source. Requires --binlog-source-ssl")
+	//连接binlog来源实例的PEM格式KEY。需要--binlog-source-ssl
+	flagSet.StringVar(&migrationContext.BinlogSourceTLSKey, "binlog-source-ssl-key", "", "Key in PEM format for TLS connections to --binlog-source. Requires --binlog-source-ssl")
+	//跳过binlog来源实例证书链和主机名的验证。需要--binlog-source-ssl
+	flagSet.BoolVar(&migrationContext.BinlogSourceTLSAllowInsecure, "binlog-source-ssl-allow-insecure", false, "Skips verification of --binlog-source certificate chain and host name. Requires --binlog-source-ssl")
+	// todo
+	//数据库名称(必填项)
+	flagSet.StringVar(&migrationContext.DatabaseName, "database", "lossless_ddl_test", "database name (mandatory)")
+	// todo
+	//表名(必填项)
+	flagSet.StringVar(&migrationContext.OriginalTableName, "table", "user", "table name (mandatory)")
+	//变更sql语句(必填项)
+	// todo sql的不用显示的添加的 alter
+	flagSet.StringVar(&migrationContext.AlterStatement, "alter", "add column newC9 varchar(24);", "alter statement (mandatory)")
+	//期望的表结构（CREATE TABLE 语句文件）；gh-ost 会对比当前表结构计算出变更sql，与 --alter 互斥
+	flagSet.StringVar(&migrationContext.DesiredSchemaFile, "desired-schema", "", "File with the desired CREATE TABLE statement. gh-ost computes the ALTER statement from the difference with the current table definition. Mutually exclusive with --alter")
+	// todo
+	//实际计算表行数，而不是估计它们(是为了更准确的进度估计)
+	flagSet.BoolVar(&migrationContext.CountTableRows, "exact-rowcount", true, "actually count table rows as opposed to estimate them (results in more accurate progress estimation)")
+	// todo
+	//和--exact-rowcount参数搭配使用  true（默认值）:在行复制开始后同时计算行数，并在以后调整行估计值 false:首先计算行数，然后开始行复制
+	flagSet.BoolVar(&migrationContext.ConcurrentCountTableRows, "concurrent-rowcount", true, "(with --exact-rowcount), when true (default): count rows after row-copy begins, concurrently, and adjust row estimate later on; when false: first count rows, then start row copy")
+	// todo 在主库上迁移，copy数据时从主库表上select。 在从库上迁移，copy数据时从从库表上select
+	//允许此迁移直接在主库上执行。建议在备库上执行
+	flagSet.BoolVar(&migrationContext.AllowedRunningOnMaster, "allow-on-master", true, "allow this migration to run directly on master. Preferably it would run on a replica")
+	// todo
+	//显式允许在主主架构Mysql中运行
+	flagSet.BoolVar(&migrationContext.AllowedMasterMaster, "allow-master-master", true, "explicitly allow running in a master-master setup")
+	//允许在 LOCK TABLES 仅作用于本节点的集群上切换（多主组复制、Galera），需确保所有写入都经由本节点
+	flagSet.BoolVar(&migrationContext.AllowLocalTableLocks, "allow-local-table-locks", false, "Allow cut-over on clusters where LOCK TABLES only applies to the local node: multi-primary Group Replication, Galera/PXC. Only safe when all writes to the migrated table go through the node gh-ost connects to")
+	//允许gh ost基于具有可空列的唯一键进行迁移。只要不存在空值，就可以了。如果所选密钥中存在空值，则数据可能已损坏。使用风险自负！
+	flagSet.BoolVar(&migrationContext.NullableUniqueKeyAllowed, "allow-nullable-unique-key", false, "allow gh-ost to migrate based on a unique key with nullable columns. As long as no NULL values exist, this should be OK. If NULL values exist in chosen key, data may be corrupted. Use at your own risk!")
+	//如果“ALTER”语句重命名列，gh ost将注意到这一点并提供对重命名的解释。默认情况下，gh ost不会继续执行。这个标志证明了gh ost的解释是正确的
+	flagSet.BoolVar(&migrationContext.ApproveRenamedColumns, "approve-renamed-columns", false, "in case your `ALTER` statement renames columns, gh-ost will note that and offer its interpretation of the rename. By default gh-ost does not proceed to execute. This flag approves that gh-ost's interpretation is correct")
+	//如果“ALTER”语句重命名列，gh ost将注意到这一点并提供对重命名的解释。默认情况下，gh ost不会继续执行。此标志告诉gh ost跳过重命名的列，即将ghost认为重命名的列视为不相关的列。注意：可能会丢失列数据
+	flagSet.BoolVar(&migrationContext.SkipRenamedColumns, "skip-renamed-columns", false, "in case your `ALTER` statement renames columns, gh-ost will note that and offer its interpretation of the rename. By default gh-ost does not proceed to execute. This flag tells gh-ost to skip the renamed columns, i.e. to treat what gh-ost thinks are renamed columns as unrelated columns. NOTE: you may lose column data")
+	//显式地让gh ost知道您正在tungsten-replication的拓扑上运行（您可能还提供--assume-master-host参数）
+	flagSet.BoolVar(&migrationContext.IsTungsten, "tungsten", false, "explicitly let gh-ost know that you are running on a tungsten-replication based topology (you are likely to also provide --assume-master-host)")
+	//危险！此标志将迁移具有外键的表，并且不会在ghost表上创建外键，因此更改后的表将没有外键。这对于有意丢弃外键很有用
+	flagSet.BoolVar(&migrationContext.DiscardForeignKeys, "discard-foreign-keys", false, "DANGER! This flag will migrate a table that has foreign keys and will NOT create foreign keys on the ghost table, thus your altered table will have NO foreign keys. This is useful for intentional dropping of foreign keys")
+	//跳过外键检查
+	flagSet.BoolVar(&migrationContext.SkipForeignKeyChecks, "skip-foreign-key-checks", false, "set to 'true' when you know for certain there are no foreign keys on your table, and wish to skip the time it takes for gh-ost to verify that")
+	//跳过严格的sql模式
+	flagSet.BoolVar(&migrationContext.SkipStrictMode, "skip-strict-mode", false, "explicitly tell gh-ost binlog applier not to enforce strict sql mode")
+	//使用阿里云RDS
+	flagSet.BoolVar(&migrationContext.AliyunRDS, "aliyun-rds", false, "set to 'true' when you execute on Aliyun RDS.")
+	//如果使用的是GCP 要设置这个参数为true
+	flagSet.BoolVar(&migrationContext.GoogleCloudPlatform, "gcp", false, "set to 'true' when you execute on a 1st generation Google Cloud Platform (GCP).")
+	// todo execute参数为false表示预执行
+	// todo 为ture表示真正执行
+	//实际执行表变更或者数据迁移   默认情况下只做一些测试然后退出
+	flags.executeFlag = flagSet.Bool("execute", true, "actually execute the alter & migrate the table. Default is noop: do some tests and exit")
+	//让迁移在备库上执行，而不是在主库上执行。迁移结束时，复制将停止，表将交换并立即交换还原。复制保持停止，您可以比较这两个表以确认
+	flagSet.BoolVar(&migrationContext.TestOnReplica, "test-on-replica", false, "Have the migration run on a replica, not on the master. At the end of migration replication is stopped, and tables are swapped and immediately swap-revert. Replication remains stopped and you can compare the two tables for building trust")
+	//启用--test on replica时，不要发出停止复制的命令（需要--test on replica）
+	flagSet.BoolVar(&migrationContext.TestOnReplicaSkipReplicaStop, "test-on-replica-skip-replica-stop", false, "When --test-on-replica is enabled, do not issue commands stop replication (requires --test-on-replica)")
+	//让迁移在备库上运行，而不是在主库上运行。这将在复制副本上执行完整迁移，包括切换（与--test-on-replica参数相反）
+	flagSet.BoolVar(&migrationContext.MigrateOnReplica, "migrate-on-replica", false, "Have the migration run on a replica, not on the master. This will do the full migration on the replica including cut-over (as opposed to --test-on-replica)")
+	//是否删除原表 默认不删除 因为删除原表的操作是一个耗时操作
+	flagSet.BoolVar(&migrationContext.OkToDropTable, "ok-to-drop-table", false, "Shall the tool drop the old table at end of operation. DROPping tables can be a long locking operation, which is why I'm not doing it by default. I'm an online tool, yes?")
+	//删除旧表前先分批删除数据（分区表则逐个 truncate 分区），受限流控制，避免大表 DROP 卡住实例
+	flagSet.BoolVar(&migrationContext.LowImpactDropOldTable, "low-impact-drop-old-table", false, "with --ok-to-drop-table: empty the old table in throttled chunks (or partition by partition) before dropping it, so that the DROP does not stall the server")
+	//旧表保留时长：在此期间不删除旧表，仅标记为待删除，由之后的迁移或 cleanup 子命令完成删除
+	flagSet.Int64Var(&migrationContext.OldTableRetentionSeconds, "old-table-retention-seconds", 0, "with --ok-to-drop-table: rather than dropping the old table, mark it to be dropped after given seconds. A later migration on the same schema, or 'gh-ost cleanup', drops it in a low impact way once due. 0 to drop immediately")
+
+	//todo 是否删除上次执行在线DDL的old表  默认情况下 如果这样的表存在会panic
+	flagSet.BoolVar(&migrationContext.InitiallyDropOldTable, "initially-drop-old-table", true, "Drop a possibly existing OLD table (remains from a previous run?) before beginning operation. Default is to panic and abort if such table exists")
+
+	// todo 执行失败时会存在残留表，通过initially-drop-ghost-table = true 可以强制删除这个表
+	//是否删除上次执行在线DDL的o残余表  默认情况下 如果这样的表存在会panic
+	flagSet.BoolVar(&migrationContext.InitiallyDropGhostTable, "initially-drop-ghost-table", true, "Drop a possibly existing Ghost table (remains from a previous run?) before beginning operation. Default is to panic and abort if such table exists")
+	//在旧表名中使用时间戳。这使得旧表名是唯一的，并且不存在冲突的交叉迁移
+	flagSet.BoolVar(&migrationContext.TimestampOldTable, "timestamp-old-table", false, "Use a timestamp in old table name. This makes old table names unique and non conflicting cross migrations")
+	// todo
+	//重命名表是一步完成还是分成两步, value="atomic"
+	flags.cutOver = flagSet.String("cut-over", "default", "choose cut-over type (default|atomic, two-step)")
+	//如果为true，则“unospone | cut-over”交互命令必须命名迁移的表
+	flagSet.BoolVar(&migrationContext.ForceNamedCutOverCommand, "force-named-cut-over", false, "When true, the 'unpostpone|cut-over' interactive command must name the migrated table")
+	//如果为true，则“panic”交互命令必须命名迁移的表
+	flagSet.BoolVar(&migrationContext.ForceNamedPanicCommand, "force-named-panic", false, "When true, the 'panic' interactive command must name the migrated table")
+	// todo
+	//将bin log 格式转换为RBR格式
+	flagSet.BoolVar(&migrationContext.SwitchToRowBinlogFormat, "switch-to-rbr", true, "let this tool automatically switch binary log format to 'ROW' on the replica, if needed. The format will NOT be switched back. I'm too scared to do that, and wish to protect you if you happen to execute another migration while this one is running")
+	//如果确定MySQL 的bin log格式是ROW格式的话这个值可以设置为true
+	flagSet.BoolVar(&migrationContext.AssumeRBR, "assume-rbr", false, "set to 'true' when you know for certain your server uses 'ROW' binlog_format. gh-ost is unable to tell, event after reading binlog_format, whether the replication process does indeed use 'ROW', and restarts replication to be certain RBR setting is applied. Such operation requires SUPER privileges which you might not have. Setting this flag avoids restarting replication and you can proceed to use gh-ost without SUPER privileges")
+	//失败的切换尝试之间的间隔呈指数增长。等待间隔服从“指数后退最大间隔”的最大可配置值
+	flagSet.BoolVar(&migrationContext.CutOverExponentialBackoff, "cut-over-exponential-backoff", false, "Wait exponentially longer intervals between failed cut-over attempts. Wait intervals obey a maximum configurable with 'exponential-backoff-max-interval').")
+	//执行指数后退的各种操作时，两次尝试之间等待的最大秒数
+	flags.exponentialBackoffMaxInterval = flagSet.Int64("exponential-backoff-max-interval", 64, "Maximum number of seconds to wait between attempts when performing various operations with exponential backoff.")
+	//每次迭代中要处理的行数 范围从100 - 100000
+	flags.chunkSize = flagSet.Int64("chunk-size", 1000, "amount of rows to handle in each iteration (allowed range: 100-100,000)")
+	//要在单个事务中应用的DML事件的批处理大小
+	flags.dmlBatchSize = flagSet.Int64("dml-batch-size", 10, "batch size for DML events to apply in a single transaction (range 1-100)")
+	// todo
+	//默认重试次数
+	flags.defaultRetries = flagSet.Int64("default-retries", 60, "Default number of retries for various operations before panicking")
+	//尝试切换时保留表锁的最大秒数（当锁超过超时时重试）
+	flags.cutOverLockTimeoutSeconds = flagSet.Int64("cut-over-lock-timeout-seconds", 3, "Max number of seconds to hold locks on tables while attempting to cut-over (retry attempted when lock exceeds timeout)")
+	//行复制期间鬼表仅保留主键和所选唯一键；其余二级索引在行复制完成后通过一条 ALTER 添加
+	flagSet.BoolVar(&migrationContext.DeferSecondaryIndexes, "defer-secondary-indexes", false, "Row-copy onto a ghost table that only has the primary key and the chosen unique key. Remaining secondary indexes are added in a single ALTER on the ghost table once row copy completes, while binlog events keep being applied. Cut-over waits for the index build")
+	//切换前分块扫描鬼表的索引，将热点页加载到 buffer pool
+	flagSet.BoolVar(&migrationContext.WarmUpGhostTable, "warm-up-ghost-table", false, "Before cut-over, scan the ghost table's indexes in throttled chunks so that its pages are resident in the buffer pool. See also --warm-up-max-seconds, --warm-up-max-pages")
+	//切换前在鬼表上重放最近的 SELECT 语句（取自 performance_schema）的数量；0 表示不重放
+	flagSet.Int64Var(&migrationContext.WarmUpReplayStatements, "warm-up-replay-statements", 0, "Before cut-over, replay up to this many recently seen SELECT statements on the migrated table (sampled from performance_schema, MySQL 8.0) against the ghost table. 0 to disable")
+	//预热的时间预算（秒）
+	flagSet.Int64Var(&migrationContext.WarmUpMaxSeconds, "warm-up-max-seconds", 60, "Max number of seconds to spend warming up the ghost table before cut-over")
+	//预热的页预算（Innodb_buffer_pool_reads 增量，为整个实例的读取量，不只是鬼表）；0 表示不限制
+	flagSet.Int64Var(&migrationContext.WarmUpMaxPages, "warm-up-max-pages", 0, "Max number of pages to read into the buffer pool while warming up the ghost table, measured by the growth of Innodb_buffer_pool_reads, which is server-wide: it counts all pages read from disk on the server during warm-up, not only the ghost table's. 0 for no limit")
+	//切换前对 performance_schema 中该表耗时最多的 N 条语句，比较原表与鬼表上的执行计划；0 表示不检查
+	flagSet.Int64Var(&migrationContext.PlanCheckDigests, "plan-check-digests", 0, "Before cut-over, EXPLAIN the top N statement digests on the migrated table (sampled from performance_schema, MySQL 8.0) against both original and ghost tables, and report query plan regressions. 0 to disable")
+	//估算行数增长超过该倍数视为执行计划退化
+	flagSet.Float64Var(&migrationContext.PlanCheckRowsFactor, "plan-check-rows-factor", 10, "With --plan-check-digests, report a plan regression when estimated rows on the ghost table grow by more than this factor")
+	//发现执行计划退化时推迟切换，直到通过交互命令 approve-query-plans 确认
+	flagSet.BoolVar(&migrationContext.PlanCheckPostpone, "plan-check-postpone", false, "With --plan-check-digests, postpone cut-over upon query plan regressions until approved via 'approve-query-plans' interactive command")
+	//切换时（持锁、交换表之前）校验行数与抽样校验和，不一致则中止迁移；切换后验证表定义与复制是否完成，失败则告警
+	flagSet.BoolVar(&migrationContext.PostCutOverValidation, "post-cut-over-validation", false, "Validate the cut-over: under the cut-over lock and before tables are swapped, compare sampled checksum (and optionally row count) of original and ghost tables, aborting the migration on mismatch; after cut-over, validate the migrated table's definition and that the rename replicated to control replicas, alerting via the post-cut-over-validation-failed hook on failure")
+	//切换后验证的时间窗口（秒），窗口结束时仍未通过验证则告警；也是持锁校验数据的超时时间
+	flagSet.Int64Var(&migrationContext.PostCutOverValidationWindowSeconds, "post-cut-over-validation-window-seconds", 60, "Number of seconds following cut-over within which post cut-over validation must pass; also the timeout for validating data under the cut-over lock (requires --post-cut-over-validation)")
+	//切换后发现表定义不符时自动回滚切换（切换后写入的数据不会被带回原表）
+	flagSet.BoolVar(&migrationContext.PostCutOverValidationRollback, "post-cut-over-validation-rollback", false, "With --post-cut-over-validation, roll back the cut-over when the migrated table does not have the expected definition. Writes issued since cut-over are not carried back to the original table")
+	//原表与鬼表之间允许的行数差异；-1（默认）表示不比较行数。注意：精确计数在切换锁内执行
+	flagSet.Int64Var(&migrationContext.PostCutOverValidationMaxRowsDelta, "post-cut-over-validation-max-rows-delta", -1, "Max allowed row count difference between original and ghost tables in cut-over validation. -1 (default) to skip row count comparison. Counting rows runs under the cut-over lock, and blocks writes for as long as it takes")
+	//切换验证时计算校验和的行数；0 表示不计算校验和
+	flagSet.Int64Var(&migrationContext.PostCutOverValidationChecksumRows, "post-cut-over-validation-checksum-rows", 1000, "Number of rows (ordered by unique key) to checksum on original and ghost tables in cut-over validation. 0 to skip checksum")
+	//每次chunk时间段的休眠时间，范围[0.0…100.0]。0：每个chunk时间段不休眠，即一个chunk接着一个chunk执行；1：每row-copy 1毫秒，则另外休眠1毫秒；0.7：每row-copy 10毫秒，则另外休眠7毫秒。
+	flags.niceRatio = flagSet.Float64("nice-ratio", 0, "force being 'nice', imply sleep time per chunk time; range: [0.0..100.0]. Example values: 0 is aggressive. 1: for every 1ms spent copying rows, sleep additional 1ms (effectively doubling runtime); 0.7: for every 10ms spend in a rowcopy chunk, spend 7ms sleeping immediately after")
+	//限制操作的复制延迟
+	flags.maxLagMillis = flagSet.Int64("max-lag-millis", 1500, "replication lag at which to throttle operation")
+	//已弃用。gh ost使用一个内部的、亚秒级的分辨率查询
+	flags.replicationLagQuery = flagSet.String("replication-lag-query", "", "Deprecated. gh-ost uses an internal, subsecond resolution query")
+	// todo
+	//要检查其延迟的备库列表 逗号分隔
+	flags.throttleControlReplicas = flagSet.String("throttle-control-replicas", "127.0.0.1:3308,127.0.0.1:3309", "List of replicas on which to check for lag; comma delimited. Example: myhost1.com:3306,myhost2.com,myhost3.com:3307")
+	//自动发现主库下的所有备库并检查其延迟，定期刷新
+	flagSet.BoolVar(&migrationContext.DiscoverThrottleControlReplicas, "discover-throttle-control-replicas", false, "Walk the replication tree below the master (via SHOW SLAVE HOSTS and binlog dump threads), and check lag on all replicas found, in addition to --throttle-control-replicas. Re-discovered periodically")
+	//自动发现的备库需匹配的正则（host:port）
+	flagSet.StringVar(&migrationContext.DiscoverReplicasInclude, "discover-replicas-include", "", "Regular expression on host:port; only discovered replicas matching it are throttle control replicas")
+	//自动发现的备库中要排除的正则（host:port），例如延迟备库、备份库
+	flagSet.StringVar(&migrationContext.DiscoverReplicasExclude, "discover-replicas-exclude", "", "Regular expression on host:port; discovered replicas matching it are ignored, e.g. delayed or backup replicas")
+	//重新发现备库的间隔秒数
+	flagSet.Int64Var(&migrationContext.DiscoverReplicasIntervalSeconds, "discover-replicas-interval-seconds", 60, "Interval, in seconds, at which replicas are re-discovered")
+	//主库上的协调表（schema.table），同一集群上并发的迁移经由此表共享限流预算
+	flagSet.StringVar(&migrationContext.CoordinationTable, "coordination-table", "", "schema.table on the master, through which concurrent migrations on the cluster register and share a throttling budget. Created if missing. Default: disabled")
+	//集群范围内所有迁移行复制速率之和的上限（行/秒），由各迁移公平分配
+	flagSet.Int64Var(&migrationContext.CoordinationMaxRowsPerSecond, "coordination-max-rows-per-second", 0, "Cluster-wide budget of copied rows per second, fair-shared between migrations registered on --coordination-table. 0 is unlimited")
+	//集群范围内同时复制行的迁移数上限，超出时轮流复制
+	flagSet.Int64Var(&migrationContext.CoordinationMaxActiveCopiers, "coordination-max-active-copiers", 0, "Max number of migrations registered on --coordination-table that copy rows at the same time; others wait their turn. 0 is unlimited")
+	//组复制：任一成员排队事务数（待认证及待应用）超过此值时限流，0表示不检查
+	flagSet.Int64Var(&migrationContext.MaxGroupReplicationQueue, "max-group-replication-queue", 1000, "On Group Replication: throttle when any member has more transactions queued (pending certification or apply). 0 disables the check")
+	//Galera：流控暂停时间占比超过此值时限流（0-1），0表示不检查
+	flagSet.Float64Var(&migrationContext.MaxWsrepFlowControlPaused, "max-wsrep-flow-control-paused", 0.05, "On Galera/PXC: throttle when the fraction of time replication was paused by flow control, over the last interval, exceeds this value (0-1). 0 disables the check")
+	//Galera：本节点接收队列长度超过此值时限流，0表示不检查
+	flagSet.Int64Var(&migrationContext.MaxWsrepLocalRecvQueue, "max-wsrep-local-recv-queue", 16, "On Galera/PXC: throttle when wsrep_local_recv_queue exceeds this value. 0 disables the check")
+	//正在读取的binlog被清除前的最小剩余时间（秒），低于此值时执行 --binlog-headroom-action，0表示不检查
+	flagSet.Int64Var(&migrationContext.MinBinlogHeadroomSeconds, "min-binlog-headroom-seconds", 3600, "Act when the binary log being read is estimated to be purged in less than this many seconds, as of binlog_expire_logs_seconds/expire_logs_days on the streamer's source. 0 disables the check")
+	//binlog剩余时间不足时的动作：notify（默认，仅日志和钩子）、apply-events（因延迟或负载限流期间继续应用binlog事件）、abort（中止迁移）
+	flagSet.StringVar(&migrationContext.BinlogHeadroomAction, "binlog-headroom-action", "notify", "What to do when binlog headroom runs below --min-binlog-headroom-seconds: notify (log and fire hook only), apply-events (keep applying binlog events even while throttled on lag or max-load; row copy remains throttled), abort")
+	//binlog事件磁盘缓冲目录：应用队列已满时（例如限流期间）将事件写入磁盘，使streamer继续读取binlog；为空表示不启用
+	flagSet.StringVar(&migrationContext.EventsSpillDir, "events-spill-dir", "", "Directory in which to buffer binlog events on disk while the apply queue is full, e.g. while throttled, such that the streamer keeps reading binary logs. Empty (default) disables disk buffering")
+	//binlog事件磁盘缓冲的最大字节数，超过时streamer暂停读取
+	flagSet.Int64Var(&migrationContext.EventsSpillMaxBytes, "events-spill-max-bytes", 10*1024*1024*1024, "Max bytes of binlog events buffered on disk in --events-spill-dir. Once reached, the streamer pauses reading binary logs")
+	//是否限流  值为0表示不限流 大于0表示限流
+	flags.throttleQuery = flagSet.String("throttle-query", "", "when given, issued (every second) to check if operation should throttle. Expecting to return zero for no-throttle, >0 for throttle. Query is issued on the migrated server. Make sure this query is lightweight")
+	//只要http请求返回的状态码不是200 就限流 确保它具有低延迟响应
+	flags.throttleHTTP = flagSet.String("throttle-http", "", "when given, gh-ost checks given URL via HEAD request; any response code other than 200 (OK) causes throttling; make sure it has low latency response")
+	//限流HTTP检查的请求方法，GET时可读取JSON响应（原因、重试间隔、建议的速率或nice-ratio）
+	flagSet.StringVar(&migrationContext.ThrottleHTTPMethod, "throttle-http-method", "HEAD", "HTTP method of --throttle-http checks: HEAD or GET. With GET, an optional JSON response may carry a throttle reason, retry-after, and a suggested rows/sec rate or nice-ratio")
+	//限流HTTP检查附带的请求头文件，每行一个 `Name: value`
+	flagSet.StringVar(&migrationContext.ThrottleHTTPHeadersFile, "throttle-http-headers-file", "", "File with request headers to send along --throttle-http checks, one `Name: value` per line, e.g. for authentication. Values may be given as ${ENV_VARIABLE}")
+	//在限流检查时忽略HTTP错误
+	flags.ignoreHTTPErrors = flagSet.Bool("ignore-http-errors", false, "ignore HTTP connection errors during throttle check")
+	//间隔多久写入一次心跳数据
+	flags.heartbeatIntervalMillis = flagSet.Int64("heartbeat-interval-millis", 100, "how frequently would gh-ost inject a heartbeat value")
+	//当这个文件存在时 操作会停止  这个文件的明明最好要和操作的表名相关
+	flagSet.StringVar(&migrationContext.ThrottleFlagFile, "throttle-flag-file", "", "operation pauses when this file exists; hint: use a file that is specific to the table being altered")
+	//这个文件存在的话操作会停止 保留默认值即可，用于限制多个gh ost操作
+	flagSet.StringVar(&migrationContext.ThrottleAdditionalFlagFile, "throttle-additional-flag-file", "/tmp/gh-ost.throttle", "operation pauses when this file exists; hint: keep default, use for throttling multiple gh-ost operations")
+	//当这个文件存在时，迁移将推迟交换表的最后阶段，并将继续同步ghost表。一旦文件被删除，切换/交换就可以执行了。
+	flagSet.StringVar(&migrationContext.PostponeCutOverFlagFile, "postpone-cut-over-flag-file", "", "while this file exists, migration will postpone the final stage of swapping tables, and will keep on syncing the ghost table. Cut-over/swapping would be ready to perform the moment the file is deleted.")
+	// todo
+	//创建此文件时，gh ost将立即终止，而不进行清理
+	flagSet.StringVar(&migrationContext.PanicFlagFile, "panic-flag-file", "/tmp/ghost.panic.flag", "when this file is created, gh-ost will immediately terminate, without cleanup")
+	//创建此文件时，gh ost将优雅地中止迁移，并按照 --abort-drop-tables 清理表
+	flagSet.StringVar(&migrationContext.AbortFlagFile, "abort-flag-file", "", "when this file is created, gh-ost will gracefully abort the migration: stop writes onto the ghost table and clean up tables per --abort-drop-tables")
+	//优雅中止时删除哪些表：all（幽灵表和变更日志表）、changelog（仅变更日志表）、none（保留全部以便排查）
+	flagSet.StringVar(&migrationContext.AbortDropTables, "abort-drop-tables", base.AbortDropAllTables, "which tables to drop upon graceful abort: 'all' (ghost and changelog tables), 'changelog' (changelog table only), 'none' (keep for inspection)")
+	//强制删除现有的套接字文件。小心：这可能会删除正在运行的迁移的套接字文件！
+	flagSet.BoolVar(&migrationContext.DropServeSocket, "initially-drop-socket-file", false, "Should gh-ost forcibly delete an existing socket file. Be careful: this might drop the socket file of a running migration!")
+	//要服务的Unix套接字文件。默认值：启动时自动确定
+	flagSet.StringVar(&migrationContext.ServeSocketFile, "serve-socket-file", "", "Unix socket file to serve on. Default: auto-determined and advertised upon startup")
+	//TCP 端口 默认不启用
+	flagSet.Int64Var(&migrationContext.ServeTCPPort, "serve-tcp-port", 0, "TCP port to serve on. Default: disabled")
+	//TCP 端口的访问令牌文件，每行：<身份> <角色> <令牌>，角色为 read-only 或 admin
+	flagSet.StringVar(&migrationContext.ServeTCPTokensFile, "serve-tcp-tokens-file", "", "File of tokens authenticating callers on --serve-tcp-port, one `<identity> <role> <token>` per line; role is 'read-only' or 'admin'")
+	//TCP 端口使用 TLS 时的服务端证书
+	flagSet.StringVar(&migrationContext.ServeTCPTLSCertificate, "serve-tcp-tls-cert", "", "Certificate in PEM format for serving TLS on --serve-tcp-port. Requires --serve-tcp-tls-key")
+	//TCP 端口使用 TLS 时的服务端私钥
+	flagSet.StringVar(&migrationContext.ServeTCPTLSKey, "serve-tcp-tls-key", "", "Key in PEM format for serving TLS on --serve-tcp-port. Requires --serve-tcp-tls-cert")
+	//校验客户端证书的 CA，指定后客户端以证书认证（mTLS）
+	flagSet.StringVar(&migrationContext.ServeTCPTLSCACertificate, "serve-tcp-tls-ca", "", "CA certificate in PEM format verifying client certificates on --serve-tcp-port (mTLS). Client identity is the certificate's common name")
+	//拥有 admin 角色的客户端证书名称（逗号分隔），其余证书为 read-only
+	flagSet.StringVar(&migrationContext.ServeTCPTLSAdminNames, "serve-tcp-tls-admin-names", "", "Comma delimited client certificate common names granted the 'admin' role. Other verified certificates are 'read-only'")
+	//守护进程模式：保存任务状态与日志的目录
+	flagSet.StringVar(&migrationContext.DaemonStateDir, "daemon-state-dir", "/tmp/gh-ost-daemon", "daemon mode: directory where job state, job logs and job sockets are kept")
+	//守护进程模式：从该 MySQL 表（schema.table）拉取待执行的迁移任务
+	flagSet.StringVar(&migrationContext.DaemonQueueTable, "daemon-queue-table", "", "daemon mode: schema.table, on --host, from which to poll queued migration jobs. Default: disabled")
+	//守护进程模式：每个集群同时运行的迁移任务数上限
+	flagSet.Int64Var(&migrationContext.DaemonMaxConcurrentPerCluster, "daemon-max-concurrent-per-cluster", 1, "daemon mode: max number of jobs running concurrently on the same cluster (see --cluster-name)")
+	//集群名称，守护进程模式据此限制并发；默认使用 --host:--port
+	flagSet.StringVar(&migrationContext.ClusterName, "cluster-name", "", "logical name of the migrated cluster, by which daemon mode limits concurrency. Default: --host:--port")
+	//找到钩子文件的目录（默认值：空，即钩子被禁用）。将执行在此路径上找到的符合钩子命名约定的钩子文件
+	flagSet.StringVar(&migrationContext.HooksPath, "hooks-path", "", "directory where hook files are found (default: empty, ie. hooks disabled). Hook files found on this path, and conforming to hook naming conventions will be executed")
+	//为方便起见，通过GH OST_hooks_提示将任意消息注入hooks
+	flagSet.StringVar(&migrationContext.HooksHintMessage, "hooks-hint", "", "arbitrary message to be injected to hooks via GH_OST_HOOKS_HINT, for your convenience")
+	//为了您的方便，可以通过GH OST_hooks_HINT_owner将所有者的任意名称注入hooks
+	flagSet.StringVar(&migrationContext.HooksHintOwner, "hooks-hint-owner", "", "arbitrary name of owner to be injected to hooks via GH_OST_HOOKS_HINT_OWNER, for your convenience")
+	//通过GH OST_hooks_HINT_令牌注入钩子的任意令牌，以方便您
+	flagSet.StringVar(&migrationContext.HooksHintToken, "hooks-hint-token", "", "arbitrary token to be injected to hooks via GH_OST_HOOKS_HINT_TOKEN, for your convenience")
+	//单个钩子的最长执行时间（秒），超时的钩子进程会被杀掉并视为失败；0 表示不限制
+	flagSet.Int64Var(&migrationContext.HooksTimeoutSeconds, "hooks-timeout-seconds", 0, "Max number of seconds a hook process may run. A hook exceeding this time is killed and considered failed. 0 for no limit")
+	//切换前钩子返回"暂不"（退出码 75 / HTTP 425）时，推迟切换，间隔该秒数后重试钩子
+	flagSet.Int64Var(&migrationContext.HooksNotYetRetrySeconds, "hooks-not-yet-retry-seconds", 30, "When a before-cut-over hook says 'not yet' (exit code 75, or HTTP 425 from a webhook), cut-over is postponed and the hook is retried after given seconds")
+	//server id
+	flagSet.UintVar(&migrationContext.ReplicaServerId, "replica-server-id", 99999, "server id used by gh-ost process. Default: 99999")
+	// todo
+	//超过最大负载 限制写
+	flags.maxLoad = flagSet.String("max-load", "Threads_running=25", "Comma delimited status-name=threshold. e.g: 'Threads_running=100,Threads_connected=500'. When status exceeds threshold, app throttles writes")
+	// todo
+	//超过最大值 应用panic 并退出
+	flags.criticalLoad = flagSet.String("critical-load", "Threads_running=1000", "Comma delimited status-name=threshold, same format as --max-load. When status exceeds threshold, app panics and quits")
+	//0时，迁移在遇到临界负载时立即释放。当非零时，在给定的时间间隔后进行第二次检查，并且只有在第二次检查仍满足临界负载时迁移才会退出
+	flagSet.Int64Var(&migrationContext.CriticalLoadIntervalMilliseconds, "critical-load-interval-millis", 0, "When 0, migration immediately bails out upon meeting critical-load. When non-zero, a second check is done after given interval, and migration only bails out if 2nd check still meets critical load")
+	//当非零时，临界负载不会panic 和退出；相反，gh ost在指定的持续时间内进入休眠状态。它不会向任何服务器读/写任何内容
+	flagSet.Int64Var(&migrationContext.CriticalLoadHibernateSeconds, "critical-load-hibernate-seconds", 0, "When nonzero, critical-load does not panic and bail out; instead, gh-ost goes into hibernate for the specified duration. It will not read/write anything to from/to any server")
+	flags.quiet = flagSet.Bool("quiet", false, "quiet")
+	// todo
+	flags.verbose = flagSet.Bool("verbose", true, "verbose")
+	flags.debug = flagSet.Bool("debug", true, "debug mode (very verbose)")
+	flags.stack = flagSet.Bool("stack", true, "add stack trace upon error")
+	flags.help = flagSet.Bool("help", false, "Display usage")
+	flags.version = flagSet.Bool("version", false, "Print version & exit")
+
+	//检查是否存在/支持另一个标志。这允许跨版本脚本。当所有其他提供的标志都存在时，以0退出，否则为非零。必须为需要值的标志提供（伪）值
+	flags.checkFlag = flagSet.Bool("check-flag", false, "Check if another flag exists/supported. This allows for cross-version scripting. Exits with 0 when all additional provided flags exist, nonzero otherwise. You must provide (dummy) values for flags that require a value. Example: gh-ost --check-flag --cut-over-lock-timeout-seconds --nice-ratio 0")
+	//要在临时表上使用的表名前缀
+	flagSet.StringVar(&migrationContext.ForceTmpTableName, "force-table-names", "", "table name prefix to be used on the temporary tables")
+	//清理模式：发现失败迁移遗留的 _gho/_ghc/_gds/_del 表，确认后低影响地删除
+	flagSet.BoolVar(&migrationContext.CleanupConfirm, "cleanup-confirm", false, "cleanup mode: actually drop eligible artifact tables. Without this flag, artifacts are only reported")
+	//清理模式：只删除最后活动时间早于该秒数的表
+	flagSet.Int64Var(&migrationContext.CleanupMinAgeSeconds, "cleanup-min-age-seconds", 86400, "cleanup mode: only drop artifact tables whose last known migration activity is older than given seconds")
+	//清理模式：行数超过该值的表先按 chunk-size 分批删除数据，再删除表（0 表示直接删除）
+	flagSet.Int64Var(&migrationContext.CleanupLowImpactRows, "cleanup-low-impact-rows", 1000000, "cleanup mode: artifact tables with more rows than this are emptied in throttled chunks (see --chunk-size, --nice-ratio) before being dropped. 0 to always drop directly")
+	//清理模式：成功迁移后 _ghc 表已删除，遗留的 _del 表没有 changelog；开启后，只要原表存在，就按表名时间戳或最后写入时间判断其年龄
+	flagSet.BoolVar(&migrationContext.CleanupOrphanedOldTables, "cleanup-orphaned-old-tables", false, "cleanup mode: also take \"old\" (_del) tables which have no changelog table, as left by successful migrations, to be gh-ost tables, provided the migrated table exists. Their age is taken from the timestamp in the table name, or else from the table's last update time")
+	return flags
+}
+
+// newJobContext parses a daemon job's command line arguments into a migration context,
+// and returns the names of the flags given
+func newJobContext(args []string) (*base.MigrationContext, []string, error) {
+	migrationContext := base.NewMigrationContext()
+	flagSet := flag.NewFlagSet("gh-ost", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	flags := defineFlags(flagSet, migrationContext)
+	if err := flagSet.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if flagSet.NArg() > 0 {
+		return nil, nil, fmt.Errorf("Unexpected arguments: %+v", flagSet.Args())
+	}
+	if *flags.askPass {
+		return nil, nil, fmt.Errorf("--ask-pass is not supported in daemon jobs")
+	}
+	flagNames := []string{}
+	flagSet.Visit(func(f *flag.Flag) {
+		flagNames = append(flagNames, f.Name)
+	})
+	if err := applyFlags(flagSet, migrationContext, flags, true); err != nil {
+		return nil, nil, err
+	}
+	return migrationContext, flagNames, nil
+}
+
+// applyFlags validates parsed flags and applies them onto the migration context.
+// requireMigration is false for modes that do not run a migration (cleanup, daemon).
+func applyFlags(flagSet *flag.FlagSet, migrationContext *base.MigrationContext, flags *cliFlags, requireMigration bool) error {
+	//对必填项的检查 start
+	if requireMigration {
+		if migrationContext.DatabaseName == "" {
+			return fmt.Errorf("--database must be provided and database name must not be empty")
+		}
+		if migrationContext.OriginalTableName == "" {
+			return fmt.Errorf("--table must be provided and table name must not be empty")
+		}
+		if migrationContext.DesiredSchemaFile != "" {
+			alterProvided := false
+			flagSet.Visit(func(f *flag.Flag) {
+				if f.Name == "alter" {
+					alterProvided = true
+				}
+			})
+			if alterProvided {
+				return fmt.Errorf("--alter and --desired-schema are mutually exclusive")
+			}
+			migrationContext.AlterStatement = ""
+		} else if migrationContext.AlterStatement == "" {
+			return fmt.Errorf("--alter must be provided and statement must not be empty")
+		}
+	}
+	//对必填项的检查 end
+
+	migrationContext.Noop = !(*flags.executeFlag)
+	//互斥参数及参数依赖检查
+	if err := migrationContext.ValidateSettings(); err != nil {
+		return err
+	}
+	if migrationContext.TestOnReplicaSkipReplicaStop {
+		log.Warning("--test-on-replica-skip-replica-stop enabled. We will not stop replication before cut-over. Ensure you have a plugin that does this.")
+	}
+
+	//过时参数检查
+	if *flags.replicationLagQuery != "" {
+		log.Warningf("--replication-lag-query is deprecated")
+	}
+
+	//判断表的重命名是一步完成还是分成两步完成，默认一步完成
+	if err := migrationContext.SetCutOverType(*flags.cutOver); err != nil {
+		return err
+	}
+	//读取配置出错
+	if err := migrationContext.ReadConfigFile(); err != nil {
+		return err
+	}
+
+	//读取要限流的实例信息并设置
+	if err := migrationContext.ReadThrottleControlReplicaKeys(*flags.throttleControlReplicas); err != nil {
+		return err
+	}
+	//读取最大负载
+	if err := migrationContext.ReadMaxLoad(*flags.maxLoad); err != nil {
+		return err
+	}
+	//读取并更细最大阈值
+	if err := migrationContext.ReadCriticalLoad(*flags.criticalLoad); err != nil {
+		return err
+	}
+	//如果ServeSocketFile文件没有指定 指定一个默认的
+	if requireMigration && migrationContext.ServeSocketFile == "" {
+		migrationContext.ServeSocketFile = fmt.Sprintf("/tmp/gh-ost.%s.%s.sock", migrationContext.DatabaseName, migrationContext.OriginalTableName)
+	}
+
+	//设置心跳间隔
+	migrationContext.SetHeartbeatIntervalMilliseconds(*flags.heartbeatIntervalMillis)
+	//设置是否间歇性迁移
+	migrationContext.SetNiceRatio(*flags.niceRatio)
+	//设置每次迭代中要处理的行数
+	migrationContext.SetChunkSize(*flags.chunkSize)
+	//设置在单个事务中应用的DML事件的批处理大小
+	migrationContext.SetDMLBatchSize(*flags.dmlBatchSize)
+	//设置限制操作的复制延迟
+	migrationContext.SetMaxLagMillisecondsThrottleThreshold(*flags.maxLagMillis)
+	//设置是否限流
+	migrationContext.SetThrottleQuery(*flags.throttleQuery)
+	//设置只要http请求返回的状态码不是200 就限流 确保它具有低延迟响应
+	migrationContext.SetThrottleHTTP(*flags.throttleHTTP)
+	//设置忽略HTTP错误
+	migrationContext.SetIgnoreHTTPErrors(*flags.ignoreHTTPErrors)
+	//设置默认重试次数
+	migrationContext.SetDefaultNumRetries(*flags.defaultRetries)
+	if migrationContext.HooksNotYetRetrySeconds < 1 {
+		return fmt.Errorf("--hooks-not-yet-retry-seconds must be at least 1")
+	}
+	migrationContext.ApplyCredentials()
+	//设置TLS出错
+	if err := migrationContext.SetupTLS(); err != nil {
+		return err
+	}
+	//设置binlog来源实例的连接
+	if err := migrationContext.SetupBinlogSource(); err != nil {
+		return err
+	}
+	//读取限流HTTP检查的请求头
+	if err := migrationContext.SetupThrottleHTTPHeaders(); err != nil {
+		return err
+	}
+	//读取交互式 TCP 端口的令牌与 TLS 设置
+	if err := migrationContext.SetupServeTCPAuth(); err != nil {
+		return err
+	}
+	//设置重命名表锁表超时时间出错
+	if err := migrationContext.SetCutOverLockTimeoutSeconds(*flags.cutOverLockTimeoutSeconds); err != nil {
+		log.Errore(err)
+	}
+	//设置二进制回退最大时间间隔
+	if err := migrationContext.SetExponentialBackoffMaxInterval(*flags.exponentialBackoffMaxInterval); err != nil {
+		log.Errore(err)
+	}
+	return nil
+}
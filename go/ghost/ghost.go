@@ -0,0 +1,439 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+// Package ghost runs gh-ost migrations in-process. It is the supported way of embedding gh-ost
+// in Go tooling: a migration is constructed from a Config, runs with a context.Context for
+// cancellation, and reports progress via typed callbacks. Library code never exits the process.
+package ghost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"gh-ost/go/base"
+	"gh-ost/go/logic"
+)
+
+// Phase is a migration milestone, e.g. "row-copy-complete" or "success". Phases match hook names
+type Phase = base.MigrationPhase
+
+// AbortError is returned by Run when the migration was aborted, either via context cancellation
+// or via the migration's own abort mechanisms (interactive 'abort' command, abort flag file)
+type AbortError = base.AbortError
+
+// Status is a periodic progress report
+type Status struct {
+	Elapsed      time.Duration
+	Progress     float64
+	RowsCopied   int64
+	RowsEstimate int64
+	// Message is the status line as printed by the gh-ost command line
+	Message string
+}
+
+// Config describes a migration. Settings are named after, and behave as, gh-ost's command
+// line flags. Unlike the command line, zero values mean "off" for boolean settings.
+type Config struct {
+	Host           string
+	Port           int
+	User           string
+	Password       string
+	MasterHost     string // --assume-master-host
+	MasterUser     string
+	MasterPassword string
+	ConfigFile     string // --conf
+
+	UseTLS           bool
+	TLSCACertificate string
+	TLSCertificate   string
+	TLSKey           string
+	TLSAllowInsecure bool
+
+	// BinlogSource: see --binlog-source and doc/binlog-source.md. Credentials and TLS default to the above
+	BinlogSource                 string
+	BinlogSourceUser             string
+	BinlogSourcePassword         string
+	BinlogSourceUseTLS           bool
+	BinlogSourceTLSCACertificate string
+	BinlogSourceTLSCertificate   string
+	BinlogSourceTLSKey           string
+	BinlogSourceTLSAllowInsecure bool
+
+	Database          string
+	Table             string
+	Alter             string
+	DesiredSchemaFile string // mutually exclusive with Alter
+	Execute           bool   // when false, this is a noop migration
+
+	AllowOnMaster      bool
+	AllowMasterMaster  bool
+	MigrateOnReplica   bool
+	TestOnReplica      bool
+	SwitchToRBR        bool
+	AssumeRBR          bool
+	ExactRowCount      bool
+	ConcurrentRowCount bool
+	ReplicaServerId    uint // default: 99999
+
+	// AllowLocalTableLocks: see --allow-local-table-locks
+	AllowLocalTableLocks bool
+
+	CutOver                   string // atomic (default) or two-step
+	CutOverLockTimeoutSeconds int64  // default: 3
+	ChunkSize                 int64  // default: 1000
+	DMLBatchSize              int64  // default: 10
+	NiceRatio                 float64
+	DefaultRetries            int64 // default: 60
+
+	MaxLagMillis            int64 // default: 1500
+	ThrottleControlReplicas string
+	// DiscoverThrottleControlReplicas: see --discover-throttle-control-replicas. Interval default: 60
+	DiscoverThrottleControlReplicas bool
+	DiscoverReplicasInclude         string
+	DiscoverReplicasExclude         string
+	DiscoverReplicasIntervalSeconds int64
+	// CoordinationTable: see --coordination-table and doc/coordination.md
+	CoordinationTable            string
+	CoordinationMaxRowsPerSecond int64
+	CoordinationMaxActiveCopiers int64
+	ThrottleQuery                string
+	ThrottleHTTP                 string
+	// ThrottleHTTPMethod: HEAD (default) or GET
+	ThrottleHTTPMethod      string
+	ThrottleHTTPHeadersFile string
+	MaxLoad                 string
+	CriticalLoad            string
+	// Flow control thresholds on Group Replication and Galera clusters; zero values apply defaults, negative disables
+	MaxGroupReplicationQueue  int64
+	MaxWsrepFlowControlPaused float64
+	MaxWsrepLocalRecvQueue    int64
+	// MinBinlogHeadroomSeconds: default 3600, negative disables. BinlogHeadroomAction: default notify
+	MinBinlogHeadroomSeconds int64
+	BinlogHeadroomAction     string
+	// EventsSpillDir: see --events-spill-dir and doc/events-spill.md. EventsSpillMaxBytes default: 10GB
+	EventsSpillDir      string
+	EventsSpillMaxBytes int64
+
+	ThrottleFlagFile        string
+	PostponeCutOverFlagFile string
+	PanicFlagFile           string
+	AbortFlagFile           string
+	AbortDropTables         string // all (default), changelog or none
+
+	OkToDropTable           bool
+	InitiallyDropOldTable   bool
+	InitiallyDropGhostTable bool
+
+	// Interactive commands are only served when a socket file or TCP port is given
+	ServeSocketFile string
+	ServeTCPPort    int64
+	// Authentication of ServeTCPPort, see doc/interactive-commands.md
+	ServeTCPTokensFile     string
+	ServeTCPTLSCertificate string
+	ServeTCPTLSKey         string
+	ServeTCPTLSCA          string
+	ServeTCPTLSAdminNames  string
+	HooksPath              string
+	HooksTimeoutSeconds    int64
+	// HooksNotYetRetrySeconds: default 30. See doc/hooks.md
+	HooksNotYetRetrySeconds int64
+
+	// StatusOutput receives the status lines otherwise printed by the command line. Default: discarded
+	StatusOutput io.Writer
+
+	// Callbacks are called synchronously on the migration's goroutines, and should return promptly
+	OnPhase    func(phase Phase)
+	OnStatus   func(status Status)
+	OnThrottle func(throttled bool, reason string)
+	// OnCutOver is called upon each cut-over attempt, with nil error on success
+	OnCutOver func(err error)
+
+	// Configure, when given, is called with the migration context once all above settings are applied.
+	// It allows for settings not covered by Config.
+	Configure func(migrationContext *base.MigrationContext) error
+}
+
+// Migration is a single migration, which may run once
+type Migration struct {
+	config           *Config
+	migrationContext *base.MigrationContext
+	started          int64
+}
+
+// NewMigration validates given config and prepares a migration
+func NewMigration(config *Config) (*Migration, error) {
+	this := &Migration{
+		config:           config,
+		migrationContext: base.NewMigrationContext(),
+	}
+	if err := this.applyConfig(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// MigrationContext returns the underlying migration context, e.g. for reading progress
+func (this *Migration) MigrationContext() *base.MigrationContext {
+	return this.migrationContext
+}
+
+func (this *Migration) applyConfig() error {
+	config := this.config
+	migrationContext := this.migrationContext
+
+	if config.Database == "" {
+		return fmt.Errorf("Database must not be empty")
+	}
+	if config.Table == "" {
+		return fmt.Errorf("Table must not be empty")
+	}
+	if config.Alter == "" && config.DesiredSchemaFile == "" {
+		return fmt.Errorf("One of Alter, DesiredSchemaFile must be given")
+	}
+	if config.Alter != "" && config.DesiredSchemaFile != "" {
+		return fmt.Errorf("Alter and DesiredSchemaFile are mutually exclusive")
+	}
+
+	migrationContext.InspectorConnectionConfig.Key.Hostname = config.Host
+	migrationContext.InspectorConnectionConfig.Key.Port = config.Port
+	if migrationContext.InspectorConnectionConfig.Key.Port == 0 {
+		migrationContext.InspectorConnectionConfig.Key.Port = 3306
+	}
+	migrationContext.CliUser = config.User
+	migrationContext.CliPassword = config.Password
+	migrationContext.AssumeMasterHostname = config.MasterHost
+	migrationContext.CliMasterUser = config.MasterUser
+	migrationContext.CliMasterPassword = config.MasterPassword
+	migrationContext.ConfigFile = config.ConfigFile
+	migrationContext.UseTLS = config.UseTLS
+	migrationContext.TLSCACertificate = config.TLSCACertificate
+	migrationContext.TLSCertificate = config.TLSCertificate
+	migrationContext.TLSKey = config.TLSKey
+	migrationContext.TLSAllowInsecure = config.TLSAllowInsecure
+	migrationContext.BinlogSourceHostname = config.BinlogSource
+	migrationContext.CliBinlogSourceUser = config.BinlogSourceUser
+	migrationContext.CliBinlogSourcePassword = config.BinlogSourcePassword
+	migrationContext.BinlogSourceUseTLS = config.BinlogSourceUseTLS
+	migrationContext.BinlogSourceTLSCACertificate = config.BinlogSourceTLSCACertificate
+	migrationContext.BinlogSourceTLSCertificate = config.BinlogSourceTLSCertificate
+	migrationContext.BinlogSourceTLSKey = config.BinlogSourceTLSKey
+	migrationContext.BinlogSourceTLSAllowInsecure = config.BinlogSourceTLSAllowInsecure
+
+	migrationContext.DatabaseName = config.Database
+	migrationContext.OriginalTableName = config.Table
+	migrationContext.AlterStatement = config.Alter
+	migrationContext.DesiredSchemaFile = config.DesiredSchemaFile
+	migrationContext.Noop = !config.Execute
+
+	migrationContext.AllowedRunningOnMaster = config.AllowOnMaster
+	migrationContext.AllowedMasterMaster = config.AllowMasterMaster
+	migrationContext.AllowLocalTableLocks = config.AllowLocalTableLocks
+	migrationContext.MigrateOnReplica = config.MigrateOnReplica
+	migrationContext.TestOnReplica = config.TestOnReplica
+	migrationContext.SwitchToRowBinlogFormat = config.SwitchToRBR
+	migrationContext.AssumeRBR = config.AssumeRBR
+	migrationContext.CountTableRows = config.ExactRowCount
+	migrationContext.ConcurrentCountTableRows = config.ConcurrentRowCount
+	migrationContext.ReplicaServerId = config.ReplicaServerId
+	if migrationContext.ReplicaServerId == 0 {
+		migrationContext.ReplicaServerId = 99999
+	}
+
+	migrationContext.DiscoverThrottleControlReplicas = config.DiscoverThrottleControlReplicas
+	migrationContext.DiscoverReplicasInclude = config.DiscoverReplicasInclude
+	migrationContext.DiscoverReplicasExclude = config.DiscoverReplicasExclude
+	if config.DiscoverReplicasIntervalSeconds > 0 {
+		migrationContext.DiscoverReplicasIntervalSeconds = config.DiscoverReplicasIntervalSeconds
+	}
+	migrationContext.CoordinationTable = config.CoordinationTable
+	migrationContext.CoordinationMaxRowsPerSecond = config.CoordinationMaxRowsPerSecond
+	migrationContext.CoordinationMaxActiveCopiers = config.CoordinationMaxActiveCopiers
+	migrationContext.ThrottleFlagFile = config.ThrottleFlagFile
+	migrationContext.PostponeCutOverFlagFile = config.PostponeCutOverFlagFile
+	migrationContext.PanicFlagFile = config.PanicFlagFile
+	migrationContext.AbortFlagFile = config.AbortFlagFile
+	if config.AbortDropTables != "" {
+		migrationContext.AbortDropTables = config.AbortDropTables
+	}
+	migrationContext.OkToDropTable = config.OkToDropTable
+	migrationContext.InitiallyDropOldTable = config.InitiallyDropOldTable
+	migrationContext.InitiallyDropGhostTable = config.InitiallyDropGhostTable
+	migrationContext.ServeSocketFile = config.ServeSocketFile
+	migrationContext.ServeTCPPort = config.ServeTCPPort
+	migrationContext.ServeTCPTokensFile = config.ServeTCPTokensFile
+	migrationContext.ServeTCPTLSCertificate = config.ServeTCPTLSCertificate
+	migrationContext.ServeTCPTLSKey = config.ServeTCPTLSKey
+	migrationContext.ServeTCPTLSCACertificate = config.ServeTCPTLSCA
+	migrationContext.ServeTCPTLSAdminNames = config.ServeTCPTLSAdminNames
+	migrationContext.HooksPath = config.HooksPath
+	migrationContext.HooksTimeoutSeconds = config.HooksTimeoutSeconds
+	if config.HooksNotYetRetrySeconds > 0 {
+		migrationContext.HooksNotYetRetrySeconds = config.HooksNotYetRetrySeconds
+	}
+
+	if err := migrationContext.ValidateSettings(); err != nil {
+		return err
+	}
+	if err := migrationContext.SetCutOverType(config.CutOver); err != nil {
+		return err
+	}
+	if err := migrationContext.ReadConfigFile(); err != nil {
+		return err
+	}
+	if err := migrationContext.ReadThrottleControlReplicaKeys(config.ThrottleControlReplicas); err != nil {
+		return err
+	}
+	if err := migrationContext.ReadMaxLoad(config.MaxLoad); err != nil {
+		return err
+	}
+	if err := migrationContext.ReadCriticalLoad(config.CriticalLoad); err != nil {
+		return err
+	}
+	migrationContext.SetHeartbeatIntervalMilliseconds(100)
+	migrationContext.SetNiceRatio(config.NiceRatio)
+	if config.ChunkSize > 0 {
+		migrationContext.SetChunkSize(config.ChunkSize)
+	}
+	if config.DMLBatchSize > 0 {
+		migrationContext.SetDMLBatchSize(config.DMLBatchSize)
+	}
+	if config.MaxLagMillis > 0 {
+		migrationContext.SetMaxLagMillisecondsThrottleThreshold(config.MaxLagMillis)
+	}
+	if config.DefaultRetries > 0 {
+		migrationContext.SetDefaultNumRetries(config.DefaultRetries)
+	}
+	migrationContext.SetThrottleQuery(config.ThrottleQuery)
+	migrationContext.SetThrottleHTTP(config.ThrottleHTTP)
+	if config.ThrottleHTTPMethod != "" {
+		migrationContext.ThrottleHTTPMethod = config.ThrottleHTTPMethod
+	}
+	migrationContext.ThrottleHTTPHeadersFile = config.ThrottleHTTPHeadersFile
+	if config.MaxGroupReplicationQueue > 0 {
+		migrationContext.MaxGroupReplicationQueue = config.MaxGroupReplicationQueue
+	} else if config.MaxGroupReplicationQueue < 0 {
+		migrationContext.MaxGroupReplicationQueue = 0
+	}
+	if config.MaxWsrepFlowControlPaused > 0 {
+		migrationContext.MaxWsrepFlowControlPaused = config.MaxWsrepFlowControlPaused
+	} else if config.MaxWsrepFlowControlPaused < 0 {
+		migrationContext.MaxWsrepFlowControlPaused = 0
+	}
+	if config.MaxWsrepLocalRecvQueue > 0 {
+		migrationContext.MaxWsrepLocalRecvQueue = config.MaxWsrepLocalRecvQueue
+	} else if config.MaxWsrepLocalRecvQueue < 0 {
+		migrationContext.MaxWsrepLocalRecvQueue = 0
+	}
+	if config.MinBinlogHeadroomSeconds > 0 {
+		migrationContext.MinBinlogHeadroomSeconds = config.MinBinlogHeadroomSeconds
+	} else if config.MinBinlogHeadroomSeconds < 0 {
+		migrationContext.MinBinlogHeadroomSeconds = 0
+	}
+	if config.BinlogHeadroomAction != "" {
+		migrationContext.BinlogHeadroomAction = config.BinlogHeadroomAction
+	}
+	migrationContext.EventsSpillDir = config.EventsSpillDir
+	if config.EventsSpillMaxBytes > 0 {
+		migrationContext.EventsSpillMaxBytes = config.EventsSpillMaxBytes
+	}
+	if config.CutOverLockTimeoutSeconds > 0 {
+		if err := migrationContext.SetCutOverLockTimeoutSeconds(config.CutOverLockTimeoutSeconds); err != nil {
+			return err
+		}
+	}
+	if err := migrationContext.SetExponentialBackoffMaxInterval(64); err != nil {
+		return err
+	}
+	migrationContext.ApplyCredentials()
+	if err := migrationContext.SetupTLS(); err != nil {
+		return err
+	}
+	if err := migrationContext.SetupBinlogSource(); err != nil {
+		return err
+	}
+	if err := migrationContext.SetupThrottleHTTPHeaders(); err != nil {
+		return err
+	}
+	if err := migrationContext.SetupServeTCPAuth(); err != nil {
+		return err
+	}
+
+	// 库模式下不能退出进程，panic abort 作为错误返回
+	migrationContext.ReturnOnPanicAbort = true
+	migrationContext.StatusOutput = ioutil.Discard
+	if config.StatusOutput != nil {
+		migrationContext.StatusOutput = config.StatusOutput
+	}
+	migrationContext.EventListener = this.onEvent
+
+	if config.Configure != nil {
+		return config.Configure(migrationContext)
+	}
+	return nil
+}
+
+// onEvent dispatches migration events onto the config's callbacks
+func (this *Migration) onEvent(event *base.MigrationEvent) {
+	switch event.Type {
+	case base.PhaseChangedEvent:
+		if this.config.OnPhase != nil {
+			this.config.OnPhase(event.Phase)
+		}
+	case base.StatusEvent:
+		if this.config.OnStatus != nil {
+			this.config.OnStatus(Status{
+				Elapsed:      event.Elapsed,
+				Progress:     event.Progress,
+				RowsCopied:   event.RowsCopied,
+				RowsEstimate: event.RowsEstimate,
+				Message:      event.Status,
+			})
+		}
+	case base.ThrottleChangedEvent:
+		if this.config.OnThrottle != nil {
+			this.config.OnThrottle(event.Throttled, event.ThrottleReason)
+		}
+	case base.CutOverEvent:
+		if this.config.OnCutOver != nil {
+			this.config.OnCutOver(event.Error)
+		}
+	}
+}
+
+// Run runs the migration, and returns when it completes or fails. Cancelling ctx gracefully aborts
+// the migration, which then cleans up as per Config.AbortDropTables, and Run returns an *AbortError.
+// A migration may only run once.
+func (this *Migration) Run(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt64(&this.started, 0, 1) {
+		return fmt.Errorf("Migration has already run")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			this.migrationContext.RequestAbort(fmt.Sprintf("context: %+v", ctx.Err()))
+		case <-done:
+		}
+	}()
+	migrator := logic.NewMigrator(this.migrationContext)
+	if err := migrator.Migrate(); err != nil {
+		migrator.ExecOnFailureHook()
+		return err
+	}
+	return nil
+}
+
+// Abort requests a graceful abort of a running migration. It is equivalent to cancelling Run's context.
+func (this *Migration) Abort(reason string) {
+	this.migrationContext.RequestAbort(reason)
+}
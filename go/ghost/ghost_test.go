@@ -0,0 +1,108 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package ghost
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gh-ost/go/base"
+
+	"github.com/outbrain/golib/log"
+	test "github.com/outbrain/golib/tests"
+)
+
+func init() {
+	log.SetLevel(log.ERROR)
+}
+
+// newBlockedMigration returns a migration whose startup hook blocks until released, such that the
+// migration may be aborted before it connects to any server. startedFile exists once the hook runs;
+// creating releaseFile lets the hook complete.
+func newBlockedMigration(t *testing.T) (migration *Migration, startedFile string, releaseFile string) {
+	hooksPath := t.TempDir()
+	startedFile = filepath.Join(hooksPath, "started")
+	releaseFile = filepath.Join(hooksPath, "release")
+	hook := "#!/bin/sh\ntouch " + startedFile + "\nwhile [ ! -f " + releaseFile + " ]; do sleep 0.01; done\n"
+	if err := ioutil.WriteFile(filepath.Join(hooksPath, "gh-ost-on-startup-wait"), []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	migration, err := NewMigration(&Config{
+		Host:      "127.0.0.1",
+		Port:      1,
+		Database:  "db",
+		Table:     "tbl",
+		Alter:     "engine=innodb",
+		HooksPath: hooksPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migration, startedFile, releaseFile
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(10 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func runAsync(ctx context.Context, migration *Migration) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- migration.Run(ctx)
+	}()
+	return result
+}
+
+func TestRunCancelAborts(t *testing.T) {
+	migration, startedFile, releaseFile := newBlockedMigration(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := runAsync(ctx, migration)
+
+	waitFor(t, func() bool { return fileExists(startedFile) })
+	cancel()
+	waitFor(t, migration.MigrationContext().IsAbortRequested)
+	if err := ioutil.WriteFile(releaseFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := <-result
+	abortErr, isAbortError := err.(*AbortError)
+	test.S(t).ExpectTrue(isAbortError)
+	test.S(t).ExpectEquals(abortErr.Reason, "context: context canceled")
+}
+
+func TestRunReturnsOnPanicAbort(t *testing.T) {
+	migration, startedFile, releaseFile := newBlockedMigration(t)
+	result := runAsync(context.Background(), migration)
+
+	waitFor(t, func() bool { return fileExists(startedFile) })
+	panicErr := errors.New("injected panic abort")
+	migration.MigrationContext().PanicAbort <- panicErr
+	waitFor(t, migration.MigrationContext().IsAbortRequested)
+	if err := ioutil.WriteFile(releaseFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := <-result
+	_, isAbortError := err.(*base.AbortError)
+	test.S(t).ExpectFalse(isAbortError)
+	test.S(t).ExpectEquals(err, panicErr)
+}
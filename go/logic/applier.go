@@ -6,8 +6,10 @@
 package logic
 
 import (
+	"context"
 	gosql "database/sql"
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -105,6 +107,9 @@ func (this *Applier) InitDBConnections() (err error) {
 	if err := this.readTableColumns(); err != nil {
 		return err
 	}
+	if err := this.validateClusterTopology(); err != nil {
+		return err
+	}
 	log.Infof("Applier initiated on %+v, version %+v", this.connectionConfig.ImpliedKey, this.migrationContext.ApplierMySQLVersion)
 	return nil
 }
@@ -120,6 +125,30 @@ func (this *Applier) validateAndReadTimeZone() error {
 	return nil
 }
 
+// validateClusterTopology detects Group Replication and Galera clusters, and checks that cut-over can run on them.
+// Cut-over relies on LOCK TABLES, which on such clusters only ever locks the table on the local node.
+func (this *Applier) validateClusterTopology() error {
+	topology, err := mysql.DetectClusterTopology(this.db)
+	if err != nil {
+		return err
+	}
+	this.migrationContext.ClusterTopology = topology
+	if topology.Type == mysql.AsyncClusterType {
+		return nil
+	}
+	log.Infof("Applier is a member of a %s cluster", topology.String())
+	if topology.RejectsTableLocks() {
+		return fmt.Errorf("Cut-over requires LOCK TABLES, which pxc_strict_mode=%s rejects. Set pxc_strict_mode=PERMISSIVE for the duration of the migration", topology.PxcStrictMode)
+	}
+	if topology.HasLocalTableLocks() {
+		if !this.migrationContext.AllowLocalTableLocks {
+			return fmt.Errorf("On a %s cluster, the cut-over's LOCK TABLES does not block writes through other nodes. If all writes go through %+v, use --allow-local-table-locks", topology.String(), this.connectionConfig.Key)
+		}
+		log.Warningf("--allow-local-table-locks given: cut-over assumes all writes to %s.%s go through %+v", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(this.migrationContext.OriginalTableName), this.connectionConfig.Key)
+	}
+	return nil
+}
+
 // readTableColumns reads table columns on applier
 func (this *Applier) readTableColumns() (err error) {
 	log.Infof("Examining table structure on applier")
@@ -163,10 +192,13 @@ func (this *Applier) ValidateOrDropExistingTables() error {
 		}
 	}
 	if len(this.migrationContext.GetOldTableName()) > mysql.MaxTableNameLength {
-		log.Fatalf("--timestamp-old-table defined, but resulting table name (%s) is too long (only %d characters allowed)", this.migrationContext.GetOldTableName(), mysql.MaxTableNameLength)
+		return fmt.Errorf("--timestamp-old-table defined, but resulting table name (%s) is too long (only %d characters allowed)", this.migrationContext.GetOldTableName(), mysql.MaxTableNameLength)
 	}
 
-	if this.tableExists(this.migrationContext.GetOldTableName()) {
+	if m := this.showTableStatus(this.migrationContext.GetOldTableName()); m != nil {
+		if dropAt, ok := base.ParsePendingDropComment(m.GetString("Comment")); ok {
+			return fmt.Errorf("Table %s already exists, and is pending drop at %s (see --old-table-retention-seconds). Panicking. Run `gh-ost cleanup` to drop it once due, or use --timestamp-old-table", sql.EscapeName(this.migrationContext.GetOldTableName()), dropAt)
+		}
 		return fmt.Errorf("Table %s already exists. Panicking. Use --initially-drop-old-table to force dropping it, though I really prefer that you drop it or rename it away", sql.EscapeName(this.migrationContext.GetOldTableName()))
 	}
 
@@ -211,6 +243,90 @@ func (this *Applier) AlterGhost() error {
 	return nil
 }
 
+// DropGhostSecondaryIndexes drops the non-unique secondary indexes on the ghost table which no foreign key
+// depends on, and returns the dropped indexes. The ghost table is expected to be empty.
+// FULLTEXT and SPATIAL indexes are kept: InnoDB cannot add them back in place without locking the table.
+func (this *Applier) DropGhostSecondaryIndexes() (droppedIndexes [](*sql.IndexDefinition), err error) {
+	createTableStatement, err := this.ShowCreateTable(this.migrationContext.GetGhostTableName())
+	if err != nil {
+		return droppedIndexes, err
+	}
+	foreignKeys := sql.ParseForeignKeyColumnNames(createTableStatement)
+	dropClauses := []string{}
+	for _, index := range sql.ParseIndexDefinitions(createTableStatement) {
+		// The primary key and unique keys are kept, as are indexes serving foreign keys
+		if index.IsUnique {
+			continue
+		}
+		if indexSupportsForeignKey(index, foreignKeys) {
+			log.Debugf("Keeping index %s, on which a foreign key depends", sql.EscapeName(index.Name))
+			continue
+		}
+		if index.IsFulltextOrSpatial() {
+			log.Debugf("Keeping FULLTEXT/SPATIAL index %s", sql.EscapeName(index.Name))
+			continue
+		}
+		droppedIndexes = append(droppedIndexes, index)
+		dropClauses = append(dropClauses, fmt.Sprintf("drop key %s", sql.EscapeName(index.Name)))
+	}
+	if len(droppedIndexes) == 0 {
+		log.Infof("No secondary indexes to defer")
+		return droppedIndexes, nil
+	}
+	query := fmt.Sprintf(`alter /* gh-ost */ table %s.%s %s`,
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(this.migrationContext.GetGhostTableName()),
+		strings.Join(dropClauses, ", "),
+	)
+	log.Infof("Deferring %d secondary indexes on ghost table %s.%s",
+		len(droppedIndexes),
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(this.migrationContext.GetGhostTableName()),
+	)
+	log.Debugf("ALTER statement: %s", query)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return droppedIndexes, err
+	}
+	return droppedIndexes, nil
+}
+
+// AddGhostIndexes adds given indexes onto the ghost table in a single, in-place and non-locking ALTER,
+// such that binlog events keep being applied meanwhile
+func (this *Applier) AddGhostIndexes(indexes [](*sql.IndexDefinition)) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	addClauses := []string{}
+	for _, index := range indexes {
+		addClauses = append(addClauses, fmt.Sprintf("add %s", index.Definition))
+	}
+	query := fmt.Sprintf(`alter /* gh-ost */ table %s.%s %s, algorithm=inplace, lock=none`,
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(this.migrationContext.GetGhostTableName()),
+		strings.Join(addClauses, ", "),
+	)
+	log.Infof("Adding %d deferred indexes on ghost table %s.%s",
+		len(indexes),
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(this.migrationContext.GetGhostTableName()),
+	)
+	log.Debugf("ALTER statement: %s", query)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return err
+	}
+	log.Infof("Deferred indexes added")
+	return nil
+}
+
+func indexSupportsForeignKey(index *sql.IndexDefinition, foreignKeys [][]string) bool {
+	for _, foreignKeyColumnNames := range foreignKeys {
+		if index.SupportsForeignKey(foreignKeyColumnNames) {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateChangelogTable creates the changelog table on the applier host
 func (this *Applier) CreateChangelogTable() error {
 	if err := this.DropChangelogTable(); err != nil {
@@ -271,6 +387,120 @@ func (this *Applier) DropGhostTable() error {
 	return this.dropTable(this.migrationContext.GetGhostTableName())
 }
 
+// MarkTablePendingDrop marks a table, via its comment, to be dropped at given time.
+// See --old-table-retention-seconds
+func (this *Applier) MarkTablePendingDrop(tableName string, dropAt time.Time) error {
+	query := fmt.Sprintf(`alter /* gh-ost */ table %s.%s comment = '%s'`,
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(tableName),
+		base.BuildPendingDropComment(dropAt),
+	)
+	log.Infof("Marking table %s.%s to be dropped at %s",
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(tableName),
+		dropAt,
+	)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadDuePendingDropTables lists tables in the migrated schema which were marked pending drop,
+// and whose retention period is over
+func (this *Applier) ReadDuePendingDropTables() (tableNames []string, err error) {
+	query := `
+		select
+			table_name as table_name,
+			table_comment as table_comment
+		from
+			information_schema.tables
+		where
+			table_schema = ?
+			and table_comment like 'gh-ost-pending-drop:%'
+	`
+	err = sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		if dropAt, ok := base.ParsePendingDropComment(m.GetString("table_comment")); ok && !time.Now().Before(dropAt) {
+			tableNames = append(tableNames, m.GetString("table_name"))
+		}
+		return nil
+	}, this.migrationContext.DatabaseName)
+	return tableNames, err
+}
+
+// ReadTablePartitionNames returns the partitions of a table, or none if the table is not partitioned
+func (this *Applier) ReadTablePartitionNames(tableName string) (partitionNames []string, err error) {
+	query := `
+		select
+			partition_name as partition_name
+		from
+			information_schema.partitions
+		where
+			table_schema = ?
+			and table_name = ?
+			and partition_name is not null
+		order by
+			partition_ordinal_position
+	`
+	err = sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		partitionNames = append(partitionNames, m.GetString("partition_name"))
+		return nil
+	}, this.migrationContext.DatabaseName, tableName)
+	return partitionNames, err
+}
+
+// TruncateTablePartition empties a single partition of a table
+func (this *Applier) TruncateTablePartition(tableName string, partitionName string) error {
+	query := fmt.Sprintf(`alter /* gh-ost */ table %s.%s truncate partition %s`,
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(tableName),
+		sql.EscapeName(partitionName),
+	)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadTablePrimaryKeyRange reads the columns of a table's primary key, and the min and max key values.
+// The values are nil when the table is empty, and the columns are empty when the table has no primary key.
+func (this *Applier) ReadTablePrimaryKeyRange(tableName string) (keyColumns *sql.ColumnList, rangeMinValues, rangeMaxValues *sql.ColumnValues, err error) {
+	if keyColumns, err = readPrimaryKeyColumns(this.db, this.migrationContext.DatabaseName, tableName); err != nil || keyColumns.Len() == 0 {
+		return keyColumns, nil, nil, err
+	}
+	if rangeMinValues, err = readKeyRangeValues(this.db, this.migrationContext.DatabaseName, tableName, keyColumns, sql.BuildUniqueKeyMinValuesPreparedQuery); err != nil {
+		return keyColumns, nil, nil, err
+	}
+	if rangeMaxValues, err = readKeyRangeValues(this.db, this.migrationContext.DatabaseName, tableName, keyColumns, sql.BuildUniqueKeyMaxValuesPreparedQuery); err != nil {
+		return keyColumns, nil, nil, err
+	}
+	return keyColumns, rangeMinValues, rangeMaxValues, nil
+}
+
+// DeleteTableRowsChunk deletes the next primary key range of up to chunk-size rows off a table, starting at
+// rangeStartValues. It returns the values ending the deleted range, which the next chunk starts after, or nil
+// once the range reaches rangeMaxValues. Deleting a bounded key range is idempotent, and may be retried.
+func (this *Applier) DeleteTableRowsChunk(tableName string, keyColumns *sql.ColumnList, rangeStartValues, rangeMaxValues *sql.ColumnValues, includeRangeStartValues bool) (rangeEndValues *sql.ColumnValues, rowsDeleted int64, err error) {
+	rangeEndValues, err = readChunkEndValues(this.db, this.migrationContext.DatabaseName, tableName, keyColumns, rangeStartValues, rangeMaxValues, includeRangeStartValues, atomic.LoadInt64(&this.migrationContext.ChunkSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	deleteRangeEndValues := rangeEndValues
+	if deleteRangeEndValues == nil {
+		deleteRangeEndValues = rangeMaxValues
+	}
+	query, explodedArgs, err := sql.BuildRangeDeletePreparedQuery(this.migrationContext.DatabaseName, tableName, keyColumns, rangeStartValues.AbstractValues(), deleteRangeEndValues.AbstractValues(), includeRangeStartValues)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := sqlutils.ExecNoPrepare(this.db, query, explodedArgs...)
+	if err != nil {
+		return nil, 0, err
+	}
+	rowsDeleted, err = result.RowsAffected()
+	return rangeEndValues, rowsDeleted, err
+}
+
 // WriteChangelog writes a value to the changelog table.
 // It returns the hint as given, for convenience
 func (this *Applier) WriteChangelog(hint, value string) (string, error) {
@@ -629,6 +859,229 @@ func (this *Applier) RenameTablesRollback() (renameError error) {
 	return log.Errore(renameError)
 }
 
+// ShowCreateTable returns the `show create table` statement of given table on the applier host
+func (this *Applier) ShowCreateTable(tableName string) (createTableStatement string, err error) {
+	return mysql.ShowCreateTable(this.db, this.migrationContext.DatabaseName, tableName)
+}
+
+// CanonicalizeCreateTable creates given table definition on a scratch table, and returns the scratch table's
+// `show create table` statement: the definition as canonically formatted by the server. The scratch table is then dropped.
+// Only a single, plain CREATE TABLE statement is accepted. On noop, the scratch table is a temporary table.
+func (this *Applier) CanonicalizeCreateTable(createTableStatement string) (canonicalStatement string, err error) {
+	tableName := this.migrationContext.GetDesiredSchemaTableName()
+	query, err := sql.RenameCreateTableStatement(createTableStatement, this.migrationContext.DatabaseName, tableName)
+	if err != nil {
+		return canonicalStatement, err
+	}
+	if this.migrationContext.Noop {
+		return this.canonicalizeCreateTemporaryTable(query, tableName)
+	}
+	if err := this.dropTable(tableName); err != nil {
+		return canonicalStatement, err
+	}
+	log.Debugf("Creating desired schema table: %s", query)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return canonicalStatement, err
+	}
+	defer this.dropTable(tableName)
+	return this.ShowCreateTable(tableName)
+}
+
+// canonicalizeCreateTemporaryTable creates given definition as a temporary table, which only lives in a
+// dedicated session, and returns its `show create table` statement
+func (this *Applier) canonicalizeCreateTemporaryTable(createTableStatement string, tableName string) (canonicalStatement string, err error) {
+	conn, err := this.db.Conn(context.Background())
+	if err != nil {
+		return canonicalStatement, err
+	}
+	defer conn.Close()
+	query := strings.Replace(createTableStatement, "CREATE TABLE ", "CREATE TEMPORARY TABLE ", 1)
+	log.Debugf("Noop: creating temporary desired schema table: %s", query)
+	if _, err := conn.ExecContext(context.Background(), query); err != nil {
+		return canonicalStatement, err
+	}
+	escapedTableName := fmt.Sprintf("%s.%s", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(tableName))
+	defer conn.ExecContext(context.Background(), fmt.Sprintf(`drop /* gh-ost */ temporary table if exists %s`, escapedTableName))
+
+	var dummy string
+	query = fmt.Sprintf(`show /* gh-ost */ create table %s`, escapedTableName)
+	if err := conn.QueryRowContext(context.Background(), query).Scan(&dummy, &canonicalStatement); err != nil {
+		return canonicalStatement, err
+	}
+	return strings.Replace(canonicalStatement, "CREATE TEMPORARY TABLE ", "CREATE TABLE ", 1), nil
+}
+
+// rowQuerier is either a connection pool or a single session, e.g. the one holding the cut-over lock
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *gosql.Row
+}
+
+// CountTableRows returns the exact number of rows in given table. This can take a while on large tables.
+// A nil querier reads through the applier's connection pool.
+func (this *Applier) CountTableRows(querier rowQuerier, tableName string) (rowCount int64, err error) {
+	if querier == nil {
+		querier = this.db
+	}
+	query := fmt.Sprintf(`select /* gh-ost */ count(*) as count_rows from %s.%s`,
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(tableName),
+	)
+	err = querier.QueryRow(query).Scan(&rowCount)
+	return rowCount, err
+}
+
+// ReadColumnTypes returns a mapping of column name to column type and collation, for given table
+func (this *Applier) ReadColumnTypes(tableName string) (columnTypes map[string]string, err error) {
+	columnTypes = make(map[string]string)
+	query := `
+		select
+				column_name as column_name,
+				column_type as column_type,
+				ifnull(collation_name, '') as collation_name
+			from
+				information_schema.columns
+			where
+				table_schema = ?
+				and table_name = ?
+	`
+	err = sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		columnTypes[m.GetString("column_name")] = fmt.Sprintf("%s %s", m.GetString("column_type"), m.GetString("collation_name"))
+		return nil
+	}, this.migrationContext.DatabaseName, tableName)
+	return columnTypes, err
+}
+
+// ChecksumTableRows checksums a sample of rows on given table: the first
+// `--post-cut-over-validation-checksum-rows` rows as ordered by given key columns.
+// A nil querier reads through the applier's connection pool.
+func (this *Applier) ChecksumTableRows(querier rowQuerier, tableName string, columnNames []string, keyColumns *sql.ColumnList) (rowCount int64, checksum int64, err error) {
+	if querier == nil {
+		querier = this.db
+	}
+	query, err := sql.BuildTableChecksumQuery(
+		this.migrationContext.DatabaseName,
+		tableName,
+		columnNames,
+		keyColumns,
+		this.migrationContext.PostCutOverValidationChecksumRows,
+	)
+	if err != nil {
+		return rowCount, checksum, err
+	}
+	err = querier.QueryRow(query).Scan(&rowCount, &checksum)
+	return rowCount, checksum, err
+}
+
+// ReadIndexScanChunk reads the next chunk of key values off given ghost table index, so as to load index pages
+// into the buffer pool. It returns the last key values read, to be used as the start of the next chunk.
+func (this *Applier) ReadIndexScanChunk(indexName string, keyColumns *sql.ColumnList, rangeStartArgs []interface{}) (rangeEndArgs []interface{}, rowsCount int64, err error) {
+	query, explodedArgs, err := sql.BuildIndexScanChunkPreparedQuery(
+		this.migrationContext.DatabaseName,
+		this.migrationContext.GetGhostTableName(),
+		indexName,
+		keyColumns,
+		rangeStartArgs,
+		atomic.LoadInt64(&this.migrationContext.ChunkSize),
+	)
+	if err != nil {
+		return rangeEndArgs, rowsCount, err
+	}
+	rows, err := this.db.Query(query, explodedArgs...)
+	if err != nil {
+		return rangeEndArgs, rowsCount, err
+	}
+	defer rows.Close()
+
+	rangeEndValues := sql.NewColumnValues(keyColumns.Len())
+	for rows.Next() {
+		if err = rows.Scan(rangeEndValues.ValuesPointers...); err != nil {
+			return rangeEndArgs, rowsCount, err
+		}
+		rowsCount++
+	}
+	if err = rows.Err(); err != nil {
+		return rangeEndArgs, rowsCount, err
+	}
+	return rangeEndValues.AbstractValues(), rowsCount, nil
+}
+
+// ReadRecentSelectStatements returns sample texts of the most recently seen SELECT digests on the migrated table,
+// as recorded by performance_schema (requires MySQL 8.0)
+func (this *Applier) ReadRecentSelectStatements(limit int64) (statements []string, err error) {
+	return this.readStatementSamples("digest_text like 'SELECT %'", "last_seen", limit)
+}
+
+// ReadTopStatements returns sample texts of the top digests on the migrated table, by total execution time,
+// as recorded by performance_schema (requires MySQL 8.0)
+func (this *Applier) ReadTopStatements(limit int64) (statements []string, err error) {
+	return this.readStatementSamples(
+		"(digest_text like 'SELECT %' or digest_text like 'UPDATE %' or digest_text like 'DELETE %' or digest_text like 'INSERT %' or digest_text like 'REPLACE %')",
+		"sum_timer_wait",
+		limit,
+	)
+}
+
+func (this *Applier) readStatementSamples(digestTextCondition string, orderBy string, limit int64) (statements []string, err error) {
+	query := fmt.Sprintf(`
+		select
+				query_sample_text as query_sample_text
+			from
+				performance_schema.events_statements_summary_by_digest
+			where
+				schema_name = ?
+				and %s
+				and digest_text like ?
+				and query_sample_text not like '%%...'
+			order by
+				%s desc
+			limit ?
+	`, digestTextCondition, orderBy)
+	err = sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		statements = append(statements, m.GetString("query_sample_text"))
+		return nil
+	}, this.migrationContext.DatabaseName, fmt.Sprintf("%%`%s`%%", this.migrationContext.OriginalTableName), limit)
+	return statements, err
+}
+
+// ExplainStatement returns the query plan of given statement
+func (this *Applier) ExplainStatement(statement string) (plan []sql.QueryPlanStep, err error) {
+	query := this.migrationContext.GetApplierServerVersion().ExplainStatement(statement)
+	err = sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		plan = append(plan, sql.QueryPlanStep{
+			Table:      m.GetString("table"),
+			AccessType: m.GetString("type"),
+			Key:        m.GetString("key"),
+			Rows:       m.GetInt64("rows"),
+		})
+		return nil
+	})
+	return plan, err
+}
+
+// ExecWarmUpStatement runs given SELECT statement within a read only transaction, and discards its result.
+// The statement is bounded by given deadline, both client side and, via MAX_EXECUTION_TIME, server side.
+func (this *Applier) ExecWarmUpStatement(statement string, deadline time.Time) error {
+	timeout := time.Until(deadline)
+	if timeout < time.Millisecond {
+		return fmt.Errorf("Warm-up deadline reached")
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	tx, err := this.db.BeginTx(ctx, &gosql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, sql.AddMaxExecutionTimeHint(statement, int64(timeout/time.Millisecond)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
 // StopSlaveIOThread is applicable with --test-on-replica; it stops the IO thread, duh.
 // We need to keep the SQL thread active so as to complete processing received events,
 // and have them written to the binary log, so that we can then read them via streamer.
@@ -791,8 +1244,18 @@ func (this *Applier) CreateAtomicCutOverSentryTable() error {
 	return nil
 }
 
+// KillQuery kills the statement running on given session, leaving the session connected
+func (this *Applier) KillQuery(sessionId int64) error {
+	query := fmt.Sprintf(`kill /* gh-ost */ query %d`, sessionId)
+	log.Infof("Killing query on session %d", sessionId)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return err
+	}
+	return nil
+}
+
 // AtomicCutOverMagicLock
-func (this *Applier) AtomicCutOverMagicLock(sessionIdChan chan int64, tableLocked chan<- error, okToUnlockTable <-chan bool, tableUnlocked chan<- error) error {
+func (this *Applier) AtomicCutOverMagicLock(sessionIdChan chan int64, tableLocked chan<- error, okToUnlockTable <-chan bool, tableUnlocked chan<- error, lockedTableReads <-chan func(tx *gosql.Tx), lockTimeoutSeconds int64) error {
 	tx, err := this.db.Begin()
 	if err != nil {
 		tableLocked <- err
@@ -822,7 +1285,7 @@ func (this *Applier) AtomicCutOverMagicLock(sessionIdChan chan int64, tableLocke
 		return err
 	}
 
-	tableLockTimeoutSeconds := this.migrationContext.CutOverLockTimeoutSeconds * 2
+	tableLockTimeoutSeconds := lockTimeoutSeconds * 2
 	log.Infof("Setting LOCK timeout as %d seconds", tableLockTimeoutSeconds)
 	query = fmt.Sprintf(`set session lock_wait_timeout:=%d`, tableLockTimeoutSeconds)
 	if _, err := tx.Exec(query); err != nil {
@@ -859,8 +1322,16 @@ func (this *Applier) AtomicCutOverMagicLock(sessionIdChan chan int64, tableLocke
 	// the UNLOCK must execute (or, alternatively, this connection dies, which gets the same impact)
 
 	// The cut-over phase will proceed to apply remaining backlog onto ghost table,
-	// and issue RENAME. We wait here until told to proceed.
-	<-okToUnlockTable
+	// and issue RENAME. We wait here until told to proceed. Meanwhile, reads of the locked
+	// original table, which only this session may read, are served here.
+	for unlock := false; !unlock; {
+		select {
+		case <-okToUnlockTable:
+			unlock = true
+		case read := <-lockedTableReads:
+			read(tx)
+		}
+	}
 	log.Infof("Will now proceed to drop magic table and unlock tables")
 
 	// The magic table is here because we locked it. And we are the only ones allowed to drop it.
@@ -893,7 +1364,7 @@ func (this *Applier) AtomicCutOverMagicLock(sessionIdChan chan int64, tableLocke
 }
 
 // AtomicCutoverRename
-func (this *Applier) AtomicCutoverRename(sessionIdChan chan int64, tablesRenamed chan<- error) error {
+func (this *Applier) AtomicCutoverRename(sessionIdChan chan int64, tablesRenamed chan<- error, lockTimeoutSeconds int64) error {
 	tx, err := this.db.Begin()
 	if err != nil {
 		return err
@@ -909,8 +1380,9 @@ func (this *Applier) AtomicCutoverRename(sessionIdChan chan int64, tablesRenamed
 	}
 	sessionIdChan <- sessionId
 
-	log.Infof("Setting RENAME timeout as %d seconds", this.migrationContext.CutOverLockTimeoutSeconds)
-	query := fmt.Sprintf(`set session lock_wait_timeout:=%d`, this.migrationContext.CutOverLockTimeoutSeconds)
+	renameLockTimeoutSeconds := lockTimeoutSeconds
+	log.Infof("Setting RENAME timeout as %d seconds", renameLockTimeoutSeconds)
+	query := fmt.Sprintf(`set session lock_wait_timeout:=%d`, renameLockTimeoutSeconds)
 	if _, err := tx.Exec(query); err != nil {
 		return err
 	}
@@ -943,6 +1415,22 @@ func (this *Applier) ShowStatusVariable(variableName string) (result int64, err
 	return result, nil
 }
 
+// ShowInnodbMetric reads the count of an information_schema.innodb_metrics counter
+func (this *Applier) ShowInnodbMetric(metricName string) (result int64, err error) {
+	query := `select /* gh-ost */ count, status from information_schema.innodb_metrics where name = ?`
+	var status string
+	if err := this.db.QueryRow(query, metricName).Scan(&result, &status); err != nil {
+		if err == gosql.ErrNoRows {
+			return 0, fmt.Errorf("Unknown innodb_metrics counter: %s", metricName)
+		}
+		return 0, err
+	}
+	if strings.ToLower(status) != "enabled" {
+		return 0, fmt.Errorf("innodb_metrics counter %s is %s. Enable via: set global innodb_monitor_enable='%s'", metricName, status, metricName)
+	}
+	return result, nil
+}
+
 // updateModifiesUniqueKeyColumns checks whether a UPDATE DML event actually
 // modifies values of the migration's unique key (the iterated key). This will call
 // for special handling.
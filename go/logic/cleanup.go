@@ -0,0 +1,541 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package logic
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gh-ost/go/base"
+	"gh-ost/go/mysql"
+	"gh-ost/go/sql"
+
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+)
+
+const (
+	// A changelog heartbeat more recent than this indicates a running migration
+	cleanupInUseHeartbeatSeconds = 600
+)
+
+// cleanupArtifact is a leftover gh-ost table found on the master
+type cleanupArtifact struct {
+	*base.ArtifactTable
+	DatabaseName string
+	TableRows    int64
+	TableSize    int64
+	// AgeSeconds is the time since last migration activity on this table, or -1 when unknown
+	AgeSeconds int64
+	AgeSource  string
+	InUse      bool
+	// PendingDropAt is set for tables marked by --old-table-retention-seconds
+	PendingDropAt time.Time
+	// Evidence tells how the table is known to have been created by gh-ost, or is empty when it is not
+	Evidence string
+}
+
+func (this *cleanupArtifact) String() string {
+	return fmt.Sprintf("%s.%s", sql.EscapeName(this.DatabaseName), sql.EscapeName(this.TableName))
+}
+
+// Cleaner discovers tables left behind by failed or aborted migrations (ghost, changelog,
+// desired-schema and "old" tables), reports them, and drops them when confirmed.
+type Cleaner struct {
+	connectionConfig *mysql.ConnectionConfig
+	db               *gosql.DB
+	migrationContext *base.MigrationContext
+}
+
+func NewCleaner(migrationContext *base.MigrationContext) *Cleaner {
+	return &Cleaner{
+		migrationContext: migrationContext,
+	}
+}
+
+// Cleanup discovers, reports and (with --cleanup-confirm) drops leftover gh-ost tables
+func (this *Cleaner) Cleanup() error {
+	if this.migrationContext.DatabaseName == "" {
+		return fmt.Errorf("--database must be provided in cleanup mode")
+	}
+	if err := this.initDBConnections(); err != nil {
+		return err
+	}
+	artifacts, err := this.discoverArtifacts()
+	if err != nil {
+		return err
+	}
+	if len(artifacts) == 0 {
+		fmt.Fprintln(os.Stdout, "# No gh-ost artifact tables found")
+		return nil
+	}
+	for _, artifact := range artifacts {
+		fmt.Fprintf(os.Stdout, "%s\trows: ~%d\tsize: %dMB\tage: %s\tstatus: %s\n",
+			artifact.String(), artifact.TableRows, artifact.TableSize/1024/1024, this.formatAge(artifact), this.describeStatus(artifact))
+	}
+	if !this.migrationContext.CleanupConfirm {
+		fmt.Fprintln(os.Stdout, "# Not dropping any table. Provide --cleanup-confirm to drop eligible tables")
+		return nil
+	}
+	for _, artifact := range artifacts {
+		if !this.isEligible(artifact) {
+			continue
+		}
+		if err := this.dropArtifact(artifact); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "# Dropped %s\n", artifact.String())
+	}
+	return nil
+}
+
+// initDBConnections connects to the master, where artifacts are dropped
+func (this *Cleaner) initDBConnections() (err error) {
+	if this.migrationContext.AssumeMasterHostname == "" {
+		log.Infof("Recursively searching for replication master")
+		visitedKeys := mysql.NewInstanceKeyMap()
+		if this.connectionConfig, err = mysql.GetMasterConnectionConfigSafe(this.migrationContext.InspectorConnectionConfig, visitedKeys, this.migrationContext.AllowedMasterMaster); err != nil {
+			return err
+		}
+	} else {
+		key, err := mysql.ParseRawInstanceKeyLoose(this.migrationContext.AssumeMasterHostname)
+		if err != nil {
+			return err
+		}
+		this.connectionConfig = this.migrationContext.InspectorConnectionConfig.DuplicateCredentials(*key)
+		if this.migrationContext.CliMasterUser != "" {
+			this.connectionConfig.User = this.migrationContext.CliMasterUser
+		}
+		if this.migrationContext.CliMasterPassword != "" {
+			this.connectionConfig.Password = this.migrationContext.CliMasterPassword
+		}
+	}
+	log.Infof("Cleaning up on master %+v", this.connectionConfig.Key)
+	if this.db, _, err = mysql.GetDB(this.migrationContext.Uuid, this.connectionConfig.GetDBUri("information_schema")); err != nil {
+		return err
+	}
+	return nil
+}
+
+// discoverArtifacts lists gh-ost artifact tables in --database. A table named like an artifact is only
+// taken to be one when proven so: by a gh-ost changelog table of its migration, or by a pending drop comment.
+// With --cleanup-orphaned-old-tables, an "old" table is also taken to be one when the migrated table exists:
+// successful migrations drop their changelog table, leaving the "old" table orphaned.
+// Changelog tables are listed last, so that an interrupted cleanup still finds them.
+func (this *Cleaner) discoverArtifacts() (artifacts []*cleanupArtifact, err error) {
+	query := `
+		select
+			table_schema,
+			table_name,
+			ifnull(table_rows, 0),
+			ifnull(data_length, 0) + ifnull(index_length, 0),
+			ifnull(timestampdiff(second, create_time, now()), -1),
+			ifnull(timestampdiff(second, update_time, now()), -1),
+			ifnull(table_comment, '')
+		from
+			information_schema.tables
+		where
+			table_type = 'BASE TABLE'
+			and table_schema = ?
+		order by
+			table_name
+	`
+	createTimeAges := map[*cleanupArtifact]int64{}
+	updateTimeAges := map[*cleanupArtifact]int64{}
+	// tableNames lists tables other than artifacts, i.e. potentially migrated tables
+	tableNames := []string{}
+	rows, err := this.db.Query(query, this.migrationContext.DatabaseName)
+	if err != nil {
+		return artifacts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		artifact := &cleanupArtifact{AgeSeconds: -1}
+		var tableName string
+		var createTimeAge, updateTimeAge int64
+		var tableComment string
+		if err := rows.Scan(&artifact.DatabaseName, &tableName, &artifact.TableRows, &artifact.TableSize, &createTimeAge, &updateTimeAge, &tableComment); err != nil {
+			return artifacts, err
+		}
+		if dropAt, ok := base.ParsePendingDropComment(tableComment); ok {
+			artifact.PendingDropAt = dropAt
+			artifact.Evidence = "pending drop comment"
+		}
+		artifactTable, ok := base.ParseArtifactTableName(tableName)
+		if !ok {
+			tableNames = append(tableNames, tableName)
+			continue
+		}
+		artifact.ArtifactTable = artifactTable
+		createTimeAges[artifact] = createTimeAge
+		updateTimeAges[artifact] = updateTimeAge
+		artifacts = append(artifacts, artifact)
+	}
+	if err := rows.Err(); err != nil {
+		return artifacts, err
+	}
+
+	// Changelog heartbeats tell when a migration was last active, as well as whether it still runs
+	changelogAges := map[string]int64{}
+	for _, artifact := range artifacts {
+		if !artifact.IsChangelog() {
+			continue
+		}
+		age, isGhostChangelog, err := this.readChangelogAge(artifact)
+		if err != nil {
+			log.Errorf("Cannot read changelog %s: %+v", artifact.String(), err)
+			continue
+		}
+		if !isGhostChangelog {
+			log.Infof("%s has no gh-ost heartbeat or state entries; not taking it for a gh-ost changelog", artifact.String())
+			continue
+		}
+		changelogAges[this.changelogKey(artifact.DatabaseName, artifact.BaseName)] = age
+	}
+	for _, artifact := range artifacts {
+		age, ok := this.findChangelogAge(changelogAges, artifact)
+		if ok && artifact.Evidence == "" {
+			artifact.Evidence = "changelog"
+		}
+		if ok && age >= 0 {
+			artifact.AgeSeconds = age
+			artifact.AgeSource = "changelog"
+			artifact.InUse = age < cleanupInUseHeartbeatSeconds
+		} else if !artifact.Timestamp.IsZero() {
+			artifact.AgeSeconds = int64(time.Since(artifact.Timestamp).Seconds())
+			artifact.AgeSource = "table name"
+		} else if createTimeAges[artifact] >= 0 {
+			artifact.AgeSeconds = createTimeAges[artifact]
+			artifact.AgeSource = "create time"
+		}
+		if artifact.Evidence == "" && this.isOrphanedOldTable(artifact, tableNames) {
+			artifact.Evidence = "orphaned old table"
+			if artifact.Timestamp.IsZero() {
+				// The "old" table is the migrated table renamed, and keeps its creation time. It is not written to
+				// since cut-over; its update time is unknown when it has not been written to since server restart.
+				artifact.AgeSeconds = updateTimeAges[artifact]
+				artifact.AgeSource = "update time"
+			}
+		}
+	}
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return !artifacts[i].IsChangelog() && artifacts[j].IsChangelog()
+	})
+	return artifacts, nil
+}
+
+// isOrphanedOldTable checks whether, with --cleanup-orphaned-old-tables, an artifact is an "old" table
+// of a migrated table which exists. Base names may be truncated, and so are matched by prefix.
+func (this *Cleaner) isOrphanedOldTable(artifact *cleanupArtifact, tableNames []string) bool {
+	if !this.migrationContext.CleanupOrphanedOldTables || artifact.Suffix != "del" {
+		return false
+	}
+	for _, tableName := range tableNames {
+		if strings.HasPrefix(tableName, artifact.BaseName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Cleaner) changelogKey(databaseName, baseName string) string {
+	return fmt.Sprintf("%s.%s", databaseName, baseName)
+}
+
+// findChangelogAge finds the changelog age of the migration an artifact belongs to. Base names of
+// timestamped "old" tables are more heavily truncated, and so are matched by prefix.
+func (this *Cleaner) findChangelogAge(changelogAges map[string]int64, artifact *cleanupArtifact) (age int64, ok bool) {
+	if age, ok = changelogAges[this.changelogKey(artifact.DatabaseName, artifact.BaseName)]; ok {
+		return age, ok
+	}
+	if artifact.Timestamp.IsZero() {
+		return age, false
+	}
+	keyPrefix := this.changelogKey(artifact.DatabaseName, artifact.BaseName)
+	for key, changelogAge := range changelogAges {
+		if strings.HasPrefix(key, keyPrefix) {
+			return changelogAge, true
+		}
+	}
+	return age, false
+}
+
+// readChangelogAge returns the number of seconds since the changelog table was last written to.
+// isGhostChangelog is true when the table holds the heartbeat or state entries gh-ost writes.
+func (this *Cleaner) readChangelogAge(artifact *cleanupArtifact) (age int64, isGhostChangelog bool, err error) {
+	query := fmt.Sprintf(`
+		select
+			ifnull(timestampdiff(second, max(last_update), now()), -1),
+			count(*)
+		from
+			%s.%s
+		where
+			hint in ('heartbeat', 'state')
+		`,
+		sql.EscapeName(artifact.DatabaseName),
+		sql.EscapeName(artifact.TableName),
+	)
+	var countEntries int64
+	if err = this.db.QueryRow(query).Scan(&age, &countEntries); err != nil {
+		return age, false, err
+	}
+	return age, countEntries > 0, nil
+}
+
+// isEligible checks whether an artifact may be dropped: it must be proven to be made by gh-ost,
+// must not belong to a running migration, and must be known to be older than --cleanup-min-age-seconds.
+// A table marked pending drop is eligible once its retention period is over.
+func (this *Cleaner) isEligible(artifact *cleanupArtifact) bool {
+	if artifact.Evidence == "" {
+		return false
+	}
+	if artifact.InUse {
+		return false
+	}
+	if !artifact.PendingDropAt.IsZero() {
+		return !time.Now().Before(artifact.PendingDropAt)
+	}
+	if artifact.AgeSeconds < 0 {
+		return false
+	}
+	return artifact.AgeSeconds >= this.migrationContext.CleanupMinAgeSeconds
+}
+
+func (this *Cleaner) describeStatus(artifact *cleanupArtifact) string {
+	if artifact.Evidence == "" {
+		if artifact.Suffix == "del" && !this.migrationContext.CleanupOrphanedOldTables {
+			return "no gh-ost changelog or pending drop comment; keeping. See --cleanup-orphaned-old-tables"
+		}
+		return "no gh-ost changelog or pending drop comment; keeping"
+	}
+	if artifact.InUse {
+		return "in use by a running migration"
+	}
+	if !artifact.PendingDropAt.IsZero() && !this.isEligible(artifact) {
+		return fmt.Sprintf("pending drop at %s; keeping", artifact.PendingDropAt)
+	}
+	if artifact.AgeSeconds < 0 && artifact.PendingDropAt.IsZero() {
+		return "unknown age; keeping"
+	}
+	if !this.isEligible(artifact) {
+		return "too recent; keeping"
+	}
+	if this.isLowImpactDrop(artifact) {
+		return "eligible for low impact drop"
+	}
+	return "eligible for drop"
+}
+
+func (this *Cleaner) formatAge(artifact *cleanupArtifact) string {
+	if artifact.AgeSeconds < 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (by %s)", base.PrettifyDurationOutput(time.Duration(artifact.AgeSeconds)*time.Second), artifact.AgeSource)
+}
+
+func (this *Cleaner) isLowImpactDrop(artifact *cleanupArtifact) bool {
+	if !artifact.PendingDropAt.IsZero() {
+		return true
+	}
+	return this.migrationContext.CleanupLowImpactRows > 0 && artifact.TableRows > this.migrationContext.CleanupLowImpactRows
+}
+
+// dropArtifact drops an artifact table. Large tables are first emptied in throttled chunks,
+// so as to avoid a lengthy, stalling DROP TABLE on the master and a replication lag spike.
+func (this *Cleaner) dropArtifact(artifact *cleanupArtifact) error {
+	if this.isLowImpactDrop(artifact) {
+		if err := this.deleteRowsInChunks(artifact); err != nil {
+			return err
+		}
+	}
+	query := fmt.Sprintf(`drop /* gh-ost */ table if exists %s`, artifact.String())
+	log.Infof("Dropping table %s", artifact.String())
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return err
+	}
+	log.Infof("Table dropped")
+	return nil
+}
+
+// deleteRowsInChunks empties a table chunk by chunk, in ascending primary key ranges, following
+// --chunk-size and --nice-ratio, and throttling on flag files and on --throttle-control-replicas lag.
+// Each chunk deletes a bounded key range; an interrupted cleanup resumes from the lowest remaining key.
+func (this *Cleaner) deleteRowsInChunks(artifact *cleanupArtifact) error {
+	keyColumns, err := readPrimaryKeyColumns(this.db, artifact.DatabaseName, artifact.TableName)
+	if err != nil {
+		return err
+	}
+	if keyColumns.Len() == 0 {
+		return fmt.Errorf("%s has no primary key, and cannot be emptied in chunks. Use --cleanup-low-impact-rows=0 to drop it directly", artifact.String())
+	}
+	rangeMinValues, err := readKeyRangeValues(this.db, artifact.DatabaseName, artifact.TableName, keyColumns, sql.BuildUniqueKeyMinValuesPreparedQuery)
+	if err != nil {
+		return err
+	}
+	rangeMaxValues, err := readKeyRangeValues(this.db, artifact.DatabaseName, artifact.TableName, keyColumns, sql.BuildUniqueKeyMaxValuesPreparedQuery)
+	if err != nil {
+		return err
+	}
+	if rangeMinValues == nil || rangeMaxValues == nil {
+		log.Infof("%s is empty", artifact.String())
+		return nil
+	}
+	log.Infof("Deleting rows from %s in chunks of %d, by %s ranges [%s]..[%s]", artifact.String(), atomic.LoadInt64(&this.migrationContext.ChunkSize), keyColumns.String(), rangeMinValues, rangeMaxValues)
+	var totalRowsDeleted int64
+	rangeStartValues := rangeMinValues
+	includeRangeStartValues := true
+	for {
+		this.throttle()
+		startTime := time.Now()
+		rangeEndValues, err := readChunkEndValues(this.db, artifact.DatabaseName, artifact.TableName, keyColumns, rangeStartValues, rangeMaxValues, includeRangeStartValues, atomic.LoadInt64(&this.migrationContext.ChunkSize))
+		if err != nil {
+			return err
+		}
+		isLastChunk := false
+		if rangeEndValues == nil {
+			rangeEndValues = rangeMaxValues
+			isLastChunk = true
+		}
+		query, explodedArgs, err := sql.BuildRangeDeletePreparedQuery(artifact.DatabaseName, artifact.TableName, keyColumns, rangeStartValues.AbstractValues(), rangeEndValues.AbstractValues(), includeRangeStartValues)
+		if err != nil {
+			return err
+		}
+		result, err := sqlutils.ExecNoPrepare(this.db, query, explodedArgs...)
+		if err != nil {
+			return err
+		}
+		rowsDeleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		totalRowsDeleted += rowsDeleted
+		log.Debugf("Deleted %d rows from %s, up to [%s]", totalRowsDeleted, artifact.String(), rangeEndValues)
+		if isLastChunk {
+			break
+		}
+		rangeStartValues = rangeEndValues
+		includeRangeStartValues = false
+		if niceRatio := this.migrationContext.GetNiceRatio(); niceRatio > 0 {
+			time.Sleep(time.Duration(float64(time.Since(startTime)) * niceRatio))
+		}
+	}
+	log.Infof("Deleted %d rows from %s", totalRowsDeleted, artifact.String())
+	return nil
+}
+
+// readPrimaryKeyColumns lists the columns of a table's primary key, in index order. It is used to empty
+// tables chunk by chunk, by the cleaner and ahead of dropping tables on a migration's cleanup.
+func readPrimaryKeyColumns(db *gosql.DB, databaseName, tableName string) (*sql.ColumnList, error) {
+	query := `
+		select
+			column_name
+		from
+			information_schema.statistics
+		where
+			table_schema = ?
+			and table_name = ?
+			and index_name = 'PRIMARY'
+		order by
+			seq_in_index
+	`
+	columnNames := []string{}
+	err := sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		columnNames = append(columnNames, m.GetString("column_name"))
+		return nil
+	}, databaseName, tableName)
+	return sql.NewColumnList(columnNames), err
+}
+
+// readKeyRangeValues reads the min or max key values of a table, or nil when the table is empty
+func readKeyRangeValues(db *gosql.DB, databaseName, tableName string, keyColumns *sql.ColumnList, buildQuery func(databaseName, tableName string, uniqueKeyColumns *sql.ColumnList) (string, error)) (values *sql.ColumnValues, err error) {
+	query, err := buildQuery(databaseName, tableName, keyColumns)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values = sql.NewColumnValues(keyColumns.Len())
+		if err = rows.Scan(values.ValuesPointers...); err != nil {
+			return nil, err
+		}
+	}
+	return values, rows.Err()
+}
+
+// readChunkEndValues reads the key values ending the next chunk, or nil when the remaining rows fit in one chunk
+func readChunkEndValues(db *gosql.DB, databaseName, tableName string, keyColumns *sql.ColumnList, rangeStartValues, rangeMaxValues *sql.ColumnValues, includeRangeStartValues bool, chunkSize int64) (values *sql.ColumnValues, err error) {
+	query, explodedArgs, err := sql.BuildUniqueKeyRangeEndPreparedQueryViaOffset(
+		databaseName,
+		tableName,
+		keyColumns,
+		rangeStartValues.AbstractValues(),
+		rangeMaxValues.AbstractValues(),
+		chunkSize,
+		includeRangeStartValues,
+		"cleanup",
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, explodedArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values = sql.NewColumnValues(keyColumns.Len())
+		if err = rows.Scan(values.ValuesPointers...); err != nil {
+			return nil, err
+		}
+	}
+	return values, rows.Err()
+}
+
+// throttle blocks while a throttle flag file exists or a control replica lags
+func (this *Cleaner) throttle() {
+	for {
+		reason := this.throttleReason()
+		if reason == "" {
+			return
+		}
+		log.Debugf("Throttling cleanup: %s", reason)
+		time.Sleep(time.Second)
+	}
+}
+
+func (this *Cleaner) throttleReason() string {
+	if this.migrationContext.ThrottleFlagFile != "" && base.FileExists(this.migrationContext.ThrottleFlagFile) {
+		return fmt.Sprintf("flag-file %s exists", this.migrationContext.ThrottleFlagFile)
+	}
+	if this.migrationContext.ThrottleAdditionalFlagFile != "" && base.FileExists(this.migrationContext.ThrottleAdditionalFlagFile) {
+		return fmt.Sprintf("flag-file %s exists", this.migrationContext.ThrottleAdditionalFlagFile)
+	}
+	maxLagMillis := atomic.LoadInt64(&this.migrationContext.MaxLagMillisecondsThrottleThreshold)
+	for _, key := range this.migrationContext.GetThrottleControlReplicaKeys().GetInstanceKeys() {
+		connectionConfig := this.migrationContext.InspectorConnectionConfig.DuplicateCredentials(key)
+		db, _, err := mysql.GetDB(this.migrationContext.Uuid, connectionConfig.GetDBUri("information_schema"))
+		if err != nil {
+			return fmt.Sprintf("cannot connect to %+v: %+v", key, err)
+		}
+		lag, err := mysql.GetReplicationLagFromSlaveStatus(db)
+		if err != nil {
+			return fmt.Sprintf("cannot read lag on %+v: %+v", key, err)
+		}
+		if lag.Nanoseconds()/int64(time.Millisecond) > maxLagMillis {
+			return fmt.Sprintf("lag=%fs on %+v", lag.Seconds(), key)
+		}
+	}
+	return ""
+}
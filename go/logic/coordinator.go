@@ -0,0 +1,245 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package logic
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gh-ost/go/base"
+	"gh-ost/go/sql"
+
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+)
+
+const (
+	// coordinationStaleSeconds: a migration not heard of for this long is considered gone
+	coordinationStaleSeconds = 10
+)
+
+// Coordinator registers this migration on the coordination table, and throttles the migration so as to keep
+// within its share of the cluster-wide budget. See doc/coordination.md
+type Coordinator struct {
+	migrationContext *base.MigrationContext
+	db               *gosql.DB
+	isCopying        func() bool
+	tableName        string
+
+	share *base.CoordinationShare
+	peers []*base.CoordinatedMigration
+	mutex *sync.Mutex
+
+	rateLimiter       base.RowsRateLimiter
+	reportRowsCopied  int64
+	reportedAt        time.Time
+	finishedMigrating int64
+}
+
+func NewCoordinator(migrationContext *base.MigrationContext, applier *Applier, isCopying func() bool) *Coordinator {
+	tokens := strings.Split(migrationContext.CoordinationTable, ".")
+	return &Coordinator{
+		migrationContext: migrationContext,
+		db:               applier.db,
+		isCopying:        isCopying,
+		tableName:        fmt.Sprintf("%s.%s", sql.EscapeName(tokens[0]), sql.EscapeName(tokens[1])),
+		share:            &base.CoordinationShare{CopierAllowed: true},
+		mutex:            &sync.Mutex{},
+	}
+}
+
+// InitiateCoordination creates the coordination table if missing, registers this migration, and begins
+// coordinating in the background
+func (this *Coordinator) InitiateCoordination() error {
+	query := fmt.Sprintf(`create /* gh-ost */ table if not exists %s (
+			migration_uuid varchar(64) charset ascii not null,
+			hostname varchar(255) not null,
+			database_name varchar(64) not null,
+			table_name varchar(64) not null,
+			rows_per_second double not null default 0,
+			copying tinyint unsigned not null default 0,
+			throttled tinyint unsigned not null default 0,
+			registered_at timestamp not null default current_timestamp,
+			last_heartbeat timestamp not null default current_timestamp,
+			primary key(migration_uuid)
+		)`, this.tableName)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query); err != nil {
+		return fmt.Errorf("Cannot create coordination table %s: %+v", this.tableName, err)
+	}
+	this.reportedAt = time.Now()
+	if err := this.coordinate(); err != nil {
+		return err
+	}
+	log.Infof("Registered on coordination table %s", this.tableName)
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if atomic.LoadInt64(&this.finishedMigrating) > 0 {
+				return
+			}
+			if err := this.coordinate(); err != nil {
+				log.Errore(err)
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for range ticker.C {
+			if atomic.LoadInt64(&this.finishedMigrating) > 0 {
+				return
+			}
+			this.migrationContext.SetCoordinationThrottleReason(this.throttleReason())
+		}
+	}()
+	return nil
+}
+
+// coordinate reports this migration's state, reads other migrations' states, and computes this migration's share.
+// Upon error, the previous share is kept.
+func (this *Coordinator) coordinate() error {
+	now := time.Now()
+	rowsCopied := this.migrationContext.GetTotalRowsCopied()
+	rowsPerSecond := 0.0
+	if elapsed := now.Sub(this.reportedAt).Seconds(); elapsed > 0 {
+		rowsPerSecond = float64(rowsCopied-this.reportRowsCopied) / elapsed
+	}
+	this.reportRowsCopied = rowsCopied
+	this.reportedAt = now
+
+	throttled, _, _ := this.migrationContext.IsThrottled()
+
+	query := fmt.Sprintf(`
+			insert /* gh-ost */ into %s
+				(migration_uuid, hostname, database_name, table_name, rows_per_second, copying, throttled, last_heartbeat)
+			values
+				(?, ?, ?, ?, ?, ?, ?, now())
+			on duplicate key update
+				rows_per_second=values(rows_per_second),
+				copying=values(copying),
+				throttled=values(throttled),
+				last_heartbeat=values(last_heartbeat)
+		`, this.tableName)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query,
+		this.migrationContext.Uuid, this.migrationContext.Hostname, this.migrationContext.DatabaseName, this.migrationContext.OriginalTableName,
+		rowsPerSecond, this.isCopying(), throttled,
+	); err != nil {
+		return err
+	}
+
+	var unixNow int64
+	migrations := []*base.CoordinatedMigration{}
+	query = fmt.Sprintf(`
+			select /* gh-ost */ migration_uuid, hostname, database_name, table_name, rows_per_second, copying, throttled, unix_timestamp(now()) as unix_now
+			from %s
+			where last_heartbeat >= now() - interval %d second
+		`, this.tableName, coordinationStaleSeconds)
+	err := sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		rowsPerSecond, err := strconv.ParseFloat(m.GetString("rows_per_second"), 64)
+		if err != nil {
+			return err
+		}
+		migrations = append(migrations, &base.CoordinatedMigration{
+			Uuid:          m.GetString("migration_uuid"),
+			Hostname:      m.GetString("hostname"),
+			DatabaseName:  m.GetString("database_name"),
+			TableName:     m.GetString("table_name"),
+			RowsPerSecond: rowsPerSecond,
+			Copying:       m.GetBool("copying"),
+			Throttled:     m.GetBool("throttled"),
+		})
+		unixNow = m.GetInt64("unix_now")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Slots rotate by the master's clock, which all migrations agree on
+	share := base.ComputeCoordinationShare(migrations, this.migrationContext.Uuid,
+		this.migrationContext.CoordinationMaxRowsPerSecond, this.migrationContext.CoordinationMaxActiveCopiers,
+		unixNow/base.CoordinationSliceSeconds,
+	)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if share.CopierAllowed != this.share.CopierAllowed {
+		if share.CopierAllowed {
+			log.Infof("Coordination: acquired copier slot")
+		} else {
+			log.Infof("Coordination: yielding copier slot; %d migrations copying, max %d", share.Copiers, this.migrationContext.CoordinationMaxActiveCopiers)
+		}
+	}
+	this.share = share
+	this.peers = migrations
+	return nil
+}
+
+// throttleReason returns the reason for which this migration should throttle, if any. The rows/sec share is
+// enforced via a token bucket, allowing a burst of one second's share or of one chunk, whichever is larger.
+func (this *Coordinator) throttleReason() string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	now := time.Now()
+	rowsCopied := this.migrationContext.GetTotalRowsCopied()
+	if !this.share.CopierAllowed {
+		this.rateLimiter.Reset(rowsCopied, now)
+		return fmt.Sprintf("coordination: waiting for copier slot; %d copying, max %d", this.share.Copiers, this.migrationContext.CoordinationMaxActiveCopiers)
+	}
+	burst := float64(atomic.LoadInt64(&this.migrationContext.ChunkSize))
+	if this.rateLimiter.Exceeded(this.share.RowsPerSecond, burst, rowsCopied, now) {
+		return fmt.Sprintf("coordination: rows/sec share %.0f", this.share.RowsPerSecond)
+	}
+	return ""
+}
+
+// PrintStatus lists the migrations known to the coordinator
+func (this *Coordinator) PrintStatus(printLine func(line string)) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	rowsShare := "unlimited"
+	if this.share.RowsPerSecond > 0 {
+		rowsShare = fmt.Sprintf("%.0f", this.share.RowsPerSecond)
+	}
+	printLine(fmt.Sprintf("# Coordination: %s; migrations: %d; copying: %d; active copiers: %d; rows/sec share: %s",
+		this.migrationContext.CoordinationTable, len(this.peers), this.share.Copiers, this.share.ActiveCopiers, rowsShare,
+	))
+	for _, peer := range this.peers {
+		if peer.Uuid == this.migrationContext.Uuid {
+			continue
+		}
+		state := "not copying"
+		if peer.Copying {
+			state = "copying"
+		}
+		if peer.Throttled {
+			state = fmt.Sprintf("%s, throttled", state)
+		}
+		printLine(fmt.Sprintf("#   %s.%s on %s: %.0f rows/sec; %s",
+			sql.EscapeName(peer.DatabaseName), sql.EscapeName(peer.TableName), peer.Hostname, peer.RowsPerSecond, state,
+		))
+	}
+}
+
+// Teardown stops coordinating and deregisters this migration
+func (this *Coordinator) Teardown() {
+	if !atomic.CompareAndSwapInt64(&this.finishedMigrating, 0, 1) {
+		return
+	}
+	this.migrationContext.SetCoordinationThrottleReason("")
+	query := fmt.Sprintf(`delete /* gh-ost */ from %s where migration_uuid = ?`, this.tableName)
+	if _, err := sqlutils.ExecNoPrepare(this.db, query, this.migrationContext.Uuid); err != nil {
+		log.Errorf("Failed deregistering from coordination table: %+v", err)
+	}
+}
@@ -0,0 +1,722 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package logic
+
+import (
+	"bufio"
+	gosql "database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gh-ost/go/base"
+	"gh-ost/go/mysql"
+	"gh-ost/go/sql"
+
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+)
+
+type JobState string
+
+const (
+	JobQueued      JobState = "queued"
+	JobRunning     JobState = "running"
+	JobComplete    JobState = "complete"
+	JobFailed      JobState = "failed"
+	JobCancelled   JobState = "cancelled"
+	JobInterrupted JobState = "interrupted"
+)
+
+// JobContextFactory builds a migration context out of gh-ost command line arguments. It also returns
+// the names of flags set by the arguments.
+type JobContextFactory func(args []string) (migrationContext *base.MigrationContext, flagNames []string, err error)
+
+// daemonJobFlags are the flags a submitted job may set. Flags which make the daemon run executables, read
+// configuration or write files on the daemon's host (e.g. --hooks-path, --conf, --events-spill-dir) are not
+// allowed, and neither are daemon and interactive interface settings. A job's postpone flag file is kept
+// in the state directory, whatever the path given.
+var daemonJobFlags = map[string]bool{
+	"host": true, "assume-master-host": true, "port": true, "user": true, "password": true, "master-user": true, "master-password": true,
+	"binlog-source": true, "binlog-source-user": true, "binlog-source-password": true,
+	"ssl": true, "ssl-ca": true, "ssl-cert": true, "ssl-key": true, "ssl-allow-insecure": true,
+	"binlog-source-ssl": true, "binlog-source-ssl-ca": true, "binlog-source-ssl-cert": true, "binlog-source-ssl-key": true, "binlog-source-ssl-allow-insecure": true,
+	"database": true, "table": true, "alter": true, "cluster-name": true, "execute": true,
+	"exact-rowcount": true, "concurrent-rowcount": true, "allow-on-master": true, "allow-master-master": true, "allow-local-table-locks": true,
+	"allow-nullable-unique-key": true, "approve-renamed-columns": true, "skip-renamed-columns": true, "tungsten": true,
+	"discard-foreign-keys": true, "skip-foreign-key-checks": true, "skip-strict-mode": true, "aliyun-rds": true, "gcp": true,
+	"test-on-replica": true, "test-on-replica-skip-replica-stop": true, "migrate-on-replica": true,
+	"ok-to-drop-table": true, "low-impact-drop-old-table": true, "old-table-retention-seconds": true,
+	"initially-drop-old-table": true, "initially-drop-ghost-table": true, "timestamp-old-table": true, "force-table-names": true,
+	"cut-over": true, "force-named-cut-over": true, "force-named-panic": true, "cut-over-lock-timeout-seconds": true,
+	"cut-over-exponential-backoff": true, "exponential-backoff-max-interval": true, "default-retries": true,
+	"switch-to-rbr": true, "assume-rbr": true, "replica-server-id": true,
+	"chunk-size": true, "dml-batch-size": true, "nice-ratio": true, "defer-secondary-indexes": true,
+	"warm-up-ghost-table": true, "warm-up-replay-statements": true, "warm-up-max-seconds": true, "warm-up-max-pages": true,
+	"plan-check-digests": true, "plan-check-rows-factor": true, "plan-check-postpone": true,
+	"post-cut-over-validation": true, "post-cut-over-validation-window-seconds": true, "post-cut-over-validation-max-rows-delta": true, "post-cut-over-validation-checksum-rows": true,
+	"max-lag-millis": true, "replication-lag-query": true, "throttle-control-replicas": true, "heartbeat-interval-millis": true,
+	"discover-throttle-control-replicas": true, "discover-replicas-include": true, "discover-replicas-exclude": true, "discover-replicas-interval-seconds": true,
+	"coordination-table": true, "coordination-max-rows-per-second": true, "coordination-max-active-copiers": true,
+	"max-group-replication-queue": true, "max-wsrep-flow-control-paused": true, "max-wsrep-local-recv-queue": true,
+	"min-binlog-headroom-seconds": true, "binlog-headroom-action": true, "events-spill-max-bytes": true,
+	"throttle-query": true, "throttle-http": true, "throttle-http-method": true, "ignore-http-errors": true,
+	"throttle-flag-file": true, "throttle-additional-flag-file": true, "postpone-cut-over-flag-file": true, "panic-flag-file": true, "abort-flag-file": true, "abort-drop-tables": true,
+	"max-load": true, "critical-load": true, "critical-load-interval-millis": true, "critical-load-hibernate-seconds": true,
+	"quiet": true, "verbose": true, "debug": true, "stack": true,
+}
+
+// Job is a migration run by the daemon
+type Job struct {
+	Id          int64
+	Args        []string
+	Cluster     string
+	Table       string
+	State       JobState
+	Paused      bool
+	Error       string
+	QueueId     int64
+	SubmittedAt time.Time
+	StartedAt   time.Time
+	EndedAt     time.Time
+
+	migrationContext *base.MigrationContext
+}
+
+func (this *Job) isDone() bool {
+	return this.State != JobQueued && this.State != JobRunning
+}
+
+// Daemon is a long running process, which accepts migration jobs via its control socket
+// or from a queue table, and runs them with per-cluster concurrency limits.
+// Job state and status output are persisted in the daemon's state directory.
+type Daemon struct {
+	migrationContext *base.MigrationContext
+	newJobContext    JobContextFactory
+	jobs             map[int64]*Job
+	jobsMutex        *sync.Mutex
+	lastJobId        int64
+	unixListener     net.Listener
+	tcpListener      net.Listener
+	queueDb          *gosql.DB
+	runningJobs      sync.WaitGroup
+	shuttingDown     int64
+}
+
+func NewDaemon(migrationContext *base.MigrationContext, newJobContext JobContextFactory) *Daemon {
+	return &Daemon{
+		migrationContext: migrationContext,
+		newJobContext:    newJobContext,
+		jobs:             make(map[int64]*Job),
+		jobsMutex:        &sync.Mutex{},
+	}
+}
+
+// Run serves the control API and schedules jobs, until Shutdown() is called and running jobs complete
+func (this *Daemon) Run() error {
+	if err := os.MkdirAll(this.migrationContext.DaemonStateDir, 0755); err != nil {
+		return err
+	}
+	if this.migrationContext.DaemonQueueTable != "" {
+		if err := this.initQueueTable(); err != nil {
+			return err
+		}
+	}
+	if err := this.loadJobs(); err != nil {
+		return err
+	}
+	if err := this.bind(); err != nil {
+		return err
+	}
+	go this.serve(this.unixListener, false)
+	go this.serve(this.tcpListener, true)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.LoadInt64(&this.shuttingDown) > 0 {
+			break
+		}
+		if this.queueDb != nil {
+			if err := this.pollQueueTable(); err != nil {
+				log.Errore(err)
+			}
+		}
+		this.scheduleJobs()
+	}
+	log.Infof("Waiting for running jobs to complete")
+	this.runningJobs.Wait()
+	if this.unixListener != nil {
+		this.unixListener.Close()
+	}
+	if this.tcpListener != nil {
+		this.tcpListener.Close()
+	}
+	return nil
+}
+
+// Shutdown stops scheduling new jobs, and gracefully aborts running jobs
+func (this *Daemon) Shutdown() {
+	atomic.StoreInt64(&this.shuttingDown, 1)
+
+	this.jobsMutex.Lock()
+	defer this.jobsMutex.Unlock()
+	for _, job := range this.jobs {
+		if job.State == JobRunning && job.migrationContext != nil {
+			job.migrationContext.RequestAbort("Daemon shutting down")
+		}
+	}
+}
+
+func (this *Daemon) jobFilePath(job *Job, extension string) string {
+	return filepath.Join(this.migrationContext.DaemonStateDir, fmt.Sprintf("job-%d.%s", job.Id, extension))
+}
+
+// loadJobs reads persisted jobs. Jobs which were running when the daemon stopped cannot be resumed.
+func (this *Daemon) loadJobs() error {
+	fileNames, err := filepath.Glob(filepath.Join(this.migrationContext.DaemonStateDir, "job-*.json"))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		job := &Job{}
+		if err := json.Unmarshal(content, job); err != nil {
+			return fmt.Errorf("Cannot read job file %s: %+v", fileName, err)
+		}
+		if job.State == JobRunning {
+			job.State = JobInterrupted
+			job.Error = "Daemon stopped while job was running"
+			job.EndedAt = time.Now()
+			if err := this.persistJob(job); err != nil {
+				return err
+			}
+		}
+		this.jobs[job.Id] = job
+		if job.Id > this.lastJobId {
+			this.lastJobId = job.Id
+		}
+	}
+	log.Infof("Loaded %d jobs from %s", len(this.jobs), this.migrationContext.DaemonStateDir)
+	return nil
+}
+
+// persistJob writes the job's state file. As job arguments may include credentials, the file is only
+// readable by owner. It expects jobsMutex to be held, or the job not to be shared yet.
+func (this *Daemon) persistJob(job *Job) error {
+	content, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(this.jobFilePath(job, "json"), content, 0600); err != nil {
+		return err
+	}
+	if job.QueueId > 0 && this.queueDb != nil {
+		queueState := string(job.State)
+		if job.State == JobQueued {
+			// 'queued' rows are up for grabs; a claimed row must not be claimed again
+			queueState = "submitted"
+		}
+		if err := this.updateQueueTableState(job.QueueId, queueState, job.Error); err != nil {
+			log.Errore(err)
+		}
+	}
+	return nil
+}
+
+// logJob appends a line to the job's log file, which also collects the migration's status output
+func (this *Daemon) logJob(job *Job, format string, args ...interface{}) {
+	f, err := os.OpenFile(this.jobFilePath(job, "log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "# %s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// validateJobArgs checks that a submitted job only sets flags allowed in daemon jobs, see daemonJobFlags
+func (this *Daemon) validateJobArgs(args []string) error {
+	_, flagNames, err := this.newJobContext(args)
+	if err != nil {
+		return err
+	}
+	for _, flagName := range flagNames {
+		if !daemonJobFlags[flagName] {
+			return fmt.Errorf("--%s is not allowed in daemon jobs", flagName)
+		}
+	}
+	return nil
+}
+
+// SubmitJob validates given gh-ost command line arguments and queues a job
+func (this *Daemon) SubmitJob(args []string, queueId int64) (*Job, error) {
+	migrationContext, _, err := this.newJobContext(args)
+	if err != nil {
+		return nil, err
+	}
+	cluster := migrationContext.ClusterName
+	if cluster == "" {
+		cluster = migrationContext.InspectorConnectionConfig.Key.StringCode()
+	}
+
+	this.jobsMutex.Lock()
+	defer this.jobsMutex.Unlock()
+
+	this.lastJobId++
+	job := &Job{
+		Id:          this.lastJobId,
+		Args:        args,
+		Cluster:     cluster,
+		Table:       fmt.Sprintf("%s.%s", sql.EscapeName(migrationContext.DatabaseName), sql.EscapeName(migrationContext.OriginalTableName)),
+		State:       JobQueued,
+		QueueId:     queueId,
+		SubmittedAt: time.Now(),
+	}
+	if err := this.persistJob(job); err != nil {
+		return nil, err
+	}
+	this.jobs[job.Id] = job
+	this.logJob(job, "job %d submitted for %s on %s", job.Id, job.Table, job.Cluster)
+	return job, nil
+}
+
+// scheduleJobs starts queued jobs, in order of submission, as per-cluster concurrency allows
+func (this *Daemon) scheduleJobs() {
+	this.jobsMutex.Lock()
+	defer this.jobsMutex.Unlock()
+
+	runningPerCluster := make(map[string]int64)
+	for _, job := range this.jobs {
+		if job.State == JobRunning {
+			runningPerCluster[job.Cluster]++
+		}
+	}
+	for _, job := range this.sortedJobs() {
+		if job.State != JobQueued || job.Paused {
+			continue
+		}
+		if runningPerCluster[job.Cluster] >= this.migrationContext.DaemonMaxConcurrentPerCluster {
+			continue
+		}
+		runningPerCluster[job.Cluster]++
+		job.State = JobRunning
+		job.StartedAt = time.Now()
+		if err := this.persistJob(job); err != nil {
+			log.Errore(err)
+		}
+		this.runningJobs.Add(1)
+		go this.runJob(job)
+	}
+}
+
+// sortedJobs returns jobs in order of submission. It expects jobsMutex to be held.
+func (this *Daemon) sortedJobs() (jobs []*Job) {
+	for _, job := range this.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Id < jobs[j].Id
+	})
+	return jobs
+}
+
+// runJob runs a migration in-process. Each job gets its own interactive socket in the state directory.
+func (this *Daemon) runJob(job *Job) {
+	defer this.runningJobs.Done()
+
+	err := func() error {
+		migrationContext, _, err := this.newJobContext(job.Args)
+		if err != nil {
+			return err
+		}
+		migrationContext.ReturnOnPanicAbort = true
+		migrationContext.ServeSocketFile = this.jobFilePath(job, "sock")
+		migrationContext.DropServeSocket = true
+		migrationContext.ServeTCPPort = 0
+		if migrationContext.PostponeCutOverFlagFile != "" {
+			migrationContext.PostponeCutOverFlagFile = this.jobFilePath(job, "postpone")
+		}
+		logFile, err := os.OpenFile(this.jobFilePath(job, "log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+		migrationContext.StatusOutput = logFile
+
+		this.jobsMutex.Lock()
+		job.migrationContext = migrationContext
+		if job.Paused {
+			atomic.StoreInt64(&migrationContext.ThrottleCommandedByUser, 1)
+		}
+		this.jobsMutex.Unlock()
+
+		this.logJob(job, "job %d started", job.Id)
+		migrator := NewMigrator(migrationContext)
+		if err := migrator.Migrate(); err != nil {
+			migrator.ExecOnFailureHook()
+			return err
+		}
+		return nil
+	}()
+
+	this.jobsMutex.Lock()
+	defer this.jobsMutex.Unlock()
+
+	job.EndedAt = time.Now()
+	if err == nil {
+		job.State = JobComplete
+	} else if _, isAbortError := err.(*base.AbortError); isAbortError {
+		job.State = JobCancelled
+		job.Error = err.Error()
+	} else {
+		job.State = JobFailed
+		job.Error = err.Error()
+	}
+	this.logJob(job, "job %d %s %s", job.Id, job.State, job.Error)
+	if err := this.persistJob(job); err != nil {
+		log.Errore(err)
+	}
+}
+
+// initQueueTable connects to the server hosting --daemon-queue-table
+func (this *Daemon) initQueueTable() (err error) {
+	tokens := strings.SplitN(this.migrationContext.DaemonQueueTable, ".", 2)
+	if len(tokens) != 2 {
+		return fmt.Errorf("--daemon-queue-table must be in schema.table format. Got: %s", this.migrationContext.DaemonQueueTable)
+	}
+	uri := this.migrationContext.InspectorConnectionConfig.GetDBUri(tokens[0])
+	if this.queueDb, _, err = mysql.GetDB(this.migrationContext.Uuid, uri); err != nil {
+		return err
+	}
+	log.Infof("Polling queue table %s", this.migrationContext.DaemonQueueTable)
+	return nil
+}
+
+func (this *Daemon) queueTableName() string {
+	tokens := strings.SplitN(this.migrationContext.DaemonQueueTable, ".", 2)
+	return fmt.Sprintf("%s.%s", sql.EscapeName(tokens[0]), sql.EscapeName(tokens[1]))
+}
+
+// pollQueueTable claims queued rows of the queue table and submits them as jobs. Rows are claimed
+// with a conditional update, such that multiple daemons may poll the same queue table. Queued jobs
+// are subject to the same flag restrictions as submitted jobs.
+func (this *Daemon) pollQueueTable() error {
+	type queueRow struct {
+		id   int64
+		args string
+	}
+	var rows []queueRow
+	query := fmt.Sprintf(`select id, args from %s where state = 'queued' order by id`, this.queueTableName())
+	err := sqlutils.QueryRowsMap(this.queueDb, query, func(m sqlutils.RowMap) error {
+		rows = append(rows, queueRow{id: m.GetInt64("id"), args: m.GetString("args")})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		claimQuery := fmt.Sprintf(`update %s set state = 'submitted' where id = ? and state = 'queued'`, this.queueTableName())
+		result, err := sqlutils.ExecNoPrepare(this.queueDb, claimQuery, row.id)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			// Claimed by another daemon
+			continue
+		}
+		args, err := base.SplitCommandLineArgs(row.args)
+		if err == nil {
+			err = this.validateJobArgs(args)
+		}
+		if err == nil {
+			_, err = this.SubmitJob(args, row.id)
+		}
+		if err != nil {
+			log.Errorf("Cannot submit queued job %d: %+v", row.id, err)
+			if err := this.updateQueueTableState(row.id, string(JobFailed), err.Error()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (this *Daemon) updateQueueTableState(queueId int64, state string, message string) error {
+	query := fmt.Sprintf(`update %s set state = ?, message = ? where id = ?`, this.queueTableName())
+	_, err := sqlutils.ExecNoPrepare(this.queueDb, query, state, message, queueId)
+	return err
+}
+
+// bind listens on the daemon's control socket file and TCP port. The socket file is made accessible to
+// its owner only. As the daemon runs submitted jobs, its TCP port requires authentication.
+func (this *Daemon) bind() (err error) {
+	if this.migrationContext.ServeSocketFile != "" {
+		if this.migrationContext.DropServeSocket && base.FileExists(this.migrationContext.ServeSocketFile) {
+			os.Remove(this.migrationContext.ServeSocketFile)
+		}
+		if this.unixListener, err = net.Listen("unix", this.migrationContext.ServeSocketFile); err != nil {
+			return err
+		}
+		if err := os.Chmod(this.migrationContext.ServeSocketFile, 0600); err != nil {
+			return err
+		}
+		log.Infof("Listening on unix socket file: %s", this.migrationContext.ServeSocketFile)
+	}
+	if this.migrationContext.ServeTCPPort != 0 {
+		if auth := this.migrationContext.ServeTCPAuth; auth == nil || !auth.RequiresAuthentication() {
+			return fmt.Errorf("Daemon will not serve TCP port %d without authentication. Provide --serve-tcp-tokens-file, or --serve-tcp-tls-ca with --serve-tcp-tls-cert and --serve-tcp-tls-key", this.migrationContext.ServeTCPPort)
+		}
+		if this.tcpListener, err = listenTCP(this.migrationContext); err != nil {
+			return err
+		}
+		log.Infof("Listening on tcp port: %d", this.migrationContext.ServeTCPPort)
+	}
+	return nil
+}
+
+func (this *Daemon) serve(listener net.Listener, overTCP bool) {
+	if listener == nil {
+		return
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if atomic.LoadInt64(&this.shuttingDown) > 0 {
+				return
+			}
+			log.Errore(err)
+			continue
+		}
+		go this.handleConnection(conn, overTCP)
+	}
+}
+
+func (this *Daemon) handleConnection(conn net.Conn, overTCP bool) {
+	defer conn.Close()
+	command, caller, err := readServerCommand(this.migrationContext, conn, overTCP)
+	if err != nil {
+		if err != io.EOF {
+			log.Warningf("Rejected daemon command connection: %+v; %s", err, caller)
+			fmt.Fprintf(conn, "%s\n", err.Error())
+		}
+		return
+	}
+	writer := bufio.NewWriter(conn)
+	defer writer.Flush()
+	if !isReadOnlyDaemonCommand(command) {
+		if !caller.CanMutate() {
+			log.Warningf("Denied daemon command %s; %s", strconv.Quote(command), caller)
+			fmt.Fprintf(writer, "Permission denied: %s is %s\n", caller.Identity, caller.Role)
+			return
+		}
+		log.Infof("Daemon command: %s command=%s", caller, strconv.QuoteToASCII(command))
+	}
+	if err := this.applyCommand(command, writer); err != nil {
+		fmt.Fprintf(writer, "%s\n", err.Error())
+		log.Errore(err)
+	}
+}
+
+// isReadOnlyDaemonCommand returns true when given daemon command changes no job. Interactive commands
+// forwarded to a job via `job <job> <command>` are read-only as per the job's own rules.
+func isReadOnlyDaemonCommand(commandLine string) bool {
+	tokens := strings.Fields(commandLine)
+	if len(tokens) == 0 {
+		return true
+	}
+	switch tokens[0] {
+	case "help", "list", "jobs", "status":
+		return true
+	case "job":
+		return len(tokens) == 3 && isReadOnlyServerCommand(tokens[2])
+	}
+	return false
+}
+
+// applyCommand executes a control command. Job commands take the job id as first argument.
+func (this *Daemon) applyCommand(commandLine string, writer io.Writer) error {
+	tokens := strings.SplitN(strings.TrimSpace(commandLine), " ", 2)
+	command := tokens[0]
+	arg := ""
+	if len(tokens) > 1 {
+		arg = strings.TrimSpace(tokens[1])
+	}
+	switch command {
+	case "help":
+		{
+			fmt.Fprint(writer, `available commands:
+submit <gh-ost arguments>     # Queue a migration job, e.g. submit --host=replica --database=db --table=tbl --alter="engine=innodb" --execute
+list                          # List all jobs
+status <job>                  # Print job's state and migration status
+cancel <job>                  # Cancel a queued job, or gracefully abort a running job
+pause <job>                   # Hold a queued job, or throttle a running job
+resume <job>                  # Release a held job, or end throttling of a running job
+cut-over <job>                # Stop postponing the cut-over of a running job
+job <job> <command>           # Send an interactive command to a running job
+help                          # This message
+`)
+			return nil
+		}
+	case "submit":
+		{
+			args, err := base.SplitCommandLineArgs(arg)
+			if err != nil {
+				return err
+			}
+			if err := this.validateJobArgs(args); err != nil {
+				return err
+			}
+			job, err := this.SubmitJob(args, 0)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(writer, "Submitted job %d\n", job.Id)
+			return nil
+		}
+	case "list", "jobs":
+		{
+			this.jobsMutex.Lock()
+			defer this.jobsMutex.Unlock()
+			for _, job := range this.sortedJobs() {
+				this.printJob(job, writer)
+			}
+			return nil
+		}
+	}
+
+	jobTokens := strings.SplitN(arg, " ", 2)
+	jobId, err := strconv.ParseInt(jobTokens[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Command %s expects a job id. Got: %s", command, jobTokens[0])
+	}
+	switch command {
+	case "status", "cut-over", "job":
+		{
+			// Interactive commands are forwarded without holding the jobs lock
+			forwardCommand, err := this.jobCommandToForward(command, jobId, jobTokens, writer)
+			if err != nil || forwardCommand == "" {
+				return err
+			}
+			return this.forwardJobCommand(jobId, forwardCommand, writer)
+		}
+	}
+
+	this.jobsMutex.Lock()
+	defer this.jobsMutex.Unlock()
+	job, ok := this.jobs[jobId]
+	if !ok {
+		return fmt.Errorf("Unknown job: %d", jobId)
+	}
+	switch command {
+	case "cancel":
+		{
+			if job.State == JobQueued {
+				job.State = JobCancelled
+				job.EndedAt = time.Now()
+				fmt.Fprintf(writer, "Cancelled job %d\n", job.Id)
+				return this.persistJob(job)
+			}
+			if job.State == JobRunning && job.migrationContext != nil {
+				job.migrationContext.RequestAbort("Job cancelled")
+				fmt.Fprintf(writer, "Aborting job %d\n", job.Id)
+				return nil
+			}
+			return fmt.Errorf("Job %d is %s; cannot cancel", job.Id, job.State)
+		}
+	case "pause", "resume":
+		{
+			if job.isDone() {
+				return fmt.Errorf("Job %d is %s; cannot %s", job.Id, job.State, command)
+			}
+			job.Paused = (command == "pause")
+			if job.migrationContext != nil {
+				var throttleCommandedByUser int64
+				if job.Paused {
+					throttleCommandedByUser = 1
+				}
+				atomic.StoreInt64(&job.migrationContext.ThrottleCommandedByUser, throttleCommandedByUser)
+			}
+			this.printJob(job, writer)
+			return this.persistJob(job)
+		}
+	}
+	return fmt.Errorf("Unknown command: %s", command)
+}
+
+// jobCommandToForward validates a job command, and returns the interactive command to send to the job, if any
+func (this *Daemon) jobCommandToForward(command string, jobId int64, jobTokens []string, writer io.Writer) (forwardCommand string, err error) {
+	this.jobsMutex.Lock()
+	defer this.jobsMutex.Unlock()
+	job, ok := this.jobs[jobId]
+	if !ok {
+		return "", fmt.Errorf("Unknown job: %d", jobId)
+	}
+	switch command {
+	case "status":
+		this.printJob(job, writer)
+		if job.State != JobRunning {
+			return "", nil
+		}
+		return "status", nil
+	case "cut-over":
+		forwardCommand = "unpostpone"
+	case "job":
+		if len(jobTokens) < 2 {
+			return "", fmt.Errorf("Command job expects an interactive command to send")
+		}
+		forwardCommand = jobTokens[1]
+	}
+	if job.State != JobRunning {
+		return "", fmt.Errorf("Job %d is %s; cannot %s", job.Id, job.State, command)
+	}
+	return forwardCommand, nil
+}
+
+func (this *Daemon) printJob(job *Job, writer io.Writer) {
+	state := string(job.State)
+	if job.Paused && !job.isDone() {
+		state = fmt.Sprintf("%s (paused)", state)
+	}
+	fmt.Fprintf(writer, "%d\t%s\t%s\t%s\tsubmitted: %s", job.Id, state, job.Cluster, job.Table, job.SubmittedAt.Format(time.RFC3339))
+	if !job.StartedAt.IsZero() {
+		fmt.Fprintf(writer, "\tstarted: %s", job.StartedAt.Format(time.RFC3339))
+	}
+	if !job.EndedAt.IsZero() {
+		fmt.Fprintf(writer, "\tended: %s", job.EndedAt.Format(time.RFC3339))
+	}
+	if job.Error != "" {
+		fmt.Fprintf(writer, "\terror: %s", job.Error)
+	}
+	fmt.Fprintln(writer)
+}
+
+// forwardJobCommand sends an interactive command to a running job's socket, and relays the response
+func (this *Daemon) forwardJobCommand(jobId int64, command string, writer io.Writer) error {
+	conn, err := net.DialTimeout("unix", this.jobFilePath(&Job{Id: jobId}, "sock"), time.Second)
+	if err != nil {
+		return fmt.Errorf("Job %d is not serving interactive commands yet: %+v", jobId, err)
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, conn)
+	return err
+}
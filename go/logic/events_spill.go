@@ -0,0 +1,202 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package logic
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"gh-ost/go/base"
+	"gh-ost/go/binlog"
+
+	"github.com/outbrain/golib/log"
+)
+
+const (
+	// eventsSpillSegmentSize is the approximate size of each spill segment file
+	eventsSpillSegmentSize = 64 * 1024 * 1024
+	// eventsSpillWaitInterval is the interval at which a full spill buffer, or a pending drain, is polled
+	eventsSpillWaitInterval = 100 * time.Millisecond
+)
+
+// EventsSpill buffers binlog DML events on disk, between the streamer and the apply queue. Once the apply
+// queue is full, e.g. while throttled, events are spilled to disk rather than blocking the streamer, which
+// then keeps reading binary logs. Spilled events are forwarded to the apply queue in order. See doc/events-spill.md
+type EventsSpill struct {
+	migrationContext *base.MigrationContext
+	applyEventsQueue chan *applyEventStruct
+	queue            *base.SpillQueue
+	spilledNotify    chan bool
+
+	// spilledEvents and forwardedEvents count events written to, and forwarded off, the spill buffer.
+	// The buffer is drained when both are equal.
+	spilledEvents     int64
+	forwardedEvents   int64
+	finishedMigrating int64
+	// done is closed upon Teardown(), releasing anyone blocked on the apply queue
+	done chan struct{}
+}
+
+// NewEventsSpill creates the spill buffer. As a migration cannot resume off spilled events, spill files
+// left by a previous run of the same migration must be removed first.
+func NewEventsSpill(migrationContext *base.MigrationContext, applyEventsQueue chan *applyEventStruct) (*EventsSpill, error) {
+	prefix := fmt.Sprintf("gh-ost.%s.%s.events", migrationContext.DatabaseName, migrationContext.OriginalTableName)
+	if base.SpillQueueExists(migrationContext.EventsSpillDir, prefix) {
+		return nil, fmt.Errorf("Found spill files of a previous run: %s.*. A migration cannot resume off spilled events; remove them and try again", filepath.Join(migrationContext.EventsSpillDir, prefix))
+	}
+	queue, err := base.NewSpillQueue(migrationContext.EventsSpillDir, prefix, eventsSpillSegmentSize)
+	if err != nil {
+		return nil, err
+	}
+	return &EventsSpill{
+		migrationContext: migrationContext,
+		applyEventsQueue: applyEventsQueue,
+		queue:            queue,
+		spilledNotify:    make(chan bool, 1),
+		done:             make(chan struct{}),
+	}, nil
+}
+
+// isDrained returns true when no spilled event is pending to be forwarded to the apply queue
+func (this *EventsSpill) isDrained() bool {
+	return atomic.LoadInt64(&this.forwardedEvents) == atomic.LoadInt64(&this.spilledEvents)
+}
+
+// Enqueue is called by the streamer for each DML event. The event goes directly to the apply queue when the
+// queue has room and nothing is spilled; otherwise it is spilled to disk, so as to keep the order of events.
+func (this *EventsSpill) Enqueue(dmlEvent *binlog.BinlogDMLEvent) error {
+	if this.isDrained() {
+		select {
+		case this.applyEventsQueue <- newApplyEventStructByDML(dmlEvent):
+			return nil
+		default:
+		}
+	}
+	record, err := dmlEvent.Encode()
+	if err != nil {
+		log.Errorf("Cannot spill binlog event %+v; enqueueing it in memory. err=%+v", dmlEvent, err)
+		return this.enqueueInMemory(dmlEvent)
+	}
+	for this.queue.Size() >= this.migrationContext.EventsSpillMaxBytes {
+		// Spill buffer is full: the streamer pauses until the apply queue consumes some of it
+		if atomic.LoadInt64(&this.finishedMigrating) > 0 || this.migrationContext.IsAbortRequested() {
+			return nil
+		}
+		time.Sleep(eventsSpillWaitInterval)
+	}
+	if err := this.queue.Push(record); err != nil {
+		log.Errorf("Cannot spill binlog event %+v; enqueueing it in memory. err=%+v", dmlEvent, err)
+		return this.enqueueInMemory(dmlEvent)
+	}
+	atomic.AddInt64(&this.spilledEvents, 1)
+	select {
+	case this.spilledNotify <- true:
+	default:
+	}
+	return nil
+}
+
+// enqueueInMemory waits for spilled events to be forwarded, then enqueues the event onto the apply queue.
+// It gives up once the migration aborts or tears down, as the apply queue is then no longer consumed.
+func (this *EventsSpill) enqueueInMemory(dmlEvent *binlog.BinlogDMLEvent) error {
+	this.WaitForwarded(atomic.LoadInt64(&this.spilledEvents))
+	select {
+	case this.applyEventsQueue <- newApplyEventStructByDML(dmlEvent):
+	case <-this.migrationContext.AbortRequested():
+	case <-this.done:
+	}
+	return nil
+}
+
+// SpilledEvents returns the number of events spilled so far
+func (this *EventsSpill) SpilledEvents() int64 {
+	return atomic.LoadInt64(&this.spilledEvents)
+}
+
+// WaitForwarded blocks until given number of spilled events have been forwarded to the apply queue
+func (this *EventsSpill) WaitForwarded(spilledEvents int64) {
+	for atomic.LoadInt64(&this.forwardedEvents) < spilledEvents {
+		if atomic.LoadInt64(&this.finishedMigrating) > 0 || this.migrationContext.IsAbortRequested() {
+			return
+		}
+		time.Sleep(eventsSpillWaitInterval)
+	}
+}
+
+// Forward reads spilled events in order, and forwards them to the apply queue. It should be executed by a goroutine.
+func (this *EventsSpill) Forward() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		if atomic.LoadInt64(&this.finishedMigrating) > 0 {
+			return
+		}
+		record, err := this.queue.Pop()
+		if err != nil {
+			// A spilled event is lost; the ghost table cannot be trusted
+			this.migrationContext.PanicAbort <- fmt.Errorf("Error reading spilled binlog events: %+v", err)
+			return
+		}
+		if record == nil {
+			select {
+			case <-this.spilledNotify:
+			case <-ticker.C:
+			}
+			continue
+		}
+		dmlEvent, err := binlog.DecodeBinlogDMLEvent(record)
+		if err != nil {
+			this.migrationContext.PanicAbort <- fmt.Errorf("Error decoding spilled binlog event: %+v", err)
+			return
+		}
+		select {
+		case this.applyEventsQueue <- newApplyEventStructByDML(dmlEvent):
+			atomic.AddInt64(&this.forwardedEvents, 1)
+		case <-this.migrationContext.AbortRequested():
+			return
+		case <-this.done:
+			return
+		}
+	}
+}
+
+// Status returns a short description of the spill buffer for the status line
+func (this *EventsSpill) Status() string {
+	return fmt.Sprintf("%d events, %.1fMB", this.queue.Len(), float64(this.queue.Size())/1024/1024)
+}
+
+// PrintStatus prints the spill buffer's state and offsets, as part of the status hint
+func (this *EventsSpill) PrintStatus(printLine func(line string)) {
+	readOffset, writeOffset := this.queue.Offsets()
+	printLine(fmt.Sprintf("# Events spill: %s in %s; spilled: %d, forwarded: %d; read offset: %s, write offset: %s",
+		this.Status(),
+		this.migrationContext.EventsSpillDir,
+		atomic.LoadInt64(&this.spilledEvents),
+		atomic.LoadInt64(&this.forwardedEvents),
+		readOffset,
+		writeOffset,
+	))
+}
+
+// Teardown stops forwarding. Spill files are removed once the migration completes; otherwise they are
+// kept, along with their read and write offsets, for inspection.
+func (this *EventsSpill) Teardown(completed bool) {
+	atomic.StoreInt64(&this.finishedMigrating, 1)
+	close(this.done)
+	if completed {
+		if err := this.queue.Remove(); err != nil {
+			log.Errore(err)
+		}
+		return
+	}
+	if err := this.queue.Close(); err != nil {
+		log.Errore(err)
+	}
+	readOffset, writeOffset := this.queue.Offsets()
+	log.Infof("Keeping spill files in %s: %d events, read offset: %s, write offset: %s", this.migrationContext.EventsSpillDir, this.queue.Len(), readOffset, writeOffset)
+}
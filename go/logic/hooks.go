@@ -7,13 +7,21 @@
 package logic
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"gh-ost/go/base"
+	"gh-ost/go/sql"
 	"github.com/outbrain/golib/log"
 )
 
@@ -31,8 +39,39 @@ const (
 	onStatus             = "gh-ost-on-status"
 	onStopReplication    = "gh-ost-on-stop-replication"
 	onStartReplication   = "gh-ost-on-start-replication"
+	onThrottled          = "gh-ost-on-throttled"
+	onUnthrottled        = "gh-ost-on-unthrottled"
+	onCutOverFailed      = "gh-ost-on-cut-over-failed"
+	onBeginHibernate     = "gh-ost-on-begin-hibernate"
+	onEndHibernate       = "gh-ost-on-end-hibernate"
+	onEndPostponed       = "gh-ost-on-end-postponed"
+	onPanic              = "gh-ost-on-panic"
+	onBinlogHeadroomLow  = "gh-ost-on-binlog-headroom-low"
+
+	onPostCutOverValidationFailed = "gh-ost-on-post-cut-over-validation-failed"
 )
 
+const (
+	// hookNotYetExitCode is the exit code (EX_TEMPFAIL) by which an executable hook says "not yet"
+	hookNotYetExitCode = 75
+	// hookNotYetStatusCode is the response status (425 Too Early) by which a webhook says "not yet"
+	hookNotYetStatusCode = 425
+)
+
+// hookNotYetError is returned when a hook asks the migration not to proceed just yet. See onBeforeCutOver
+type hookNotYetError struct {
+	hook string
+}
+
+func (this *hookNotYetError) Error() string {
+	return fmt.Sprintf("hook %s says: not yet", this.hook)
+}
+
+func isHookNotYet(err error) bool {
+	_, ok := err.(*hookNotYetError)
+	return ok
+}
+
 type HooksExecutor struct {
 	migrationContext *base.MigrationContext
 }
@@ -78,12 +117,50 @@ func (this *HooksExecutor) applyEnvironmentVariables(extraVariables ...string) [
 
 // executeHook executes a command, and sets relevant environment variables
 // combined output & error are printed to gh-ost's standard error.
-func (this *HooksExecutor) executeHook(hook string, extraVariables ...string) error {
+// The migration state document is passed on the hook's standard input.
+// With --hooks-timeout-seconds, a hook running for longer is killed and fails.
+func (this *HooksExecutor) executeHook(hook string, payload []byte, extraVariables ...string) error {
 	cmd := exec.Command(hook)
 	cmd.Env = this.applyEnvironmentVariables(extraVariables...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var combinedOutput bytes.Buffer
+	cmd.Stdout = &combinedOutput
+	cmd.Stderr = &combinedOutput
 
-	combinedOutput, err := cmd.CombinedOutput()
-	fmt.Fprintln(os.Stderr, string(combinedOutput))
+	if err := cmd.Start(); err != nil {
+		return log.Errore(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	if this.migrationContext.HooksTimeoutSeconds <= 0 {
+		err := <-done
+		fmt.Fprintln(os.Stderr, combinedOutput.String())
+		return this.hookResult(hook, err)
+	}
+	timeout := time.Duration(this.migrationContext.HooksTimeoutSeconds) * time.Second
+	select {
+	case err := <-done:
+		fmt.Fprintln(os.Stderr, combinedOutput.String())
+		return this.hookResult(hook, err)
+	case <-time.After(timeout):
+	}
+	cmd.Process.Kill()
+	select {
+	case <-done:
+		fmt.Fprintln(os.Stderr, combinedOutput.String())
+	case <-time.After(time.Second):
+		// Output is still held by processes the hook has spawned
+	}
+	return log.Errorf("hook %s timed out after %+v and was killed", hook, timeout)
+}
+
+// hookResult interprets an executable hook's exit status
+func (this *HooksExecutor) hookResult(hook string, err error) error {
+	if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == hookNotYetExitCode {
+		return &hookNotYetError{hook: hook}
+	}
 	return log.Errore(err)
 }
 
@@ -96,57 +173,205 @@ func (this *HooksExecutor) detectHooks(baseName string) (hooks []string, err err
 	return hooks, err
 }
 
+// hookPayload is the migration state document, passed to executable hooks on standard input, and posted
+// to webhooks. It has the information environment variables provide to executable hooks, keyed by lower
+// cased variable name without the GH_OST_ prefix, as well as further migration state.
+func (this *HooksExecutor) hookPayload(baseName string, extraVariables ...string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"event":                baseName,
+		"migration_uuid":       this.migrationContext.Uuid,
+		"database_name":        this.migrationContext.DatabaseName,
+		"table_name":           this.migrationContext.OriginalTableName,
+		"ghost_table_name":     this.migrationContext.GetGhostTableName(),
+		"old_table_name":       this.migrationContext.GetOldTableName(),
+		"ddl":                  this.migrationContext.AlterStatement,
+		"elapsed_seconds":      this.migrationContext.ElapsedTime().Seconds(),
+		"elapsed_copy_seconds": this.migrationContext.ElapsedRowCopyTime().Seconds(),
+		"estimated_rows":       atomic.LoadInt64(&this.migrationContext.RowsEstimate) + atomic.LoadInt64(&this.migrationContext.RowsDeltaEstimate),
+		"copied_rows":          this.migrationContext.GetTotalRowsCopied(),
+		"migrated_host":        this.migrationContext.GetApplierHostname(),
+		"inspected_host":       this.migrationContext.GetInspectorHostname(),
+		"executing_host":       this.migrationContext.Hostname,
+		"inspected_lag":        this.migrationContext.GetCurrentLagDuration().Seconds(),
+		"progress":             this.migrationContext.GetProgressPct(),
+		"hooks_hint":           this.migrationContext.HooksHintMessage,
+		"hooks_hint_owner":     this.migrationContext.HooksHintOwner,
+		"hooks_hint_token":     this.migrationContext.HooksHintToken,
+		"dry_run":              this.migrationContext.Noop,
+	}
+	columnNames := func(columns *sql.ColumnList) []string {
+		if columns == nil {
+			return []string{}
+		}
+		return columns.Names()
+	}
+	payload["original_table_columns"] = columnNames(this.migrationContext.OriginalTableColumns)
+	payload["shared_columns"] = columnNames(this.migrationContext.SharedColumns)
+	payload["mapped_shared_columns"] = columnNames(this.migrationContext.MappedSharedColumns)
+	if uniqueKey := this.migrationContext.UniqueKey; uniqueKey != nil {
+		payload["unique_key"] = map[string]interface{}{
+			"name":    uniqueKey.Name,
+			"columns": uniqueKey.Columns.Names(),
+		}
+	}
+	coordinates := this.migrationContext.GetRecentBinlogCoordinates()
+	payload["binlog_coordinates"] = map[string]interface{}{
+		"log_file": coordinates.LogFile,
+		"log_pos":  coordinates.LogPos,
+	}
+	payload["iteration"] = this.migrationContext.GetIteration()
+	payload["dml_events_applied"] = atomic.LoadInt64(&this.migrationContext.TotalDMLEventsApplied)
+	payload["cut_over_attempts"] = atomic.LoadInt64(&this.migrationContext.CutOverAttempts)
+	isThrottled, throttleReason, _ := this.migrationContext.IsThrottled()
+	payload["throttled"] = isThrottled
+	payload["throttle_reason"] = throttleReason
+	payload["postponing_cut_over"] = atomic.LoadInt64(&this.migrationContext.IsPostponingCutOver) > 0
+	payload["abort_requested"] = this.migrationContext.IsAbortRequested()
+	for _, variable := range extraVariables {
+		tokens := strings.SplitN(variable, "=", 2)
+		if len(tokens) < 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(tokens[0], "GH_OST_"))
+		payload[key] = strings.Trim(tokens[1], "'")
+	}
+	return payload
+}
+
+// executeWebhook POSTs given payload to a webhook, retrying as configured. Any response other than 2xx is an error.
+func (this *HooksExecutor) executeWebhook(webhook *base.Webhook, baseName string, payload []byte) (err error) {
+	client := &http.Client{Timeout: webhook.Timeout}
+	for attempt := int64(0); attempt <= webhook.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhook.RetryInterval)
+		}
+		if err = this.postWebhook(client, webhook, baseName, payload); err == nil || isHookNotYet(err) {
+			return err
+		}
+		log.Warningf("%+v webhook %s: attempt %d failed: %+v", baseName, webhook.Name, attempt+1, err)
+	}
+	return log.Errorf("%+v webhook %s failed: %+v", baseName, webhook.Name, err)
+}
+
+func (this *HooksExecutor) postWebhook(client *http.Client, webhook *base.Webhook, baseName string, payload []byte) error {
+	request, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Gh-Ost-Event", baseName)
+	request.Header.Set("X-Gh-Ost-Migration", this.migrationContext.Uuid)
+	if webhook.Secret != "" {
+		request.Header.Set("X-Gh-Ost-Signature", "sha256="+webhook.Signature(payload))
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode == hookNotYetStatusCode {
+		return &hookNotYetError{hook: webhook.Name}
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("response status: %s", response.Status)
+	}
+	return nil
+}
+
+func (this *HooksExecutor) executeWebhooks(baseName string, payload []byte) error {
+	for _, webhook := range this.migrationContext.GetWebhooks() {
+		if !webhook.HandlesEvent(baseName) {
+			continue
+		}
+		log.Infof("executing %+v webhook: %s", baseName, webhook.Name)
+		if err := this.executeWebhook(webhook, baseName, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (this *HooksExecutor) executeHooks(baseName string, extraVariables ...string) error {
 	hooks, err := this.detectHooks(baseName)
 	if err != nil {
 		return err
 	}
+	webhooks := this.migrationContext.GetWebhooks()
+	if len(hooks) == 0 && len(webhooks) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(this.hookPayload(baseName, extraVariables...))
+	if err != nil {
+		return err
+	}
 	for _, hook := range hooks {
 		log.Infof("executing %+v hook: %+v", baseName, hook)
-		if err := this.executeHook(hook, extraVariables...); err != nil {
+		if err := this.executeHook(hook, payload, extraVariables...); err != nil {
 			return err
 		}
 	}
-	return nil
+	return this.executeWebhooks(baseName, payload)
 }
 
 func (this *HooksExecutor) onStartup() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseStartup)
 	return this.executeHooks(onStartup)
 }
 
 func (this *HooksExecutor) onValidated() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseValidated)
 	return this.executeHooks(onValidated)
 }
 
 func (this *HooksExecutor) onRowCountComplete() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseRowCountComplete)
 	return this.executeHooks(onRowCountComplete)
 }
 func (this *HooksExecutor) onBeforeRowCopy() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseBeforeRowCopy)
 	return this.executeHooks(onBeforeRowCopy)
 }
 
 func (this *HooksExecutor) onRowCopyComplete() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseRowCopyComplete)
 	return this.executeHooks(onRowCopyComplete)
 }
 
 func (this *HooksExecutor) onBeginPostponed() error {
-	return this.executeHooks(onBeginPostponed)
+	this.migrationContext.EmitPhaseChanged(base.PhaseBeginPostponed)
+	if err := this.executeHooks(onBeginPostponed); !isHookNotYet(err) {
+		return err
+	}
+	// Cut-over is being postponed anyway
+	return nil
 }
 
+// onBeforeCutOver runs before-cut-over hooks. A hook may return a hookNotYetError, in which case
+// cut-over is to be postponed and the hooks retried.
 func (this *HooksExecutor) onBeforeCutOver() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseBeforeCutOver)
 	return this.executeHooks(onBeforeCutOver)
 }
 
-func (this *HooksExecutor) onInteractiveCommand(command string) error {
+func (this *HooksExecutor) onInteractiveCommand(command string, caller *base.ServerCaller) error {
 	v := fmt.Sprintf("GH_OST_COMMAND='%s'", command)
-	return this.executeHooks(onInteractiveCommand, v)
+	identity := fmt.Sprintf("GH_OST_COMMAND_IDENTITY=%s", caller.Identity)
+	role := fmt.Sprintf("GH_OST_COMMAND_ROLE=%s", caller.Role)
+	return this.executeHooks(onInteractiveCommand, v, identity, role)
 }
 
 func (this *HooksExecutor) onSuccess() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseSuccess)
 	return this.executeHooks(onSuccess)
 }
 
 func (this *HooksExecutor) onFailure() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseFailure)
+	if this.migrationContext.IsAbortRequested() {
+		v := fmt.Sprintf("GH_OST_ABORT_REASON=%s", this.migrationContext.GetAbortReason())
+		return this.executeHooks(onFailure, v)
+	}
 	return this.executeHooks(onFailure)
 }
 
@@ -156,9 +381,56 @@ func (this *HooksExecutor) onStatus(statusMessage string) error {
 }
 
 func (this *HooksExecutor) onStopReplication() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseStopReplication)
 	return this.executeHooks(onStopReplication)
 }
 
 func (this *HooksExecutor) onStartReplication() error {
+	this.migrationContext.EmitPhaseChanged(base.PhaseStartReplication)
 	return this.executeHooks(onStartReplication)
 }
+
+func (this *HooksExecutor) onThrottled(reason string) error {
+	v := fmt.Sprintf("GH_OST_THROTTLE_REASON=%s", reason)
+	return this.executeHooks(onThrottled, v)
+}
+
+func (this *HooksExecutor) onUnthrottled() error {
+	return this.executeHooks(onUnthrottled)
+}
+
+func (this *HooksExecutor) onCutOverFailed(cutOverError error) error {
+	attempt := fmt.Sprintf("GH_OST_CUT_OVER_ATTEMPT=%d", atomic.LoadInt64(&this.migrationContext.CutOverAttempts))
+	v := fmt.Sprintf("GH_OST_CUT_OVER_ERROR=%s", cutOverError)
+	return this.executeHooks(onCutOverFailed, attempt, v)
+}
+
+func (this *HooksExecutor) onBeginHibernate(reason string, hibernateUntil time.Time) error {
+	until := fmt.Sprintf("GH_OST_HIBERNATE_UNTIL=%s", hibernateUntil.Format(time.RFC3339))
+	v := fmt.Sprintf("GH_OST_CRITICAL_LOAD=%s", reason)
+	return this.executeHooks(onBeginHibernate, until, v)
+}
+
+func (this *HooksExecutor) onEndHibernate() error {
+	return this.executeHooks(onEndHibernate)
+}
+
+func (this *HooksExecutor) onEndPostponed() error {
+	return this.executeHooks(onEndPostponed)
+}
+
+func (this *HooksExecutor) onBinlogHeadroomLow(logFile string, headroom time.Duration) error {
+	file := fmt.Sprintf("GH_OST_BINLOG_FILE=%s", logFile)
+	v := fmt.Sprintf("GH_OST_BINLOG_HEADROOM_SECONDS=%d", int64(headroom.Seconds()))
+	return this.executeHooks(onBinlogHeadroomLow, file, v)
+}
+
+func (this *HooksExecutor) onPostCutOverValidationFailed(validationErr error) error {
+	v := fmt.Sprintf("GH_OST_VALIDATION_ERROR=%s", validationErr)
+	return this.executeHooks(onPostCutOverValidationFailed, v)
+}
+
+func (this *HooksExecutor) onPanic(panicError error) error {
+	v := fmt.Sprintf("GH_OST_PANIC_ERROR=%s", panicError)
+	return this.executeHooks(onPanic, v)
+}
@@ -77,7 +77,7 @@ func (this *Inspector) InitDBConnections() (err error) {
 	if err := this.applyBinlogFormat(); err != nil {
 		return err
 	}
-	log.Infof("Inspector initiated on %+v, version %+v", this.connectionConfig.ImpliedKey, this.migrationContext.InspectorMySQLVersion)
+	log.Infof("Inspector initiated on %+v, version %+v (%s)", this.connectionConfig.ImpliedKey, this.migrationContext.InspectorMySQLVersion, this.migrationContext.GetInspectorServerVersion().Flavor)
 	return nil
 }
 
@@ -221,10 +221,13 @@ func (this *Inspector) validateGrants() error {
 	foundReplicationClient := false
 	foundReplicationSlave := false
 	foundDBAll := false
+	foundSlaveMonitor := false
+	serverVersion := this.migrationContext.GetInspectorServerVersion()
 
 	err := sqlutils.QueryRowsMap(this.db, query, func(rowMap sqlutils.RowMap) error {
 		for _, grantData := range rowMap {
 			grant := grantData.String
+			privileges, level := mysql.ParseGrantPrivileges(grant)
 			if strings.Contains(grant, `GRANT ALL PRIVILEGES ON *.*`) {
 				foundAll = true
 			}
@@ -234,9 +237,19 @@ func (this *Inspector) validateGrants() error {
 			if strings.Contains(grant, `REPLICATION CLIENT`) && strings.Contains(grant, ` ON *.*`) {
 				foundReplicationClient = true
 			}
-			if strings.Contains(grant, `REPLICATION SLAVE`) && strings.Contains(grant, ` ON *.*`) {
+			if privileges["REPLICATION SLAVE"] && level == "*.*" {
+				// Not to be confused with MariaDB's REPLICATION SLAVE ADMIN
 				foundReplicationSlave = true
 			}
+			if serverVersion.IsMariaDB() && level == "*.*" {
+				// As of MariaDB 10.5, REPLICATION CLIENT is named BINLOG MONITOR, and SHOW SLAVE STATUS requires SLAVE MONITOR
+				if privileges["BINLOG MONITOR"] {
+					foundReplicationClient = true
+				}
+				if privileges["SLAVE MONITOR"] || privileges["REPLICA MONITOR"] {
+					foundSlaveMonitor = true
+				}
+			}
 			if strings.Contains(grant, fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.*", this.migrationContext.DatabaseName)) {
 				foundDBAll = true
 			}
@@ -261,6 +274,9 @@ func (this *Inspector) validateGrants() error {
 		log.Infof("User has ALL privileges")
 		return nil
 	}
+	if serverVersion.HasSlaveMonitorPrivilege() && !foundSlaveMonitor && !foundSuper {
+		return log.Errorf("User has insufficient privileges for migration. %s requires SLAVE MONITOR (REPLICA MONITOR) on *.* to read replication status", serverVersion)
+	}
 	if foundSuper && foundReplicationSlave && foundDBAll {
 		log.Infof("User has SUPER, REPLICATION SLAVE privileges, and has ALL privileges on %s.*", sql.EscapeName(this.migrationContext.DatabaseName))
 		return nil
@@ -270,6 +286,9 @@ func (this *Inspector) validateGrants() error {
 		return nil
 	}
 	log.Debugf("Privileges: Super: %t, REPLICATION CLIENT: %t, REPLICATION SLAVE: %t, ALL on *.*: %t, ALL on %s.*: %t", foundSuper, foundReplicationClient, foundReplicationSlave, foundAll, sql.EscapeName(this.migrationContext.DatabaseName), foundDBAll)
+	if serverVersion.HasBinlogMonitorPrivilege() {
+		return log.Errorf("User has insufficient privileges for migration. Needed: SUPER|BINLOG MONITOR, REPLICATION SLAVE and ALL on %s.*", sql.EscapeName(this.migrationContext.DatabaseName))
+	}
 	return log.Errorf("User has insufficient privileges for migration. Needed: SUPER|REPLICATION CLIENT, REPLICATION SLAVE and ALL on %s.*", sql.EscapeName(this.migrationContext.DatabaseName))
 }
 
@@ -302,8 +321,14 @@ func (this *Inspector) restartReplication() error {
 }
 
 // applyBinlogFormat sets ROW binlog format and restarts replication to make
-// the replication thread apply it.
+// the replication thread apply it. With --binlog-source the inspected server's binlog format is left as is.
 func (this *Inspector) applyBinlogFormat() error {
+	if this.migrationContext.HasBinlogSource() {
+		if this.migrationContext.SwitchToRowBinlogFormat {
+			log.Warningf("--switch-to-rbr does not apply with --binlog-source; binlog_format on %s:%d is left as is", this.connectionConfig.Key.Hostname, this.connectionConfig.Key.Port)
+		}
+		return nil
+	}
 	if this.migrationContext.RequiresBinlogFormatChange() {
 		if !this.migrationContext.SwitchToRowBinlogFormat {
 			return fmt.Errorf("Existing binlog_format is %s. Am not switching it to ROW unless you specify --switch-to-rbr", this.migrationContext.OriginalBinlogFormat)
@@ -329,8 +354,13 @@ func (this *Inspector) applyBinlogFormat() error {
 	return nil
 }
 
-// validateBinlogs checks that binary log configuration is good to go
+// validateBinlogs checks that binary log configuration is good to go. With --binlog-source, binary logs
+// are not read off the inspected server, and the binlog source is validated by the streamer instead.
 func (this *Inspector) validateBinlogs() error {
+	if this.migrationContext.HasBinlogSource() {
+		log.Infof("Binary logs are streamed from %s; not validating binary logs on %s:%d", this.migrationContext.GetBinlogSourceConnectionConfig().Key.DisplayString(), this.connectionConfig.Key.Hostname, this.connectionConfig.Key.Port)
+		return nil
+	}
 	query := `select @@global.log_bin, @@global.binlog_format`
 	var hasBinaryLogs bool
 	if err := this.db.QueryRow(query).Scan(&hasBinaryLogs, &this.migrationContext.OriginalBinlogFormat); err != nil {
@@ -366,6 +396,11 @@ func (this *Inspector) validateBinlogs() error {
 	if this.migrationContext.OriginalBinlogRowImage != "FULL" {
 		return fmt.Errorf("%s:%d has '%s' binlog_row_image, and only 'FULL' is supported. This operation cannot proceed. You may `set global binlog_row_image='full'` and try again", this.connectionConfig.Key.Hostname, this.connectionConfig.Key.Port, this.migrationContext.OriginalBinlogRowImage)
 	}
+	if binlogCompressed, err := mysql.IsBinlogCompressed(this.db); err != nil {
+		return err
+	} else if binlogCompressed {
+		return fmt.Errorf("%s:%d has log_bin_compress enabled; compressed binary log events are not supported. You may `set global log_bin_compress=0` and try again", this.connectionConfig.Key.Hostname, this.connectionConfig.Key.Port)
+	}
 
 	log.Infof("binary logs validated on %s:%d", this.connectionConfig.Key.Hostname, this.connectionConfig.Key.Port)
 	return nil
@@ -6,11 +6,14 @@
 package logic
 
 import (
+	gosql "database/sql"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -33,6 +36,9 @@ func ReadChangelogState(s string) ChangelogState {
 	return ChangelogState(strings.Split(s, ":")[0])
 }
 
+// binlogHeadroomCheckInterval is the interval at which binary log retention is read off the streamer's source
+const binlogHeadroomCheckInterval = 10 * time.Second
+
 type tableWriteFunc func() error
 
 type applyEventStruct struct {
@@ -68,6 +74,8 @@ type Migrator struct {
 	eventsStreamer   *EventsStreamer
 	server           *Server
 	throttler        *Throttler
+	coordinator      *Coordinator
+	eventsSpill      *EventsSpill
 	hooksExecutor    *HooksExecutor
 	migrationContext *base.MigrationContext
 
@@ -77,12 +85,29 @@ type Migrator struct {
 	allEventsUpToLockProcessed chan string
 
 	rowCopyCompleteFlag int64
+	rowCopyStartedFlag  int64
 	// copyRowsQueue should not be buffered; if buffered some non-damaging but
 	//  excessive work happens at the end of the iteration as new copy-jobs arrive before realizing the copy is complete
 	copyRowsQueue    chan tableWriteFunc
 	applyEventsQueue chan *applyEventStruct
 
 	handledChangelogStates map[string]bool
+	// deferredIndexes are ghost table indexes dropped ahead of row copy, to be added back once row copy completes
+	deferredIndexes [](*sql.IndexDefinition)
+	ghostTableWarmedUp bool
+	// expectedCreateTableStatement is the ghost table definition, as read just before cut-over
+	expectedCreateTableStatement string
+	// checksumColumnNames and checksumGhostColumnNames are the columns checksummed by cut-over data validation
+	checksumColumnNames      []string
+	checksumGhostColumnNames []string
+	// checksumGhostKeyColumns is the migration's unique key, by ghost table column names
+	checksumGhostKeyColumns *sql.ColumnList
+	// cutOverValidationFailed is set when post cut-over validation failed without rolling back; the old table is then kept
+	cutOverValidationFailed bool
+	// panicAbortError is set when a panic abort ends the migration in-process (see ReturnOnPanicAbort).
+	// It is set by the panic abort listener, and read as the migration concludes
+	panicAbortError      error
+	panicAbortErrorMutex *sync.Mutex
 	//完成数据迁移
 	finishedMigrating int64
 }
@@ -108,6 +133,7 @@ func NewMigrator(context *base.MigrationContext) *Migrator {
 		applyEventsQueue: make(chan *applyEventStruct, base.MaxEventsBatchSize),
 		//处理bin log 变更
 		handledChangelogStates: make(map[string]bool),
+		panicAbortErrorMutex:   &sync.Mutex{},
 		//已完成迁移的数量
 		finishedMigrating: 0,
 	}
@@ -130,6 +156,9 @@ func (this *Migrator) initiateHooksExecutor() (err error) {
 // (or fails with error)
 func (this *Migrator) sleepWhileTrue(operation func() (bool, error)) error {
 	for {
+		if err := this.checkAbort(); err != nil {
+			return err
+		}
 		shouldSleep, err := operation()
 		if err != nil {
 			return err
@@ -149,6 +178,9 @@ func (this *Migrator) retryOperation(operation func() error, notFatalHint ...boo
 			// sleep after previous iteration
 			time.Sleep(1 * time.Second)
 		}
+		if abortErr := this.checkAbort(); abortErr != nil {
+			return abortErr
+		}
 		err = operation()
 		if err == nil {
 			return nil
@@ -178,6 +210,9 @@ func (this *Migrator) retryOperationWithExponentialBackoff(operation func() erro
 		if i != 0 {
 			time.Sleep(time.Duration(interval) * time.Second)
 		}
+		if abortErr := this.checkAbort(); abortErr != nil {
+			return abortErr
+		}
 		err = operation()
 		if err == nil {
 			return nil
@@ -201,9 +236,18 @@ func (this *Migrator) executeAndThrottleOnError(operation func() error) (err err
 
 // consumeRowCopyComplete blocks on the rowCopyComplete channel once, and then
 // consumes and drops any further incoming events that may be left hanging.
-func (this *Migrator) consumeRowCopyComplete() {
-	if err := <-this.rowCopyComplete; err != nil {
-		this.migrationContext.PanicAbort <- err
+// It returns early upon graceful abort.
+func (this *Migrator) consumeRowCopyComplete() error {
+	select {
+	case err := <-this.rowCopyComplete:
+		if abortErr := this.checkAbort(); abortErr != nil {
+			return abortErr
+		}
+		if err != nil {
+			this.migrationContext.PanicAbort <- err
+		}
+	case <-this.migrationContext.AbortRequested():
+		return this.checkAbort()
 	}
 	atomic.StoreInt64(&this.rowCopyCompleteFlag, 1)
 	this.migrationContext.MarkRowCopyEndTime()
@@ -214,12 +258,24 @@ func (this *Migrator) consumeRowCopyComplete() {
 			}
 		}
 	}()
+	return nil
 }
 
 func (this *Migrator) canStopStreaming() bool {
+	if this.migrationContext.IsAbortRequested() {
+		return true
+	}
 	return atomic.LoadInt64(&this.migrationContext.CutOverCompleteFlag) != 0
 }
 
+// checkAbort returns an abort error if graceful abort has been requested
+func (this *Migrator) checkAbort() error {
+	if !this.migrationContext.IsAbortRequested() {
+		return nil
+	}
+	return &base.AbortError{Reason: this.migrationContext.GetAbortReason()}
+}
+
 // onChangelogStateEvent is called when a binlog event operation on the changelog table is intercepted.
 func (this *Migrator) onChangelogStateEvent(dmlEvent *binlog.BinlogDMLEvent) (err error) {
 	// Hey, I created the changelog table, I know the type of columns it has!
@@ -245,7 +301,15 @@ func (this *Migrator) onChangelogStateEvent(dmlEvent *binlog.BinlogDMLEvent) (er
 			// or have event functions in applyEventsQueue.
 			// So as not to create a potential deadlock, we write this func to applyEventsQueue
 			// asynchronously, understanding it doesn't really matter.
+			// Events spilled to disk are yet to reach applyEventsQueue, though, and must precede this func.
+			var spilledEvents int64
+			if this.eventsSpill != nil {
+				spilledEvents = this.eventsSpill.SpilledEvents()
+			}
 			go func() {
+				if this.eventsSpill != nil {
+					this.eventsSpill.WaitForwarded(spilledEvents)
+				}
 				this.applyEventsQueue <- newApplyEventStructByFunc(&applyEventFunc)
 			}()
 		}
@@ -260,8 +324,47 @@ func (this *Migrator) onChangelogStateEvent(dmlEvent *binlog.BinlogDMLEvent) (er
 // 监听是否有panic发生，其实是
 // listenOnPanicAbort aborts on abort request
 func (this *Migrator) listenOnPanicAbort() {
-	err := <-this.migrationContext.PanicAbort
-	log.Fatale(err)
+	for err := range this.migrationContext.PanicAbort {
+		if this.migrationContext.IsAbortRequested() {
+			// Errors are expected while aborting, as tables are being dropped
+			log.Errorf("Error while aborting: %+v", err)
+			continue
+		}
+		if this.hooksExecutor != nil {
+			this.hooksExecutor.onPanic(err)
+		}
+		if this.migrationContext.ReturnOnPanicAbort {
+			log.Errore(err)
+			this.setPanicAbortError(err)
+			this.migrationContext.RequestAbort(fmt.Sprintf("panic: %+v", err))
+			continue
+		}
+		log.Fatale(err)
+	}
+}
+
+func (this *Migrator) setPanicAbortError(err error) {
+	this.panicAbortErrorMutex.Lock()
+	defer this.panicAbortErrorMutex.Unlock()
+	if this.panicAbortError == nil {
+		this.panicAbortError = err
+	}
+}
+
+func (this *Migrator) getPanicAbortError() error {
+	this.panicAbortErrorMutex.Lock()
+	defer this.panicAbortErrorMutex.Unlock()
+	return this.panicAbortError
+}
+
+// parseAndValidateStatement parses the ALTER statement and validates it
+func (this *Migrator) parseAndValidateStatement() (err error) {
+	//解析变更sql,获得到将原始表名命名为新的表名 若出错 直接返回错误
+	if err := this.parser.ParseAlterStatement(this.migrationContext.AlterStatement); err != nil {
+		return err
+	}
+	//检查这个表的类是否符合重命名的条件
+	return this.validateStatement()
 }
 
 // validateStatement validates the `alter` statement meets criteria.
@@ -340,31 +443,38 @@ func (this *Migrator) Migrate() (err error) {
 		return err
 	}
 
-	//单起一个协程去监听是否panic退出
-	go this.listenOnPanicAbort()
-
 	//检查钩子执行器是否初始化成功
 	if err := this.initiateHooksExecutor(); err != nil {
 		return err
 	}
+	//单起一个协程去监听是否panic退出；监听者会执行 onPanic 钩子，因此在钩子执行器初始化之后启动
+	go this.listenOnPanicAbort()
 	//钩子执行器启动
 	if err := this.hooksExecutor.onStartup(); err != nil {
 
 		return err
 	}
-	//解析变更sql,获得到将原始表名命名为新的表名 若出错 直接返回错误
-	if err := this.parser.ParseAlterStatement(this.migrationContext.AlterStatement); err != nil {
-		return err
-	}
-	//检查这个表的类是否符合重命名的条件
-		if err := this.validateStatement(); err != nil {
-		return err
+	//解析并校验变更sql；使用 --desired-schema 时，变更sql要在连接数据库后才能计算出来
+	if this.migrationContext.DesiredSchemaFile == "" {
+		if err := this.parseAndValidateStatement(); err != nil {
+			return err
+		}
 	}
 
 	// After this point, we'll need to teardown anything that's been started
 	//   so we don't leave things hanging around
 	defer this.teardown()
+	//优雅中止：有序停止迁移，并按策略清理表
+	defer func() {
+		if err != nil && this.migrationContext.IsAbortRequested() {
+			err = this.cleanupAfterAbort(err)
+		}
+	}()
 
+	// An abort requested meanwhile, e.g. while startup hooks ran, ends the migration before connecting
+	if err := this.checkAbort(); err != nil {
+		return err
+	}
 	if err := this.initiateInspector(); err != nil {
 		return err
 	}
@@ -381,7 +491,11 @@ func (this *Migrator) Migrate() (err error) {
 
 	initialLag, _ := this.inspector.getReplicationLag()
 	log.Infof("Waiting for ghost table to be migrated. Current lag is %+v", initialLag)
-	<-this.ghostTableMigrated
+	select {
+	case <-this.ghostTableMigrated:
+	case <-this.migrationContext.AbortRequested():
+		return this.checkAbort()
+	}
 	log.Debugf("ghost table migrated")
 	// Yay! We now know the Ghost and Changelog tables are good to examine!
 	// When running on replica, this means the replica has those tables. When running
@@ -394,6 +508,9 @@ func (this *Migrator) Migrate() (err error) {
 	if err := this.hooksExecutor.onValidated(); err != nil {
 		return err
 	}
+	if err := this.deferSecondaryIndexes(); err != nil {
+		return err
+	}
 	// todo ????????????????????????????? 问大佬，这是怎么回事？？？？
 	if err := this.initiateServer(); err != nil {
 		return err
@@ -409,6 +526,9 @@ func (this *Migrator) Migrate() (err error) {
 	if err := this.applier.ReadMigrationRangeValues(); err != nil {
 		return err
 	}
+	if err := this.initiateCoordinator(); err != nil {
+		return err
+	}
 	if err := this.initiateThrottler(); err != nil {
 		return err
 	}
@@ -418,36 +538,54 @@ func (this *Migrator) Migrate() (err error) {
 	go this.executeWriteFuncs()
 	go this.iterateChunks()
 	this.migrationContext.MarkRowCopyStartTime()
+	atomic.StoreInt64(&this.rowCopyStartedFlag, 1)
 	go this.initiateStatus()
 
 	log.Debugf("Operating until row copy is complete")
-	this.consumeRowCopyComplete()
+	if err := this.consumeRowCopyComplete(); err != nil {
+		return err
+	}
 	log.Infof("Row copy complete")
 	if err := this.hooksExecutor.onRowCopyComplete(); err != nil {
 		return err
 	}
+	//行复制完成后再添加延迟的二级索引；索引添加完成前不会切换
+	if err := this.addDeferredIndexes(); err != nil {
+		return err
+	}
+	//对比原表与鬼表上热点语句的执行计划
+	this.checkQueryPlans()
 	this.printStatus(ForcePrintStatusRule)
 
-	if err := this.hooksExecutor.onBeforeCutOver(); err != nil {
+	if err := this.runBeforeCutOverHooks(); err != nil {
 		return err
 	}
 	var retrier func(func() error, ...bool) error
-	if this.migrationContext.CutOverExponentialBackoff {
+	if this.migrationContext.GetCutOverExponentialBackoff() {
 		retrier = this.retryOperationWithExponentialBackoff
 	} else {
 		retrier = this.retryOperation
 	}
+	if err := this.prepareCutOverValidation(); err != nil {
+		return err
+	}
 	if err := retrier(this.cutOver); err != nil {
 		return err
 	}
 	atomic.StoreInt64(&this.migrationContext.CutOverCompleteFlag, 1)
-
-	if err := this.finalCleanup(); err != nil {
-		return nil
+	//切换后验证，失败则回滚切换
+	if err := this.postCutOverValidation(); err != nil {
+		return err
 	}
+
+	// The migration succeeded as of cut-over; dropping the old table, possibly in throttled chunks, follows the success hook
 	if err := this.hooksExecutor.onSuccess(); err != nil {
 		return err
 	}
+	if err := this.finalCleanup(); err != nil {
+		log.Errore(err)
+		return nil
+	}
 	log.Infof("Done migrating %s.%s", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(this.migrationContext.OriginalTableName))
 	return nil
 }
@@ -459,6 +597,7 @@ func (this *Migrator) ExecOnFailureHook() (err error) {
 }
 
 func (this *Migrator) handleCutOverResult(cutOverError error) (err error) {
+	this.migrationContext.EmitEvent(&base.MigrationEvent{Type: base.CutOverEvent, Error: cutOverError})
 	if this.migrationContext.TestOnReplica {
 		// We're merely testing, we don't want to keep this state. Rollback the renames as possible
 		this.applier.RenameTablesRollback()
@@ -467,6 +606,7 @@ func (this *Migrator) handleCutOverResult(cutOverError error) (err error) {
 		return nil
 	}
 	// Only on error:
+	this.hooksExecutor.onCutOverFailed(cutOverError)
 
 	if this.migrationContext.TestOnReplica {
 		// With `--test-on-replica` we stop replication thread, and then proceed to use
@@ -502,31 +642,41 @@ func (this *Migrator) cutOver() (err error) {
 
 	this.migrationContext.MarkPointOfInterest()
 	log.Debugf("checking for cut-over postpone")
-	this.sleepWhileTrue(
+	if err := this.sleepWhileTrue(
 		func() (bool, error) {
-			if this.migrationContext.PostponeCutOverFlagFile == "" {
-				return false, nil
+			if atomic.LoadInt64(&this.migrationContext.QueryPlanApprovalPendingFlag) > 0 {
+				// Query plan regressions await user approval
+				return this.postponeCutOver()
 			}
 			if atomic.LoadInt64(&this.migrationContext.UserCommandedUnpostponeFlag) > 0 {
 				atomic.StoreInt64(&this.migrationContext.UserCommandedUnpostponeFlag, 0)
 				return false, nil
 			}
+			if this.migrationContext.IsCutOverPostponedByUser() {
+				return this.postponeCutOver()
+			}
+			if this.migrationContext.PostponeCutOverFlagFile == "" {
+				return false, nil
+			}
 			if base.FileExists(this.migrationContext.PostponeCutOverFlagFile) {
 				// Postpone file defined and exists!
-				if atomic.LoadInt64(&this.migrationContext.IsPostponingCutOver) == 0 {
-					if err := this.hooksExecutor.onBeginPostponed(); err != nil {
-						return true, err
-					}
-				}
-				atomic.StoreInt64(&this.migrationContext.IsPostponingCutOver, 1)
-				return true, nil
+				return this.postponeCutOver()
 			}
 			return false, nil
 		},
-	)
-	atomic.StoreInt64(&this.migrationContext.IsPostponingCutOver, 0)
+	); err != nil {
+		atomic.StoreInt64(&this.migrationContext.IsPostponingCutOver, 0)
+		return err
+	}
+	if atomic.SwapInt64(&this.migrationContext.IsPostponingCutOver, 0) > 0 {
+		if err := this.hooksExecutor.onEndPostponed(); err != nil {
+			return err
+		}
+	}
 	this.migrationContext.MarkPointOfInterest()
 	log.Debugf("checking for cut-over postpone: complete")
+	//切换前预热鬼表，使其热点页常驻 buffer pool
+	this.warmUpGhostTable()
 
     //todo 这个参数的意思是--test-on-replica，告诉ghost这是在预检查？？？
 	if this.migrationContext.TestOnReplica {
@@ -546,26 +696,32 @@ func (this *Migrator) cutOver() (err error) {
 			}
 		}
 	}
+	// Streamer and write funcs stop upon abort; locking the original table then would block writes in vain
+	if err := this.checkAbort(); err != nil {
+		return err
+	}
+	atomic.AddInt64(&this.migrationContext.CutOverAttempts, 1)
+	cutOverType := this.migrationContext.GetCutOverType()
 	//todo 判断是是否是自动cutOver
-	if this.migrationContext.CutOverType == base.CutOverAtomic {
+	if cutOverType == base.CutOverAtomic {
 		// Atomic solution: we use low timeout and multiple attempts. But for
 		// each failed attempt, we throttle until replication lag is back to normal
 		err := this.atomicCutOver()
 		this.handleCutOverResult(err)
 		return err
 	}
-	if this.migrationContext.CutOverType == base.CutOverTwoStep {
+	if cutOverType == base.CutOverTwoStep {
 		err := this.cutOverTwoStep()
 		this.handleCutOverResult(err)
 		return err
 	}
-	return log.Fatalf("Unknown cut-over type: %d; should never get here!", this.migrationContext.CutOverType)
+	return log.Errorf("Unknown cut-over type: %d; should never get here!", cutOverType)
 }
 
 // Inject the "AllEventsUpToLockProcessed" state hint, wait for it to appear in the binary logs,
 // make sure the queue is drained.
-func (this *Migrator) waitForEventsUpToLock() (err error) {
-	timeout := time.NewTimer(time.Second * time.Duration(this.migrationContext.CutOverLockTimeoutSeconds))
+func (this *Migrator) waitForEventsUpToLock(lockTimeoutSeconds int64) (err error) {
+	timeout := time.NewTimer(time.Second * time.Duration(lockTimeoutSeconds))
 
 	this.migrationContext.MarkPointOfInterest()
 	waitForEventsUpToLockStartTime := time.Now()
@@ -602,6 +758,48 @@ func (this *Migrator) waitForEventsUpToLock() (err error) {
 	return nil
 }
 
+// postponeCutOver marks cut-over as postponed, running the on-begin-postponed hook upon first postponement
+func (this *Migrator) postponeCutOver() (bool, error) {
+	if atomic.LoadInt64(&this.migrationContext.IsPostponingCutOver) == 0 {
+		if err := this.hooksExecutor.onBeginPostponed(); err != nil {
+			return true, err
+		}
+	}
+	atomic.StoreInt64(&this.migrationContext.IsPostponingCutOver, 1)
+	return true, nil
+}
+
+// runBeforeCutOverHooks runs the before-cut-over hooks. While a hook says "not yet", cut-over is postponed,
+// and the hooks are retried every --hooks-not-yet-retry-seconds. An 'unpostpone' command overrides hooks.
+func (this *Migrator) runBeforeCutOverHooks() error {
+	for {
+		err := this.hooksExecutor.onBeforeCutOver()
+		if !isHookNotYet(err) {
+			return err
+		}
+		if atomic.LoadInt64(&this.migrationContext.UserCommandedUnpostponeFlag) > 0 {
+			log.Infof("%+v; overridden by user command", err)
+			return nil
+		}
+		log.Infof("%+v; postponing cut-over for %d seconds", err, this.migrationContext.HooksNotYetRetrySeconds)
+		if _, err := this.postponeCutOver(); err != nil {
+			return err
+		}
+		retryAt := time.Now().Add(time.Duration(this.migrationContext.HooksNotYetRetrySeconds) * time.Second)
+		err = this.sleepWhileTrue(
+			func() (bool, error) {
+				if atomic.LoadInt64(&this.migrationContext.UserCommandedUnpostponeFlag) > 0 {
+					return false, nil
+				}
+				return time.Now().Before(retryAt), nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+}
+
 // cutOverTwoStep will lock down the original table, execute
 // what's left of last DML entries, and **non-atomically** swap original->old, then new->original.
 // There is a point in time where the "original" table does not exist and queries are non-blocked
@@ -610,14 +808,23 @@ func (this *Migrator) cutOverTwoStep() (err error) {
 	atomic.StoreInt64(&this.migrationContext.InCutOverCriticalSectionFlag, 1)
 	defer atomic.StoreInt64(&this.migrationContext.InCutOverCriticalSectionFlag, 0)
 	atomic.StoreInt64(&this.migrationContext.AllEventsUpToLockProcessedInjectedFlag, 0)
+	// --cut-over-lock-timeout-seconds may change via interactive command; it is read once per attempt
+	lockTimeoutSeconds := this.migrationContext.GetCutOverLockTimeoutSeconds()
 
 	if err := this.retryOperation(this.applier.LockOriginalTable); err != nil {
 		return err
 	}
 
-	if err := this.retryOperation(this.waitForEventsUpToLock); err != nil {
+	if err := this.retryOperation(func() error {
+		return this.waitForEventsUpToLock(lockTimeoutSeconds)
+	}); err != nil {
 		return err
 	}
+	// The original table is locked by the applier's singleton session, which alone may read it
+	if err := this.validateCutOverData(this.applier.singletonDB); err != nil {
+		this.applier.UnlockTables()
+		return log.Errore(err)
+	}
 	if err := this.retryOperation(this.applier.SwapTablesQuickAndBumpy); err != nil {
 		return err
 	}
@@ -643,12 +850,15 @@ func (this *Migrator) atomicCutOver() (err error) {
 	}()
 
 	atomic.StoreInt64(&this.migrationContext.AllEventsUpToLockProcessedInjectedFlag, 0)
+	// --cut-over-lock-timeout-seconds may change via interactive command; it is read once per attempt
+	lockTimeoutSeconds := this.migrationContext.GetCutOverLockTimeoutSeconds()
 
 	lockOriginalSessionIdChan := make(chan int64, 2)
 	tableLocked := make(chan error, 2)
 	tableUnlocked := make(chan error, 2)
+	lockedTableReads := make(chan func(tx *gosql.Tx), 1)
 	go func() {
-		if err := this.applier.AtomicCutOverMagicLock(lockOriginalSessionIdChan, tableLocked, okToUnlockTable, tableUnlocked); err != nil {
+		if err := this.applier.AtomicCutOverMagicLock(lockOriginalSessionIdChan, tableLocked, okToUnlockTable, tableUnlocked, lockedTableReads, lockTimeoutSeconds); err != nil {
 			log.Errore(err)
 		}
 	}()
@@ -659,9 +869,31 @@ func (this *Migrator) atomicCutOver() (err error) {
 	log.Infof("Session locking original & magic tables is %+v", lockOriginalSessionId)
 	// At this point we know the original table is locked.
 	// We know any newly incoming DML on original table is blocked.
-	if err := this.waitForEventsUpToLock(); err != nil {
+	if err := this.waitForEventsUpToLock(lockTimeoutSeconds); err != nil {
 		return log.Errore(err)
 	}
+	// Original and ghost tables are now expected to be identical. The original table is read by the locking session.
+	dataValidated := make(chan error, 1)
+	lockedTableReads <- func(tx *gosql.Tx) {
+		dataValidated <- this.validateCutOverData(tx)
+	}
+	select {
+	case err := <-dataValidated:
+		if err != nil {
+			return log.Errore(err)
+		}
+	case <-this.migrationContext.AbortRequested():
+		// Interrupt the locked read so that the original table is unlocked right away
+		if err := this.applier.KillQuery(lockOriginalSessionId); err != nil {
+			log.Errore(err)
+		}
+		return this.checkAbort()
+	case <-time.After(time.Duration(this.migrationContext.PostCutOverValidationWindowSeconds) * time.Second):
+		if err := this.applier.KillQuery(lockOriginalSessionId); err != nil {
+			log.Errore(err)
+		}
+		return log.Errorf("Timed out validating cut-over data after %d seconds", this.migrationContext.PostCutOverValidationWindowSeconds)
+	}
 
 	// Step 2
 	// We now attempt an atomic RENAME on original & ghost tables, and expect it to block.
@@ -671,7 +903,7 @@ func (this *Migrator) atomicCutOver() (err error) {
 	renameSessionIdChan := make(chan int64, 2)
 	tablesRenamed := make(chan error, 2)
 	go func() {
-		if err := this.applier.AtomicCutoverRename(renameSessionIdChan, tablesRenamed); err != nil {
+		if err := this.applier.AtomicCutoverRename(renameSessionIdChan, tablesRenamed, lockTimeoutSeconds); err != nil {
 			// Abort! Release the lock
 			atomic.StoreInt64(&tableRenameKnownToHaveFailed, 1)
 			okToUnlockTable <- true
@@ -728,7 +960,7 @@ func (this *Migrator) initiateServer() (err error) {
 	var f printStatusFunc = func(rule PrintStatusRule, writer io.Writer) {
 		this.printStatus(rule, writer)
 	}
-	this.server = NewServer(this.migrationContext, this.hooksExecutor, f)
+	this.server = NewServer(this.migrationContext, this.hooksExecutor, f, this.applier.WriteAndLogChangelog)
 	if err := this.server.BindSocketFile(); err != nil {
 		return err
 	}
@@ -800,6 +1032,15 @@ func (this *Migrator) initiateInspector() (err error) {
 	} else if this.migrationContext.InspectorIsAlsoApplier() && !this.migrationContext.AllowedRunningOnMaster {
 		return fmt.Errorf("It seems like this migration attempt to run directly on master. Preferably it would be executed on a replica (and this reduces load from the master). To proceed please provide --allow-on-master. Inspector config=%+v, applier config=%+v", this.migrationContext.InspectorConnectionConfig, this.migrationContext.ApplierConnectionConfig)
 	}
+	if this.migrationContext.HasBinlogSource() {
+		// The streamer does not read the inspected server's binary logs; --binlog-source is validated by the streamer.
+		// Lag is measured on the binlog source, hence the inspected replica is checked as a throttle control replica.
+		if !this.migrationContext.InspectorIsAlsoApplier() {
+			this.migrationContext.AddThrottleControlReplicaKey(this.migrationContext.InspectorConnectionConfig.Key)
+		}
+		log.Infof("Binlog source: %s", this.migrationContext.GetBinlogSourceConnectionConfig().Key.DisplayString())
+		return nil
+	}
 	if err := this.inspector.validateLogSlaveUpdates(); err != nil {
 		return err
 	}
@@ -838,6 +1079,16 @@ func (this *Migrator) printMigrationStatusHint(writers ...io.Writer) {
 		*this.inspector.connectionConfig.ImpliedKey,
 		this.migrationContext.Hostname,
 	))
+	if this.migrationContext.HasBinlogSource() {
+		fmt.Fprintln(w, fmt.Sprintf("# Streaming binary logs from %+v",
+			*this.eventsStreamer.connectionConfig.ImpliedKey,
+		))
+	}
+	if this.migrationContext.GetBinlogSourceServerVersion().IsMariaDB() {
+		fmt.Fprintln(w, fmt.Sprintf("# Binlog GTID position: %s",
+			this.eventsStreamer.GetCurrentGTIDPosition(),
+		))
+	}
 	fmt.Fprintln(w, fmt.Sprintf("# Migration started at %+v",
 		this.migrationContext.StartTime.Format(time.RubyDate),
 	))
@@ -869,6 +1120,35 @@ func (this *Migrator) printMigrationStatusHint(writers ...io.Writer) {
 			this.migrationContext.ThrottleAdditionalFlagFile, setIndicator,
 		))
 	}
+	if headroom, limited := this.migrationContext.GetBinlogHeadroom(); limited {
+		fmt.Fprintln(w, fmt.Sprintf("# binlog headroom: %s; min-binlog-headroom-seconds: %d; binlog-headroom-action: %s",
+			base.PrettifyDurationOutput(headroom), this.migrationContext.MinBinlogHeadroomSeconds, this.migrationContext.BinlogHeadroomAction,
+		))
+	}
+	switch topology := this.migrationContext.ClusterTopology; topology.Type {
+	case mysql.GroupReplicationClusterType:
+		fmt.Fprintln(w, fmt.Sprintf("# cluster: %s; max-group-replication-queue: %d",
+			topology.String(), this.migrationContext.MaxGroupReplicationQueue,
+		))
+	case mysql.GaleraClusterType:
+		fmt.Fprintln(w, fmt.Sprintf("# cluster: %s; max-wsrep-flow-control-paused: %.2f; max-wsrep-local-recv-queue: %d",
+			topology.String(), this.migrationContext.MaxWsrepFlowControlPaused, this.migrationContext.MaxWsrepLocalRecvQueue,
+		))
+	}
+	if throttleHTTP := this.migrationContext.GetThrottleHTTP(); throttleHTTP != "" {
+		suggestions := ""
+		if result := this.migrationContext.GetThrottleHTTPResult(); result != nil {
+			if result.NiceRatio > 0 {
+				suggestions = fmt.Sprintf("%s; suggested nice-ratio: %f", suggestions, result.NiceRatio)
+			}
+			if result.RowsPerSecond > 0 {
+				suggestions = fmt.Sprintf("%s; suggested rows/sec: %.0f", suggestions, result.RowsPerSecond)
+			}
+		}
+		fmt.Fprintln(w, fmt.Sprintf("# throttle-http: %s %+v%s",
+			this.migrationContext.ThrottleHTTPMethod, throttleHTTP, suggestions,
+		))
+	}
 	if throttleQuery := this.migrationContext.GetThrottleQuery(); throttleQuery != "" {
 		fmt.Fprintln(w, fmt.Sprintf("# throttle-query: %+v",
 			throttleQuery,
@@ -879,6 +1159,12 @@ func (this *Migrator) printMigrationStatusHint(writers ...io.Writer) {
 			throttleControlReplicaKeys.Len(),
 		))
 	}
+	if this.coordinator != nil {
+		this.coordinator.PrintStatus(func(line string) { fmt.Fprintln(w, line) })
+	}
+	if this.eventsSpill != nil {
+		this.eventsSpill.PrintStatus(func(line string) { fmt.Fprintln(w, line) })
+	}
 
 	if this.migrationContext.PostponeCutOverFlagFile != "" {
 		setIndicator := ""
@@ -889,6 +1175,18 @@ func (this *Migrator) printMigrationStatusHint(writers ...io.Writer) {
 			this.migrationContext.PostponeCutOverFlagFile, setIndicator,
 		))
 	}
+	if atomic.LoadInt64(&this.migrationContext.UserCommandedPostponeFlag) > 0 {
+		fmt.Fprintln(w, "# cut-over postponed by user command")
+	} else if this.migrationContext.IsCutOverPostponedByUser() {
+		fmt.Fprintln(w, fmt.Sprintf("# cut-over postponed until: %+v",
+			time.Unix(0, atomic.LoadInt64(&this.migrationContext.PostponeCutOverUntil)).Format(time.RFC3339),
+		))
+	}
+	fmt.Fprintln(w, fmt.Sprintf("# cut-over: %s; lock timeout: %ds; exponential backoff: %t",
+		this.migrationContext.GetCutOverTypeName(),
+		this.migrationContext.GetCutOverLockTimeoutSeconds(),
+		this.migrationContext.GetCutOverExponentialBackoff(),
+	))
 	if this.migrationContext.PanicFlagFile != "" {
 		fmt.Fprintln(w, fmt.Sprintf("# panic-flag-file: %+v",
 			this.migrationContext.PanicFlagFile,
@@ -911,7 +1209,7 @@ func (this *Migrator) printStatus(rule PrintStatusRule, writers ...io.Writer) {
 	if rule == NoPrintStatusRule {
 		return
 	}
-	writers = append(writers, os.Stdout)
+	writers = append(writers, this.migrationContext.StatusOutput)
 
 	elapsedTime := this.migrationContext.ElapsedTime()
 	elapsedSeconds := int64(elapsedTime.Seconds())
@@ -959,13 +1257,26 @@ func (this *Migrator) printStatus(rule PrintStatusRule, writers ...io.Writer) {
 	}
 
 	state := "migrating"
-	if atomic.LoadInt64(&this.migrationContext.CountingRowsFlag) > 0 && !this.migrationContext.ConcurrentCountTableRows {
+	if this.migrationContext.IsAbortRequested() {
+		state = "aborting"
+	} else if atomic.LoadInt64(&this.migrationContext.CountingRowsFlag) > 0 && !this.migrationContext.ConcurrentCountTableRows {
 		state = "counting rows"
+	} else if atomic.LoadInt64(&this.migrationContext.IsAddingDeferredIndexes) > 0 {
+		eta = "due"
+		state = "adding deferred indexes"
+	} else if atomic.LoadInt64(&this.migrationContext.IsWarmingUpGhostTable) > 0 {
+		eta = "due"
+		state = fmt.Sprintf("warming up ghost table, %d pages read server-wide", atomic.LoadInt64(&this.migrationContext.WarmUpPagesRead))
 	} else if atomic.LoadInt64(&this.migrationContext.IsPostponingCutOver) > 0 {
 		eta = "due"
 		state = "postponing cut-over"
+		if atomic.LoadInt64(&this.migrationContext.QueryPlanApprovalPendingFlag) > 0 {
+			state = "postponing cut-over, query plan regressions pending approval"
+		}
 	} else if isThrottled, throttleReason, _ := this.migrationContext.IsThrottled(); isThrottled {
 		state = fmt.Sprintf("throttled, %s", throttleReason)
+	} else if reason := this.migrationContext.GetRowCopyThrottleReason(); reason != "" && atomic.LoadInt64(&this.rowCopyCompleteFlag) == 0 {
+		state = fmt.Sprintf("row copy throttled, %s", reason)
 	}
 
 	shouldPrintStatus := false
@@ -1003,12 +1314,22 @@ func (this *Migrator) printStatus(rule PrintStatusRule, writers ...io.Writer) {
 		state,
 		eta,
 	)
+	if this.eventsSpill != nil {
+		status = fmt.Sprintf("%s; Spilled: %s", status, this.eventsSpill.Status())
+	}
+	if headroom, limited := this.migrationContext.GetBinlogHeadroom(); limited {
+		status = fmt.Sprintf("%s; Binlog headroom: %s", status, base.PrettifyDurationOutput(headroom))
+		if this.migrationContext.IsBinlogHeadroomLow() {
+			status = fmt.Sprintf("%s (low)", status)
+		}
+	}
 	this.applier.WriteChangelog(
 		fmt.Sprintf("copy iteration %d at %d", this.migrationContext.GetIteration(), time.Now().Unix()),
 		status,
 	)
 	w := io.MultiWriter(writers...)
 	fmt.Fprintln(w, status)
+	this.migrationContext.EmitEvent(&base.MigrationEvent{Type: base.StatusEvent, Status: status})
 
 	if elapsedSeconds%60 == 0 {
 		this.hooksExecutor.onStatus(status)
@@ -1048,17 +1369,93 @@ func (this *Migrator) initiateStreaming() error {
 			this.migrationContext.SetRecentBinlogCoordinates(*this.eventsStreamer.GetCurrentBinlogCoordinates())
 		}
 	}()
+	go this.monitorBinlogHeadroom()
 	return nil
 }
 
+// monitorBinlogHeadroom estimates how long until the binary log being read is purged, and acts as per
+// --binlog-headroom-action once below --min-binlog-headroom-seconds. Should the binary log be purged
+// already, the migration aborts: the streamer could not reconnect. With --min-binlog-headroom-seconds=0
+// nothing is monitored.
+func (this *Migrator) monitorBinlogHeadroom() {
+	if this.migrationContext.MinBinlogHeadroomSeconds == 0 {
+		return
+	}
+	ticker := time.NewTicker(binlogHeadroomCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.LoadInt64(&this.finishedMigrating) > 0 {
+			return
+		}
+		retention, err := this.eventsStreamer.ReadBinlogRetention()
+		if err != nil {
+			log.Errorf("Failed reading binlog retention: %+v", err)
+			continue
+		}
+		logFile := this.eventsStreamer.GetCurrentBinlogCoordinates().LogFile
+		if !retention.HasLogFile(logFile) {
+			this.migrationContext.SetBinlogHeadroom(0, true)
+			this.migrationContext.RequestAbort(fmt.Sprintf("binary log %s, which the streamer reads, has been purged", logFile))
+			return
+		}
+		headroom, limited := retention.Headroom(this.eventsStreamer.GetLastEventTime(), time.Now())
+		this.migrationContext.SetBinlogHeadroom(headroom, limited)
+
+		minHeadroom := time.Duration(this.migrationContext.MinBinlogHeadroomSeconds) * time.Second
+		isLow := limited && minHeadroom > 0 && headroom < minHeadroom
+		if !isLow {
+			if atomic.CompareAndSwapInt64(&this.migrationContext.BinlogHeadroomLowFlag, 1, 0) {
+				log.Infof("Binlog headroom recovered: %s, reading %s", base.PrettifyDurationOutput(headroom), logFile)
+			}
+			continue
+		}
+		if !atomic.CompareAndSwapInt64(&this.migrationContext.BinlogHeadroomLowFlag, 0, 1) {
+			continue
+		}
+		log.Warningf("Binlog headroom is low: %s reading %s is estimated to be purged in %s. Action: %s",
+			this.migrationContext.GetBinlogSourceConnectionConfig().Key.DisplayString(), logFile, base.PrettifyDurationOutput(headroom), this.migrationContext.BinlogHeadroomAction,
+		)
+		this.hooksExecutor.onBinlogHeadroomLow(logFile, headroom)
+		if this.migrationContext.BinlogHeadroomAction == base.AbortBinlogHeadroomAction {
+			this.migrationContext.RequestAbort(fmt.Sprintf("binlog headroom %s is below --min-binlog-headroom-seconds", base.PrettifyDurationOutput(headroom)))
+			return
+		}
+	}
+}
+
+// applyEventsWhileThrottled applies a binlog event, if any, even though throttled. It is used once binlog
+// headroom is low and --binlog-headroom-action=apply-events, and throttling is due to lag or load, such that
+// the streamer progresses off the binary log about to be purged. Row copy remains throttled.
+func (this *Migrator) applyEventsWhileThrottled() error {
+	select {
+	case eventStruct := <-this.applyEventsQueue:
+		return this.onApplyEventStruct(eventStruct)
+	case <-time.After(250 * time.Millisecond):
+		return nil
+	}
+}
+
 // addDMLEventsListener begins listening for binlog events on the original table,
-// and creates & enqueues a write task per such event.
+// and creates & enqueues a write task per such event. With --events-spill-dir, events
+// overflowing the apply queue are buffered on disk.
 func (this *Migrator) addDMLEventsListener() error {
+	if this.migrationContext.EventsSpillDir != "" {
+		eventsSpill, err := NewEventsSpill(this.migrationContext, this.applyEventsQueue)
+		if err != nil {
+			return log.Errorf("Cannot create events spill buffer in %s: %+v", this.migrationContext.EventsSpillDir, err)
+		}
+		this.eventsSpill = eventsSpill
+		go this.eventsSpill.Forward()
+		log.Infof("Buffering binlog events on disk in %s, up to %d bytes", this.migrationContext.EventsSpillDir, this.migrationContext.EventsSpillMaxBytes)
+	}
 	err := this.eventsStreamer.AddListener(
 		false,
 		this.migrationContext.DatabaseName,
 		this.migrationContext.OriginalTableName,
 		func(dmlEvent *binlog.BinlogDMLEvent) error {
+			if this.eventsSpill != nil {
+				return this.eventsSpill.Enqueue(dmlEvent)
+			}
 			this.applyEventsQueue <- newApplyEventStructByDML(dmlEvent)
 			return nil
 		},
@@ -1066,9 +1463,21 @@ func (this *Migrator) addDMLEventsListener() error {
 	return err
 }
 
+// initiateCoordinator registers this migration on the coordination table, when one is configured
+func (this *Migrator) initiateCoordinator() error {
+	if this.migrationContext.CoordinationTable == "" {
+		return nil
+	}
+	isCopying := func() bool {
+		return atomic.LoadInt64(&this.rowCopyStartedFlag) > 0 && atomic.LoadInt64(&this.rowCopyCompleteFlag) == 0
+	}
+	this.coordinator = NewCoordinator(this.migrationContext, this.applier, isCopying)
+	return this.coordinator.InitiateCoordination()
+}
+
 // initiateThrottler kicks in the throttling collection and the throttling checks.
 func (this *Migrator) initiateThrottler() error {
-	this.throttler = NewThrottler(this.migrationContext, this.applier, this.inspector)
+	this.throttler = NewThrottler(this.migrationContext, this.applier, this.inspector, this.eventsStreamer, this.hooksExecutor)
 
 	go this.throttler.initiateThrottlerCollection(this.firstThrottlingCollected)
 	log.Infof("Waiting for first throttle metrics to be collected")
@@ -1081,6 +1490,52 @@ func (this *Migrator) initiateThrottler() error {
 	return nil
 }
 
+// initiateDesiredSchemaAlter computes the ALTER statement off --desired-schema: the difference between the
+// migrated table's current definition and the desired CREATE TABLE statement.
+func (this *Migrator) initiateDesiredSchemaAlter() error {
+	if this.migrationContext.DesiredSchemaFile == "" {
+		return nil
+	}
+	bytes, err := ioutil.ReadFile(this.migrationContext.DesiredSchemaFile)
+	if err != nil {
+		return err
+	}
+	desiredCreateTableStatement := strings.TrimRight(strings.TrimSpace(string(bytes)), ";")
+	currentCreateTableStatement, err := this.inspector.showCreateTable(this.migrationContext.OriginalTableName)
+	if err != nil {
+		return err
+	}
+	// Have the server format the desired definition, so that it compares with the current definition
+	canonicalCreateTableStatement, err := this.applier.CanonicalizeCreateTable(desiredCreateTableStatement)
+	if err != nil {
+		return log.Errorf("Unable to create desired schema %s: %+v", this.migrationContext.DesiredSchemaFile, err)
+	}
+	renames := sql.ParseRenamedColumnsAnnotations(desiredCreateTableStatement)
+	alterStatement, err := sql.BuildAlterStatement(
+		sql.ParseTableDefinition(currentCreateTableStatement),
+		sql.ParseTableDefinition(canonicalCreateTableStatement),
+		renames,
+	)
+	if err != nil {
+		return err
+	}
+	if len(renames) > 0 {
+		// Renames are explicitly annotated in desired schema
+		this.migrationContext.ApproveRenamedColumns = true
+	}
+	this.migrationContext.AlterStatement = alterStatement
+	log.Infof("Desired schema computes to: %s", alterStatement)
+	if this.migrationContext.Noop {
+		fmt.Fprintf(this.migrationContext.StatusOutput, "# Desired schema %s computes to:\nALTER TABLE %s.%s %s\n",
+			this.migrationContext.DesiredSchemaFile,
+			sql.EscapeName(this.migrationContext.DatabaseName),
+			sql.EscapeName(this.migrationContext.OriginalTableName),
+			alterStatement,
+		)
+	}
+	return this.parseAndValidateStatement()
+}
+
 func (this *Migrator) initiateApplier() error {
 	this.applier = NewApplier(this.migrationContext)
 	if err := this.applier.InitDBConnections(); err != nil {
@@ -1089,6 +1544,10 @@ func (this *Migrator) initiateApplier() error {
 	if err := this.applier.ValidateOrDropExistingTables(); err != nil {
 		return err
 	}
+	//根据期望的表结构计算出变更sql
+	if err := this.initiateDesiredSchemaAlter(); err != nil {
+		return err
+	}
 	if err := this.applier.CreateChangelogTable(); err != nil {
 		log.Errorf("Unable to create changelog table, see further error details. Perhaps a previous migration failed without dropping the table? OR is there a running migration? Bailing out")
 		return err
@@ -1182,7 +1641,11 @@ func (this *Migrator) iterateChunks() error {
 			return nil
 		}
 		// Enqueue copy operation; to be executed by executeWriteFuncs()
-		this.copyRowsQueue <- copyRowsFunc
+		select {
+		case this.copyRowsQueue <- copyRowsFunc:
+		case <-this.migrationContext.AbortRequested():
+			return nil
+		}
 	}
 	return nil
 }
@@ -1253,7 +1716,19 @@ func (this *Migrator) executeWriteFuncs() error {
 		if atomic.LoadInt64(&this.finishedMigrating) > 0 {
 			return nil
 		}
+		if this.migrationContext.IsAbortRequested() {
+			return nil
+		}
 
+		if this.migrationContext.IsBinlogHeadroomLow() && this.migrationContext.BinlogHeadroomAction == base.ApplyEventsBinlogHeadroomAction {
+			// Only lag and load throttling is bypassed; hibernation and user commanded throttling are not
+			if isThrottled, _, reasonHint := this.migrationContext.IsThrottled(); isThrottled && (reasonHint == base.LagThrottleReasonHint || reasonHint == base.LoadThrottleReasonHint) {
+				if err := this.applyEventsWhileThrottled(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
 		this.throttler.throttle(nil)
 
 		// We give higher priority to event processing, then secondary priority to
@@ -1267,6 +1742,18 @@ func (this *Migrator) executeWriteFuncs() error {
 			}
 		default:
 			{
+				if reason := this.migrationContext.GetRowCopyThrottleReason(); reason != "" {
+					// Coordination with concurrent migrations, or a throttle HTTP suggested rate, only holds back row copy;
+					// binlog events keep being applied
+					select {
+					case eventStruct := <-this.applyEventsQueue:
+						if err := this.onApplyEventStruct(eventStruct); err != nil {
+							return err
+						}
+					case <-time.After(100 * time.Millisecond):
+					}
+					continue
+				}
 				select {
 				case copyRowsFunc := <-this.copyRowsQueue:
 					{
@@ -1275,7 +1762,7 @@ func (this *Migrator) executeWriteFuncs() error {
 						if err := copyRowsFunc(); err != nil {
 							return log.Errore(err)
 						}
-						if niceRatio := this.migrationContext.GetNiceRatio(); niceRatio > 0 {
+						if niceRatio := this.migrationContext.GetEffectiveNiceRatio(); niceRatio > 0 {
 							copyRowsDuration := time.Since(copyRowsStartTime)
 							sleepTimeNanosecondFloat64 := niceRatio * float64(copyRowsDuration.Nanoseconds())
 							sleepTime := time.Duration(time.Duration(int64(sleepTimeNanosecondFloat64)) * time.Nanosecond)
@@ -1296,9 +1783,496 @@ func (this *Migrator) executeWriteFuncs() error {
 	return nil
 }
 
+// deferSecondaryIndexes drops secondary indexes off the (empty) ghost table, so that row copy
+// writes onto a lean table. Indexes are added back by addDeferredIndexes.
+func (this *Migrator) deferSecondaryIndexes() (err error) {
+	if !this.migrationContext.DeferSecondaryIndexes {
+		return nil
+	}
+	this.deferredIndexes, err = this.applier.DropGhostSecondaryIndexes()
+	return err
+}
+
+// addDeferredIndexes adds back indexes dropped by deferSecondaryIndexes, in a single ALTER.
+// Binlog events keep being applied onto the ghost table while indexes are built.
+func (this *Migrator) addDeferredIndexes() error {
+	if len(this.deferredIndexes) == 0 {
+		return nil
+	}
+	atomic.StoreInt64(&this.migrationContext.IsAddingDeferredIndexes, 1)
+	defer atomic.StoreInt64(&this.migrationContext.IsAddingDeferredIndexes, 0)
+
+	this.printStatus(ForcePrintStatusRule)
+	return this.applier.AddGhostIndexes(this.deferredIndexes)
+}
+
+// warmUpGhostTable loads ghost table pages into the buffer pool ahead of cut-over, so that the
+// migrated table does not start out cold. It replays recent SELECT statements onto the ghost table,
+// then scans its indexes in chunks, within the configured time and page budget.
+// Warm-up is best effort: errors are logged and do not fail the migration.
+func (this *Migrator) warmUpGhostTable() {
+	if this.ghostTableWarmedUp {
+		// cut-over may be retried; warm-up only runs once
+		return
+	}
+	this.ghostTableWarmedUp = true
+	if !this.migrationContext.WarmUpGhostTable && this.migrationContext.WarmUpReplayStatements <= 0 {
+		return
+	}
+	atomic.StoreInt64(&this.migrationContext.IsWarmingUpGhostTable, 1)
+	defer atomic.StoreInt64(&this.migrationContext.IsWarmingUpGhostTable, 0)
+
+	// Innodb_buffer_pool_reads is server-wide: the page budget counts all pages read from disk on the server
+	// during warm-up, not only those of the ghost table
+	initialPagesRead, err := this.applier.ShowStatusVariable("Innodb_buffer_pool_reads")
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	deadline := time.Now().Add(time.Duration(this.migrationContext.WarmUpMaxSeconds) * time.Second)
+	budgetExhausted := func() bool {
+		if time.Now().After(deadline) {
+			log.Infof("Warm-up: time budget exhausted")
+			return true
+		}
+		pagesRead, err := this.applier.ShowStatusVariable("Innodb_buffer_pool_reads")
+		if err != nil {
+			return false
+		}
+		atomic.StoreInt64(&this.migrationContext.WarmUpPagesRead, pagesRead-initialPagesRead)
+		if this.migrationContext.WarmUpMaxPages > 0 && pagesRead-initialPagesRead >= this.migrationContext.WarmUpMaxPages {
+			log.Infof("Warm-up: page budget exhausted")
+			return true
+		}
+		return false
+	}
+	log.Infof("Warming up ghost table %s.%s", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(this.migrationContext.GetGhostTableName()))
+	if this.warmUpReplayStatements(deadline, budgetExhausted) {
+		this.warmUpScanIndexes(budgetExhausted)
+	}
+	log.Infof("Warm-up complete: %d pages read into buffer pool, server-wide", atomic.LoadInt64(&this.migrationContext.WarmUpPagesRead))
+}
+
+// warmUpReplayStatements runs recently seen SELECT statements on the migrated table against the ghost table.
+// Each statement is bounded by the warm-up deadline. It returns false when warm-up budget is exhausted.
+func (this *Migrator) warmUpReplayStatements(deadline time.Time, budgetExhausted func() bool) bool {
+	if this.migrationContext.WarmUpReplayStatements <= 0 {
+		return true
+	}
+	if serverVersion := this.migrationContext.GetApplierServerVersion(); !serverVersion.HasStatementSamples() {
+		log.Infof("Warm-up: %s keeps no statement samples in performance_schema; not replaying statements", serverVersion)
+		return true
+	}
+	statements, err := this.applier.ReadRecentSelectStatements(this.migrationContext.WarmUpReplayStatements)
+	if err != nil {
+		log.Errorf("Warm-up: cannot read recent statements from performance_schema: %+v", err)
+		return true
+	}
+	replayed := 0
+	for _, statement := range statements {
+		if budgetExhausted() {
+			return false
+		}
+		statement, err := sql.RewriteReplayStatement(statement, this.migrationContext.DatabaseName, this.migrationContext.OriginalTableName, this.migrationContext.GetGhostTableName())
+		if err != nil {
+			log.Debugf("Warm-up: not replaying statement: %+v", err)
+			continue
+		}
+		this.throttler.throttle(nil)
+		if err := this.applier.ExecWarmUpStatement(statement, deadline); err != nil {
+			log.Debugf("Warm-up: statement failed: %+v", err)
+			continue
+		}
+		replayed++
+	}
+	log.Infof("Warm-up: replayed %d statements", replayed)
+	return !budgetExhausted()
+}
+
+// warmUpScanIndexes scans the ghost table's secondary indexes, then its primary key, in chunks
+func (this *Migrator) warmUpScanIndexes(budgetExhausted func() bool) {
+	if !this.migrationContext.WarmUpGhostTable {
+		return
+	}
+	createTableStatement, err := this.applier.ShowCreateTable(this.migrationContext.GetGhostTableName())
+	if err != nil {
+		log.Errore(err)
+		return
+	}
+	indexes := sql.ParseIndexDefinitions(createTableStatement)
+	clusteringColumnNames := this.migrationContext.UniqueKey.Columns.Names()
+	var primaryKey *sql.IndexDefinition
+	scanIndexes := [](*sql.IndexDefinition){}
+	for _, index := range indexes {
+		if index.IsPrimary() {
+			primaryKey = index
+			clusteringColumnNames = index.ColumnNames
+			continue
+		}
+		scanIndexes = append(scanIndexes, index)
+	}
+	if primaryKey != nil {
+		scanIndexes = append(scanIndexes, primaryKey)
+	}
+	for _, index := range scanIndexes {
+		if !index.IsRangeScannable() {
+			continue
+		}
+		// Rows are ordered by index columns followed by the clustering key; this is the actual order of index entries
+		keyColumnNames := append([]string{}, index.ColumnNames...)
+		keyColumnsOrdinals := sql.NewColumnList(index.ColumnNames).Ordinals
+		for _, columnName := range clusteringColumnNames {
+			if _, ok := keyColumnsOrdinals[columnName]; !ok {
+				keyColumnNames = append(keyColumnNames, columnName)
+			}
+		}
+		log.Infof("Warm-up: scanning index %s", sql.EscapeName(index.Name))
+		keyColumns := sql.NewColumnList(keyColumnNames)
+		var rangeStartArgs []interface{}
+		for {
+			if budgetExhausted() {
+				return
+			}
+			this.throttler.throttle(nil)
+			rangeEndArgs, rowsCount, err := this.applier.ReadIndexScanChunk(index.Name, keyColumns, rangeStartArgs)
+			if err != nil {
+				log.Errorf("Warm-up: error scanning index %s: %+v", sql.EscapeName(index.Name), err)
+				break
+			}
+			if rowsCount < atomic.LoadInt64(&this.migrationContext.ChunkSize) {
+				break
+			}
+			rangeStartArgs = rangeEndArgs
+		}
+	}
+}
+
+// checkQueryPlans compares query plans of the top statements on the migrated table with their plans on the
+// ghost table, and reports regressions. With --plan-check-postpone, regressions postpone the cut-over
+// until approved via the `approve-query-plans` interactive command.
+func (this *Migrator) checkQueryPlans() {
+	if this.migrationContext.PlanCheckDigests <= 0 {
+		return
+	}
+	if serverVersion := this.migrationContext.GetApplierServerVersion(); !serverVersion.HasStatementSamples() {
+		log.Infof("Query plan check: %s keeps no statement samples in performance_schema; skipping", serverVersion)
+		return
+	}
+	statements, err := this.applier.ReadTopStatements(this.migrationContext.PlanCheckDigests)
+	if err != nil {
+		log.Errorf("Query plan check: cannot read statements from performance_schema: %+v", err)
+		return
+	}
+	checkedCount := 0
+	regressionsCount := 0
+	for _, statement := range statements {
+		ghostStatement, found := sql.RewriteTableReferences(statement, this.migrationContext.DatabaseName, this.migrationContext.OriginalTableName, this.migrationContext.GetGhostTableName())
+		if !found {
+			continue
+		}
+		originalPlan, err := this.applier.ExplainStatement(statement)
+		if err != nil {
+			log.Debugf("Query plan check: cannot explain statement: %+v", err)
+			continue
+		}
+		ghostPlan, err := this.applier.ExplainStatement(ghostStatement)
+		if err != nil {
+			log.Debugf("Query plan check: cannot explain statement on ghost table: %+v", err)
+			continue
+		}
+		checkedCount++
+		regressions := sql.CompareQueryPlans(originalPlan, ghostPlan, this.migrationContext.PlanCheckRowsFactor)
+		if len(regressions) == 0 {
+			continue
+		}
+		regressionsCount++
+		log.Warningf("Query plan regression: %s; statement: %s", strings.Join(regressions, "; "), statement)
+	}
+	log.Infof("Query plan check: %d statements checked, %d regressed", checkedCount, regressionsCount)
+	if regressionsCount > 0 && this.migrationContext.PlanCheckPostpone {
+		log.Warningf("Postponing cut-over until query plan regressions are approved via `approve-query-plans` interactive command")
+		atomic.StoreInt64(&this.migrationContext.QueryPlanApprovalPendingFlag, 1)
+	}
+}
+
+// prepareCutOverValidation reads the ghost table definition, and the columns to checksum, ahead of cut-over
+func (this *Migrator) prepareCutOverValidation() (err error) {
+	if !this.postCutOverValidationEnabled() {
+		return nil
+	}
+	if this.expectedCreateTableStatement, err = this.applier.ShowCreateTable(this.migrationContext.GetGhostTableName()); err != nil {
+		return err
+	}
+	if this.migrationContext.PostCutOverValidationChecksumRows <= 0 {
+		return nil
+	}
+	columnTypes, err := this.applier.ReadColumnTypes(this.migrationContext.OriginalTableName)
+	if err != nil {
+		return err
+	}
+	ghostColumnTypes, err := this.applier.ReadColumnTypes(this.migrationContext.GetGhostTableName())
+	if err != nil {
+		return err
+	}
+	// Only columns of identical type and collation on both tables are checksummed
+	this.checksumColumnNames = []string{}
+	this.checksumGhostColumnNames = []string{}
+	mappedColumnNames := make(map[string]string)
+	mappedSharedColumnNames := this.migrationContext.MappedSharedColumns.Names()
+	for i, sharedColumnName := range this.migrationContext.SharedColumns.Names() {
+		mappedColumnName := mappedSharedColumnNames[i]
+		mappedColumnNames[sharedColumnName] = mappedColumnName
+		if columnTypes[sharedColumnName] == "" || columnTypes[sharedColumnName] != ghostColumnTypes[mappedColumnName] {
+			continue
+		}
+		this.checksumColumnNames = append(this.checksumColumnNames, sharedColumnName)
+		this.checksumGhostColumnNames = append(this.checksumGhostColumnNames, mappedColumnName)
+	}
+	ghostKeyColumnNames := []string{}
+	for _, keyColumnName := range this.migrationContext.UniqueKey.Columns.Names() {
+		ghostKeyColumnNames = append(ghostKeyColumnNames, mappedColumnNames[keyColumnName])
+	}
+	this.checksumGhostKeyColumns = sql.NewColumnList(ghostKeyColumnNames)
+	if len(this.checksumColumnNames) == 0 {
+		log.Warningf("Cut-over validation: no columns of identical type on %s and %s; checksum will be skipped",
+			sql.EscapeName(this.migrationContext.OriginalTableName), sql.EscapeName(this.migrationContext.GetGhostTableName()),
+		)
+	}
+	return nil
+}
+
+func (this *Migrator) postCutOverValidationEnabled() bool {
+	if !this.migrationContext.PostCutOverValidation {
+		return false
+	}
+	if this.migrationContext.Noop || this.migrationContext.TestOnReplica {
+		return false
+	}
+	return true
+}
+
+// validateCutOverData compares the row count and a sampled checksum of the original and ghost tables. It runs
+// under the cut-over lock, once all events up to the lock have been applied, when both tables are expected to
+// be identical; the original table is read through given querier, the session holding the lock.
+// A mismatch aborts the migration before tables are swapped. A failing read is returned, to retry the cut-over.
+func (this *Migrator) validateCutOverData(querier rowQuerier) error {
+	if !this.postCutOverValidationEnabled() {
+		return nil
+	}
+	tableName := this.migrationContext.OriginalTableName
+	ghostTableName := this.migrationContext.GetGhostTableName()
+	var mismatch error
+	if maxRowsDelta := this.migrationContext.PostCutOverValidationMaxRowsDelta; maxRowsDelta >= 0 {
+		rowCount, err := this.applier.CountTableRows(querier, tableName)
+		if err != nil {
+			return err
+		}
+		ghostRowCount, err := this.applier.CountTableRows(nil, ghostTableName)
+		if err != nil {
+			return err
+		}
+		rowsDelta := ghostRowCount - rowCount
+		if rowsDelta < 0 {
+			rowsDelta = -rowsDelta
+		}
+		if rowsDelta > maxRowsDelta {
+			mismatch = fmt.Errorf("Row count mismatch: %s has %d rows, %s has %d rows", sql.EscapeName(tableName), rowCount, sql.EscapeName(ghostTableName), ghostRowCount)
+		}
+	}
+	if mismatch == nil && this.migrationContext.PostCutOverValidationChecksumRows > 0 && len(this.checksumColumnNames) > 0 {
+		rowCount, checksum, err := this.applier.ChecksumTableRows(querier, tableName, this.checksumColumnNames, &this.migrationContext.UniqueKey.Columns)
+		if err != nil {
+			return err
+		}
+		ghostRowCount, ghostChecksum, err := this.applier.ChecksumTableRows(nil, ghostTableName, this.checksumGhostColumnNames, this.checksumGhostKeyColumns)
+		if err != nil {
+			return err
+		}
+		if rowCount != ghostRowCount || checksum != ghostChecksum {
+			mismatch = fmt.Errorf("Checksum mismatch on first %d rows: %s has %d/%d, %s has %d/%d", this.migrationContext.PostCutOverValidationChecksumRows, sql.EscapeName(tableName), rowCount, checksum, sql.EscapeName(ghostTableName), ghostRowCount, ghostChecksum)
+		}
+	}
+	if mismatch != nil {
+		// Not to be retried: the tables are not swapped, and the migration aborts
+		this.migrationContext.RequestAbort(fmt.Sprintf("cut-over validation failed: %+v", mismatch))
+		return mismatch
+	}
+	log.Infof("Cut-over data validation passed")
+	return nil
+}
+
+// postCutOverValidation runs sanity checks right after cut-over: the migrated table has the
+// expected definition, and the rename has made it to the replicas. Checks are retried throughout
+// the validation window. By then the migrated table serves production, so failing checks only alert, unless
+// --post-cut-over-validation-rollback rolls back a definition mismatch. Data is validated ahead of the swap,
+// see validateCutOverData.
+// postCutOverValidation 切换后验证；失败时回滚切换
+func (this *Migrator) postCutOverValidation() error {
+	if !this.postCutOverValidationEnabled() {
+		return nil
+	}
+	windowDuration := time.Duration(this.migrationContext.PostCutOverValidationWindowSeconds) * time.Second
+	deadline := this.migrationContext.RenameTablesEndTime.Add(windowDuration)
+	log.Infof("Validating cut-over; validation window ends at %+v", deadline)
+	for {
+		retryable, err := this.validateCutOver()
+		if err == nil {
+			break
+		}
+		if !retryable {
+			if this.migrationContext.PostCutOverValidationRollback {
+				return this.rollbackCutOver(err)
+			}
+			return this.alertCutOverValidationFailed(err)
+		}
+		if time.Now().After(deadline) {
+			// e.g. a lagging replica: rolling back would lose writes made on the migrated table since cut-over
+			return this.alertCutOverValidationFailed(fmt.Errorf("validation window expired: %+v", err))
+		}
+		if err := this.checkAbort(); err != nil {
+			return err
+		}
+		log.Infof("Post cut-over validation not yet passing: %+v. Will retry", err)
+		time.Sleep(time.Second)
+	}
+	log.Infof("Post cut-over validation passed")
+	return nil
+}
+
+// validateCutOver runs the post cut-over checks. A returned error is retryable when it
+// may resolve by itself, e.g. a replica not yet having applied the rename.
+func (this *Migrator) validateCutOver() (retryable bool, err error) {
+	createTableStatement, err := this.applier.ShowCreateTable(this.migrationContext.OriginalTableName)
+	if err != nil {
+		return true, err
+	}
+	if sql.NormalizeCreateTableStatement(createTableStatement) != sql.NormalizeCreateTableStatement(this.expectedCreateTableStatement) {
+		return false, fmt.Errorf("%s.%s does not have the expected (migrated) definition", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(this.migrationContext.OriginalTableName))
+	}
+	if err := this.validateCutOverReplicated(); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// validateCutOverReplicated verifies the migrated table is in place on the inspected server and on
+// throttle control replicas, i.e. that the rename has been replicated.
+func (this *Migrator) validateCutOverReplicated() error {
+	replicaKeys := this.migrationContext.GetThrottleControlReplicaKeys()
+	replicaKeys.AddKey(this.migrationContext.InspectorConnectionConfig.Key)
+	for _, replicaKey := range replicaKeys.GetInstanceKeys() {
+		if replicaKey.Equals(&this.migrationContext.ApplierConnectionConfig.Key) {
+			continue
+		}
+		connectionConfig := this.migrationContext.InspectorConnectionConfig.Duplicate()
+		connectionConfig.Key = replicaKey
+		db, _, err := mysql.GetDB(this.migrationContext.Uuid, connectionConfig.GetDBUri(this.migrationContext.DatabaseName))
+		if err != nil {
+			return err
+		}
+		createTableStatement, err := mysql.ShowCreateTable(db, this.migrationContext.DatabaseName, this.migrationContext.OriginalTableName)
+		if err != nil {
+			return fmt.Errorf("%+v: %+v", replicaKey, err)
+		}
+		if sql.NormalizeCreateTableStatement(createTableStatement) != sql.NormalizeCreateTableStatement(this.expectedCreateTableStatement) {
+			return fmt.Errorf("%+v: cut-over not yet replicated", replicaKey)
+		}
+		if _, err := mysql.ShowCreateTable(db, this.migrationContext.DatabaseName, this.migrationContext.GetOldTableName()); err != nil {
+			return fmt.Errorf("%+v: %+v", replicaKey, err)
+		}
+	}
+	return nil
+}
+
+// alertCutOverValidationFailed reports failed post cut-over validation, and keeps the old table for inspection.
+// The migration otherwise proceeds.
+func (this *Migrator) alertCutOverValidationFailed(validationErr error) error {
+	log.Errorf("Post cut-over validation failed: %+v. Not rolling back; keeping %s for inspection",
+		validationErr, sql.EscapeName(this.migrationContext.GetOldTableName()),
+	)
+	this.cutOverValidationFailed = true
+	if err := this.hooksExecutor.onPostCutOverValidationFailed(validationErr); err != nil {
+		log.Errore(err)
+	}
+	return nil
+}
+
+// rollbackCutOver swaps the original table back in place, following failed post cut-over validation.
+// Writes applied to the migrated table since cut-over remain on the ghost table and are not carried back.
+func (this *Migrator) rollbackCutOver(validationErr error) error {
+	log.Errorf("Post cut-over validation failed: %+v. Rolling back cut-over", validationErr)
+	if err := this.applier.RenameTablesRollback(); err != nil {
+		return log.Errorf("Post cut-over validation failed: %+v; rollback failed as well: %+v. Manual intervention required", validationErr, err)
+	}
+	log.Warningf("Cut-over rolled back. Writes issued on %s since cut-over are now on %s and are not carried back",
+		sql.EscapeName(this.migrationContext.OriginalTableName), sql.EscapeName(this.migrationContext.GetGhostTableName()),
+	)
+	return fmt.Errorf("Post cut-over validation failed, cut-over rolled back: %+v", validationErr)
+}
+
+// cleanupAfterAbort concludes a gracefully aborted migration: it stops writes onto the ghost table,
+// restores replication if stopped by --test-on-replica, and drops tables according to --abort-drop-tables.
+func (this *Migrator) cleanupAfterAbort(migrationErr error) error {
+	abortErr := &base.AbortError{Reason: this.migrationContext.GetAbortReason()}
+	if _, isAbortError := migrationErr.(*base.AbortError); !isAbortError {
+		log.Errorf("Error while aborting: %+v", migrationErr)
+	}
+	log.Infof("Aborting migration: %s", abortErr.Reason)
+	atomic.StoreInt64(&this.finishedMigrating, 1)
+	if panicAbortError := this.getPanicAbortError(); panicAbortError != nil {
+		// panic abort means: no cleanup
+		return panicAbortError
+	}
+	if this.applier == nil {
+		return abortErr
+	}
+	if atomic.LoadInt64(&this.migrationContext.CutOverCompleteFlag) > 0 {
+		log.Warningf("Cut-over is complete; not dropping any tables")
+		return abortErr
+	}
+	if this.migrationContext.TestOnReplica && !this.migrationContext.TestOnReplicaSkipReplicaStop {
+		log.Infof("Starting replication, which may have been stopped by --test-on-replica")
+		if err := this.applier.StartReplication(); err != nil {
+			log.Errore(err)
+		}
+	}
+	switch this.migrationContext.AbortDropTables {
+	case base.AbortDropAllTables:
+		if err := this.applier.DropGhostTable(); err != nil {
+			log.Errore(err)
+		}
+		if err := this.applier.DropAtomicCutOverSentryTableIfExists(); err != nil {
+			log.Errore(err)
+		}
+		if err := this.applier.DropChangelogTable(); err != nil {
+			log.Errore(err)
+		}
+	case base.AbortDropChangelogTable:
+		if err := this.applier.DropChangelogTable(); err != nil {
+			log.Errore(err)
+		}
+	default:
+		log.Infof("--abort-drop-tables=%s: keeping ghost and changelog tables", this.migrationContext.AbortDropTables)
+	}
+	return abortErr
+}
+
 // finalCleanup takes actions at very end of migration, dropping tables etc.
 // finalCleanup 在迁移结束时采取措施，删除表等。
 func (this *Migrator) finalCleanup() error {
+	okToDropTable := this.migrationContext.OkToDropTable && !this.cutOverValidationFailed
+	dropOldTable := okToDropTable && !this.migrationContext.TestOnReplica && !this.migrationContext.Noop
+	if dropOldTable {
+		// Tables are emptied while replication lag is still measured via changelog heartbeat, so that throttling applies
+		if err := this.dropDuePendingTables(); err != nil {
+			return err
+		}
+		if this.migrationContext.LowImpactDropOldTable && this.migrationContext.OldTableRetentionSeconds == 0 {
+			if err := this.emptyTableLowImpact(this.migrationContext.GetOldTableName()); err != nil {
+				return err
+			}
+		}
+	}
 	atomic.StoreInt64(&this.migrationContext.CleanupImminentFlag, 1)
 
 	if this.migrationContext.Noop {
@@ -1316,7 +2290,14 @@ func (this *Migrator) finalCleanup() error {
 	if err := this.retryOperation(this.applier.DropChangelogTable); err != nil {
 		return err
 	}
-	if this.migrationContext.OkToDropTable && !this.migrationContext.TestOnReplica {
+	if dropOldTable && this.migrationContext.OldTableRetentionSeconds > 0 {
+		dropAt := time.Now().Add(time.Duration(this.migrationContext.OldTableRetentionSeconds) * time.Second)
+		if err := this.retryOperation(func() error {
+			return this.applier.MarkTablePendingDrop(this.migrationContext.GetOldTableName(), dropAt)
+		}); err != nil {
+			return err
+		}
+	} else if okToDropTable && !this.migrationContext.TestOnReplica {
 		if err := this.retryOperation(this.applier.DropOldTable); err != nil {
 			return err
 		}
@@ -1336,6 +2317,91 @@ func (this *Migrator) finalCleanup() error {
 	return nil
 }
 
+// dropDuePendingTables finishes drops of "old" tables that previous migrations marked
+// pending drop (see --old-table-retention-seconds), and whose retention period is over
+func (this *Migrator) dropDuePendingTables() error {
+	tableNames, err := this.applier.ReadDuePendingDropTables()
+	if err != nil {
+		return err
+	}
+	for _, tableName := range tableNames {
+		log.Infof("Table %s.%s is due for drop", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(tableName))
+		if err := this.emptyTableLowImpact(tableName); err != nil {
+			return err
+		}
+		if err := this.retryOperation(func() error {
+			return this.applier.dropTable(tableName)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyTableLowImpact empties a table ahead of dropping it, so that the DROP itself is cheap.
+// A partitioned table is truncated partition by partition; otherwise rows are deleted in chunks of
+// ascending primary key ranges. Both honor the throttler. A table with no primary key is left as is.
+func (this *Migrator) emptyTableLowImpact(tableName string) error {
+	partitionNames, err := this.applier.ReadTablePartitionNames(tableName)
+	if err != nil {
+		return err
+	}
+	if len(partitionNames) > 0 {
+		log.Infof("Truncating %d partitions of %s.%s", len(partitionNames), sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(tableName))
+		for _, partitionName := range partitionNames {
+			this.throttler.throttle(nil)
+			if err := this.retryOperation(func() error {
+				return this.applier.TruncateTablePartition(tableName, partitionName)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var keyColumns *sql.ColumnList
+	var rangeMinValues, rangeMaxValues *sql.ColumnValues
+	if err := this.retryOperation(func() (err error) {
+		keyColumns, rangeMinValues, rangeMaxValues, err = this.applier.ReadTablePrimaryKeyRange(tableName)
+		return err
+	}); err != nil {
+		return err
+	}
+	if keyColumns.Len() == 0 {
+		log.Warningf("%s.%s has no primary key, and cannot be emptied in chunks. It is dropped as is", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(tableName))
+		return nil
+	}
+	if rangeMinValues == nil || rangeMaxValues == nil {
+		return nil
+	}
+	log.Infof("Deleting rows from %s.%s in chunks, by %s ranges", sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(tableName), keyColumns.String())
+	var totalRowsDeleted int64
+	rangeStartValues := rangeMinValues
+	includeRangeStartValues := true
+	for {
+		this.throttler.throttle(nil)
+		startTime := time.Now()
+		var rangeEndValues *sql.ColumnValues
+		var rowsDeleted int64
+		if err := this.retryOperation(func() (err error) {
+			rangeEndValues, rowsDeleted, err = this.applier.DeleteTableRowsChunk(tableName, keyColumns, rangeStartValues, rangeMaxValues, includeRangeStartValues)
+			return err
+		}); err != nil {
+			return err
+		}
+		totalRowsDeleted += rowsDeleted
+		if rangeEndValues == nil {
+			break
+		}
+		rangeStartValues = rangeEndValues
+		includeRangeStartValues = false
+		if niceRatio := this.migrationContext.GetNiceRatio(); niceRatio > 0 {
+			time.Sleep(time.Duration(float64(time.Since(startTime)) * niceRatio))
+		}
+	}
+	log.Infof("Deleted %d rows from %s.%s", totalRowsDeleted, sql.EscapeName(this.migrationContext.DatabaseName), sql.EscapeName(tableName))
+	return nil
+}
+
 func (this *Migrator) teardown() {
 	atomic.StoreInt64(&this.finishedMigrating, 1)
 
@@ -1360,4 +2426,19 @@ func (this *Migrator) teardown() {
 		log.Infof("Tearing down throttler")
 		this.throttler.Teardown()
 	}
+
+	if this.coordinator != nil {
+		log.Infof("Tearing down coordinator")
+		this.coordinator.Teardown()
+	}
+
+	if this.eventsSpill != nil {
+		log.Infof("Tearing down events spill")
+		this.eventsSpill.Teardown(atomic.LoadInt64(&this.migrationContext.CutOverCompleteFlag) > 0)
+	}
+
+	if this.server != nil {
+		log.Infof("Tearing down server")
+		this.server.Teardown()
+	}
 }
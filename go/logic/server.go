@@ -7,6 +7,7 @@ package logic
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -14,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"gh-ost/go/base"
 	"github.com/outbrain/golib/log"
@@ -21,6 +23,101 @@ import (
 
 type printStatusFunc func(PrintStatusRule, io.Writer)
 
+// auditCommandFunc records a mutating interactive command, e.g. onto the changelog table
+type auditCommandFunc func(hint, value string) (string, error)
+
+const (
+	auditCommandHint      = "interactive-command"
+	auditCommandMaxLength = 1024
+)
+
+// readOnlyServerCommands may be issued by any authenticated caller. Any command given a '?' argument is read-only, too.
+var readOnlyServerCommands = map[string]bool{
+	"help":        true,
+	"sup":         true,
+	"info":        true,
+	"status":      true,
+	"coordinates": true,
+}
+
+// isReadOnlyServerCommand returns true when given interactive command does not change the migration
+func isReadOnlyServerCommand(command string) bool {
+	tokens := strings.SplitN(command, "=", 2)
+	if len(tokens) > 1 && strings.TrimSpace(tokens[1]) == "?" {
+		return true
+	}
+	return readOnlyServerCommands[strings.TrimSpace(tokens[0])]
+}
+
+// listenTCP listens on the configured TCP port, serving TLS if so configured
+func listenTCP(migrationContext *base.MigrationContext) (listener net.Listener, err error) {
+	if listener, err = net.Listen("tcp", fmt.Sprintf(":%d", migrationContext.ServeTCPPort)); err != nil {
+		return nil, err
+	}
+	auth := migrationContext.ServeTCPAuth
+	if auth == nil {
+		log.Warningf("TCP port %d is served without authentication. See --serve-tcp-tokens-file, --serve-tcp-tls-ca", migrationContext.ServeTCPPort)
+		return listener, nil
+	}
+	if auth.TLSConfig != nil {
+		listener = tls.NewListener(listener, auth.TLSConfig)
+	}
+	if !auth.RequiresAuthentication() {
+		log.Warningf("TCP port %d is served without authentication. See --serve-tcp-tokens-file, --serve-tcp-tls-ca", migrationContext.ServeTCPPort)
+	}
+	return listener, nil
+}
+
+// readServerCommand authenticates the caller and reads a command off given connection.
+// A caller may authenticate with a first `auth <token>` line, followed by the command line.
+// On the TCP port, a verified client certificate authenticates the caller, too.
+// Callers on the unix socket file are admins when the socket file is only writable by its owner, see NewUnixSocketCaller.
+func readServerCommand(migrationContext *base.MigrationContext, conn net.Conn, overTCP bool) (command string, caller *base.ServerCaller, err error) {
+	auth := migrationContext.ServeTCPAuth
+	if !overTCP {
+		caller = base.NewUnixSocketCaller(migrationContext.ServeSocketFile)
+	} else {
+		caller = &base.ServerCaller{Identity: "anonymous", Role: base.AdminServerRole, Remote: conn.RemoteAddr().String()}
+		if auth != nil && auth.RequiresAuthentication() {
+			caller.Role = ""
+		}
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			if err := tlsConn.Handshake(); err != nil {
+				return "", caller, err
+			}
+			if certificates := tlsConn.ConnectionState().PeerCertificates; len(certificates) > 0 && auth.TLSConfig.ClientCAs != nil {
+				caller = auth.AuthenticateCertificate(certificates[0])
+				caller.Remote = conn.RemoteAddr().String()
+			}
+		}
+	}
+	reader := bufio.NewReader(conn)
+	line, _, err := reader.ReadLine()
+	if err != nil {
+		return "", caller, err
+	}
+	command = string(line)
+	if strings.HasPrefix(command, "auth ") {
+		var tokenCaller *base.ServerCaller
+		if auth != nil {
+			tokenCaller = auth.AuthenticateToken(strings.TrimSpace(strings.TrimPrefix(command, "auth ")))
+		}
+		if tokenCaller == nil {
+			return "", caller, fmt.Errorf("Authentication failed")
+		}
+		tokenCaller.Remote = caller.Remote
+		caller = tokenCaller
+		if line, _, err = reader.ReadLine(); err != nil {
+			return "", caller, err
+		}
+		command = string(line)
+	}
+	if caller.Role == "" {
+		return "", caller, fmt.Errorf("Authentication required")
+	}
+	return command, caller, nil
+}
+
 // Server listens for requests on a socket file or via TCP
 type Server struct {
 	migrationContext *base.MigrationContext
@@ -28,13 +125,16 @@ type Server struct {
 	tcpListener      net.Listener
 	hooksExecutor    *HooksExecutor
 	printStatus      printStatusFunc
+	auditCommand     auditCommandFunc
+	closed           int64
 }
 
-func NewServer(migrationContext *base.MigrationContext, hooksExecutor *HooksExecutor, printStatus printStatusFunc) *Server {
+func NewServer(migrationContext *base.MigrationContext, hooksExecutor *HooksExecutor, printStatus printStatusFunc, auditCommand auditCommandFunc) *Server {
 	return &Server{
 		migrationContext: migrationContext,
 		hooksExecutor:    hooksExecutor,
 		printStatus:      printStatus,
+		auditCommand:     auditCommand,
 	}
 }
 
@@ -62,7 +162,7 @@ func (this *Server) BindTCPPort() (err error) {
 	if this.migrationContext.ServeTCPPort == 0 {
 		return nil
 	}
-	this.tcpListener, err = net.Listen("tcp", fmt.Sprintf(":%d", this.migrationContext.ServeTCPPort))
+	this.tcpListener, err = listenTCP(this.migrationContext)
 	if err != nil {
 		return err
 	}
@@ -73,12 +173,19 @@ func (this *Server) BindTCPPort() (err error) {
 // Serve begins listening & serving on whichever device was configured
 func (this *Server) Serve() (err error) {
 	go func() {
+		if this.unixListener == nil {
+			return
+		}
 		for {
 			conn, err := this.unixListener.Accept()
 			if err != nil {
+				if atomic.LoadInt64(&this.closed) > 0 {
+					return
+				}
 				log.Errore(err)
+				continue
 			}
-			go this.handleConnection(conn)
+			go this.handleConnection(conn, false)
 		}
 	}()
 	go func() {
@@ -88,31 +195,50 @@ func (this *Server) Serve() (err error) {
 		for {
 			conn, err := this.tcpListener.Accept()
 			if err != nil {
+				if atomic.LoadInt64(&this.closed) > 0 {
+					return
+				}
 				log.Errore(err)
+				continue
 			}
-			go this.handleConnection(conn)
+			go this.handleConnection(conn, true)
 		}
 	}()
 
 	return nil
 }
 
-func (this *Server) handleConnection(conn net.Conn) (err error) {
+// Teardown stops listening
+func (this *Server) Teardown() {
+	atomic.StoreInt64(&this.closed, 1)
+	if this.unixListener != nil {
+		this.unixListener.Close()
+	}
+	if this.tcpListener != nil {
+		this.tcpListener.Close()
+	}
+}
+
+func (this *Server) handleConnection(conn net.Conn, overTCP bool) (err error) {
 	if conn != nil {
 		defer conn.Close()
 	}
-	command, _, err := bufio.NewReader(conn).ReadLine()
+	command, caller, err := readServerCommand(this.migrationContext, conn, overTCP)
 	if err != nil {
+		if err != io.EOF {
+			log.Warningf("Rejected interactive command connection: %+v; %s", err, caller)
+			fmt.Fprintf(conn, "%s\n", err.Error())
+		}
 		return err
 	}
-	return this.onServerCommand(string(command), bufio.NewWriter(conn))
+	return this.onServerCommand(command, caller, bufio.NewWriter(conn))
 }
 
 // onServerCommand responds to a user's interactive command
-func (this *Server) onServerCommand(command string, writer *bufio.Writer) (err error) {
+func (this *Server) onServerCommand(command string, caller *base.ServerCaller, writer *bufio.Writer) (err error) {
 	defer writer.Flush()
 
-	printStatusRule, err := this.applyServerCommand(command, writer)
+	printStatusRule, err := this.applyServerCommand(command, caller, writer)
 	if err == nil {
 		this.printStatus(printStatusRule, writer)
 	} else {
@@ -122,9 +248,17 @@ func (this *Server) onServerCommand(command string, writer *bufio.Writer) (err e
 }
 
 // applyServerCommand parses and executes commands by user
-func (this *Server) applyServerCommand(command string, writer *bufio.Writer) (printStatusRule PrintStatusRule, err error) {
+func (this *Server) applyServerCommand(command string, caller *base.ServerCaller, writer *bufio.Writer) (printStatusRule PrintStatusRule, err error) {
 	printStatusRule = NoPrintStatusRule
 
+	if !isReadOnlyServerCommand(command) {
+		if !caller.CanMutate() {
+			log.Warningf("Denied interactive command %s; %s", strconv.Quote(command), caller)
+			return NoPrintStatusRule, fmt.Errorf("Permission denied: %s is %s", caller.Identity, caller.Role)
+		}
+		this.recordCommand(command, caller)
+	}
+
 	tokens := strings.SplitN(command, "=", 2)
 	command = strings.TrimSpace(tokens[0])
 	arg := ""
@@ -136,8 +270,11 @@ func (this *Server) applyServerCommand(command string, writer *bufio.Writer) (pr
 	}
 	argIsQuestion := (arg == "?")
 	throttleHint := "# Note: you may only throttle for as long as your binary logs are not purged\n"
+	if headroom, limited := this.migrationContext.GetBinlogHeadroom(); limited {
+		throttleHint = fmt.Sprintf("# Note: you may only throttle for as long as your binary logs are not purged; estimated binlog headroom: %s\n", base.PrettifyDurationOutput(headroom))
+	}
 
-	if err := this.hooksExecutor.onInteractiveCommand(command); err != nil {
+	if err := this.hooksExecutor.onInteractiveCommand(command, caller); err != nil {
 		return NoPrintStatusRule, err
 	}
 
@@ -160,7 +297,14 @@ throttle-http=<URL>                  # Set a new throttle URL
 throttle-control-replicas=<replicas> # Set a new comma delimited list of throttle control replicas
 throttle                             # Force throttling
 no-throttle                          # End forced throttling (other throttling may still apply)
+postpone                             # Postpone cut-over until 'unpostpone'
+postpone-until=<timestamp>           # Postpone cut-over until given time (RFC3339, 'YYYY-MM-DD hh:mm:ss' or unix epoch seconds)
 unpostpone                           # Bail out a cut-over postpone; proceed to cut-over
+cut-over-lock-timeout=<seconds>      # Set a new cut-over lock timeout (range 1-10); applies on next cut-over attempt
+cut-over-type=<type>                 # Set a new cut-over type: atomic|two-step; applies on next cut-over attempt
+cut-over-exponential-backoff=<bool>  # Wait exponentially longer between failed cut-over attempts; applies once cut-over begins
+approve-query-plans                  # Approve reported query plan regressions; no longer postpone cut-over on their account
+abort                                # abort the migration gracefully: stop writes, clean up tables per --abort-drop-tables
 panic                                # panic and quit without cleanup
 help                                 # This message
 - use '?' (question mark) as argument to get info rather than set. e.g. "max-load=?" will just print out current max-load.
@@ -265,7 +409,7 @@ help                                 # This message
 				return NoPrintStatusRule, nil
 			}
 			this.migrationContext.SetThrottleQuery(arg)
-			fmt.Fprintf(writer, throttleHint)
+			fmt.Fprint(writer, throttleHint)
 			return ForcePrintStatusAndHintRule, nil
 		}
 	case "throttle-http":
@@ -275,7 +419,7 @@ help                                 # This message
 				return NoPrintStatusRule, nil
 			}
 			this.migrationContext.SetThrottleHTTP(arg)
-			fmt.Fprintf(writer, throttleHint)
+			fmt.Fprint(writer, throttleHint)
 			return ForcePrintStatusAndHintRule, nil
 		}
 	case "throttle-control-replicas":
@@ -298,7 +442,7 @@ help                                 # This message
 				return NoPrintStatusRule, err
 			}
 			atomic.StoreInt64(&this.migrationContext.ThrottleCommandedByUser, 1)
-			fmt.Fprintf(writer, throttleHint)
+			fmt.Fprint(writer, throttleHint)
 			return ForcePrintStatusAndHintRule, nil
 		}
 	case "no-throttle", "unthrottle", "resume", "continue":
@@ -311,6 +455,76 @@ help                                 # This message
 			atomic.StoreInt64(&this.migrationContext.ThrottleCommandedByUser, 0)
 			return ForcePrintStatusAndHintRule, nil
 		}
+	case "postpone", "postpone-until":
+		{
+			if command == "postpone-until" && argIsQuestion {
+				if postponeUntil := atomic.LoadInt64(&this.migrationContext.PostponeCutOverUntil); postponeUntil > 0 {
+					fmt.Fprintf(writer, "%s\n", time.Unix(0, postponeUntil).Format(time.RFC3339))
+				}
+				return NoPrintStatusRule, nil
+			}
+			if command == "postpone" && arg != "" && arg != this.migrationContext.OriginalTableName {
+				// User explicitly provided table name. This is a courtesy protection mechanism
+				err := fmt.Errorf("User commanded 'postpone' on %s, but migrated table is %s; ignoring request.", arg, this.migrationContext.OriginalTableName)
+				return NoPrintStatusRule, err
+			}
+			if atomic.LoadInt64(&this.migrationContext.CutOverCompleteFlag) > 0 {
+				err := fmt.Errorf("User commanded '%s', but cut-over is already complete; ignoring request.", command)
+				return NoPrintStatusRule, err
+			}
+			if command == "postpone" {
+				atomic.StoreInt64(&this.migrationContext.UserCommandedPostponeFlag, 1)
+				fmt.Fprintf(writer, "Postponed\n")
+				return ForcePrintStatusAndHintRule, nil
+			}
+			postponeUntil, err := base.ParseTimestamp(arg)
+			if err != nil {
+				return NoPrintStatusRule, err
+			}
+			atomic.StoreInt64(&this.migrationContext.PostponeCutOverUntil, postponeUntil.UnixNano())
+			fmt.Fprintf(writer, "Postponed until %s\n", postponeUntil.Format(time.RFC3339))
+			return ForcePrintStatusAndHintRule, nil
+		}
+	case "cut-over-lock-timeout":
+		{
+			if argIsQuestion {
+				fmt.Fprintf(writer, "%+v\n", this.migrationContext.GetCutOverLockTimeoutSeconds())
+				return NoPrintStatusRule, nil
+			}
+			if timeoutSeconds, err := strconv.Atoi(arg); err != nil {
+				return NoPrintStatusRule, err
+			} else if err := this.migrationContext.SetCutOverLockTimeoutSeconds(int64(timeoutSeconds)); err != nil {
+				return NoPrintStatusRule, err
+			}
+			return ForcePrintStatusAndHintRule, nil
+		}
+	case "cut-over-type":
+		{
+			if argIsQuestion {
+				fmt.Fprintf(writer, "%s\n", this.migrationContext.GetCutOverTypeName())
+				return NoPrintStatusRule, nil
+			}
+			if arg == "" {
+				return NoPrintStatusRule, fmt.Errorf("cut-over-type expects one of: atomic, two-step")
+			}
+			if err := this.migrationContext.SetCutOverType(arg); err != nil {
+				return NoPrintStatusRule, err
+			}
+			return ForcePrintStatusAndHintRule, nil
+		}
+	case "cut-over-exponential-backoff":
+		{
+			if argIsQuestion {
+				fmt.Fprintf(writer, "%+v\n", this.migrationContext.GetCutOverExponentialBackoff())
+				return NoPrintStatusRule, nil
+			}
+			exponentialBackoff, err := strconv.ParseBool(arg)
+			if err != nil {
+				return NoPrintStatusRule, err
+			}
+			this.migrationContext.SetCutOverExponentialBackoff(exponentialBackoff)
+			return ForcePrintStatusAndHintRule, nil
+		}
 	case "unpostpone", "no-postpone", "cut-over":
 		{
 			if arg == "" && this.migrationContext.ForceNamedCutOverCommand {
@@ -322,14 +536,50 @@ help                                 # This message
 				err := fmt.Errorf("User commanded 'unpostpone' on %s, but migrated table is %s; ignoring request.", arg, this.migrationContext.OriginalTableName)
 				return NoPrintStatusRule, err
 			}
+			wasPostponedByUser := this.migrationContext.IsCutOverPostponedByUser()
+			this.migrationContext.ClearUserCommandedPostpone()
 			if atomic.LoadInt64(&this.migrationContext.IsPostponingCutOver) > 0 {
 				atomic.StoreInt64(&this.migrationContext.UserCommandedUnpostponeFlag, 1)
 				fmt.Fprintf(writer, "Unpostponed\n")
 				return ForcePrintStatusAndHintRule, nil
 			}
+			if wasPostponedByUser {
+				fmt.Fprintf(writer, "Cancelled user commanded postpone\n")
+				return ForcePrintStatusAndHintRule, nil
+			}
 			fmt.Fprintf(writer, "You may only invoke this when gh-ost is actively postponing migration. At this time it is not.\n")
 			return NoPrintStatusRule, nil
 		}
+	case "approve-query-plans":
+		{
+			if arg != "" && arg != this.migrationContext.OriginalTableName {
+				// User explicitly provided table name. This is a courtesy protection mechanism
+				err := fmt.Errorf("User commanded 'approve-query-plans' on %s, but migrated table is %s; ignoring request.", arg, this.migrationContext.OriginalTableName)
+				return NoPrintStatusRule, err
+			}
+			if atomic.LoadInt64(&this.migrationContext.QueryPlanApprovalPendingFlag) > 0 {
+				atomic.StoreInt64(&this.migrationContext.QueryPlanApprovalPendingFlag, 0)
+				fmt.Fprintf(writer, "Query plans approved\n")
+				return ForcePrintStatusAndHintRule, nil
+			}
+			fmt.Fprintf(writer, "No query plan regressions pending approval\n")
+			return NoPrintStatusRule, nil
+		}
+	case "abort":
+		{
+			if arg != "" && arg != this.migrationContext.OriginalTableName {
+				// User explicitly provided table name. This is a courtesy protection mechanism
+				err := fmt.Errorf("User commanded 'abort' on %s, but migrated table is %s; ignoring request.", arg, this.migrationContext.OriginalTableName)
+				return NoPrintStatusRule, err
+			}
+			if atomic.LoadInt64(&this.migrationContext.CutOverCompleteFlag) > 0 {
+				err := fmt.Errorf("User commanded 'abort', but cut-over is already complete; ignoring request.")
+				return NoPrintStatusRule, err
+			}
+			this.migrationContext.RequestAbort("User commanded 'abort'")
+			fmt.Fprintf(writer, "Aborting\n")
+			return ForcePrintStatusAndHintRule, nil
+		}
 	case "panic":
 		{
 			if arg == "" && this.migrationContext.ForceNamedPanicCommand {
@@ -351,3 +601,20 @@ help                                 # This message
 	}
 	return NoPrintStatusRule, nil
 }
+
+// recordCommand logs a mutating command along with its caller, and writes it onto the changelog table.
+// A failure to write does not block the command: 'abort' and 'panic' must work even when the database does not.
+func (this *Server) recordCommand(command string, caller *base.ServerCaller) {
+	quotedCommand := strconv.QuoteToASCII(command)
+	if len(quotedCommand) > auditCommandMaxLength {
+		quotedCommand = quotedCommand[:auditCommandMaxLength]
+	}
+	value := fmt.Sprintf("%s command=%s", caller, quotedCommand)
+	log.Infof("Interactive command: %s", value)
+	if this.auditCommand == nil {
+		return
+	}
+	if _, err := this.auditCommand(auditCommandHint, value); err != nil {
+		log.Errorf("Failed writing interactive command to changelog: %+v", err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"gh-ost/go/base"
 	"gh-ost/go/binlog"
 	"gh-ost/go/mysql"
+	"gh-ost/go/sql"
 
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/golib/sqlutils"
@@ -45,6 +46,7 @@ type EventsStreamer struct {
 	//数据迁移上下文
 	migrationContext         *base.MigrationContext
 	initialBinlogCoordinates *mysql.BinlogCoordinates
+	initialGTIDPosition      mysql.MariaDBGTIDPosition
 	listeners                [](*BinlogEventListener)
 	listenersMutex           *sync.Mutex
 	eventsChannel            chan *binlog.BinlogEntry
@@ -53,7 +55,7 @@ type EventsStreamer struct {
 
 func NewEventsStreamer(migrationContext *base.MigrationContext) *EventsStreamer {
 	return &EventsStreamer{
-		connectionConfig: migrationContext.InspectorConnectionConfig,
+		connectionConfig: migrationContext.GetBinlogSourceConnectionConfig(),
 		migrationContext: migrationContext,
 		listeners:        [](*BinlogEventListener){},
 		listenersMutex:   &sync.Mutex{},
@@ -113,9 +115,16 @@ func (this *EventsStreamer) InitDBConnections() (err error) {
 	if this.db, _, err = mysql.GetDB(this.migrationContext.Uuid, EventsStreamerUri); err != nil {
 		return err
 	}
-	if _, err := base.ValidateConnection(this.db, this.connectionConfig, this.migrationContext); err != nil {
+	version, err := base.ValidateConnection(this.db, this.connectionConfig, this.migrationContext)
+	if err != nil {
 		return err
 	}
+	this.migrationContext.BinlogSourceMySQLVersion = version
+	if this.migrationContext.HasBinlogSource() {
+		if err := this.validateBinlogSource(); err != nil {
+			return err
+		}
+	}
 	if err := this.readCurrentBinlogCoordinates(); err != nil {
 		return err
 	}
@@ -126,12 +135,51 @@ func (this *EventsStreamer) InitDBConnections() (err error) {
 	return nil
 }
 
+// validateBinlogSource checks that binary logs on --binlog-source are good to go. The inspected server's
+// binary logs are validated by the inspector.
+func (this *EventsStreamer) validateBinlogSource() error {
+	settings, err := mysql.ReadBinlogSourceSettings(this.db)
+	if err != nil {
+		return err
+	}
+	if err := settings.Validate(); err != nil {
+		return fmt.Errorf("Cannot stream binary logs from %s: %+v", this.connectionConfig.Key.DisplayString(), err)
+	}
+	log.Infof("binary logs validated on binlog source %s", this.connectionConfig.Key.DisplayString())
+	return nil
+}
+
+// ReadChangelogHeartbeat reads the changelog heartbeat off the binlog source, as replicated from the master
+func (this *EventsStreamer) ReadChangelogHeartbeat() (heartbeatValue string, err error) {
+	query := fmt.Sprintf(`select /* gh-ost */ value from %s.%s where hint = 'heartbeat' and id <= 255`,
+		sql.EscapeName(this.migrationContext.DatabaseName),
+		sql.EscapeName(this.migrationContext.GetChangelogTableName()),
+	)
+	err = this.db.QueryRow(query).Scan(&heartbeatValue)
+	return heartbeatValue, err
+}
+
 // initBinlogReader creates and connects the reader: we hook up to a MySQL server as a replica
 func (this *EventsStreamer) initBinlogReader(binlogCoordinates *mysql.BinlogCoordinates) error {
 	goMySQLReader, err := binlog.NewGoMySQLReader(this.migrationContext)
 	if err != nil {
 		return err
 	}
+	if this.binlogReader != nil {
+		// Reconnecting. On MariaDB, resume past the last complete transaction read; rows events
+		// of a partially read transaction are skipped as per LastAppliedRowsEventHint
+		gtidPosition := this.binlogReader.GetCurrentGTIDPosition()
+		if this.migrationContext.GetBinlogSourceServerVersion().IsMariaDB() && len(gtidPosition) > 0 {
+			if err := goMySQLReader.ConnectBinlogStreamerAtGTID(gtidPosition, *binlogCoordinates); err != nil {
+				return err
+			}
+			this.binlogReader = goMySQLReader
+			return nil
+		}
+		goMySQLReader.SetGTIDPosition(gtidPosition)
+	} else {
+		goMySQLReader.SetGTIDPosition(this.initialGTIDPosition)
+	}
 	if err := goMySQLReader.ConnectBinlogStreamer(*binlogCoordinates); err != nil {
 		return err
 	}
@@ -143,6 +191,39 @@ func (this *EventsStreamer) GetCurrentBinlogCoordinates() *mysql.BinlogCoordinat
 	return this.binlogReader.GetCurrentBinlogCoordinates()
 }
 
+// GetCurrentGTIDPosition returns the MariaDB GTID position of the last binlog event read; it is empty on MySQL
+func (this *EventsStreamer) GetCurrentGTIDPosition() mysql.MariaDBGTIDPosition {
+	return this.binlogReader.GetCurrentGTIDPosition()
+}
+
+// GetLastEventTime returns the time of the last binlog event read
+func (this *EventsStreamer) GetLastEventTime() time.Time {
+	return this.binlogReader.GetLastEventTime()
+}
+
+// ReadBinlogRetention reads binary logs expiry and the binary logs present on the streamer's source
+func (this *EventsStreamer) ReadBinlogRetention() (*base.BinlogRetention, error) {
+	variables := make(map[string]int64)
+	query := `show /* gh-ost */ global variables where variable_name in ('binlog_expire_logs_seconds', 'expire_logs_days')`
+	err := sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		variables[strings.ToLower(m.GetString("Variable_name"))] = m.GetInt64("Value")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logFiles := []string{}
+	query = `show /* gh-ost */ binary logs`
+	err = sqlutils.QueryRowsMap(this.db, query, func(m sqlutils.RowMap) error {
+		logFiles = append(logFiles, m.GetString("Log_name"))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return base.NewBinlogRetention(variables["binlog_expire_logs_seconds"], variables["expire_logs_days"], logFiles), nil
+}
+
 func (this *EventsStreamer) GetReconnectBinlogCoordinates() *mysql.BinlogCoordinates {
 	return &mysql.BinlogCoordinates{LogFile: this.GetCurrentBinlogCoordinates().LogFile, LogPos: 4}
 }
@@ -166,6 +247,16 @@ func (this *EventsStreamer) readCurrentBinlogCoordinates() error {
 	if !foundMasterStatus {
 		return fmt.Errorf("Got no results from SHOW MASTER STATUS. Bailing out")
 	}
+	if this.migrationContext.GetBinlogSourceServerVersion().IsMariaDB() {
+		var gtidBinlogPos string
+		if err := this.db.QueryRow(`select /* gh-ost */ @@global.gtid_binlog_pos`).Scan(&gtidBinlogPos); err != nil {
+			return err
+		}
+		if this.initialGTIDPosition, err = mysql.ParseMariaDBGTIDPosition(gtidBinlogPos); err != nil {
+			return err
+		}
+		log.Debugf("Streamer GTID position: %s", this.initialGTIDPosition)
+	}
 	log.Debugf("Streamer binlog coordinates: %+v", *this.initialBinlogCoordinates)
 	return nil
 }
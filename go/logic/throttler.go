@@ -6,6 +6,7 @@
 package logic
 
 import (
+	gosql "database/sql"
 	"fmt"
 	"net/http"
 	"strings"
@@ -38,7 +39,10 @@ var (
 	}
 )
 
-const frenoMagicHint = "freno"
+const (
+	frenoMagicHint      = "freno"
+	throttleHTTPTimeout = 1 * time.Second
+)
 
 // Throttler collects metrics related to throttling and makes informed decision
 // whether throttling should take place.
@@ -46,15 +50,29 @@ type Throttler struct {
 	migrationContext  *base.MigrationContext
 	applier           *Applier
 	inspector         *Inspector
+	eventsStreamer    *EventsStreamer
+	hooksExecutor     *HooksExecutor
+	loadSampler       *base.LoadSampler
+	httpClient        *http.Client
 	finishedMigrating int64
+	// throttleHooks queues onThrottled/onUnthrottled hooks, which run in order off the throttle checks
+	throttleHooks chan func()
 }
 
-func NewThrottler(migrationContext *base.MigrationContext, applier *Applier, inspector *Inspector) *Throttler {
+// throttleHooksQueueSize is the number of throttle hooks which may be pending while a hook runs
+const throttleHooksQueueSize = 100
+
+func NewThrottler(migrationContext *base.MigrationContext, applier *Applier, inspector *Inspector, eventsStreamer *EventsStreamer, hooksExecutor *HooksExecutor) *Throttler {
 	return &Throttler{
 		migrationContext:  migrationContext,
 		applier:           applier,
+		hooksExecutor:     hooksExecutor,
 		inspector:         inspector,
+		eventsStreamer:    eventsStreamer,
+		loadSampler:       base.NewLoadSampler(),
+		httpClient:        &http.Client{Timeout: throttleHTTPTimeout},
 		finishedMigrating: 0,
+		throttleHooks:     make(chan func(), throttleHooksQueueSize),
 	}
 }
 
@@ -83,7 +101,12 @@ func (this *Throttler) shouldThrottle() (result bool, reason string, reasonHint
 	}
 	// HTTP throttle
 	statusCode := atomic.LoadInt64(&this.migrationContext.ThrottleHTTPStatusCode)
-	if statusCode != 0 && statusCode != http.StatusOK {
+	if result := this.migrationContext.GetThrottleHTTPResult(); result != nil && result.Throttle {
+		if result.Reason != "" {
+			return true, fmt.Sprintf("%s: %s", this.throttleHttpMessage(result.StatusCode), result.Reason), base.NoThrottleReasonHint
+		}
+		return true, this.throttleHttpMessage(result.StatusCode), base.NoThrottleReasonHint
+	} else if statusCode != 0 && statusCode != http.StatusOK {
 		return true, this.throttleHttpMessage(int(statusCode)), base.NoThrottleReasonHint
 	}
 
@@ -91,7 +114,7 @@ func (this *Throttler) shouldThrottle() (result bool, reason string, reasonHint
 	maxLagMillisecondsThrottleThreshold := atomic.LoadInt64(&this.migrationContext.MaxLagMillisecondsThrottleThreshold)
 	lag := atomic.LoadInt64(&this.migrationContext.CurrentLag)
 	if time.Duration(lag) > time.Duration(maxLagMillisecondsThrottleThreshold)*time.Millisecond {
-		return true, fmt.Sprintf("lag=%fs", time.Duration(lag).Seconds()), base.NoThrottleReasonHint
+		return true, fmt.Sprintf("lag=%fs", time.Duration(lag).Seconds()), base.LagThrottleReasonHint
 	}
 	checkThrottleControlReplicas := true
 	if (this.migrationContext.TestOnReplica || this.migrationContext.MigrateOnReplica) && (atomic.LoadInt64(&this.migrationContext.AllEventsUpToLockProcessedInjectedFlag) > 0) {
@@ -100,10 +123,14 @@ func (this *Throttler) shouldThrottle() (result bool, reason string, reasonHint
 	if checkThrottleControlReplicas {
 		lagResult := this.migrationContext.GetControlReplicasLagResult()
 		if lagResult.Err != nil {
-			return true, fmt.Sprintf("%+v %+v", lagResult.Key, lagResult.Err), base.NoThrottleReasonHint
+			return true, fmt.Sprintf("%+v %+v", lagResult.Key, lagResult.Err), base.LagThrottleReasonHint
+		}
+		replicaMaxLag := time.Duration(maxLagMillisecondsThrottleThreshold) * time.Millisecond
+		if lagResult.MaxLag > 0 {
+			replicaMaxLag = lagResult.MaxLag
 		}
-		if lagResult.Lag > time.Duration(maxLagMillisecondsThrottleThreshold)*time.Millisecond {
-			return true, fmt.Sprintf("%+v replica-lag=%fs", lagResult.Key, lagResult.Lag.Seconds()), base.NoThrottleReasonHint
+		if lagResult.Lag > replicaMaxLag {
+			return true, fmt.Sprintf("%+v replica-lag=%fs", lagResult.Key, lagResult.Lag.Seconds()), base.LagThrottleReasonHint
 		}
 	}
 	// Got here? No metrics indicates we need throttling.
@@ -149,6 +176,14 @@ func (this *Throttler) collectReplicationLag(firstThrottlingCollected chan<- boo
 			} else {
 				atomic.StoreInt64(&this.migrationContext.CurrentLag, int64(lag))
 			}
+		} else if this.migrationContext.HasBinlogSource() {
+			// Binlog events are only as recent as the binlog source: that's where lag is measured.
+			// The inspected server's lag is checked as a throttle control replica.
+			if heartbeatValue, err := this.eventsStreamer.ReadChangelogHeartbeat(); err != nil {
+				return log.Errore(err)
+			} else {
+				this.parseChangelogHeartbeat(heartbeatValue)
+			}
 		} else {
 			if heartbeatValue, err := this.inspector.readChangelogState("heartbeat"); err != nil {
 				return log.Errore(err)
@@ -185,19 +220,40 @@ func (this *Throttler) collectControlReplicasLag() {
 		sql.EscapeName(this.migrationContext.GetChangelogTableName()),
 	)
 
-	readReplicaLag := func(connectionConfig *mysql.ConnectionConfig) (lag time.Duration, err error) {
+	readReplicaLag := func(connectionConfig *mysql.ConnectionConfig, replicaLag *base.ReplicaLag) (lag time.Duration, err error) {
 		dbUri := connectionConfig.GetDBUri("information_schema")
-
-		var heartbeatValue string
-		if db, _, err := mysql.GetDB(this.migrationContext.Uuid, dbUri); err != nil {
+		db, _, err := mysql.GetDB(this.migrationContext.Uuid, dbUri)
+		if err != nil {
 			return lag, err
-		} else if err = db.QueryRow(replicationLagQuery).Scan(&heartbeatValue); err != nil {
+		}
+		switch replicaLag.Source {
+		case base.SecondsBehindMasterReplicaLagSource:
+			return mysql.GetReplicationLagFromSlaveStatus(db)
+		case base.PtHeartbeatReplicaLagSource, base.QueryReplicaLagSource:
+			var lagSeconds gosql.NullFloat64
+			if err := db.QueryRow(replicaLag.Query).Scan(&lagSeconds); err != nil {
+				return lag, err
+			}
+			if !lagSeconds.Valid {
+				return lag, fmt.Errorf("replica-lag %s: query returned NULL", replicaLag.Name)
+			}
+			return time.Duration(lagSeconds.Float64 * float64(time.Second)), nil
+		}
+		var heartbeatValue string
+		if err = db.QueryRow(replicationLagQuery).Scan(&heartbeatValue); err != nil {
 			return lag, err
 		}
-
 		lag, err = parseChangelogHeartbeat(heartbeatValue)
 		return lag, err
 	}
+	// lagRatio is a replica's lag relative to the lag it tolerates
+	lagRatio := func(lagResult *mysql.ReplicationLagResult) float64 {
+		maxLag := lagResult.MaxLag
+		if maxLag == 0 {
+			maxLag = time.Duration(atomic.LoadInt64(&this.migrationContext.MaxLagMillisecondsThrottleThreshold)) * time.Millisecond
+		}
+		return float64(lagResult.Lag) / float64(maxLag)
+	}
 
 	readControlReplicasLag := func() (result *mysql.ReplicationLagResult) {
 		instanceKeyMap := this.migrationContext.GetThrottleControlReplicaKeys()
@@ -209,9 +265,10 @@ func (this *Throttler) collectControlReplicasLag() {
 			connectionConfig := this.migrationContext.InspectorConnectionConfig.Duplicate()
 			connectionConfig.Key = replicaKey
 
-			lagResult := &mysql.ReplicationLagResult{Key: connectionConfig.Key}
+			replicaLag := this.migrationContext.GetReplicaLag(replicaKey)
+			lagResult := &mysql.ReplicationLagResult{Key: connectionConfig.Key, MaxLag: replicaLag.MaxLag}
 			go func() {
-				lagResult.Lag, lagResult.Err = readReplicaLag(connectionConfig)
+				lagResult.Lag, lagResult.Err = readReplicaLag(connectionConfig, replicaLag)
 				lagResults <- lagResult
 			}()
 		}
@@ -221,7 +278,7 @@ func (this *Throttler) collectControlReplicasLag() {
 				result = lagResult
 			} else if lagResult.Err != nil {
 				result = lagResult
-			} else if lagResult.Lag.Nanoseconds() > result.Lag.Nanoseconds() {
+			} else if result.Err == nil && lagRatio(lagResult) > lagRatio(result) {
 				result = lagResult
 			}
 		}
@@ -259,10 +316,73 @@ func (this *Throttler) collectControlReplicasLag() {
 	}
 }
 
+// readLoadSource reads a single value off the applier
+func (this *Throttler) readLoadSource(source base.LoadSource) (int64, error) {
+	if source.Type == base.InnodbMetricsLoadSource {
+		return this.applier.ShowInnodbMetric(source.Name)
+	}
+	return this.applier.ShowStatusVariable(source.Name)
+}
+
+// readLoadMetric samples the sources of a max-load/critical-load metric, and evaluates it.
+// Rates are computed over consecutive samples, i.e. over the throttler's collection interval
+func (this *Throttler) readLoadMetric(expression string) (value int64, err error) {
+	metric, err := base.ParseLoadMetric(expression)
+	if err != nil {
+		return 0, err
+	}
+	for _, source := range metric.Sources() {
+		sourceValue, err := this.readLoadSource(source)
+		if err != nil {
+			return 0, err
+		}
+		this.loadSampler.Sample(source, sourceValue, time.Now())
+	}
+	return this.loadSampler.Evaluate(metric)
+}
+
+// checkClusterFlowControl returns a throttle reason when a Group Replication or Galera cluster is, or is about to be,
+// in flow control. On such clusters a lagging node slows down writes cluster-wide.
+func (this *Throttler) checkClusterFlowControl() (reason string, err error) {
+	switch this.migrationContext.ClusterTopology.Type {
+	case mysql.GroupReplicationClusterType:
+		if maxQueue := this.migrationContext.MaxGroupReplicationQueue; maxQueue > 0 {
+			queue, err := mysql.GetGroupReplicationQueue(this.applier.db)
+			if err != nil {
+				return "", err
+			}
+			if queue > maxQueue {
+				return fmt.Sprintf("group-replication-queue=%d > %d", queue, maxQueue), nil
+			}
+		}
+	case mysql.GaleraClusterType:
+		if maxPaused := this.migrationContext.MaxWsrepFlowControlPaused; maxPaused > 0 {
+			// nanoseconds paused per second, over the collection interval
+			pausedNanos, err := this.readLoadMetric("rate(wsrep_flow_control_paused_ns)")
+			if err != nil {
+				return "", err
+			}
+			if paused := float64(pausedNanos) / float64(time.Second); paused > maxPaused {
+				return fmt.Sprintf("wsrep-flow-control-paused=%.2f > %.2f", paused, maxPaused), nil
+			}
+		}
+		if maxRecvQueue := this.migrationContext.MaxWsrepLocalRecvQueue; maxRecvQueue > 0 {
+			recvQueue, err := this.applier.ShowStatusVariable("wsrep_local_recv_queue")
+			if err != nil {
+				return "", err
+			}
+			if recvQueue > maxRecvQueue {
+				return fmt.Sprintf("wsrep-local-recv-queue=%d > %d", recvQueue, maxRecvQueue), nil
+			}
+		}
+	}
+	return "", nil
+}
+
 func (this *Throttler) criticalLoadIsMet() (met bool, variableName string, value int64, threshold int64, err error) {
 	criticalLoad := this.migrationContext.GetCriticalLoad()
 	for variableName, threshold = range criticalLoad {
-		value, err = this.applier.ShowStatusVariable(variableName)
+		value, err = this.readLoadMetric(variableName)
 		if err != nil {
 			return false, variableName, value, threshold, err
 		}
@@ -273,32 +393,89 @@ func (this *Throttler) criticalLoadIsMet() (met bool, variableName string, value
 	return false, variableName, value, threshold, nil
 }
 
-// collectReplicationLag reads the latest changelog heartbeat value
+// checkThrottleHTTP issues a single throttle HTTP check. The migration's identity is sent as query parameters.
+func (this *Throttler) checkThrottleHTTP(throttleHTTP string) (*base.ThrottleHTTPResult, error) {
+	url, err := base.ThrottleHTTPURL(throttleHTTP, this.migrationContext.DatabaseName, this.migrationContext.OriginalTableName, this.migrationContext.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(this.migrationContext.ThrottleHTTPMethod, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range this.migrationContext.GetThrottleHTTPHeaders() {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return base.ParseThrottleHTTPResponse(resp, time.Now())
+}
+
+// collectThrottleHTTPStatus checks the throttle HTTP endpoint every 100ms, or less frequently when the endpoint
+// suggests a retry-after. It also enforces a rows/sec rate suggested by the endpoint.
 func (this *Throttler) collectThrottleHTTPStatus(firstThrottlingCollected chan<- bool) {
+	var retryAt time.Time
+	var retryURL string
 	collectFunc := func() (sleep bool, err error) {
 		if atomic.LoadInt64(&this.migrationContext.HibernateUntil) > 0 {
 			return true, nil
 		}
 		url := this.migrationContext.GetThrottleHTTP()
 		if url == "" {
+			atomic.StoreInt64(&this.migrationContext.ThrottleHTTPStatusCode, 0)
+			this.migrationContext.SetThrottleHTTPResult(nil)
 			return true, nil
 		}
-		resp, err := http.Head(url)
+		if url == retryURL && time.Now().Before(retryAt) {
+			// Keep the previous result until the endpoint asks to be checked again
+			return false, nil
+		}
+		result, err := this.checkThrottleHTTP(url)
 		if err != nil {
 			return false, err
 		}
-		atomic.StoreInt64(&this.migrationContext.ThrottleHTTPStatusCode, int64(resp.StatusCode))
+		if result.RetryAfter > 0 {
+			retryAt = time.Now().Add(result.RetryAfter)
+			retryURL = url
+		} else {
+			retryURL = ""
+		}
+		atomic.StoreInt64(&this.migrationContext.ThrottleHTTPStatusCode, int64(result.StatusCode))
+		this.migrationContext.SetThrottleHTTPResult(result)
 		return false, nil
 	}
-
-	_, err := collectFunc()
-	if err != nil {
+	onError := func(err error) {
 		// If not told to ignore errors, we'll throttle on HTTP connection issues
 		if !this.migrationContext.IgnoreHTTPErrors {
 			atomic.StoreInt64(&this.migrationContext.ThrottleHTTPStatusCode, int64(-1))
+			this.migrationContext.SetThrottleHTTPResult(&base.ThrottleHTTPResult{StatusCode: -1, Throttle: true, Reason: err.Error()})
+		}
+	}
+	// A suggested rate only holds back row copy, see executeWriteFuncs; it does not toggle the throttle state
+	rateLimiter := &base.RowsRateLimiter{}
+	checkRate := func() {
+		rowsPerSecond := 0.0
+		if result := this.migrationContext.GetThrottleHTTPResult(); result != nil {
+			rowsPerSecond = result.RowsPerSecond
+		}
+		burst := float64(atomic.LoadInt64(&this.migrationContext.ChunkSize))
+		if rateLimiter.Exceeded(rowsPerSecond, burst, this.migrationContext.GetTotalRowsCopied(), time.Now()) {
+			this.migrationContext.SetThrottleHTTPRateReason(fmt.Sprintf("throttle-http: rows/sec %.0f", rowsPerSecond))
+		} else {
+			this.migrationContext.SetThrottleHTTPRateReason("")
 		}
 	}
 
+	if _, err := collectFunc(); err != nil {
+		onError(err)
+	}
+	checkRate()
+
 	firstThrottlingCollected <- true
 
 	ticker := time.Tick(100 * time.Millisecond)
@@ -309,11 +486,9 @@ func (this *Throttler) collectThrottleHTTPStatus(firstThrottlingCollected chan<-
 
 		sleep, err := collectFunc()
 		if err != nil {
-			// If not told to ignore errors, we'll throttle on HTTP connection issues
-			if !this.migrationContext.IgnoreHTTPErrors {
-				atomic.StoreInt64(&this.migrationContext.ThrottleHTTPStatusCode, int64(-1))
-			}
+			onError(err)
 		}
+		checkRate()
 
 		if sleep {
 			time.Sleep(1 * time.Second)
@@ -338,6 +513,12 @@ func (this *Throttler) collectGeneralThrottleMetrics() error {
 			this.migrationContext.PanicAbort <- fmt.Errorf("Found panic-file %s. Aborting without cleanup", this.migrationContext.PanicFlagFile)
 		}
 	}
+	// ... and for graceful abort
+	if this.migrationContext.AbortFlagFile != "" {
+		if base.FileExists(this.migrationContext.AbortFlagFile) {
+			this.migrationContext.RequestAbort(fmt.Sprintf("Found abort-flag-file %s", this.migrationContext.AbortFlagFile))
+		}
+	}
 
 	criticalLoadMet, variableName, value, threshold, err := this.criticalLoadIsMet()
 	if err != nil {
@@ -350,9 +531,11 @@ func (this *Throttler) collectGeneralThrottleMetrics() error {
 		atomic.StoreInt64(&this.migrationContext.HibernateUntil, hibernateUntilTime.UnixNano())
 		log.Errorf("critical-load met: %s=%d, >=%d. Will hibernate for the duration of %+v, until %+v", variableName, value, threshold, hibernateDuration, hibernateUntilTime)
 		go func() {
-			time.Sleep(hibernateDuration)
+			this.hooksExecutor.onBeginHibernate(fmt.Sprintf("%s=%d", variableName, value), hibernateUntilTime)
+			time.Sleep(time.Until(hibernateUntilTime))
 			this.migrationContext.SetThrottleGeneralCheckResult(base.NewThrottleCheckResult(true, "leaving hibernation", base.LeavingHibernationThrottleReasonHint))
 			atomic.StoreInt64(&this.migrationContext.HibernateUntil, 0)
+			this.hooksExecutor.onEndHibernate()
 		}()
 		return nil
 	}
@@ -392,14 +575,19 @@ func (this *Throttler) collectGeneralThrottleMetrics() error {
 
 	maxLoad := this.migrationContext.GetMaxLoad()
 	for variableName, threshold := range maxLoad {
-		value, err := this.applier.ShowStatusVariable(variableName)
+		value, err := this.readLoadMetric(variableName)
 		if err != nil {
 			return setThrottle(true, fmt.Sprintf("%s %s", variableName, err), base.NoThrottleReasonHint)
 		}
 		if value >= threshold {
-			return setThrottle(true, fmt.Sprintf("max-load %s=%d >= %d", variableName, value, threshold), base.NoThrottleReasonHint)
+			return setThrottle(true, fmt.Sprintf("max-load %s=%d >= %d", variableName, value, threshold), base.LoadThrottleReasonHint)
 		}
 	}
+	if reason, err := this.checkClusterFlowControl(); err != nil {
+		return setThrottle(true, fmt.Sprintf("flow-control %s", err), base.NoThrottleReasonHint)
+	} else if reason != "" {
+		return setThrottle(true, reason, base.NoThrottleReasonHint)
+	}
 	if this.migrationContext.GetThrottleQuery() != "" {
 		if res, _ := this.applier.ExecuteThrottleQuery(); res > 0 {
 			return setThrottle(true, "throttle-query", base.NoThrottleReasonHint)
@@ -409,10 +597,54 @@ func (this *Throttler) collectGeneralThrottleMetrics() error {
 	return setThrottle(false, "", base.NoThrottleReasonHint)
 }
 
+// discoverReplicas walks the replication tree below the applier, and updates the discovered throttle control replicas.
+// Upon error, the previously discovered replicas are kept.
+func (this *Throttler) discoverReplicas() error {
+	applierKey := this.migrationContext.ApplierConnectionConfig.Key
+	discoveredKeys, err := mysql.DiscoverReplicas(this.applier.db, applierKey, this.migrationContext.InspectorConnectionConfig, mysql.NewInstanceKeyMap())
+	if err != nil {
+		return log.Errorf("Failed discovering replicas of %+v: %+v", applierKey, err)
+	}
+	replicaKeys, err := this.migrationContext.FilterDiscoveredReplicaKeys(discoveredKeys)
+	if err != nil {
+		return log.Errore(err)
+	}
+	previousKeys := this.migrationContext.GetDiscoveredReplicaKeys()
+	for _, key := range replicaKeys.GetInstanceKeys() {
+		if !previousKeys.HasKey(key) {
+			log.Infof("Discovered throttle control replica: %+v", key)
+		}
+	}
+	for _, key := range previousKeys.GetInstanceKeys() {
+		if !replicaKeys.HasKey(key) {
+			log.Infof("No longer a throttle control replica: %+v", key)
+		}
+	}
+	this.migrationContext.SetDiscoveredReplicaKeys(replicaKeys)
+	return nil
+}
+
+// collectDiscoveredReplicas periodically re-discovers replicas, picking up topology changes
+func (this *Throttler) collectDiscoveredReplicas() {
+	ticker := time.NewTicker(time.Duration(this.migrationContext.DiscoverReplicasIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.LoadInt64(&this.finishedMigrating) > 0 {
+			return
+		}
+		this.discoverReplicas()
+	}
+}
+
 // initiateThrottlerMetrics initiates the various processes that collect measurements
 // that may affect throttling. There are several components, all running independently,
 // that collect such metrics.
 func (this *Throttler) initiateThrottlerCollection(firstThrottlingCollected chan<- bool) {
+	if this.migrationContext.DiscoverThrottleControlReplicas {
+		// First discovery precedes first lag collection
+		this.discoverReplicas()
+		go this.collectDiscoveredReplicas()
+	}
 	go this.collectReplicationLag(firstThrottlingCollected)
 	go this.collectControlReplicasLag()
 	go this.collectThrottleHTTPStatus(firstThrottlingCollected)
@@ -432,9 +664,34 @@ func (this *Throttler) initiateThrottlerCollection(firstThrottlingCollected chan
 	}()
 }
 
+// runThrottleHooks runs queued throttle hooks one at a time, such that a slow hook does not delay throttle checks
+func (this *Throttler) runThrottleHooks() {
+	for {
+		select {
+		case hook := <-this.throttleHooks:
+			hook()
+		case <-time.After(time.Second):
+			if atomic.LoadInt64(&this.finishedMigrating) > 0 {
+				return
+			}
+		}
+	}
+}
+
+// queueThrottleHook queues a throttle hook without blocking. Should hooks run so slowly that the queue
+// fills up, the hook is skipped.
+func (this *Throttler) queueThrottleHook(hookName string, hook func()) {
+	select {
+	case this.throttleHooks <- hook:
+	default:
+		log.Warningf("Too many pending throttle hooks; skipping %s", hookName)
+	}
+}
+
 // initiateThrottlerChecks initiates the throttle ticker and sets the basic behavior of throttling.
 func (this *Throttler) initiateThrottlerChecks() error {
 	throttlerTick := time.Tick(100 * time.Millisecond)
+	go this.runThrottleHooks()
 
 	throttlerFunction := func() {
 		alreadyThrottling, currentReason, _ := this.migrationContext.IsThrottled()
@@ -450,6 +707,12 @@ func (this *Throttler) initiateThrottlerChecks() error {
 			this.applier.WriteAndLogChangelog("throttle", "done throttling")
 		}
 		this.migrationContext.SetThrottled(shouldThrottle, throttleReason, throttleReasonHint)
+		// Hook failures do not fail the migration; they are logged by the executor
+		if shouldThrottle && !alreadyThrottling {
+			this.queueThrottleHook(onThrottled, func() { this.hooksExecutor.onThrottled(throttleReason) })
+		} else if alreadyThrottling && !shouldThrottle {
+			this.queueThrottleHook(onUnthrottled, func() { this.hooksExecutor.onUnthrottled() })
+		}
 	}
 	throttlerFunction()
 	for range throttlerTick {
@@ -471,6 +734,9 @@ func (this *Throttler) throttle(onThrottled func()) {
 		if shouldThrottle, _, _ := this.migrationContext.IsThrottled(); !shouldThrottle {
 			return
 		}
+		if this.migrationContext.IsAbortRequested() {
+			return
+		}
 		if onThrottled != nil {
 			onThrottled()
 		}
@@ -0,0 +1,69 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/outbrain/golib/sqlutils"
+)
+
+// BinlogSourceSettings are the binary log settings of the server binlog events are streamed from
+type BinlogSourceSettings struct {
+	LogBin          bool
+	BinlogFormat    string
+	BinlogRowImage  string
+	LogSlaveUpdates bool
+	// LogBinCompress is MariaDB's log_bin_compress
+	LogBinCompress bool
+	// IsReplica is true when the server replicates from another server
+	IsReplica bool
+}
+
+// ReadBinlogSourceSettings reads binary log settings off given server
+func ReadBinlogSourceSettings(db *gosql.DB) (settings *BinlogSourceSettings, err error) {
+	settings = &BinlogSourceSettings{}
+	query := `select /* gh-ost */ @@global.log_bin, @@global.binlog_format, @@global.log_slave_updates`
+	if err := db.QueryRow(query).Scan(&settings.LogBin, &settings.BinlogFormat, &settings.LogSlaveUpdates); err != nil {
+		return nil, err
+	}
+	query = `select /* gh-ost */ @@global.binlog_row_image`
+	if err := db.QueryRow(query).Scan(&settings.BinlogRowImage); err != nil {
+		// Only as of 5.6
+		settings.BinlogRowImage = "FULL"
+	}
+	if settings.LogBinCompress, err = IsBinlogCompressed(db); err != nil {
+		return nil, err
+	}
+	err = sqlutils.QueryRowsMap(db, `show /* gh-ost */ slave status`, func(m sqlutils.RowMap) error {
+		settings.IsReplica = true
+		return nil
+	})
+	return settings, err
+}
+
+// Validate checks the settings allow streaming row events off the server. A replica must further log the
+// changes it replicates, since the migration writes to the master.
+func (this *BinlogSourceSettings) Validate() error {
+	if !this.LogBin {
+		return fmt.Errorf("binary logs must be enabled (log_bin)")
+	}
+	if strings.ToUpper(this.BinlogFormat) != "ROW" {
+		return fmt.Errorf("binlog_format must be ROW. Got: %s", this.BinlogFormat)
+	}
+	if strings.ToUpper(this.BinlogRowImage) != "FULL" {
+		return fmt.Errorf("binlog_row_image must be FULL. Got: %s", this.BinlogRowImage)
+	}
+	if this.LogBinCompress {
+		return fmt.Errorf("log_bin_compress must be disabled: compressed binary log events are not supported")
+	}
+	if this.IsReplica && !this.LogSlaveUpdates {
+		return fmt.Errorf("log_slave_updates must be enabled on a replica")
+	}
+	return nil
+}
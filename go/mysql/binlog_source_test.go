@@ -0,0 +1,41 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestBinlogSourceSettingsValidate(t *testing.T) {
+	{
+		settings := &BinlogSourceSettings{LogBin: true, BinlogFormat: "ROW", BinlogRowImage: "full"}
+		test.S(t).ExpectNil(settings.Validate())
+	}
+	{
+		settings := &BinlogSourceSettings{LogBin: false, BinlogFormat: "ROW", BinlogRowImage: "FULL"}
+		test.S(t).ExpectNotNil(settings.Validate())
+	}
+	{
+		settings := &BinlogSourceSettings{LogBin: true, BinlogFormat: "MIXED", BinlogRowImage: "FULL"}
+		test.S(t).ExpectNotNil(settings.Validate())
+	}
+	{
+		settings := &BinlogSourceSettings{LogBin: true, BinlogFormat: "ROW", BinlogRowImage: "MINIMAL"}
+		test.S(t).ExpectNotNil(settings.Validate())
+	}
+	{
+		settings := &BinlogSourceSettings{LogBin: true, BinlogFormat: "ROW", BinlogRowImage: "FULL", IsReplica: true}
+		test.S(t).ExpectNotNil(settings.Validate())
+		settings.LogSlaveUpdates = true
+		test.S(t).ExpectNil(settings.Validate())
+	}
+	{
+		settings := &BinlogSourceSettings{LogBin: true, BinlogFormat: "ROW", BinlogRowImage: "FULL", LogBinCompress: true}
+		test.S(t).ExpectNotNil(settings.Validate())
+	}
+}
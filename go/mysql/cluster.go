@@ -0,0 +1,134 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/outbrain/golib/sqlutils"
+)
+
+// ClusterType is the replication technology of the cluster a server belongs to
+type ClusterType string
+
+const (
+	AsyncClusterType            ClusterType = "async"
+	GroupReplicationClusterType ClusterType = "group-replication"
+	GaleraClusterType           ClusterType = "galera"
+)
+
+// ClusterTopology describes the cluster a server belongs to
+type ClusterTopology struct {
+	Type ClusterType
+	// SinglePrimary applies to Group Replication: false when the group runs in multi-primary mode
+	SinglePrimary bool
+	// PxcStrictMode applies to Percona XtraDB Cluster; empty on other Galera flavors
+	PxcStrictMode string
+}
+
+// HasLocalTableLocks returns true when LOCK TABLES only applies to the local node, and does not prevent
+// writes on the table through other nodes of the cluster
+func (this *ClusterTopology) HasLocalTableLocks() bool {
+	switch this.Type {
+	case GroupReplicationClusterType:
+		return !this.SinglePrimary
+	case GaleraClusterType:
+		return true
+	}
+	return false
+}
+
+// RejectsTableLocks returns true when the server refuses LOCK TABLES altogether
+func (this *ClusterTopology) RejectsTableLocks() bool {
+	if this.Type != GaleraClusterType {
+		return false
+	}
+	switch strings.ToUpper(this.PxcStrictMode) {
+	case "ENFORCING", "MASTER":
+		return true
+	}
+	return false
+}
+
+func (this *ClusterTopology) String() string {
+	switch this.Type {
+	case GroupReplicationClusterType:
+		if this.SinglePrimary {
+			return fmt.Sprintf("%s (single-primary)", this.Type)
+		}
+		return fmt.Sprintf("%s (multi-primary)", this.Type)
+	case GaleraClusterType:
+		if this.PxcStrictMode != "" {
+			return fmt.Sprintf("%s (pxc_strict_mode=%s)", this.Type, this.PxcStrictMode)
+		}
+	}
+	return string(this.Type)
+}
+
+// showGlobalVariable reads a global variable, returning empty string when the variable does not exist
+func showGlobalVariable(db *gosql.DB, variableName string) (value string, err error) {
+	query := fmt.Sprintf(`show /* gh-ost */ global variables like '%s'`, variableName)
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		value = m.GetString("Value")
+		return nil
+	})
+	return value, err
+}
+
+// DetectClusterTopology detects whether given server is a member of a Group Replication group or of a
+// Galera/PXC cluster. Anything else is considered to be asynchronous replication.
+func DetectClusterTopology(db *gosql.DB) (topology *ClusterTopology, err error) {
+	topology = &ClusterTopology{Type: AsyncClusterType}
+
+	wsrepProvider, err := showGlobalVariable(db, "wsrep_provider")
+	if err != nil {
+		return nil, err
+	}
+	if wsrepProvider != "" && strings.ToLower(wsrepProvider) != "none" {
+		wsrepOn, err := showGlobalVariable(db, "wsrep_on")
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToUpper(wsrepOn) == "ON" {
+			topology.Type = GaleraClusterType
+			if topology.PxcStrictMode, err = showGlobalVariable(db, "pxc_strict_mode"); err != nil {
+				return nil, err
+			}
+			return topology, nil
+		}
+	}
+
+	// performance_schema.replication_group_members exists as of 5.7, and is empty unless the server
+	// is a member of a group. Failure to read it means no Group Replication.
+	onlineMembers := 0
+	query := `select /* gh-ost */ count(*) from performance_schema.replication_group_members where member_state = 'ONLINE'`
+	if err := db.QueryRow(query).Scan(&onlineMembers); err != nil || onlineMembers == 0 {
+		return topology, nil
+	}
+	topology.Type = GroupReplicationClusterType
+	singlePrimaryMode, err := showGlobalVariable(db, "group_replication_single_primary_mode")
+	if err != nil {
+		return nil, err
+	}
+	topology.SinglePrimary = strings.ToUpper(singlePrimaryMode) == "ON" || singlePrimaryMode == "1"
+	return topology, nil
+}
+
+// GetGroupReplicationQueue returns the largest number of transactions queued on any member of the group,
+// either pending certification or, as of 8.0, pending apply
+func GetGroupReplicationQueue(db *gosql.DB) (queue int64, err error) {
+	query := `select /* gh-ost */ * from performance_schema.replication_group_member_stats`
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		memberQueue := m.GetInt64("COUNT_TRANSACTIONS_IN_QUEUE") + m.GetInt64("COUNT_TRANSACTIONS_REMOTE_IN_APPLIER_QUEUE")
+		if memberQueue > queue {
+			queue = memberQueue
+		}
+		return nil
+	})
+	return queue, err
+}
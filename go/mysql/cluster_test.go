@@ -0,0 +1,47 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestClusterTopologyTableLocks(t *testing.T) {
+	{
+		topology := &ClusterTopology{Type: AsyncClusterType}
+		test.S(t).ExpectFalse(topology.HasLocalTableLocks())
+		test.S(t).ExpectFalse(topology.RejectsTableLocks())
+		test.S(t).ExpectEquals(topology.String(), "async")
+	}
+	{
+		topology := &ClusterTopology{Type: GroupReplicationClusterType, SinglePrimary: true}
+		test.S(t).ExpectFalse(topology.HasLocalTableLocks())
+		test.S(t).ExpectFalse(topology.RejectsTableLocks())
+		test.S(t).ExpectEquals(topology.String(), "group-replication (single-primary)")
+	}
+	{
+		topology := &ClusterTopology{Type: GroupReplicationClusterType}
+		test.S(t).ExpectTrue(topology.HasLocalTableLocks())
+		test.S(t).ExpectEquals(topology.String(), "group-replication (multi-primary)")
+	}
+	{
+		topology := &ClusterTopology{Type: GaleraClusterType, PxcStrictMode: "PERMISSIVE"}
+		test.S(t).ExpectTrue(topology.HasLocalTableLocks())
+		test.S(t).ExpectFalse(topology.RejectsTableLocks())
+		test.S(t).ExpectEquals(topology.String(), "galera (pxc_strict_mode=PERMISSIVE)")
+	}
+	{
+		topology := &ClusterTopology{Type: GaleraClusterType, PxcStrictMode: "ENFORCING"}
+		test.S(t).ExpectTrue(topology.RejectsTableLocks())
+	}
+	{
+		topology := &ClusterTopology{Type: GaleraClusterType}
+		test.S(t).ExpectFalse(topology.RejectsTableLocks())
+		test.S(t).ExpectEquals(topology.String(), "galera")
+	}
+}
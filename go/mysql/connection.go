@@ -18,6 +18,8 @@ import (
 
 const (
 	TLS_CONFIG_KEY = "ghost"
+	// BINLOG_SOURCE_TLS_CONFIG_KEY registers the TLS settings of --binlog-source, when given its own
+	BINLOG_SOURCE_TLS_CONFIG_KEY = "ghost-binlog-source"
 )
 
 // ConnectionConfig is the minimal configuration required to connect to a MySQL server
@@ -27,6 +29,8 @@ type ConnectionConfig struct {
 	Password   string
 	ImpliedKey *InstanceKey
 	tlsConfig  *tls.Config
+	// tlsConfigKey is the name tlsConfig is registered with on the driver; TLS_CONFIG_KEY when empty
+	tlsConfigKey string
 }
 
 func NewConnectionConfig() *ConnectionConfig {
@@ -40,10 +44,11 @@ func NewConnectionConfig() *ConnectionConfig {
 // DuplicateCredentials creates a new connection config with given key and with same credentials as this config
 func (this *ConnectionConfig) DuplicateCredentials(key InstanceKey) *ConnectionConfig {
 	config := &ConnectionConfig{
-		Key:       key,
-		User:      this.User,
-		Password:  this.Password,
-		tlsConfig: this.tlsConfig,
+		Key:          key,
+		User:         this.User,
+		Password:     this.Password,
+		tlsConfig:    this.tlsConfig,
+		tlsConfigKey: this.tlsConfigKey,
 	}
 	config.ImpliedKey = &config.Key
 	return config
@@ -62,6 +67,12 @@ func (this *ConnectionConfig) Equals(other *ConnectionConfig) bool {
 }
 
 func (this *ConnectionConfig) UseTLS(caCertificatePath, clientCertificate, clientKey string, allowInsecure bool) error {
+	return this.UseTLSAs(TLS_CONFIG_KEY, caCertificatePath, clientCertificate, clientKey, allowInsecure)
+}
+
+// UseTLSAs sets up TLS, registering the settings on the driver with given key, such that connections
+// to different servers may use different TLS settings
+func (this *ConnectionConfig) UseTLSAs(tlsConfigKey string, caCertificatePath, clientCertificate, clientKey string, allowInsecure bool) error {
 	var rootCertPool *x509.CertPool
 	var certs []tls.Certificate
 	var err error
@@ -95,7 +106,8 @@ func (this *ConnectionConfig) UseTLS(caCertificatePath, clientCertificate, clien
 		InsecureSkipVerify: allowInsecure,
 	}
 
-	return mysql.RegisterTLSConfig(TLS_CONFIG_KEY, this.tlsConfig)
+	this.tlsConfigKey = tlsConfigKey
+	return mysql.RegisterTLSConfig(tlsConfigKey, this.tlsConfig)
 }
 
 func (this *ConnectionConfig) TLSConfig() *tls.Config {
@@ -115,6 +127,9 @@ func (this *ConnectionConfig) GetDBUri(databaseName string) string {
 	tlsOption := "false"
 	if this.tlsConfig != nil {
 		tlsOption = TLS_CONFIG_KEY
+		if this.tlsConfigKey != "" {
+			tlsOption = this.tlsConfigKey
+		}
 	}
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?interpolateParams=%t&autocommit=true&charset=utf8mb4,utf8,latin1&tls=%s", this.User, this.Password, hostname, this.Key.Port, databaseName, interpolateParams, tlsOption)
 }
@@ -82,3 +82,18 @@ func TestGetDBUriWithTLSSetup(t *testing.T) {
 	uri := c.GetDBUri("test")
 	test.S(t).ExpectEquals(uri, "gromit:penguin@tcp(myhost:3306)/test?interpolateParams=true&autocommit=true&charset=utf8mb4,utf8,latin1&tls=ghost")
 }
+
+func TestGetDBUriWithTLSConfigKey(t *testing.T) {
+	c := NewConnectionConfig()
+	c.Key = InstanceKey{Hostname: "myhost", Port: 3306}
+	c.User = "gromit"
+	c.Password = "penguin"
+	c.tlsConfig = &tls.Config{}
+	c.tlsConfigKey = BINLOG_SOURCE_TLS_CONFIG_KEY
+
+	uri := c.GetDBUri("test")
+	test.S(t).ExpectEquals(uri, "gromit:penguin@tcp(myhost:3306)/test?interpolateParams=true&autocommit=true&charset=utf8mb4,utf8,latin1&tls=ghost-binlog-source")
+
+	dup := c.DuplicateCredentials(InstanceKey{Hostname: "otherhost", Port: 3310})
+	test.S(t).ExpectEquals(dup.tlsConfigKey, BINLOG_SOURCE_TLS_CONFIG_KEY)
+}
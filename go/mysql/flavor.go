@@ -0,0 +1,106 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Flavor is the MySQL variant a server runs. Values match the flavors of the binlog library.
+type Flavor string
+
+const (
+	MySQLFlavor   Flavor = "mysql"
+	MariaDBFlavor Flavor = "mariadb"
+)
+
+var versionPattern = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.([0-9]+)`)
+
+// ServerVersion is a server's version, as parsed from @@version, e.g. `5.7.26-log` or `10.5.8-MariaDB-log`
+type ServerVersion struct {
+	Flavor Flavor
+	Major  int
+	Minor  int
+	Patch  int
+}
+
+// ParseServerVersion parses @@version. A version that cannot be parsed is treated as MySQL 0.0.0
+func ParseServerVersion(version string) *ServerVersion {
+	serverVersion := &ServerVersion{Flavor: MySQLFlavor}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		serverVersion.Flavor = MariaDBFlavor
+		// Replication protocol clients may see MariaDB 10 as `5.5.5-10.x.y-MariaDB`
+		version = strings.TrimPrefix(version, "5.5.5-")
+	}
+	submatch := versionPattern.FindStringSubmatch(version)
+	if len(submatch) == 0 {
+		return serverVersion
+	}
+	serverVersion.Major, _ = strconv.Atoi(submatch[1])
+	serverVersion.Minor, _ = strconv.Atoi(submatch[2])
+	serverVersion.Patch, _ = strconv.Atoi(submatch[3])
+	return serverVersion
+}
+
+func (this *ServerVersion) String() string {
+	return fmt.Sprintf("%s %d.%d.%d", this.Flavor, this.Major, this.Minor, this.Patch)
+}
+
+// IsMariaDB returns true for MariaDB servers
+func (this *ServerVersion) IsMariaDB() bool {
+	return this.Flavor == MariaDBFlavor
+}
+
+// IsAtLeast returns true when the server's version is equal to or greater than given version
+func (this *ServerVersion) IsAtLeast(major, minor, patch int) bool {
+	if this.Major != major {
+		return this.Major > major
+	}
+	if this.Minor != minor {
+		return this.Minor > minor
+	}
+	return this.Patch >= patch
+}
+
+// HasStatementSamples returns true when performance_schema keeps sample query texts per statement digest,
+// as of MySQL 8.0.3. MariaDB has no query_sample_text column.
+func (this *ServerVersion) HasStatementSamples() bool {
+	return !this.IsMariaDB() && this.IsAtLeast(8, 0, 3)
+}
+
+// HasBinlogMonitorPrivilege returns true when REPLICATION CLIENT is named BINLOG MONITOR, as of MariaDB 10.5.2
+func (this *ServerVersion) HasBinlogMonitorPrivilege() bool {
+	return this.IsMariaDB() && this.IsAtLeast(10, 5, 2)
+}
+
+// HasSlaveMonitorPrivilege returns true when SHOW SLAVE STATUS requires the SLAVE MONITOR privilege,
+// as of MariaDB 10.5.9
+func (this *ServerVersion) HasSlaveMonitorPrivilege() bool {
+	return this.IsMariaDB() && this.IsAtLeast(10, 5, 9)
+}
+
+// ExplainStatement returns an EXPLAIN query for given statement, producing a tabular plan
+func (this *ServerVersion) ExplainStatement(statement string) string {
+	if this.IsMariaDB() {
+		// MariaDB has no FORMAT=TRADITIONAL; tabular output is its default
+		return fmt.Sprintf("explain %s", statement)
+	}
+	return fmt.Sprintf("explain format=traditional %s", statement)
+}
+
+// IsBinlogCompressed returns true when the server writes compressed binary log events (MariaDB's
+// log_bin_compress), which gh-ost cannot decode. Servers without such variable return false.
+func IsBinlogCompressed(db *gosql.DB) (bool, error) {
+	value, err := showGlobalVariable(db, "log_bin_compress")
+	if err != nil {
+		return false, err
+	}
+	return strings.ToUpper(value) == "ON" || value == "1", nil
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	{
+		version := ParseServerVersion("5.7.26-log")
+		test.S(t).ExpectEquals(version.Flavor, MySQLFlavor)
+		test.S(t).ExpectEquals(version.String(), "mysql 5.7.26")
+		test.S(t).ExpectFalse(version.IsMariaDB())
+	}
+	{
+		version := ParseServerVersion("8.0.21")
+		test.S(t).ExpectEquals(version.String(), "mysql 8.0.21")
+	}
+	{
+		version := ParseServerVersion("10.5.8-MariaDB-log")
+		test.S(t).ExpectEquals(version.Flavor, MariaDBFlavor)
+		test.S(t).ExpectEquals(version.String(), "mariadb 10.5.8")
+		test.S(t).ExpectTrue(version.IsMariaDB())
+	}
+	{
+		version := ParseServerVersion("5.5.5-10.3.27-MariaDB-0+deb10u1")
+		test.S(t).ExpectEquals(version.String(), "mariadb 10.3.27")
+	}
+	{
+		version := ParseServerVersion("5.5.68-MariaDB")
+		test.S(t).ExpectEquals(version.String(), "mariadb 5.5.68")
+	}
+	{
+		version := ParseServerVersion("unknown")
+		test.S(t).ExpectEquals(version.String(), "mysql 0.0.0")
+	}
+}
+
+func TestServerVersionIsAtLeast(t *testing.T) {
+	version := ParseServerVersion("8.0.21")
+	test.S(t).ExpectTrue(version.IsAtLeast(8, 0, 21))
+	test.S(t).ExpectTrue(version.IsAtLeast(8, 0, 3))
+	test.S(t).ExpectTrue(version.IsAtLeast(5, 7, 30))
+	test.S(t).ExpectFalse(version.IsAtLeast(8, 0, 22))
+	test.S(t).ExpectFalse(version.IsAtLeast(8, 1, 0))
+	test.S(t).ExpectFalse(version.IsAtLeast(10, 0, 0))
+}
+
+func TestServerVersionFeatures(t *testing.T) {
+	{
+		version := ParseServerVersion("8.0.21")
+		test.S(t).ExpectTrue(version.HasStatementSamples())
+		test.S(t).ExpectFalse(version.HasBinlogMonitorPrivilege())
+		test.S(t).ExpectFalse(version.HasSlaveMonitorPrivilege())
+		test.S(t).ExpectEquals(version.ExplainStatement("select 1"), "explain format=traditional select 1")
+	}
+	{
+		version := ParseServerVersion("5.7.26")
+		test.S(t).ExpectFalse(version.HasStatementSamples())
+	}
+	{
+		version := ParseServerVersion("10.4.17-MariaDB")
+		test.S(t).ExpectFalse(version.HasStatementSamples())
+		test.S(t).ExpectFalse(version.HasBinlogMonitorPrivilege())
+		test.S(t).ExpectFalse(version.HasSlaveMonitorPrivilege())
+		test.S(t).ExpectEquals(version.ExplainStatement("select 1"), "explain select 1")
+	}
+	{
+		version := ParseServerVersion("10.5.8-MariaDB")
+		test.S(t).ExpectTrue(version.HasBinlogMonitorPrivilege())
+		test.S(t).ExpectFalse(version.HasSlaveMonitorPrivilege())
+	}
+	{
+		version := ParseServerVersion("10.6.4-MariaDB")
+		test.S(t).ExpectFalse(version.HasStatementSamples())
+		test.S(t).ExpectTrue(version.HasBinlogMonitorPrivilege())
+		test.S(t).ExpectTrue(version.HasSlaveMonitorPrivilege())
+	}
+}
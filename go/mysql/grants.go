@@ -0,0 +1,56 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"strings"
+)
+
+// ParseGrantPrivileges parses a SHOW GRANTS row into its privileges, e.g. `REPLICATION SLAVE`, and the level they
+// apply to, e.g. `*.*`. Column lists are dropped off column privileges. Rows that grant no privileges on a level,
+// such as role grants, return no privileges.
+func ParseGrantPrivileges(grant string) (privileges map[string]bool, level string) {
+	privileges = make(map[string]bool)
+	grant = strings.TrimSpace(grant)
+	if !strings.HasPrefix(strings.ToUpper(grant), "GRANT ") {
+		return privileges, level
+	}
+	grant = grant[len("GRANT "):]
+	onIndex := strings.Index(grant, " ON ")
+	if onIndex < 0 {
+		return privileges, level
+	}
+	level = grant[onIndex+len(" ON "):]
+	if toIndex := strings.Index(level, " TO "); toIndex >= 0 {
+		level = level[:toIndex]
+	}
+	level = strings.TrimSpace(level)
+
+	depth := 0
+	privilege := ""
+	addPrivilege := func() {
+		if privilege = strings.ToUpper(strings.TrimSpace(privilege)); privilege != "" {
+			privileges[privilege] = true
+		}
+		privilege = ""
+	}
+	for _, c := range grant[:onIndex] {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth > 0:
+			// column list
+		case c == ',':
+			addPrivilege()
+		default:
+			privilege += string(c)
+		}
+	}
+	addPrivilege()
+	return privileges, level
+}
@@ -0,0 +1,49 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestParseGrantPrivileges(t *testing.T) {
+	{
+		privileges, level := ParseGrantPrivileges("GRANT RELOAD, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `gh-ost`@`%`")
+		test.S(t).ExpectEquals(level, "*.*")
+		test.S(t).ExpectEquals(len(privileges), 3)
+		test.S(t).ExpectTrue(privileges["REPLICATION SLAVE"])
+		test.S(t).ExpectTrue(privileges["REPLICATION CLIENT"])
+	}
+	{
+		// MariaDB 10.5
+		privileges, level := ParseGrantPrivileges("GRANT REPLICATION SLAVE ADMIN, BINLOG MONITOR, SLAVE MONITOR ON *.* TO `gh-ost`@`%` IDENTIFIED BY PASSWORD '*1234'")
+		test.S(t).ExpectEquals(level, "*.*")
+		test.S(t).ExpectTrue(privileges["BINLOG MONITOR"])
+		test.S(t).ExpectTrue(privileges["SLAVE MONITOR"])
+		test.S(t).ExpectTrue(privileges["REPLICATION SLAVE ADMIN"])
+		test.S(t).ExpectFalse(privileges["REPLICATION SLAVE"])
+	}
+	{
+		privileges, level := ParseGrantPrivileges("GRANT SELECT (id, name), INSERT ON `test`.`gh_ost_test` TO 'gh-ost'@'%'")
+		test.S(t).ExpectEquals(level, "`test`.`gh_ost_test`")
+		test.S(t).ExpectEquals(len(privileges), 2)
+		test.S(t).ExpectTrue(privileges["SELECT"])
+		test.S(t).ExpectTrue(privileges["INSERT"])
+	}
+	{
+		privileges, level := ParseGrantPrivileges("GRANT ALL PRIVILEGES ON `test`.* TO 'gh-ost'@'%' WITH GRANT OPTION")
+		test.S(t).ExpectEquals(level, "`test`.*")
+		test.S(t).ExpectTrue(privileges["ALL PRIVILEGES"])
+	}
+	{
+		// MariaDB role grant
+		privileges, level := ParseGrantPrivileges("GRANT `migrations` TO `gh-ost`@`%`")
+		test.S(t).ExpectEquals(level, "")
+		test.S(t).ExpectEquals(len(privileges), 0)
+	}
+}
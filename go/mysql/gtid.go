@@ -0,0 +1,117 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MariaDBGTID is a MariaDB global transaction ID, in the form domain-server-sequence, e.g. `0-1-100`
+type MariaDBGTID struct {
+	DomainID       uint32
+	ServerID       uint32
+	SequenceNumber uint64
+}
+
+// ParseMariaDBGTID parses a MariaDB GTID such as `0-1-100`
+func ParseMariaDBGTID(gtid string) (*MariaDBGTID, error) {
+	tokens := strings.Split(strings.TrimSpace(gtid), "-")
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("ParseMariaDBGTID: Cannot parse MariaDB GTID from %s. Expected format is domain-server-sequence", gtid)
+	}
+	domainID, err := strconv.ParseUint(tokens[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("ParseMariaDBGTID: invalid domain id: %s", tokens[0])
+	}
+	serverID, err := strconv.ParseUint(tokens[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("ParseMariaDBGTID: invalid server id: %s", tokens[1])
+	}
+	sequenceNumber, err := strconv.ParseUint(tokens[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("ParseMariaDBGTID: invalid sequence number: %s", tokens[2])
+	}
+	return &MariaDBGTID{DomainID: uint32(domainID), ServerID: uint32(serverID), SequenceNumber: sequenceNumber}, nil
+}
+
+func (this MariaDBGTID) String() string {
+	return fmt.Sprintf("%d-%d-%d", this.DomainID, this.ServerID, this.SequenceNumber)
+}
+
+// MariaDBGTIDPosition is a MariaDB replication position: the last GTID of each replication domain,
+// as in @@gtid_binlog_pos, e.g. `0-1-100,1-2-5`
+type MariaDBGTIDPosition map[uint32]MariaDBGTID
+
+// ParseMariaDBGTIDPosition parses a comma separated list of MariaDB GTIDs. An empty string is an empty position.
+func ParseMariaDBGTIDPosition(position string) (MariaDBGTIDPosition, error) {
+	gtidPosition := make(MariaDBGTIDPosition)
+	for _, token := range strings.Split(position, ",") {
+		if strings.TrimSpace(token) == "" {
+			continue
+		}
+		gtid, err := ParseMariaDBGTID(token)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := gtidPosition[gtid.DomainID]; found {
+			return nil, fmt.Errorf("ParseMariaDBGTIDPosition: domain %d listed more than once in %s", gtid.DomainID, position)
+		}
+		gtidPosition.Update(*gtid)
+	}
+	return gtidPosition, nil
+}
+
+// Update advances the position of the GTID's domain to given GTID
+func (this MariaDBGTIDPosition) Update(gtid MariaDBGTID) {
+	this[gtid.DomainID] = gtid
+}
+
+// Advance updates the position of the GTID's domain to given GTID only when it is past the domain's
+// current position, i.e. its sequence number is higher. It returns true when the position changed.
+func (this MariaDBGTIDPosition) Advance(gtid MariaDBGTID) bool {
+	if current, found := this[gtid.DomainID]; found && current.SequenceNumber >= gtid.SequenceNumber {
+		return false
+	}
+	this.Update(gtid)
+	return true
+}
+
+// Contains returns true when this position is at or past the other position, in each of the other's domains
+func (this MariaDBGTIDPosition) Contains(other MariaDBGTIDPosition) bool {
+	for domainID, otherGTID := range other {
+		gtid, found := this[domainID]
+		if !found || gtid.SequenceNumber < otherGTID.SequenceNumber {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of this position
+func (this MariaDBGTIDPosition) Clone() MariaDBGTIDPosition {
+	clone := make(MariaDBGTIDPosition)
+	for domainID, gtid := range this {
+		clone[domainID] = gtid
+	}
+	return clone
+}
+
+// String returns the position's GTIDs, ordered by domain
+func (this MariaDBGTIDPosition) String() string {
+	domainIDs := []int{}
+	for domainID := range this {
+		domainIDs = append(domainIDs, int(domainID))
+	}
+	sort.Ints(domainIDs)
+	tokens := []string{}
+	for _, domainID := range domainIDs {
+		tokens = append(tokens, this[uint32(domainID)].String())
+	}
+	return strings.Join(tokens, ",")
+}
@@ -0,0 +1,84 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestParseMariaDBGTID(t *testing.T) {
+	{
+		gtid, err := ParseMariaDBGTID("0-1-100")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(gtid.DomainID, uint32(0))
+		test.S(t).ExpectEquals(gtid.ServerID, uint32(1))
+		test.S(t).ExpectEquals(gtid.SequenceNumber, uint64(100))
+		test.S(t).ExpectEquals(gtid.String(), "0-1-100")
+	}
+	{
+		_, err := ParseMariaDBGTID("0-1")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := ParseMariaDBGTID("0-x-100")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		// MySQL GTIDs are not MariaDB GTIDs
+		_, err := ParseMariaDBGTID("3e11fa47-71ca-11e1-9e33-c80aa9429562:23")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestParseMariaDBGTIDPosition(t *testing.T) {
+	{
+		position, err := ParseMariaDBGTIDPosition("")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(position), 0)
+		test.S(t).ExpectEquals(position.String(), "")
+	}
+	{
+		position, err := ParseMariaDBGTIDPosition("2-1-7, 0-1-100")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(len(position), 2)
+		test.S(t).ExpectEquals(position.String(), "0-1-100,2-1-7")
+	}
+	{
+		_, err := ParseMariaDBGTIDPosition("0-1-100,0-2-101")
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := ParseMariaDBGTIDPosition("0-1-100,bogus")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestMariaDBGTIDPositionUpdate(t *testing.T) {
+	position, _ := ParseMariaDBGTIDPosition("0-1-100")
+	clone := position.Clone()
+
+	position.Update(MariaDBGTID{DomainID: 0, ServerID: 2, SequenceNumber: 101})
+	position.Update(MariaDBGTID{DomainID: 1, ServerID: 2, SequenceNumber: 5})
+	test.S(t).ExpectEquals(position.String(), "0-2-101,1-2-5")
+	test.S(t).ExpectEquals(clone.String(), "0-1-100")
+
+	test.S(t).ExpectTrue(position.Contains(clone))
+	test.S(t).ExpectFalse(clone.Contains(position))
+	test.S(t).ExpectTrue(position.Contains(position))
+	test.S(t).ExpectTrue(clone.Contains(MariaDBGTIDPosition{}))
+}
+
+func TestMariaDBGTIDPositionAdvance(t *testing.T) {
+	position, _ := ParseMariaDBGTIDPosition("0-1-100,1-2-5")
+
+	test.S(t).ExpectFalse(position.Advance(MariaDBGTID{DomainID: 0, ServerID: 3, SequenceNumber: 99}))
+	test.S(t).ExpectFalse(position.Advance(MariaDBGTID{DomainID: 0, ServerID: 3, SequenceNumber: 100}))
+	test.S(t).ExpectTrue(position.Advance(MariaDBGTID{DomainID: 1, ServerID: 3, SequenceNumber: 6}))
+	test.S(t).ExpectTrue(position.Advance(MariaDBGTID{DomainID: 2, ServerID: 3, SequenceNumber: 1}))
+	test.S(t).ExpectEquals(position.String(), "0-1-100,1-3-6,2-3-1")
+}
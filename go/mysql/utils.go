@@ -8,6 +8,8 @@ package mysql
 import (
 	gosql "database/sql"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +27,8 @@ type ReplicationLagResult struct {
 	Key InstanceKey
 	Lag time.Duration
 	Err error
+	// MaxLag is the lag tolerated on this replica. Zero means the general threshold applies
+	MaxLag time.Duration
 }
 
 func NewNoReplicationLagResult() *ReplicationLagResult {
@@ -140,6 +144,116 @@ func GetMasterConnectionConfigSafe(connectionConfig *ConnectionConfig, visitedKe
 	return GetMasterConnectionConfigSafe(masterConfig, visitedKeys, allowMasterMaster)
 }
 
+// processlistHostname strips the client port off a processlist host, e.g. `10.0.0.5:51234` => `10.0.0.5`
+func processlistHostname(host string) string {
+	if i := strings.LastIndex(host, ":"); i > 0 {
+		if _, err := strconv.Atoi(host[i+1:]); err == nil {
+			host = host[:i]
+		}
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// GetReplicaKeys lists the direct replicas of the instance at given db, via SHOW SLAVE HOSTS and via binlog dump
+// threads in the processlist. SHOW SLAVE HOSTS only lists replicas configured with report_host. Replicas found
+// in the processlist are assumed to listen on given port, i.e. on the same port as their master.
+func GetReplicaKeys(db *gosql.DB, port int) (replicaKeys *InstanceKeyMap, err error) {
+	replicaKeys = NewInstanceKeyMap()
+	err = sqlutils.QueryRowsMap(db, `show slave hosts`, func(m sqlutils.RowMap) error {
+		if host := m.GetString("Host"); host != "" {
+			replicaKeys.AddKey(InstanceKey{Hostname: host, Port: m.GetInt("Port")})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	query := `select /* gh-ost */ host from information_schema.processlist where command in ('Binlog Dump', 'Binlog Dump GTID')`
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		if host := processlistHostname(m.GetString("host")); host != "" {
+			key := InstanceKey{Hostname: host, Port: port}
+			// A replica may be listed by both methods, possibly by name and by IP
+			for _, replicaKey := range replicaKeys.GetInstanceKeys() {
+				if replicaKey.Port == port && sameHost(replicaKey.Hostname, host) {
+					return nil
+				}
+			}
+			replicaKeys.AddKey(key)
+		}
+		return nil
+	})
+	return replicaKeys, err
+}
+
+// sameHost returns true when given host names are equal, or resolve to a common IP address
+func sameHost(host1, host2 string) bool {
+	if host1 == host2 {
+		return true
+	}
+	addresses1, err := net.LookupHost(host1)
+	if err != nil {
+		return false
+	}
+	addresses2, err := net.LookupHost(host2)
+	if err != nil {
+		return false
+	}
+	for _, address1 := range addresses1 {
+		for _, address2 := range addresses2 {
+			if address1 == address2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DiscoverReplicas walks the replication tree below the instance at given db, recursively. Replicas are connected
+// to with the credentials of replicaConfig. It returns replicas which could be connected to and are indeed
+// replicating; others are logged and skipped.
+func DiscoverReplicas(db *gosql.DB, instanceKey InstanceKey, replicaConfig *ConnectionConfig, visitedKeys *InstanceKeyMap) (replicaKeys *InstanceKeyMap, err error) {
+	replicaKeys = NewInstanceKeyMap()
+	visitedKeys.AddKey(instanceKey)
+
+	directReplicaKeys, err := GetReplicaKeys(db, instanceKey.Port)
+	if err != nil {
+		return nil, err
+	}
+	for _, replicaKey := range directReplicaKeys.GetInstanceKeys() {
+		if visitedKeys.HasKey(replicaKey) {
+			continue
+		}
+		connectionConfig := replicaConfig.Duplicate()
+		connectionConfig.Key = replicaKey
+		if masterKey, err := GetMasterKeyFromSlaveStatus(connectionConfig); err != nil {
+			log.Warningf("Skipping discovered replica %+v: %+v", replicaKey, err)
+			visitedKeys.AddKey(replicaKey)
+			continue
+		} else if masterKey == nil {
+			log.Warningf("Skipping discovered replica %+v: not replicating", replicaKey)
+			visitedKeys.AddKey(replicaKey)
+			continue
+		}
+		childKeys, err := discoverReplicasOf(connectionConfig, visitedKeys)
+		if err != nil {
+			log.Warningf("Skipping discovered replica %+v: %+v", replicaKey, err)
+			continue
+		}
+		replicaKeys.AddKey(replicaKey)
+		replicaKeys.AddKeys(childKeys.GetInstanceKeys())
+	}
+	return replicaKeys, nil
+}
+
+func discoverReplicasOf(connectionConfig *ConnectionConfig, visitedKeys *InstanceKeyMap) (replicaKeys *InstanceKeyMap, err error) {
+	db, err := gosql.Open("mysql", connectionConfig.GetDBUri("information_schema"))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return DiscoverReplicas(db, connectionConfig.Key, connectionConfig, visitedKeys)
+}
+
 func GetReplicationBinlogCoordinates(db *gosql.DB) (readBinlogCoordinates *BinlogCoordinates, executeBinlogCoordinates *BinlogCoordinates, err error) {
 	err = sqlutils.QueryRowsMap(db, `show slave status`, func(m sqlutils.RowMap) error {
 		readBinlogCoordinates = &BinlogCoordinates{
@@ -203,3 +317,11 @@ func GetTableColumns(db *gosql.DB, databaseName, tableName string) (*sql.ColumnL
 	}
 	return sql.NewColumnList(columnNames), sql.NewColumnList(virtualColumnNames), nil
 }
+
+// ShowCreateTable returns the `show create table` statement for given table
+func ShowCreateTable(db *gosql.DB, databaseName, tableName string) (createTableStatement string, err error) {
+	var dummy string
+	query := fmt.Sprintf(`show /* gh-ost */ create table %s.%s`, sql.EscapeName(databaseName), sql.EscapeName(tableName))
+	err = db.QueryRow(query).Scan(&dummy, &createTableStatement)
+	return createTableStatement, err
+}
@@ -0,0 +1,25 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestProcesslistHostname(t *testing.T) {
+	test.S(t).ExpectEquals(processlistHostname("10.0.0.5:51234"), "10.0.0.5")
+	test.S(t).ExpectEquals(processlistHostname("replica-1.example.com:40022"), "replica-1.example.com")
+	test.S(t).ExpectEquals(processlistHostname("replica-1.example.com"), "replica-1.example.com")
+	test.S(t).ExpectEquals(processlistHostname("[fd00::5]:51234"), "fd00::5")
+	test.S(t).ExpectEquals(processlistHostname(""), "")
+}
+
+func TestSameHost(t *testing.T) {
+	test.S(t).ExpectTrue(sameHost("10.0.0.5", "10.0.0.5"))
+	test.S(t).ExpectFalse(sameHost("10.0.0.5", "10.0.0.6"))
+}
@@ -387,6 +387,131 @@ func buildUniqueKeyMinMaxValuesPreparedQuery(databaseName, tableName string, uni
 	return query, nil
 }
 
+// BuildTableChecksumQuery builds a query that checksums the first `limit` rows of given table,
+// as ordered by given unique key. The query returns the number of rows checksummed, and their checksum.
+// NULL values are accounted for, such that a NULL and an empty string do not checksum the same.
+func BuildTableChecksumQuery(databaseName, tableName string, checksumColumnNames []string, uniqueKeyColumns *ColumnList, limit int64) (string, error) {
+	if len(checksumColumnNames) == 0 {
+		return "", fmt.Errorf("Got 0 columns in BuildTableChecksumQuery")
+	}
+	if uniqueKeyColumns.Len() == 0 {
+		return "", fmt.Errorf("Got 0 unique key columns in BuildTableChecksumQuery")
+	}
+	if limit <= 0 {
+		return "", fmt.Errorf("Non positive limit in BuildTableChecksumQuery: %d", limit)
+	}
+	databaseName = EscapeName(databaseName)
+	tableName = EscapeName(tableName)
+
+	columnNames := duplicateNames(checksumColumnNames)
+	isNullTokens := make([]string, len(columnNames), len(columnNames))
+	for i := range columnNames {
+		columnNames[i] = EscapeName(columnNames[i])
+		isNullTokens[i] = fmt.Sprintf("isnull(%s)", columnNames[i])
+	}
+	uniqueKeyColumnNames := duplicateNames(uniqueKeyColumns.Names())
+	for i := range uniqueKeyColumnNames {
+		uniqueKeyColumnNames[i] = EscapeName(uniqueKeyColumnNames[i])
+	}
+	query := fmt.Sprintf(`
+      select /* gh-ost %s.%s checksum */
+					count(*),
+					coalesce(bit_xor(crc32(concat_ws('#', %s, concat(%s)))), 0)
+				from (
+					select %s
+						from %s.%s
+						order by %s
+						limit %d
+				) sel_checksum
+    `, databaseName, tableName,
+		strings.Join(columnNames, ", "), strings.Join(isNullTokens, ", "),
+		strings.Join(columnNames, ", "),
+		databaseName, tableName,
+		strings.Join(uniqueKeyColumnNames, ", "),
+		limit,
+	)
+	return query, nil
+}
+
+// BuildIndexScanChunkPreparedQuery builds a query reading the next chunk of key values off given index, in index order.
+// keyColumns are the index columns followed by the clustering key columns, such that rows are uniquely ordered and
+// the scan is covered by the index. With no range start args, the query reads the first chunk.
+func BuildIndexScanChunkPreparedQuery(databaseName, tableName, indexName string, keyColumns *ColumnList, rangeStartArgs []interface{}, chunkSize int64) (result string, explodedArgs []interface{}, err error) {
+	if keyColumns.Len() == 0 {
+		return "", explodedArgs, fmt.Errorf("Got 0 columns in BuildIndexScanChunkPreparedQuery")
+	}
+	if chunkSize <= 0 {
+		return "", explodedArgs, fmt.Errorf("Non positive chunk size in BuildIndexScanChunkPreparedQuery: %d", chunkSize)
+	}
+	whereClause := ""
+	if len(rangeStartArgs) > 0 {
+		rangeStartComparison, rangeExplodedArgs, err := BuildRangePreparedComparison(keyColumns, rangeStartArgs, GreaterThanComparisonSign)
+		if err != nil {
+			return "", explodedArgs, err
+		}
+		whereClause = fmt.Sprintf("where %s", rangeStartComparison)
+		explodedArgs = append(explodedArgs, rangeExplodedArgs...)
+	}
+	databaseName = EscapeName(databaseName)
+	tableName = EscapeName(tableName)
+	indexName = EscapeName(indexName)
+
+	keyColumnNames := duplicateNames(keyColumns.Names())
+	for i := range keyColumnNames {
+		keyColumnNames[i] = EscapeName(keyColumnNames[i])
+	}
+	result = fmt.Sprintf(`
+      select /* gh-ost %s.%s warm-up */ %s
+				from
+					%s.%s force index (%s)
+				%s
+				order by
+					%s
+				limit %d
+    `, databaseName, tableName, strings.Join(keyColumnNames, ", "),
+		databaseName, tableName, indexName,
+		whereClause,
+		strings.Join(keyColumnNames, ", "),
+		chunkSize,
+	)
+	return result, explodedArgs, nil
+}
+
+// BuildRangeDeletePreparedQuery builds a query deleting the rows of a unique key range, such that a table
+// may be emptied chunk by chunk in key order
+func BuildRangeDeletePreparedQuery(databaseName, tableName string, uniqueKeyColumns *ColumnList, rangeStartArgs, rangeEndArgs []interface{}, includeRangeStartValues bool) (result string, explodedArgs []interface{}, err error) {
+	if uniqueKeyColumns.Len() == 0 {
+		return "", explodedArgs, fmt.Errorf("Got 0 columns in BuildRangeDeletePreparedQuery")
+	}
+	databaseName = EscapeName(databaseName)
+	tableName = EscapeName(tableName)
+
+	var startRangeComparisonSign ValueComparisonSign = GreaterThanComparisonSign
+	if includeRangeStartValues {
+		startRangeComparisonSign = GreaterThanOrEqualsComparisonSign
+	}
+	rangeStartComparison, rangeExplodedArgs, err := BuildRangePreparedComparison(uniqueKeyColumns, rangeStartArgs, startRangeComparisonSign)
+	if err != nil {
+		return "", explodedArgs, err
+	}
+	explodedArgs = append(explodedArgs, rangeExplodedArgs...)
+	rangeEndComparison, rangeExplodedArgs, err := BuildRangePreparedComparison(uniqueKeyColumns, rangeEndArgs, LessThanOrEqualsComparisonSign)
+	if err != nil {
+		return "", explodedArgs, err
+	}
+	explodedArgs = append(explodedArgs, rangeExplodedArgs...)
+	result = fmt.Sprintf(`
+			delete /* gh-ost %s.%s */
+				from
+					%s.%s
+				where %s and %s
+		`, databaseName, tableName,
+		databaseName, tableName,
+		rangeStartComparison, rangeEndComparison,
+	)
+	return result, explodedArgs, nil
+}
+
 func BuildDMLDeleteQuery(databaseName, tableName string, tableColumns, uniqueKeyColumns *ColumnList, args []interface{}) (result string, uniqueKeyArgs []interface{}, err error) {
 	if len(args) != tableColumns.Len() {
 		return result, uniqueKeyArgs, fmt.Errorf("args count differs from table column count in BuildDMLDeleteQuery")
@@ -338,6 +338,36 @@ func TestBuildUniqueKeyMinValuesPreparedQuery(t *testing.T) {
 	}
 }
 
+func TestBuildTableChecksumQuery(t *testing.T) {
+	databaseName := "mydb"
+	tableName := "tbl"
+	uniqueKeyColumns := NewColumnList([]string{"id"})
+	{
+		query, err := BuildTableChecksumQuery(databaseName, tableName, []string{"id", "name", "position"}, uniqueKeyColumns, 1000)
+		test.S(t).ExpectNil(err)
+		expected := `
+			select /* gh-ost mydb.tbl checksum */
+			    count(*),
+			    coalesce(bit_xor(crc32(concat_ws('#', id, name, position, concat(isnull(id), isnull(name), isnull(position))))), 0)
+			  from (
+			    select id, name, position
+			      from mydb.tbl
+			      order by id
+			      limit 1000
+			  ) sel_checksum
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+	}
+	{
+		_, err := BuildTableChecksumQuery(databaseName, tableName, []string{}, uniqueKeyColumns, 1000)
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		_, err := BuildTableChecksumQuery(databaseName, tableName, []string{"id"}, uniqueKeyColumns, 0)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
 func TestBuildDMLDeleteQuery(t *testing.T) {
 	databaseName := "mydb"
 	tableName := "tbl"
@@ -677,3 +707,71 @@ func TestBuildDMLUpdateQuerySignedUnsigned(t *testing.T) {
 		test.S(t).ExpectTrue(reflect.DeepEqual(uniqueKeyArgs, []interface{}{uint8(253)}))
 	}
 }
+
+func TestBuildIndexScanChunkPreparedQuery(t *testing.T) {
+	databaseName := "mydb"
+	tableName := "tbl"
+	indexName := "name_idx"
+	keyColumns := NewColumnList([]string{"name", "id"})
+	{
+		query, explodedArgs, err := BuildIndexScanChunkPreparedQuery(databaseName, tableName, indexName, keyColumns, nil, 500)
+		test.S(t).ExpectNil(err)
+		expected := `
+			select /* gh-ost mydb.tbl warm-up */ name, id
+				from mydb.tbl force index (name_idx)
+				order by name, id
+				limit 500
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+		test.S(t).ExpectEquals(len(explodedArgs), 0)
+	}
+	{
+		query, explodedArgs, err := BuildIndexScanChunkPreparedQuery(databaseName, tableName, indexName, keyColumns, []interface{}{"x", 3}, 500)
+		test.S(t).ExpectNil(err)
+		expected := `
+			select /* gh-ost mydb.tbl warm-up */ name, id
+				from mydb.tbl force index (name_idx)
+				where ((name > ?) or (((name = ?)) AND (id > ?)))
+				order by name, id
+				limit 500
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+		test.S(t).ExpectTrue(reflect.DeepEqual(explodedArgs, []interface{}{"x", "x", 3}))
+	}
+	{
+		_, _, err := BuildIndexScanChunkPreparedQuery(databaseName, tableName, indexName, keyColumns, nil, 0)
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestBuildRangeDeletePreparedQuery(t *testing.T) {
+	databaseName := "mydb"
+	tableName := "tbl"
+	uniqueKeyColumns := NewColumnList([]string{"name", "position"})
+	{
+		query, explodedArgs, err := BuildRangeDeletePreparedQuery(databaseName, tableName, uniqueKeyColumns, []interface{}{3, 17}, []interface{}{103, 117}, true)
+		test.S(t).ExpectNil(err)
+		expected := `
+			delete /* gh-ost mydb.tbl */
+				from mydb.tbl
+				where ((name > ?) or (((name = ?)) AND (position > ?)) or ((name = ?) and (position = ?))) and ((name < ?) or (((name = ?)) AND (position < ?)) or ((name = ?) and (position = ?)))
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+		test.S(t).ExpectTrue(reflect.DeepEqual(explodedArgs, []interface{}{3, 3, 17, 3, 17, 103, 103, 117, 103, 117}))
+	}
+	{
+		query, explodedArgs, err := BuildRangeDeletePreparedQuery(databaseName, tableName, uniqueKeyColumns, []interface{}{3, 17}, []interface{}{103, 117}, false)
+		test.S(t).ExpectNil(err)
+		expected := `
+			delete /* gh-ost mydb.tbl */
+				from mydb.tbl
+				where ((name > ?) or (((name = ?)) AND (position > ?))) and ((name < ?) or (((name = ?)) AND (position < ?)) or ((name = ?) and (position = ?)))
+		`
+		test.S(t).ExpectEquals(normalizeQuery(query), normalizeQuery(expected))
+		test.S(t).ExpectTrue(reflect.DeepEqual(explodedArgs, []interface{}{3, 3, 17, 103, 103, 117, 103, 117}))
+	}
+	{
+		_, _, err := BuildRangeDeletePreparedQuery(databaseName, tableName, NewColumnList([]string{}), nil, nil, false)
+		test.S(t).ExpectNotNil(err)
+	}
+}
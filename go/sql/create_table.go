@@ -0,0 +1,238 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	createTableNameRegexp          = regexp.MustCompile("(?i)^\\s*create\\s+table\\s+(?:if\\s+not\\s+exists\\s+)?((?:`[^`]+`|[^\\s(.`]+)\\.)?(`[^`]+`|[^\\s(.`]+)")
+	createTableAutoIncrementRegexp = regexp.MustCompile("(?i)\\s+auto_increment=[0-9]+")
+	indexKeyPartPrefixRegexp       = regexp.MustCompile("`\\s*\\([0-9]+\\)")
+	indexDefinitionRegexp          = regexp.MustCompile("(?i)^\\s*(primary\\s+key|(?:unique\\s+|fulltext\\s+|spatial\\s+)?(?:key|index)\\s+(`(?:[^`]|``)+`))\\s*(\\(.*)$")
+	foreignKeyDefinitionRegexp     = regexp.MustCompile("(?i)^\\s*(?:constraint\\s+(?:`(?:[^`]|``)+`\\s+)?)?foreign\\s+key\\s*(?:`(?:[^`]|``)+`\\s*)?(\\(.*)$")
+)
+
+// IndexDefinition is an index, as listed in a `SHOW CREATE TABLE` output
+type IndexDefinition struct {
+	Name        string
+	ColumnNames []string
+	IsUnique    bool
+	// Definition is the index line as it appears in the table definition, e.g. "KEY `idx_c` (`c`)",
+	// and can be used as is in an `ALTER TABLE ... ADD` clause
+	Definition string
+}
+
+// IsPrimary checks if this index is the primary key
+func (this *IndexDefinition) IsPrimary() bool {
+	return this.Name == "PRIMARY"
+}
+
+// SupportsForeignKey checks whether this index can serve given foreign key columns, i.e. the foreign key
+// columns are the index' leading columns, in order
+func (this *IndexDefinition) SupportsForeignKey(foreignKeyColumnNames []string) bool {
+	if len(foreignKeyColumnNames) > len(this.ColumnNames) {
+		return false
+	}
+	for i, columnName := range foreignKeyColumnNames {
+		if !strings.EqualFold(columnName, this.ColumnNames[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// RenameCreateTableStatement validates that given statement is exactly one plain `CREATE TABLE` statement, with
+// column definitions, and rewrites it to create given table. `CREATE TABLE ... LIKE`, `CREATE TABLE ... SELECT`,
+// further statements and executable comments are rejected.
+func RenameCreateTableStatement(createTableStatement string, databaseName, tableName string) (string, error) {
+	tokens := tokenizeStatement(createTableStatement)
+	// positions of tokens other than whitespace and comments
+	significant := []int{}
+	for i, token := range tokens {
+		if token.tokenType == spaceStatementToken {
+			if strings.HasPrefix(token.text, "/*!") {
+				return "", fmt.Errorf("Executable comments are not supported in CREATE TABLE statement")
+			}
+			continue
+		}
+		significant = append(significant, i)
+	}
+	tokenAt := func(k int) *statementToken {
+		if k >= len(significant) {
+			return &statementToken{tokenType: spaceStatementToken}
+		}
+		return &tokens[significant[k]]
+	}
+	keywordAt := func(k int) string {
+		if token := tokenAt(k); token.tokenType == wordStatementToken {
+			return strings.ToLower(token.text)
+		}
+		return ""
+	}
+	if keywordAt(0) != "create" || keywordAt(1) != "table" {
+		return "", fmt.Errorf("Not a CREATE TABLE statement")
+	}
+	k := 2
+	if keywordAt(k) == "if" && keywordAt(k+1) == "not" && keywordAt(k+2) == "exists" {
+		k += 3
+	}
+	// [schema.]table
+	if !tokenAt(k).isName() {
+		return "", fmt.Errorf("Cannot parse table name in CREATE TABLE statement")
+	}
+	if tokenAt(k+1).text == "." && tokenAt(k+2).isName() {
+		k += 2
+	}
+	nameEnd := significant[k]
+	k++
+	if tokenAt(k).text != "(" || keywordAt(k+1) == "like" {
+		return "", fmt.Errorf("CREATE TABLE statement must list column definitions")
+	}
+	depth := 0
+	for ; k < len(significant); k++ {
+		switch token := tokenAt(k); {
+		case token.text == "(":
+			depth++
+		case token.text == ")":
+			depth--
+		case token.text == ";":
+			return "", fmt.Errorf("Expected a single CREATE TABLE statement")
+		case depth == 0 && token.tokenType == wordStatementToken:
+			switch strings.ToLower(token.text) {
+			case "select", "as", "like", "ignore", "replace", "union", "with", "values", "table":
+				return "", fmt.Errorf("Unsupported %s clause in CREATE TABLE statement", strings.ToUpper(token.text))
+			}
+		}
+	}
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("CREATE TABLE %s.%s", EscapeName(databaseName), EscapeName(tableName)))
+	for _, token := range tokens[nameEnd+1:] {
+		buf.WriteString(token.text)
+	}
+	return buf.String(), nil
+}
+
+// NormalizeCreateTableStatement strips the table name and the AUTO_INCREMENT counter
+// off a `SHOW CREATE TABLE` output, such that definitions of two tables can be compared.
+func NormalizeCreateTableStatement(createTableStatement string) string {
+	normalized := createTableNameRegexp.ReplaceAllString(createTableStatement, "CREATE TABLE")
+	normalized = createTableAutoIncrementRegexp.ReplaceAllString(normalized, "")
+	return strings.TrimSpace(normalized)
+}
+
+// IsFulltextOrSpatial checks whether this is a FULLTEXT or SPATIAL index
+func (this *IndexDefinition) IsFulltextOrSpatial() bool {
+	lowerDefinition := strings.ToLower(this.Definition)
+	return strings.HasPrefix(lowerDefinition, "fulltext") || strings.HasPrefix(lowerDefinition, "spatial")
+}
+
+// IsRangeScannable checks whether this index can be scanned in order of its columns, i.e. it is
+// a B-tree index over whole columns, with no prefix or functional key parts
+func (this *IndexDefinition) IsRangeScannable() bool {
+	if this.IsFulltextOrSpatial() {
+		return false
+	}
+	if indexKeyPartPrefixRegexp.MatchString(this.Definition) {
+		return false
+	}
+	for _, columnName := range this.ColumnNames {
+		if strings.HasPrefix(columnName, "(") {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseIndexDefinitions returns the indexes listed in a `SHOW CREATE TABLE` output, in order of appearance.
+// Foreign key constraints are not indexes and are not listed.
+func ParseIndexDefinitions(createTableStatement string) (indexes [](*IndexDefinition)) {
+	for _, line := range strings.Split(createTableStatement, "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		submatch := indexDefinitionRegexp.FindStringSubmatch(line)
+		if len(submatch) == 0 {
+			continue
+		}
+		index := &IndexDefinition{
+			Name:        "PRIMARY",
+			ColumnNames: parseIndexColumnNames(submatch[3]),
+			Definition:  line,
+		}
+		if submatch[2] != "" {
+			index.Name = unescapeName(submatch[2])
+		}
+		lowerLine := strings.ToLower(line)
+		index.IsUnique = strings.HasPrefix(lowerLine, "primary") || strings.HasPrefix(lowerLine, "unique")
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// ParseForeignKeyColumnNames returns the columns of each foreign key constraint listed in a `SHOW CREATE TABLE` output
+func ParseForeignKeyColumnNames(createTableStatement string) (foreignKeys [][]string) {
+	for _, line := range strings.Split(createTableStatement, "\n") {
+		submatch := foreignKeyDefinitionRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if len(submatch) == 0 {
+			continue
+		}
+		foreignKeys = append(foreignKeys, parseIndexColumnNames(submatch[1]))
+	}
+	return foreignKeys
+}
+
+// parseIndexColumnNames extracts column names off an index' key part list, e.g. "(`a`,`b`(10) DESC) USING BTREE"
+func parseIndexColumnNames(keyParts string) (columnNames []string) {
+	depth := 0
+	token := ""
+	for _, c := range keyParts {
+		switch {
+		case c == '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return append(columnNames, keyPartColumnName(token))
+			}
+		case c == ',' && depth == 1:
+			columnNames = append(columnNames, keyPartColumnName(token))
+			token = ""
+			continue
+		}
+		token += string(c)
+	}
+	return columnNames
+}
+
+// keyPartColumnName strips prefix length and ordering off a key part, e.g. "`b`(10) DESC" => "b"
+func keyPartColumnName(keyPart string) string {
+	keyPart = strings.TrimSpace(keyPart)
+	if !strings.HasPrefix(keyPart, "`") {
+		// functional key part
+		return keyPart
+	}
+	for i := 1; i < len(keyPart); i++ {
+		if keyPart[i] != '`' {
+			continue
+		}
+		if i+1 < len(keyPart) && keyPart[i+1] == '`' {
+			i++
+			continue
+		}
+		return unescapeName(keyPart[:i+1])
+	}
+	return keyPart
+}
+
+func unescapeName(escapedName string) string {
+	name := strings.TrimPrefix(strings.TrimSuffix(escapedName, "`"), "`")
+	return strings.Replace(name, "``", "`", -1)
+}
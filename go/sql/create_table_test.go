@@ -0,0 +1,140 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/outbrain/golib/log"
+	test "github.com/outbrain/golib/tests"
+)
+
+func init() {
+	log.SetLevel(log.ERROR)
+}
+
+func TestNormalizeCreateTableStatement(t *testing.T) {
+	{
+		original := "CREATE TABLE `tbl` (\n  `id` int(11) NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB AUTO_INCREMENT=17 DEFAULT CHARSET=utf8mb4"
+		ghost := "CREATE TABLE `_tbl_gho` (\n  `id` int(11) NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB AUTO_INCREMENT=23 DEFAULT CHARSET=utf8mb4"
+		test.S(t).ExpectEquals(NormalizeCreateTableStatement(original), NormalizeCreateTableStatement(ghost))
+		test.S(t).ExpectEquals(NormalizeCreateTableStatement(original), "CREATE TABLE (\n  `id` int(11) NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	}
+	{
+		original := "CREATE TABLE `tbl` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"
+		ghost := "CREATE TABLE `_tbl_gho` (\n  `id` bigint(20) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"
+		test.S(t).ExpectNotEquals(NormalizeCreateTableStatement(original), NormalizeCreateTableStatement(ghost))
+	}
+}
+
+func TestParseIndexDefinitions(t *testing.T) {
+	createTableStatement := "CREATE TABLE `tbl` (\n" +
+		"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+		"  `a` int(11) NOT NULL,\n" +
+		"  `b` varchar(255) NOT NULL,\n" +
+		"  `key` text,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `a_b_uidx` (`a`,`b`(10)),\n" +
+		"  KEY `b_idx` (`b` DESC) USING BTREE COMMENT 'by b',\n" +
+		"  KEY `odd``name` ((`a` + 1)),\n" +
+		"  FULLTEXT KEY `key_ftidx` (`key`),\n" +
+		"  CONSTRAINT `tbl_fk` FOREIGN KEY (`a`) REFERENCES `parent` (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	indexes := ParseIndexDefinitions(createTableStatement)
+	test.S(t).ExpectEquals(len(indexes), 5)
+
+	test.S(t).ExpectEquals(indexes[0].Name, "PRIMARY")
+	test.S(t).ExpectTrue(indexes[0].IsPrimary())
+	test.S(t).ExpectTrue(indexes[0].IsUnique)
+	test.S(t).ExpectTrue(reflect.DeepEqual(indexes[0].ColumnNames, []string{"id"}))
+	test.S(t).ExpectEquals(indexes[0].Definition, "PRIMARY KEY (`id`)")
+	test.S(t).ExpectTrue(indexes[0].IsRangeScannable())
+
+	test.S(t).ExpectEquals(indexes[1].Name, "a_b_uidx")
+	test.S(t).ExpectFalse(indexes[1].IsPrimary())
+	test.S(t).ExpectTrue(indexes[1].IsUnique)
+	test.S(t).ExpectTrue(reflect.DeepEqual(indexes[1].ColumnNames, []string{"a", "b"}))
+	test.S(t).ExpectFalse(indexes[1].IsRangeScannable())
+
+	test.S(t).ExpectEquals(indexes[2].Name, "b_idx")
+	test.S(t).ExpectFalse(indexes[2].IsUnique)
+	test.S(t).ExpectTrue(reflect.DeepEqual(indexes[2].ColumnNames, []string{"b"}))
+	test.S(t).ExpectEquals(indexes[2].Definition, "KEY `b_idx` (`b` DESC) USING BTREE COMMENT 'by b'")
+	test.S(t).ExpectTrue(indexes[2].IsRangeScannable())
+	test.S(t).ExpectFalse(indexes[2].IsFulltextOrSpatial())
+
+	test.S(t).ExpectEquals(indexes[3].Name, "odd`name")
+	test.S(t).ExpectTrue(reflect.DeepEqual(indexes[3].ColumnNames, []string{"(`a` + 1)"}))
+	test.S(t).ExpectFalse(indexes[3].IsRangeScannable())
+
+	test.S(t).ExpectEquals(indexes[4].Name, "key_ftidx")
+	test.S(t).ExpectFalse(indexes[4].IsUnique)
+	test.S(t).ExpectEquals(indexes[4].Definition, "FULLTEXT KEY `key_ftidx` (`key`)")
+	test.S(t).ExpectFalse(indexes[4].IsRangeScannable())
+	test.S(t).ExpectTrue(indexes[4].IsFulltextOrSpatial())
+}
+
+func TestParseForeignKeyColumnNames(t *testing.T) {
+	createTableStatement := "CREATE TABLE `tbl` (\n" +
+		"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+		"  `a` int(11) NOT NULL,\n" +
+		"  `b` int(11) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `a_b_idx` (`a`,`b`),\n" +
+		"  KEY `b_idx` (`b`),\n" +
+		"  CONSTRAINT `tbl_fk` FOREIGN KEY (`a`) REFERENCES `parent` (`id`),\n" +
+		"  CONSTRAINT `tbl_b_fk` FOREIGN KEY (`b`, `a`) REFERENCES `other` (`x`, `y`) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	foreignKeys := ParseForeignKeyColumnNames(createTableStatement)
+	test.S(t).ExpectEquals(len(foreignKeys), 2)
+	test.S(t).ExpectTrue(reflect.DeepEqual(foreignKeys[0], []string{"a"}))
+	test.S(t).ExpectTrue(reflect.DeepEqual(foreignKeys[1], []string{"b", "a"}))
+
+	indexes := ParseIndexDefinitions(createTableStatement)
+	test.S(t).ExpectEquals(len(indexes), 3)
+	test.S(t).ExpectTrue(indexes[1].SupportsForeignKey(foreignKeys[0]))
+	test.S(t).ExpectFalse(indexes[1].SupportsForeignKey(foreignKeys[1]))
+	test.S(t).ExpectFalse(indexes[2].SupportsForeignKey(foreignKeys[0]))
+	test.S(t).ExpectFalse(indexes[2].SupportsForeignKey(foreignKeys[1]))
+}
+
+func TestRenameCreateTableStatement(t *testing.T) {
+	{
+		statement, err := RenameCreateTableStatement("create table tbl (id int)", "mydb", "_tbl_gds")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "CREATE TABLE `mydb`.`_tbl_gds` (id int)")
+	}
+	{
+		statement, err := RenameCreateTableStatement("CREATE TABLE IF NOT EXISTS `otherdb`.`tbl`(id int)", "mydb", "_tbl_gds")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "CREATE TABLE `mydb`.`_tbl_gds`(id int)")
+	}
+	{
+		statement, err := RenameCreateTableStatement("\n  create table otherdb.tbl (id int)", "mydb", "_tbl_gds")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "CREATE TABLE `mydb`.`_tbl_gds` (id int)")
+	}
+	{
+		statement, err := RenameCreateTableStatement("-- desired schema\n/* tbl */ CREATE TABLE tbl (\n  id int, -- gh-ost:renamed-from=x\n  `c` varchar(8) DEFAULT 'a;b'\n) ENGINE=InnoDB COMMENT='as select'", "mydb", "_tbl_gds")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(statement, "CREATE TABLE `mydb`.`_tbl_gds` (\n  id int, -- gh-ost:renamed-from=x\n  `c` varchar(8) DEFAULT 'a;b'\n) ENGINE=InnoDB COMMENT='as select'")
+	}
+	for _, statement := range []string{
+		"drop table tbl",
+		"create temporary table tbl (id int)",
+		"create table tbl like other",
+		"create table tbl (like other)",
+		"create table tbl select * from other",
+		"create table tbl (id int) as select id from other",
+		"create table tbl (id int); drop table other",
+		"create table tbl (id int) /*!99999 ; drop table other */",
+		"create table tbl",
+	} {
+		_, err := RenameCreateTableStatement(statement, "mydb", "_tbl_gds")
+		test.S(t).ExpectNotNil(err)
+	}
+}
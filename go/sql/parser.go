@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -144,3 +145,342 @@ func (this *Parser) DroppedColumnsMap() map[string]bool {
 func (this *Parser) IsRenameTable() bool {
 	return this.isRenameTable
 }
+
+type statementTokenType int
+
+const (
+	wordStatementToken statementTokenType = iota
+	nameStatementToken
+	literalStatementToken
+	spaceStatementToken
+	punctuationStatementToken
+)
+
+type statementToken struct {
+	text      string
+	tokenType statementTokenType
+}
+
+// isName checks whether this token is a, possibly quoted, identifier
+func (this *statementToken) isName() bool {
+	return this.tokenType == wordStatementToken || this.tokenType == nameStatementToken
+}
+
+// name returns the identifier this token stands for
+func (this *statementToken) name() string {
+	if this.tokenType == nameStatementToken {
+		return unescapeName(this.text)
+	}
+	return this.text
+}
+
+var (
+	// sideEffectFunctions are functions which wait, lock, read files or change state; a statement calling them is not replayed
+	sideEffectFunctions = map[string]bool{
+		"sleep":                             true,
+		"benchmark":                         true,
+		"get_lock":                          true,
+		"release_lock":                      true,
+		"release_all_locks":                 true,
+		"load_file":                         true,
+		"master_pos_wait":                   true,
+		"source_pos_wait":                   true,
+		"wait_for_executed_gtid_set":        true,
+		"wait_until_sql_thread_after_gtids": true,
+		"last_insert_id":                    true,
+		"nextval":                           true,
+		"setval":                            true,
+		"lastval":                           true,
+	}
+	// fromClauseEndKeywords end a FROM clause, after which commas no longer separate table references
+	fromClauseEndKeywords = map[string]bool{
+		"where":  true,
+		"group":  true,
+		"having": true,
+		"window": true,
+		"order":  true,
+		"limit":  true,
+		"union":  true,
+		"set":    true,
+	}
+)
+
+// tokenizeStatement splits a statement into words, quoted names, string literals, whitespace/comments and punctuation
+func tokenizeStatement(statement string) (tokens []statementToken) {
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		end := i + 1
+		tokenType := punctuationStatementToken
+		switch {
+		case c == '\'' || c == '"':
+			end, tokenType = quotedTokenEnd(statement, i), literalStatementToken
+		case c == '`':
+			end, tokenType = quotedTokenEnd(statement, i), nameStatementToken
+		case strings.HasPrefix(statement[i:], "/*"):
+			end, tokenType = len(statement), spaceStatementToken
+			if commentEnd := strings.Index(statement[i+2:], "*/"); commentEnd >= 0 {
+				end = i + 2 + commentEnd + 2
+			}
+		case c == '#' || strings.HasPrefix(statement[i:], "-- "):
+			end, tokenType = len(statement), spaceStatementToken
+			if lineEnd := strings.IndexByte(statement[i:], '\n'); lineEnd >= 0 {
+				end = i + lineEnd + 1
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			for end < len(statement) && strings.IndexByte(" \t\n\r", statement[end]) >= 0 {
+				end++
+			}
+			tokenType = spaceStatementToken
+		case isIdentifierChar(c):
+			for end < len(statement) && isIdentifierChar(statement[end]) {
+				end++
+			}
+			tokenType = wordStatementToken
+		case c == ':' && strings.HasPrefix(statement[i:], ":="):
+			end = i + 2
+		}
+		tokens = append(tokens, statementToken{text: statement[i:end], tokenType: tokenType})
+		i = end
+	}
+	return tokens
+}
+
+// RewriteReplayStatement validates that a statement is safe to replay onto the ghost table: a single SELECT,
+// which reads no table other than given table, takes no locks, writes nothing, and calls no function with
+// side effects. It returns the statement with references to the table rewritten into the ghost table.
+func RewriteReplayStatement(statement string, databaseName, tableName, ghostTableName string) (rewritten string, err error) {
+	rewritten, found, err := rewriteTableReferences(statement, databaseName, tableName, ghostTableName, true)
+	if err != nil {
+		return statement, err
+	}
+	if !found {
+		return statement, fmt.Errorf("statement does not read %s", EscapeName(tableName))
+	}
+	return rewritten, nil
+}
+
+// RewriteTableReferences rewrites references to given table in a SELECT, INSERT, REPLACE, UPDATE or DELETE
+// statement into another table, e.g. so as to explain the statement on the ghost table. Only table references,
+// and table qualifiers of column references, are rewritten: literals, aliases, columns and other tables are
+// left intact. It returns the rewritten statement, and whether any table reference was found.
+func RewriteTableReferences(statement string, databaseName, tableName, newTableName string) (rewritten string, found bool) {
+	rewritten, found, err := rewriteTableReferences(statement, databaseName, tableName, newTableName, false)
+	if err != nil {
+		return statement, false
+	}
+	return rewritten, found
+}
+
+// rewriteTableReferences rewrites references to given table into another table. With replay, the statement
+// is validated to be a SELECT which is safe to replay, and reads no other table.
+func rewriteTableReferences(statement string, databaseName, tableName, newTableName string, replay bool) (rewritten string, found bool, err error) {
+	tokens := tokenizeStatement(statement)
+	// positions of tokens other than whitespace and comments
+	significant := []int{}
+	for i, token := range tokens {
+		if token.tokenType == spaceStatementToken {
+			if strings.HasPrefix(token.text, "/*!") {
+				return statement, false, fmt.Errorf("statement has an executable comment")
+			}
+			continue
+		}
+		significant = append(significant, i)
+	}
+	tokenAt := func(k int) *statementToken {
+		if k < 0 || k >= len(significant) {
+			return &statementToken{tokenType: spaceStatementToken}
+		}
+		return &tokens[significant[k]]
+	}
+	keywordAt := func(k int) string {
+		if token := tokenAt(k); token.tokenType == wordStatementToken {
+			return strings.ToLower(token.text)
+		}
+		return ""
+	}
+	// nameChainEnd returns the position following a dotted name chain, e.g. `db`.`tbl`.`col`, starting at given position
+	nameChainEnd := func(k int) int {
+		for tokenAt(k+1).text == "." && tokenAt(k+2).isName() {
+			k += 2
+		}
+		return k + 1
+	}
+	if replay && keywordAt(0) != "select" {
+		return statement, false, fmt.Errorf("not a SELECT statement")
+	}
+	depth := 0
+	inFromClause := map[int]bool{}
+	expectTable := false
+	for k := 0; k < len(significant); {
+		token := tokenAt(k)
+		keyword := keywordAt(k)
+		switch {
+		case token.text == "(":
+			depth++
+			// a parenthesized table reference list, unless it turns out to be a subquery
+			inFromClause[depth] = expectTable
+			k++
+			continue
+		case token.text == ")":
+			inFromClause[depth] = false
+			depth--
+			expectTable = false
+		case token.text == ";":
+			if k+1 < len(significant) {
+				return statement, false, fmt.Errorf("multiple statements")
+			}
+		case replay && token.text == ":=":
+			return statement, false, fmt.Errorf("statement assigns variables")
+		case token.text == "," && inFromClause[depth]:
+			expectTable = true
+			k++
+			continue
+		case replay && keyword == "into":
+			return statement, false, fmt.Errorf("statement has an INTO clause")
+		case replay && (keyword == "for" && (keywordAt(k+1) == "update" || keywordAt(k+1) == "share") ||
+			keyword == "lock" && keywordAt(k+1) == "in"):
+			return statement, false, fmt.Errorf("statement has a locking clause")
+		case replay && keyword != "" && sideEffectFunctions[keyword] && tokenAt(k+1).text == "(":
+			return statement, false, fmt.Errorf("statement calls %s()", keyword)
+		case keyword == "into":
+			// INSERT/REPLACE INTO
+			expectTable = true
+			k++
+			continue
+		case keyword == "update" && keywordAt(k-1) != "key" && keywordAt(k-1) != "for":
+			// UPDATE, though not ON DUPLICATE KEY UPDATE
+			inFromClause[depth] = true
+			expectTable = true
+			k++
+			continue
+		case keyword == "select":
+			inFromClause[depth] = false
+			expectTable = false
+		case keyword == "from":
+			inFromClause[depth] = true
+			expectTable = true
+			k++
+			continue
+		case strings.HasSuffix(keyword, "join"):
+			expectTable = true
+			k++
+			continue
+		case fromClauseEndKeywords[keyword]:
+			inFromClause[depth] = false
+		case token.isName() && expectTable:
+			// table reference: [schema.]table
+			end := nameChainEnd(k)
+			schemaName, referencedTableName := "", tokenAt(end-1).name()
+			if end-k == 3 {
+				schemaName = token.name()
+			} else if end-k != 1 {
+				return statement, false, fmt.Errorf("cannot parse table reference")
+			}
+			if !strings.EqualFold(referencedTableName, tableName) || (schemaName != "" && !strings.EqualFold(schemaName, databaseName)) {
+				if replay {
+					return statement, false, fmt.Errorf("statement reads table %s other than %s", EscapeName(referencedTableName), EscapeName(tableName))
+				}
+				expectTable = false
+				k = end
+				continue
+			}
+			tokens[significant[k]].text = fmt.Sprintf("%s.%s", EscapeName(databaseName), EscapeName(newTableName))
+			for i := significant[k] + 1; i <= significant[end-1]; i++ {
+				tokens[i].text = ""
+			}
+			found = true
+			expectTable = false
+			k = end
+			continue
+		case token.isName() && tokenAt(k+1).text == ".":
+			// qualified column reference: [[schema.]table.]column, or [schema.]table.*
+			end := nameChainEnd(k)
+			namesCount := (end - k + 1) / 2
+			if tokenAt(end).text == "." && tokenAt(end+1).text == "*" {
+				namesCount++
+			}
+			switch namesCount {
+			case 2:
+				if strings.EqualFold(token.name(), tableName) {
+					tokens[significant[k]].text = EscapeName(newTableName)
+				}
+			case 3:
+				if strings.EqualFold(token.name(), databaseName) && strings.EqualFold(tokenAt(k+2).name(), tableName) {
+					tokens[significant[k+2]].text = EscapeName(newTableName)
+				}
+			}
+			k = end
+			continue
+		}
+		expectTable = false
+		k++
+	}
+	var buf strings.Builder
+	for _, token := range tokens {
+		buf.WriteString(token.text)
+	}
+	return buf.String(), found, nil
+}
+
+// AddMaxExecutionTimeHint bounds a SELECT statement's execution time on the server via a MAX_EXECUTION_TIME
+// optimizer hint, placed right after the SELECT keyword. Should the statement have a hint comment already,
+// the hint is prepended to it; as the first of conflicting hints applies, it takes precedence.
+func AddMaxExecutionTimeHint(statement string, maxExecutionTimeMillis int64) string {
+	hint := fmt.Sprintf("MAX_EXECUTION_TIME(%d)", maxExecutionTimeMillis)
+	tokens := tokenizeStatement(statement)
+	for i, token := range tokens {
+		if token.tokenType == spaceStatementToken {
+			continue
+		}
+		if token.tokenType != wordStatementToken || !strings.EqualFold(token.text, "select") {
+			return statement
+		}
+		var buf strings.Builder
+		for _, token := range tokens[:i+1] {
+			buf.WriteString(token.text)
+		}
+		rest := tokens[i+1:]
+		for j, token := range rest {
+			if strings.HasPrefix(token.text, "/*+") {
+				for _, token := range rest[:j] {
+					buf.WriteString(token.text)
+				}
+				buf.WriteString("/*+ " + hint + " " + strings.TrimPrefix(token.text, "/*+"))
+				rest = rest[j+1:]
+				break
+			}
+			if token.tokenType != spaceStatementToken || strings.TrimSpace(token.text) != "" {
+				buf.WriteString(" /*+ " + hint + " */")
+				break
+			}
+		}
+		for _, token := range rest {
+			buf.WriteString(token.text)
+		}
+		return buf.String()
+	}
+	return statement
+}
+
+// quotedTokenEnd returns the index following the closing quote of a quoted token starting at given index
+func quotedTokenEnd(statement string, start int) int {
+	quote := statement[start]
+	for i := start + 1; i < len(statement); i++ {
+		if quote != '`' && statement[i] == '\\' {
+			i++
+			continue
+		}
+		if statement[i] == quote {
+			if i+1 < len(statement) && statement[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(statement)
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
@@ -200,3 +200,93 @@ func TestParseAlterStatementRenameTable(t *testing.T) {
 		test.S(t).ExpectTrue(parser.isRenameTable)
 	}
 }
+
+func TestRewriteTableReferences(t *testing.T) {
+	{
+		rewritten, found := RewriteTableReferences("select * from tbl where id = 3", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(rewritten, "select * from `mydb`.`_tbl_gho` where id = 3")
+	}
+	{
+		rewritten, found := RewriteTableReferences("SELECT `tbl`.`a`, tbl FROM `mydb`.`tbl` JOIN other ON (other.id=tbl.id) WHERE other.tbl = 1", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(rewritten, "SELECT `_tbl_gho`.`a`, tbl FROM `mydb`.`_tbl_gho` JOIN other ON (other.id=`_tbl_gho`.id) WHERE other.tbl = 1")
+	}
+	{
+		rewritten, found := RewriteTableReferences("update tbl set tbl = 1, tbl.b = 2 where id in (select id from other)", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(rewritten, "update `mydb`.`_tbl_gho` set tbl = 1, `_tbl_gho`.b = 2 where id in (select id from other)")
+	}
+	{
+		rewritten, found := RewriteTableReferences("delete from tbl where tbl > 3 order by id limit 10", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(rewritten, "delete from `mydb`.`_tbl_gho` where tbl > 3 order by id limit 10")
+	}
+	{
+		rewritten, found := RewriteTableReferences("insert into tbl (id, tbl) values (1, 'tbl') on duplicate key update tbl = 'tbl'", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectTrue(found)
+		test.S(t).ExpectEquals(rewritten, "insert into `mydb`.`_tbl_gho` (id, tbl) values (1, 'tbl') on duplicate key update tbl = 'tbl'")
+	}
+	{
+		rewritten, found := RewriteTableReferences("select * from tbl_archive where name = 'tbl' and x = \"it\\\"s tbl\"", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectFalse(found)
+		test.S(t).ExpectEquals(rewritten, "select * from tbl_archive where name = 'tbl' and x = \"it\\\"s tbl\"")
+	}
+	{
+		_, found := RewriteTableReferences("select * from otherdb.tbl", "mydb", "tbl", "_tbl_gho")
+		test.S(t).ExpectFalse(found)
+	}
+}
+
+func TestRewriteReplayStatement(t *testing.T) {
+	{
+		rewritten, err := RewriteReplayStatement("select * from tbl where id = 3", "db", "tbl", "_tbl_gho")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(rewritten, "select * from `db`.`_tbl_gho` where id = 3")
+	}
+	{
+		rewritten, err := RewriteReplayStatement("SELECT `tbl`.`a`, tbl.*, db.tbl.b, tbl FROM `db`.`tbl` AS t WHERE tbl.c = 'tbl' and t.tbl = 1.5", "db", "tbl", "_tbl_gho")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(rewritten, "SELECT `_tbl_gho`.`a`, `_tbl_gho`.*, db.`_tbl_gho`.b, tbl FROM `db`.`_tbl_gho` AS t WHERE `_tbl_gho`.c = 'tbl' and t.tbl = 1.5")
+	}
+	{
+		rewritten, err := RewriteReplayStatement("select a from tbl force index (idx_a) where b in (select b from tbl where c > 0) order by a, b limit 1, 2", "db", "tbl", "_tbl_gho")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(rewritten, "select a from `db`.`_tbl_gho` force index (idx_a) where b in (select b from `db`.`_tbl_gho` where c > 0) order by a, b limit 1, 2")
+	}
+	{
+		rewritten, err := RewriteReplayStatement("select /* tbl */ count(*) from (select a from tbl) as x", "db", "tbl", "_tbl_gho")
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(rewritten, "select /* tbl */ count(*) from (select a from `db`.`_tbl_gho`) as x")
+	}
+	for _, statement := range []string{
+		"select * from tbl_archive where name = 'tbl'",
+		"select * from tbl join other on (other.id = tbl.id)",
+		"select * from tbl, other",
+		"select * from (tbl join other using (id))",
+		"select * from otherdb.tbl",
+		"select * from tbl where id in (select id from other)",
+		"select * from tbl for update",
+		"select * from tbl where id = 1 FOR SHARE",
+		"select * from tbl lock in share mode",
+		"select * from tbl into outfile '/tmp/x'",
+		"select sleep(1) from tbl",
+		"select get_lock('x', 1), a from tbl",
+		"select @x := a from tbl",
+		"select * from tbl; delete from tbl",
+		"select * from tbl /*!50000 for update */",
+		"update tbl set a = 1",
+		"with x as (select * from tbl) select * from x",
+	} {
+		_, err := RewriteReplayStatement(statement, "db", "tbl", "_tbl_gho")
+		test.S(t).ExpectNotNil(err)
+	}
+}
+
+func TestAddMaxExecutionTimeHint(t *testing.T) {
+	test.S(t).ExpectEquals(AddMaxExecutionTimeHint("select * from tbl", 500), "select /*+ MAX_EXECUTION_TIME(500) */ * from tbl")
+	test.S(t).ExpectEquals(AddMaxExecutionTimeHint("/* app */ SELECT\n  a from tbl", 500), "/* app */ SELECT /*+ MAX_EXECUTION_TIME(500) */\n  a from tbl")
+	test.S(t).ExpectEquals(AddMaxExecutionTimeHint("select /*+ MAX_EXECUTION_TIME(9000) INDEX(tbl idx_a) */ a from tbl", 500), "select /*+ MAX_EXECUTION_TIME(500)  MAX_EXECUTION_TIME(9000) INDEX(tbl idx_a) */ a from tbl")
+	test.S(t).ExpectEquals(AddMaxExecutionTimeHint("select /* tbl */ a from tbl", 500), "select /*+ MAX_EXECUTION_TIME(500) */ /* tbl */ a from tbl")
+	test.S(t).ExpectEquals(AddMaxExecutionTimeHint("show tables", 500), "show tables")
+}
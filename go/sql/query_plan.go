@@ -0,0 +1,54 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"fmt"
+)
+
+// QueryPlanStep is a single row of a traditional `EXPLAIN` output
+type QueryPlanStep struct {
+	Table      string
+	AccessType string
+	Key        string
+	Rows       int64
+}
+
+func (this *QueryPlanStep) isFullTableScan() bool {
+	return this.AccessType == "ALL"
+}
+
+func (this *QueryPlanStep) isFullScan() bool {
+	return this.AccessType == "ALL" || this.AccessType == "index"
+}
+
+// CompareQueryPlans compares the plan of a statement on the original table with the plan of the same statement,
+// rewritten to run on the ghost table. It describes regressions: a step turning into a full scan,
+// using a different index, or having its estimated rows grow by more than rowsFactor.
+func CompareQueryPlans(originalPlan, ghostPlan []QueryPlanStep, rowsFactor float64) (regressions []string) {
+	if len(originalPlan) != len(ghostPlan) {
+		return append(regressions, fmt.Sprintf("plan changed from %d to %d steps", len(originalPlan), len(ghostPlan)))
+	}
+	for i := range originalPlan {
+		original := originalPlan[i]
+		ghost := ghostPlan[i]
+		if ghost.isFullTableScan() && !original.isFullTableScan() {
+			regressions = append(regressions, fmt.Sprintf("%s: full table scan (was: %s on %s)", ghost.Table, original.AccessType, original.Key))
+		} else if ghost.isFullScan() && !original.isFullScan() {
+			regressions = append(regressions, fmt.Sprintf("%s: full index scan on %s (was: %s on %s)", ghost.Table, ghost.Key, original.AccessType, original.Key))
+		} else if ghost.Key != original.Key {
+			regressions = append(regressions, fmt.Sprintf("%s: using key %s (was: %s)", ghost.Table, ghost.Key, original.Key))
+		}
+		originalRows := original.Rows
+		if originalRows < 1 {
+			originalRows = 1
+		}
+		if rowsFactor > 0 && float64(ghost.Rows) > float64(originalRows)*rowsFactor {
+			regressions = append(regressions, fmt.Sprintf("%s: estimated rows up from %d to %d", ghost.Table, original.Rows, ghost.Rows))
+		}
+	}
+	return regressions
+}
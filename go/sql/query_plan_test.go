@@ -0,0 +1,62 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+func TestCompareQueryPlans(t *testing.T) {
+	originalPlan := []QueryPlanStep{
+		{Table: "tbl", AccessType: "ref", Key: "name_idx", Rows: 20},
+		{Table: "other", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+	}
+	{
+		ghostPlan := []QueryPlanStep{
+			{Table: "_tbl_gho", AccessType: "ref", Key: "name_idx", Rows: 25},
+			{Table: "other", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+		}
+		regressions := CompareQueryPlans(originalPlan, ghostPlan, 10)
+		test.S(t).ExpectEquals(len(regressions), 0)
+	}
+	{
+		ghostPlan := []QueryPlanStep{
+			{Table: "_tbl_gho", AccessType: "ALL", Key: "", Rows: 100000},
+			{Table: "other", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+		}
+		regressions := CompareQueryPlans(originalPlan, ghostPlan, 10)
+		test.S(t).ExpectEquals(len(regressions), 2)
+		test.S(t).ExpectEquals(regressions[0], "_tbl_gho: full table scan (was: ref on name_idx)")
+		test.S(t).ExpectEquals(regressions[1], "_tbl_gho: estimated rows up from 20 to 100000")
+	}
+	{
+		ghostPlan := []QueryPlanStep{
+			{Table: "_tbl_gho", AccessType: "ref", Key: "name_status_idx", Rows: 30},
+			{Table: "other", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+		}
+		regressions := CompareQueryPlans(originalPlan, ghostPlan, 10)
+		test.S(t).ExpectEquals(len(regressions), 1)
+		test.S(t).ExpectEquals(regressions[0], "_tbl_gho: using key name_status_idx (was: name_idx)")
+	}
+	{
+		ghostPlan := []QueryPlanStep{
+			{Table: "_tbl_gho", AccessType: "index", Key: "name_idx", Rows: 20},
+			{Table: "other", AccessType: "eq_ref", Key: "PRIMARY", Rows: 1},
+		}
+		regressions := CompareQueryPlans(originalPlan, ghostPlan, 0)
+		test.S(t).ExpectEquals(len(regressions), 1)
+		test.S(t).ExpectEquals(regressions[0], "_tbl_gho: full index scan on name_idx (was: ref on name_idx)")
+	}
+	{
+		ghostPlan := []QueryPlanStep{
+			{Table: "_tbl_gho", AccessType: "ref", Key: "name_idx", Rows: 20},
+		}
+		regressions := CompareQueryPlans(originalPlan, ghostPlan, 10)
+		test.S(t).ExpectEquals(len(regressions), 1)
+	}
+}
@@ -0,0 +1,336 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	tableOptionRegexp           = regexp.MustCompile("(?i)\\b((?:default\\s+)?[a-z_]+)\\s*=\\s*('(?:[^'\\\\]|\\\\.|'')*'|[^\\s]+)")
+	stringColumnTypeRegexp      = regexp.MustCompile("(?i)^(char|varchar|tinytext|text|mediumtext|longtext|enum|set)\\b")
+	renamedFromAnnotationRegexp = regexp.MustCompile("(?i)^\\s*(`(?:[^`]|``)+`|[^\\s`]+)\\s.*--\\s*gh-ost:renamed-from=(`(?:[^`]|``)+`|[^\\s`,]+)")
+	whitespaceRegexp            = regexp.MustCompile("\\s+")
+)
+
+// ColumnDefinition is a column, as listed in a `SHOW CREATE TABLE` output
+type ColumnDefinition struct {
+	Name string
+	// Type is the column type, e.g. "varchar(32)"
+	Type string
+	// Definition is the column line as it appears in the table definition, e.g. "`c` varchar(32) NOT NULL"
+	Definition string
+}
+
+// TableOption is a table option, e.g. ENGINE=InnoDB
+type TableOption struct {
+	Name  string
+	Value string
+}
+
+// TableDefinition is a table's columns, indexes, constraints and options, as parsed off a `SHOW CREATE TABLE` output
+type TableDefinition struct {
+	Columns      [](*ColumnDefinition)
+	Indexes      [](*IndexDefinition)
+	Constraints  []string
+	Options      [](*TableOption)
+	Partitioning string
+}
+
+// ParseTableDefinition parses a `SHOW CREATE TABLE` output
+func ParseTableDefinition(createTableStatement string) *TableDefinition {
+	table := &TableDefinition{
+		Indexes: ParseIndexDefinitions(createTableStatement),
+	}
+	lines := strings.Split(createTableStatement, "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+		switch {
+		case strings.HasPrefix(line, "`"):
+			table.Columns = append(table.Columns, parseColumnDefinition(line))
+		case strings.HasPrefix(strings.ToUpper(line), "CONSTRAINT "):
+			table.Constraints = append(table.Constraints, line)
+		case i > 0 && strings.HasPrefix(line, ")"):
+			table.Options = parseTableOptions(strings.TrimPrefix(line, ")"))
+			table.Partitioning = strings.TrimSpace(strings.Join(lines[i+1:], "\n"))
+			return table
+		}
+	}
+	return table
+}
+
+func parseColumnDefinition(line string) *ColumnDefinition {
+	nameEnd := quotedTokenEnd(line, 0)
+	rest := strings.TrimSpace(line[nameEnd:])
+	depth := 0
+	var quote rune
+	typeEnd := len(rest)
+	for i, c := range rest {
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\'' || c == '"' {
+			quote = c
+		} else if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+		} else if c == ' ' && depth == 0 {
+			typeEnd = i
+			break
+		}
+	}
+	return &ColumnDefinition{
+		Name:       unescapeName(line[:nameEnd]),
+		Type:       rest[:typeEnd],
+		Definition: line,
+	}
+}
+
+func parseTableOptions(optionsText string) (options [](*TableOption)) {
+	for _, submatch := range tableOptionRegexp.FindAllStringSubmatch(optionsText, -1) {
+		name := strings.ToUpper(whitespaceRegexp.ReplaceAllString(submatch[1], " "))
+		if name == "AUTO_INCREMENT" {
+			continue
+		}
+		options = append(options, &TableOption{Name: name, Value: submatch[2]})
+	}
+	return options
+}
+
+// GetOption returns the value of given table option, or an empty string when the option is not set
+func (this *TableDefinition) GetOption(name string) string {
+	for _, option := range this.Options {
+		if option.Name == name {
+			return option.Value
+		}
+	}
+	return ""
+}
+
+func (this *TableDefinition) getColumn(name string) *ColumnDefinition {
+	for _, column := range this.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column
+		}
+	}
+	return nil
+}
+
+func (this *TableDefinition) getIndex(name string) *IndexDefinition {
+	for _, index := range this.Indexes {
+		if strings.EqualFold(index.Name, name) {
+			return index
+		}
+	}
+	return nil
+}
+
+// effectiveColumnDefinition makes the character set and collation of a string column explicit,
+// where inherited from the table's defaults. This allows comparing columns across tables of different defaults.
+func (this *TableDefinition) effectiveColumnDefinition(column *ColumnDefinition) string {
+	if !stringColumnTypeRegexp.MatchString(column.Type) {
+		return column.Definition
+	}
+	upperDefinition := strings.ToUpper(column.Definition)
+	if strings.Contains(upperDefinition, " CHARACTER SET ") {
+		return column.Definition
+	}
+	clauses := []string{}
+	if charset := this.GetOption("DEFAULT CHARSET"); charset != "" {
+		clauses = append(clauses, fmt.Sprintf("CHARACTER SET %s", charset))
+		if collation := this.GetOption("COLLATE"); collation != "" && !strings.Contains(upperDefinition, " COLLATE ") {
+			clauses = append(clauses, fmt.Sprintf("COLLATE %s", collation))
+		}
+	}
+	if len(clauses) == 0 {
+		return column.Definition
+	}
+	nameEnd := quotedTokenEnd(column.Definition, 0)
+	typeEnd := nameEnd + strings.Index(column.Definition[nameEnd:], column.Type) + len(column.Type)
+	return fmt.Sprintf("%s %s%s", column.Definition[:typeEnd], strings.Join(clauses, " "), column.Definition[typeEnd:])
+}
+
+// ParseRenamedColumnsAnnotations reads column rename annotations off a (hand written) `CREATE TABLE` statement.
+// A column is annotated as renamed via a trailing comment, e.g.:
+//   `new_name` int NOT NULL, -- gh-ost:renamed-from=old_name
+// The returned map has desired (new) column names as keys, and current (old) column names as values.
+func ParseRenamedColumnsAnnotations(createTableStatement string) map[string]string {
+	renames := make(map[string]string)
+	for _, line := range strings.Split(createTableStatement, "\n") {
+		if submatch := renamedFromAnnotationRegexp.FindStringSubmatch(line); len(submatch) > 0 {
+			renames[unescapeName(submatch[1])] = unescapeName(submatch[2])
+		}
+	}
+	return renames
+}
+
+// BuildAlterStatement computes the ALTER TABLE clauses which turn the current table definition into the desired one.
+// Both definitions are expected to be `SHOW CREATE TABLE` outputs, such that identical definitions are identical in text.
+// renames maps desired column names onto current column names.
+func BuildAlterStatement(current, desired *TableDefinition, renames map[string]string) (alterStatement string, err error) {
+	if strings.Join(current.Constraints, "\n") != strings.Join(desired.Constraints, "\n") {
+		return "", fmt.Errorf("Constraints differ between current and desired schema; changing constraints is not supported")
+	}
+	if current.Partitioning != desired.Partitioning {
+		return "", fmt.Errorf("Partitioning differs between current and desired schema; changing partitioning is not supported")
+	}
+	// renamedColumns maps lower cased current names onto desired names; renamedFrom maps lower cased desired names onto current names
+	renamedColumns := make(map[string]string)
+	renamedFrom := make(map[string]string)
+	for desiredName, currentName := range renames {
+		if desired.getColumn(desiredName) == nil {
+			return "", fmt.Errorf("Column %s is annotated as renamed, but is not found in desired schema", EscapeName(desiredName))
+		}
+		if current.getColumn(currentName) == nil {
+			return "", fmt.Errorf("Column %s is annotated as renamed from %s, which is not found in current schema", EscapeName(desiredName), EscapeName(currentName))
+		}
+		if current.getColumn(desiredName) != nil || desired.getColumn(currentName) != nil {
+			return "", fmt.Errorf("Column %s is annotated as renamed from %s, but both columns exist in current or desired schema", EscapeName(desiredName), EscapeName(currentName))
+		}
+		renamedColumns[strings.ToLower(currentName)] = desiredName
+		renamedFrom[strings.ToLower(desiredName)] = currentName
+	}
+
+	indexDropClauses := []string{}
+	indexAddClauses := []string{}
+	for _, index := range current.Indexes {
+		desiredIndex := desired.getIndex(index.Name)
+		if desiredIndex != nil && renameIndexColumns(index.Definition, renamedColumns) == desiredIndex.Definition {
+			continue
+		}
+		if index.IsPrimary() {
+			indexDropClauses = append(indexDropClauses, "DROP PRIMARY KEY")
+		} else {
+			indexDropClauses = append(indexDropClauses, fmt.Sprintf("DROP KEY %s", EscapeName(index.Name)))
+		}
+	}
+	for _, index := range desired.Indexes {
+		currentIndex := current.getIndex(index.Name)
+		if currentIndex != nil && renameIndexColumns(currentIndex.Definition, renamedColumns) == index.Definition {
+			continue
+		}
+		indexAddClauses = append(indexAddClauses, fmt.Sprintf("ADD %s", index.Definition))
+	}
+
+	columnClauses := []string{}
+	// simulatedColumns follows the column order throughout the ALTER, to tell which columns need repositioning
+	simulatedColumns := []string{}
+	for _, column := range current.Columns {
+		if desiredName, ok := renamedColumns[strings.ToLower(column.Name)]; ok {
+			simulatedColumns = append(simulatedColumns, strings.ToLower(desiredName))
+		} else if desired.getColumn(column.Name) != nil {
+			simulatedColumns = append(simulatedColumns, strings.ToLower(column.Name))
+		} else {
+			columnClauses = append(columnClauses, fmt.Sprintf("DROP COLUMN %s", EscapeName(column.Name)))
+		}
+	}
+	for i, column := range desired.Columns {
+		position := "FIRST"
+		if i > 0 {
+			position = fmt.Sprintf("AFTER %s", EscapeName(desired.Columns[i-1].Name))
+		}
+		definition := desired.effectiveColumnDefinition(column)
+		currentName, isRenamed := renamedFrom[strings.ToLower(column.Name)]
+		currentColumn := current.getColumn(column.Name)
+		if isRenamed {
+			currentColumn = current.getColumn(currentName)
+		}
+		if currentColumn == nil {
+			// New column
+			clause := fmt.Sprintf("ADD COLUMN %s", definition)
+			if i != len(simulatedColumns) {
+				clause = fmt.Sprintf("%s %s", clause, position)
+			}
+			columnClauses = append(columnClauses, clause)
+			simulatedColumns = insertColumnName(simulatedColumns, i, strings.ToLower(column.Name))
+			continue
+		}
+		isMisplaced := simulatedColumns[i] != strings.ToLower(column.Name)
+		if isMisplaced {
+			simulatedColumns = removeColumnName(simulatedColumns, strings.ToLower(column.Name))
+			simulatedColumns = insertColumnName(simulatedColumns, i, strings.ToLower(column.Name))
+		}
+		var clause string
+		if isRenamed {
+			clause = fmt.Sprintf("CHANGE COLUMN %s %s", EscapeName(currentColumn.Name), definition)
+		} else if isMisplaced || definition != current.effectiveColumnDefinition(currentColumn) {
+			clause = fmt.Sprintf("MODIFY COLUMN %s", definition)
+		} else {
+			continue
+		}
+		if isMisplaced {
+			clause = fmt.Sprintf("%s %s", clause, position)
+		}
+		columnClauses = append(columnClauses, clause)
+	}
+
+	optionClauses := []string{}
+	for _, option := range desired.Options {
+		if current.GetOption(option.Name) != option.Value {
+			optionClauses = append(optionClauses, fmt.Sprintf("%s=%s", option.Name, option.Value))
+		}
+	}
+	for _, option := range current.Options {
+		if desired.GetOption(option.Name) != "" {
+			continue
+		}
+		switch option.Name {
+		case "COMMENT":
+			optionClauses = append(optionClauses, "COMMENT=''")
+		case "ROW_FORMAT", "STATS_PERSISTENT", "STATS_AUTO_RECALC", "STATS_SAMPLE_PAGES":
+			optionClauses = append(optionClauses, fmt.Sprintf("%s=DEFAULT", option.Name))
+		case "KEY_BLOCK_SIZE":
+			optionClauses = append(optionClauses, "KEY_BLOCK_SIZE=0")
+		}
+	}
+
+	clauses := []string{}
+	clauses = append(clauses, indexDropClauses...)
+	clauses = append(clauses, columnClauses...)
+	clauses = append(clauses, indexAddClauses...)
+	if len(optionClauses) > 0 {
+		clauses = append(clauses, strings.Join(optionClauses, " "))
+	}
+	if len(clauses) == 0 {
+		return "", fmt.Errorf("Desired schema is identical to current schema; nothing to migrate")
+	}
+	return strings.Join(clauses, ", "), nil
+}
+
+// renameIndexColumns applies column renames onto the key parts of an index definition
+func renameIndexColumns(indexDefinition string, renamedColumns map[string]string) string {
+	keyPartsStart := strings.Index(indexDefinition, "(")
+	if keyPartsStart < 0 || len(renamedColumns) == 0 {
+		return indexDefinition
+	}
+	keyParts := indexDefinition[keyPartsStart:]
+	for currentName, desiredName := range renamedColumns {
+		keyParts = regexp.MustCompile("(?i)"+regexp.QuoteMeta(EscapeName(currentName))).ReplaceAllLiteralString(keyParts, EscapeName(desiredName))
+	}
+	return indexDefinition[:keyPartsStart] + keyParts
+}
+
+func insertColumnName(columnNames []string, position int, columnName string) []string {
+	columnNames = append(columnNames, "")
+	copy(columnNames[position+1:], columnNames[position:])
+	columnNames[position] = columnName
+	return columnNames
+}
+
+func removeColumnName(columnNames []string, columnName string) []string {
+	for i := range columnNames {
+		if columnNames[i] == columnName {
+			return append(columnNames[:i], columnNames[i+1:]...)
+		}
+	}
+	return columnNames
+}
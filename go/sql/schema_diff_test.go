@@ -0,0 +1,117 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"strings"
+	"testing"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+const currentCreateTable = "CREATE TABLE `tbl` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `name` varchar(64) NOT NULL,\n" +
+	"  `status` tinyint(4) DEFAULT NULL,\n" +
+	"  `ts` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `name_idx` (`name`),\n" +
+	"  KEY `status_idx` (`status`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=17 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='some table'"
+
+func TestParseTableDefinition(t *testing.T) {
+	table := ParseTableDefinition(currentCreateTable)
+	test.S(t).ExpectEquals(len(table.Columns), 4)
+	test.S(t).ExpectEquals(table.Columns[1].Name, "name")
+	test.S(t).ExpectEquals(table.Columns[1].Type, "varchar(64)")
+	test.S(t).ExpectEquals(table.Columns[1].Definition, "`name` varchar(64) NOT NULL")
+	test.S(t).ExpectEquals(len(table.Indexes), 3)
+	test.S(t).ExpectEquals(len(table.Constraints), 0)
+	test.S(t).ExpectEquals(len(table.Options), 4)
+	test.S(t).ExpectEquals(table.GetOption("ENGINE"), "InnoDB")
+	test.S(t).ExpectEquals(table.GetOption("DEFAULT CHARSET"), "utf8mb4")
+	test.S(t).ExpectEquals(table.GetOption("COLLATE"), "utf8mb4_0900_ai_ci")
+	test.S(t).ExpectEquals(table.GetOption("COMMENT"), "'some table'")
+	test.S(t).ExpectEquals(table.GetOption("AUTO_INCREMENT"), "")
+	test.S(t).ExpectEquals(table.Partitioning, "")
+}
+
+func TestParseRenamedColumnsAnnotations(t *testing.T) {
+	statement := "create table tbl (\n" +
+		"  id int not null,\n" +
+		"  `full_name` varchar(64) not null, -- gh-ost:renamed-from=name\n" +
+		"  state tinyint -- gh-ost:renamed-from=`status`\n" +
+		")"
+	renames := ParseRenamedColumnsAnnotations(statement)
+	test.S(t).ExpectEquals(len(renames), 2)
+	test.S(t).ExpectEquals(renames["full_name"], "name")
+	test.S(t).ExpectEquals(renames["state"], "status")
+}
+
+func TestBuildAlterStatement(t *testing.T) {
+	current := ParseTableDefinition(currentCreateTable)
+	{
+		desired := ParseTableDefinition(currentCreateTable)
+		_, err := BuildAlterStatement(current, desired, map[string]string{})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		desired := ParseTableDefinition("CREATE TABLE `tbl` (\n" +
+			"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+			"  `name` varchar(128) NOT NULL,\n" +
+			"  `status` tinyint(4) DEFAULT NULL,\n" +
+			"  `ts` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+			"  `extra` int(11) DEFAULT NULL,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  KEY `name_idx` (`name`),\n" +
+			"  KEY `status_idx` (`status`,`ts`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='some table'")
+		alterStatement, err := BuildAlterStatement(current, desired, map[string]string{})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alterStatement, "DROP KEY `status_idx`, "+
+			"MODIFY COLUMN `name` varchar(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL, "+
+			"ADD COLUMN `extra` int(11) DEFAULT NULL, "+
+			"ADD KEY `status_idx` (`status`,`ts`)")
+	}
+	{
+		// renames, drops, reordering and table options
+		desired := ParseTableDefinition("CREATE TABLE `tbl` (\n" +
+			"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+			"  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+			"  `new_id` int(11) NOT NULL,\n" +
+			"  `full_name` varchar(64) NOT NULL,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  KEY `name_idx` (`full_name`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=COMPRESSED")
+		renames := map[string]string{"full_name": "name", "created": "ts"}
+		alterStatement, err := BuildAlterStatement(current, desired, renames)
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alterStatement, "DROP KEY `status_idx`, "+
+			"DROP COLUMN `status`, "+
+			"CHANGE COLUMN `ts` `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `id`, "+
+			"ADD COLUMN `new_id` int(11) NOT NULL AFTER `created`, "+
+			"CHANGE COLUMN `name` `full_name` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL, "+
+			"ROW_FORMAT=COMPRESSED COMMENT=''")
+	}
+	{
+		// Changing the table's default charset makes string columns' (previously inherited) charset explicit
+		desired := ParseTableDefinition(strings.Replace(strings.Replace(currentCreateTable, "utf8mb4_0900_ai_ci", "latin1_swedish_ci", 1), "utf8mb4", "latin1", 1))
+		alterStatement, err := BuildAlterStatement(current, desired, map[string]string{})
+		test.S(t).ExpectNil(err)
+		test.S(t).ExpectEquals(alterStatement, "MODIFY COLUMN `name` varchar(64) CHARACTER SET latin1 COLLATE latin1_swedish_ci NOT NULL, "+
+			"DEFAULT CHARSET=latin1 COLLATE=latin1_swedish_ci")
+	}
+	{
+		desired := ParseTableDefinition(currentCreateTable)
+		_, err := BuildAlterStatement(current, desired, map[string]string{"name": "no_such_column"})
+		test.S(t).ExpectNotNil(err)
+	}
+	{
+		desired := ParseTableDefinition(strings.Replace(currentCreateTable, "  KEY `status_idx` (`status`)\n", "  KEY `status_idx` (`status`),\n  CONSTRAINT `fk` FOREIGN KEY (`status`) REFERENCES `other` (`id`)\n", 1))
+		_, err := BuildAlterStatement(current, desired, map[string]string{})
+		test.S(t).ExpectNotNil(err)
+	}
+}
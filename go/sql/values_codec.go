@@ -0,0 +1,272 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type tags of encoded column values. The applier relies on the golang type of binlog values (e.g. signed
+// integers converted to unsigned, strings converted by charset) hence the type is kept along with the value.
+const (
+	nullValueTag byte = iota
+	int8ValueTag
+	int16ValueTag
+	int32ValueTag
+	int64ValueTag
+	intValueTag
+	uint8ValueTag
+	uint16ValueTag
+	uint32ValueTag
+	uint64ValueTag
+	uintValueTag
+	float32ValueTag
+	float64ValueTag
+	boolValueTag
+	stringValueTag
+	bytesValueTag
+	timeValueTag
+)
+
+// maxEncodedLength caps lengths read off encoded values, so as not to allocate arbitrary amounts on corrupt input
+const maxEncodedLength = 1 << 30
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutUvarint(scratch[:], value)])
+}
+
+func writeVarint(buf *bytes.Buffer, value int64) {
+	var scratch [binary.MaxVarintLen64]byte
+	buf.Write(scratch[:binary.PutVarint(scratch[:], value)])
+}
+
+// EncodeBytes appends a length prefixed byte array
+func EncodeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// DecodeBytes reads a byte array as encoded by EncodeBytes
+func DecodeBytes(reader *bytes.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxEncodedLength || length > uint64(reader.Len()) {
+		return nil, fmt.Errorf("Invalid encoded length: %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func encodeValue(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(nullValueTag)
+	case int8:
+		buf.WriteByte(int8ValueTag)
+		writeVarint(buf, int64(v))
+	case int16:
+		buf.WriteByte(int16ValueTag)
+		writeVarint(buf, int64(v))
+	case int32:
+		buf.WriteByte(int32ValueTag)
+		writeVarint(buf, int64(v))
+	case int64:
+		buf.WriteByte(int64ValueTag)
+		writeVarint(buf, v)
+	case int:
+		buf.WriteByte(intValueTag)
+		writeVarint(buf, int64(v))
+	case uint8:
+		buf.WriteByte(uint8ValueTag)
+		writeUvarint(buf, uint64(v))
+	case uint16:
+		buf.WriteByte(uint16ValueTag)
+		writeUvarint(buf, uint64(v))
+	case uint32:
+		buf.WriteByte(uint32ValueTag)
+		writeUvarint(buf, uint64(v))
+	case uint64:
+		buf.WriteByte(uint64ValueTag)
+		writeUvarint(buf, v)
+	case uint:
+		buf.WriteByte(uintValueTag)
+		writeUvarint(buf, uint64(v))
+	case float32:
+		buf.WriteByte(float32ValueTag)
+		var scratch [4]byte
+		binary.LittleEndian.PutUint32(scratch[:], math.Float32bits(v))
+		buf.Write(scratch[:])
+	case float64:
+		buf.WriteByte(float64ValueTag)
+		var scratch [8]byte
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		buf.Write(scratch[:])
+	case bool:
+		buf.WriteByte(boolValueTag)
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		buf.WriteByte(stringValueTag)
+		EncodeBytes(buf, []byte(v))
+	case []byte:
+		buf.WriteByte(bytesValueTag)
+		EncodeBytes(buf, v)
+	case time.Time:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(timeValueTag)
+		EncodeBytes(buf, data)
+	case driver.Valuer:
+		// e.g. decimal values, which the driver passes on as strings
+		driverValue, err := v.Value()
+		if err != nil {
+			return err
+		}
+		if _, ok := driverValue.(driver.Valuer); ok {
+			return fmt.Errorf("Cannot encode value of type %T", value)
+		}
+		return encodeValue(buf, driverValue)
+	default:
+		return fmt.Errorf("Cannot encode value of type %T", value)
+	}
+	return nil
+}
+
+func decodeValue(reader *bytes.Reader) (interface{}, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case nullValueTag:
+		return nil, nil
+	case int8ValueTag, int16ValueTag, int32ValueTag, int64ValueTag, intValueTag:
+		v, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case int8ValueTag:
+			return int8(v), nil
+		case int16ValueTag:
+			return int16(v), nil
+		case int32ValueTag:
+			return int32(v), nil
+		case int64ValueTag:
+			return v, nil
+		}
+		return int(v), nil
+	case uint8ValueTag, uint16ValueTag, uint32ValueTag, uint64ValueTag, uintValueTag:
+		v, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case uint8ValueTag:
+			return uint8(v), nil
+		case uint16ValueTag:
+			return uint16(v), nil
+		case uint32ValueTag:
+			return uint32(v), nil
+		case uint64ValueTag:
+			return v, nil
+		}
+		return uint(v), nil
+	case float32ValueTag:
+		var scratch [4]byte
+		if _, err := io.ReadFull(reader, scratch[:]); err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(scratch[:])), nil
+	case float64ValueTag:
+		var scratch [8]byte
+		if _, err := io.ReadFull(reader, scratch[:]); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(scratch[:])), nil
+	case boolValueTag:
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		return b != 0, nil
+	case stringValueTag:
+		data, err := DecodeBytes(reader)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case bytesValueTag:
+		return DecodeBytes(reader)
+	case timeValueTag:
+		data, err := DecodeBytes(reader)
+		if err != nil {
+			return nil, err
+		}
+		var t time.Time
+		if err := t.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("Unknown encoded value type: %d", tag)
+}
+
+// EncodeColumnValues appends a compact binary encoding of given column values, which may be nil.
+// Values keep their golang types when read back by DecodeColumnValues.
+func EncodeColumnValues(buf *bytes.Buffer, values *ColumnValues) error {
+	if values == nil {
+		writeUvarint(buf, 0)
+		return nil
+	}
+	abstractValues := values.AbstractValues()
+	writeUvarint(buf, uint64(len(abstractValues))+1)
+	for _, value := range abstractValues {
+		if err := encodeValue(buf, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeColumnValues reads column values as encoded by EncodeColumnValues
+func DecodeColumnValues(reader *bytes.Reader) (*ColumnValues, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	length--
+	if length > uint64(reader.Len()) {
+		return nil, fmt.Errorf("Invalid encoded column values length: %d", length)
+	}
+	abstractValues := make([]interface{}, length)
+	for i := range abstractValues {
+		if abstractValues[i], err = decodeValue(reader); err != nil {
+			return nil, err
+		}
+	}
+	return ToColumnValues(abstractValues), nil
+}
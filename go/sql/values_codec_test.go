@@ -0,0 +1,73 @@
+/*
+   Copyright 2016 GitHub Inc.
+	 See https://github.com/github/gh-ost/blob/master/LICENSE
+*/
+
+package sql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	test "github.com/outbrain/golib/tests"
+)
+
+type testDecimal string
+
+func (this testDecimal) Value() (driver.Value, error) {
+	return string(this), nil
+}
+
+func TestEncodeColumnValues(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 10, 0, 0, 123000, time.UTC)
+	values := ToColumnValues([]interface{}{
+		nil, int8(-3), int16(-300), int32(-70000), int64(-5000000000), 2017,
+		uint8(3), uint16(300), uint32(70000), uint64(5000000000), uint(7),
+		float32(1.5), float64(-2.25), true, "abc", []byte{0, 1, 2}, []byte{}, timestamp,
+	})
+	buf := &bytes.Buffer{}
+	test.S(t).ExpectNil(EncodeColumnValues(buf, values))
+	test.S(t).ExpectNil(EncodeColumnValues(buf, nil))
+
+	reader := bytes.NewReader(buf.Bytes())
+	decoded, err := DecodeColumnValues(reader)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(len(decoded.AbstractValues()), len(values.AbstractValues()))
+	for i, value := range values.AbstractValues() {
+		decodedValue := decoded.AbstractValues()[i]
+		test.S(t).ExpectEquals(reflect.TypeOf(decodedValue), reflect.TypeOf(value))
+		if timeValue, ok := value.(time.Time); ok {
+			test.S(t).ExpectTrue(timeValue.Equal(decodedValue.(time.Time)))
+		} else {
+			test.S(t).ExpectTrue(reflect.DeepEqual(decodedValue, value))
+		}
+	}
+	decoded, err = DecodeColumnValues(reader)
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectTrue(decoded == nil)
+	test.S(t).ExpectEquals(reader.Len(), 0)
+}
+
+func TestEncodeColumnValuesValuer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	test.S(t).ExpectNil(EncodeColumnValues(buf, ToColumnValues([]interface{}{testDecimal("3.1415")})))
+	decoded, err := DecodeColumnValues(bytes.NewReader(buf.Bytes()))
+	test.S(t).ExpectNil(err)
+	test.S(t).ExpectEquals(decoded.AbstractValues()[0], "3.1415")
+}
+
+func TestEncodeColumnValuesUnsupported(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := EncodeColumnValues(buf, ToColumnValues([]interface{}{struct{}{}}))
+	test.S(t).ExpectNotNil(err)
+}
+
+func TestDecodeColumnValuesCorrupt(t *testing.T) {
+	buf := &bytes.Buffer{}
+	test.S(t).ExpectNil(EncodeColumnValues(buf, ToColumnValues([]interface{}{"abcdef"})))
+	_, err := DecodeColumnValues(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	test.S(t).ExpectNotNil(err)
+}
@@ -0,0 +1,23 @@
+drop table if exists gh_ost_test;
+create table gh_ost_test (
+  id int auto_increment,
+  i int not null,
+  color varchar(32),
+  primary key(id)
+) auto_increment=1;
+
+drop event if exists gh_ost_test;
+delimiter ;;
+create event gh_ost_test
+  on schedule every 1 second
+  starts current_timestamp
+  ends current_timestamp + interval 60 second
+  on completion not preserve
+  enable
+  do
+begin
+  -- multi-row statements, each annotated by a single Annotate_rows event
+  insert into gh_ost_test (i, color) values (11, 'red'), (13, 'green'), (17, 'blue');
+  update gh_ost_test set i=i+1 where color in ('red', 'green');
+  delete from gh_ost_test where color = 'blue' order by id limit 1;
+end ;;
@@ -0,0 +1,28 @@
+drop table if exists gh_ost_test;
+create table gh_ost_test (
+  id int auto_increment,
+  i int not null,
+  domain_id int unsigned not null,
+  primary key(id)
+) auto_increment=1;
+
+drop event if exists gh_ost_test;
+delimiter ;;
+create event gh_ost_test
+  on schedule every 1 second
+  starts current_timestamp
+  ends current_timestamp + interval 60 second
+  on completion not preserve
+  enable
+  do
+begin
+  -- transactions in two replication domains, interleaved in the binary log
+  set session gtid_domain_id := 0;
+  insert into gh_ost_test values (null, 11, @@gtid_domain_id);
+  set session gtid_domain_id := 7;
+  insert into gh_ost_test values (null, 13, @@gtid_domain_id);
+  set @last_insert_id := last_insert_id();
+  update gh_ost_test set i=i+1 where id = @last_insert_id;
+  set session gtid_domain_id := 0;
+  insert into gh_ost_test values (null, 17, @@gtid_domain_id);
+end ;;
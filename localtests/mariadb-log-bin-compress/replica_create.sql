@@ -0,0 +1 @@
+set global log_bin_compress := 1;
@@ -21,6 +21,7 @@ master_port=
 replica_host=
 replica_port=
 original_sql_mode=
+mysql_flavor=
 
 OPTIND=1
 while getopts "b:" OPTION
@@ -49,6 +50,11 @@ verify_master_and_replica() {
   fi
   original_sql_mode="$(gh-ost-test-mysql-master -e "select @@global.sql_mode" -s -s)"
   echo "sql_mode on master is ${original_sql_mode}"
+  mysql_flavor="mysql"
+  if gh-ost-test-mysql-master -s -s -e "select @@version" | grep -qi "mariadb" ; then
+    mysql_flavor="mariadb"
+  fi
+  echo "# flavor is ${mysql_flavor}"
 
   echo "Gracefully sleeping for 3 seconds while replica is setting up..."
   sleep 3
@@ -104,6 +110,14 @@ test_single() {
     fi
   fi
 
+  if [ -f $tests_path/$test_name/flavor ] ; then
+    # The test only applies to given flavor: mysql or mariadb
+    if [ "$(cat $tests_path/$test_name/flavor)" != "$mysql_flavor" ] ; then
+      echo -n "Skipping: $test_name"
+      return 0
+    fi
+  fi
+
   echo -n "Testing: $test_name"
 
   echo_dot
@@ -116,6 +130,9 @@ test_single() {
   fi
 
   gh-ost-test-mysql-master --default-character-set=utf8mb4 test < $tests_path/$test_name/create.sql
+  if [ -f $tests_path/$test_name/replica_create.sql ] ; then
+    gh-ost-test-mysql-replica --default-character-set=utf8mb4 test < $tests_path/$test_name/replica_create.sql
+  fi
 
   extra_args=""
   if [ -f $tests_path/$test_name/extra_args ] ; then
@@ -176,6 +193,9 @@ test_single() {
   if [ -f $tests_path/$test_name/destroy.sql ] ; then
     gh-ost-test-mysql-master --default-character-set=utf8mb4 test < $tests_path/$test_name/destroy.sql
   fi
+  if [ -f $tests_path/$test_name/replica_destroy.sql ] ; then
+    gh-ost-test-mysql-replica --default-character-set=utf8mb4 test < $tests_path/$test_name/replica_destroy.sql
+  fi
 
   if [ -f $tests_path/$test_name/expect_failure ] ; then
     if [ $execution_result -eq 0 ] ; then